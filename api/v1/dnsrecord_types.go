@@ -0,0 +1,111 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// RoutingPolicySimple is a plain record set without a routing policy.
+	RoutingPolicySimple = "simple"
+	// RoutingPolicyFailover routes to the primary record while it is healthy.
+	RoutingPolicyFailover = "failover"
+	// RoutingPolicyWeighted routes proportionally to the record weights.
+	RoutingPolicyWeighted = "weighted"
+	// RoutingPolicyLatency routes to the region with the lowest latency.
+	RoutingPolicyLatency = "latency"
+	// RoutingPolicyMultiValue answers with up to eight healthy records.
+	RoutingPolicyMultiValue = "multivalue"
+)
+
+// DNSRecordSpec defines the desired state of DNSRecord
+type DNSRecordSpec struct {
+	// HostedZoneID is the Route53 hosted zone which contains the record.
+	HostedZoneID string `json:"hosted_zone_id"`
+	// Name is the fully qualified record name.
+	Name string `json:"name"`
+	// Type is the record type eg. A, AAAA, CNAME.
+	Type string `json:"type"`
+	// TTL of the record in seconds. Ignored for alias records.
+	TTL int64 `json:"ttl,omitempty"`
+	// Values of the record. Mutually exclusive with Alias.
+	Values []string `json:"values,omitempty"`
+	// Alias points the record at another AWS resource.
+	Alias *DNSRecordAlias `json:"alias,omitempty"`
+
+	// RoutingPolicy is one of simple, failover, weighted, latency or multivalue.
+	RoutingPolicy string `json:"routing_policy,omitempty"`
+	// SetIdentifier differentiates records with the same name and type.
+	SetIdentifier string `json:"set_identifier,omitempty"`
+	// Failover is PRIMARY or SECONDARY when using the failover routing policy.
+	Failover string `json:"failover,omitempty"`
+	// Weight of the record when using the weighted routing policy.
+	Weight *int64 `json:"weight,omitempty"`
+	// Region of the record when using the latency routing policy.
+	Region string `json:"region,omitempty"`
+
+	// HealthCheck is the name of a HealthCheck in the same namespace whose
+	// Route53 health check is attached to the record.
+	HealthCheck string `json:"health_check,omitempty"`
+}
+
+// DNSRecordAlias defines an alias target.
+type DNSRecordAlias struct {
+	HostedZoneID         string `json:"hosted_zone_id"`
+	DNSName              string `json:"dns_name"`
+	EvaluateTargetHealth bool   `json:"evaluate_target_health,omitempty"`
+}
+
+// DNSRecordRef identifies a record set within a hosted zone.
+type DNSRecordRef struct {
+	HostedZoneID  string `json:"hosted_zone_id"`
+	Name          string `json:"name"`
+	Type          string `json:"type"`
+	SetIdentifier string `json:"set_identifier,omitempty"`
+}
+
+// DNSRecordStatus defines the observed state of DNSRecord
+type DNSRecordStatus struct {
+	HealthCheckId string        `json:"health_check_id,omitempty"`
+	ChangeId      string        `json:"change_id,omitempty"`
+	ChangeStatus  string        `json:"change_status,omitempty"`
+	Applied       *DNSRecordRef `json:"applied,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// DNSRecord is the Schema for the dnsrecords API
+type DNSRecord struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DNSRecordSpec   `json:"spec,omitempty"`
+	Status DNSRecordStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// DNSRecordList contains a list of DNSRecord
+type DNSRecordList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DNSRecord `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&DNSRecord{}, &DNSRecordList{})
+}
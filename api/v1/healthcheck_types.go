@@ -16,9 +16,84 @@ limitations under the License.
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+const (
+	// AnnotationPaused suspends all mutating AWS calls for a HealthCheck when set to "true".
+	AnnotationPaused = "route53.skpr.io/paused"
+	// AnnotationDryRun plans the AWS changes for a HealthCheck, without making
+	// them, when set to "true".
+	AnnotationDryRun = "route53.skpr.io/dry-run"
+	// AnnotationSleep on a namespace disables its health checks when set to "true".
+	AnnotationSleep = "route53.skpr.io/sleep"
+	// AnnotationTestAlarm forces the alarm into ALARM once for each new value, to
+	// test that notifications are delivered.
+	AnnotationTestAlarm = "route53.skpr.io/test-alarm"
+	// LabelStatusPageExclude hides a HealthCheck from the status page when set to "true".
+	LabelStatusPageExclude = "route53.skpr.io/status-page-exclude"
+)
+
+const (
+	// ConditionPaused reports whether reconciliation is suspended.
+	ConditionPaused = "Paused"
+	// ConditionAlarmSuppressed reports whether alarm actions are suppressed.
+	ConditionAlarmSuppressed = "AlarmSuppressed"
+	// ConditionHealthy reports the result of probes made by the incluster backend.
+	ConditionHealthy = "Healthy"
+	// ConditionErrorBudgetExhausted reports whether the SLO has been missed.
+	ConditionErrorBudgetExhausted = "ErrorBudgetExhausted"
+	// ConditionThrottled reports whether the last reconcile was throttled by AWS.
+	ConditionThrottled = "Throttled"
+	// ConditionQuotaExceeded reports whether the health check was not created
+	// because of the account limit or a HealthCheckQuota.
+	ConditionQuotaExceeded = "QuotaExceeded"
+	// ConditionDrifted reports whether the live AWS resources were changed
+	// outside of the controller.
+	ConditionDrifted = "Drifted"
+	// ConditionUptimeUnavailable reports whether the availability could not be
+	// refreshed, so the last reported uptime is stale.
+	ConditionUptimeUnavailable = "UptimeUnavailable"
+)
+
+const (
+	// DriftPolicyCorrect reverts changes made outside of the controller.
+	DriftPolicyCorrect = "correct"
+	// DriftPolicyReport only reports changes made outside of the controller.
+	DriftPolicyReport = "report"
+)
+
+const (
+	// BackendRoute53 checks the endpoint with Route53 health checkers.
+	BackendRoute53 = "route53"
+	// BackendInCluster checks the endpoint from the manager, for services which
+	// are not reachable from the internet.
+	BackendInCluster = "incluster"
+)
+
+// AlerterType is an alerter which raises alerts when the endpoint is unhealthy.
+// +kubebuilder:validation:Enum=cloudwatch;prometheus
+type AlerterType string
+
+const (
+	// AlerterCloudWatch alarms on the health check metric in CloudWatch.
+	AlerterCloudWatch AlerterType = "cloudwatch"
+	// AlerterPrometheus writes a PrometheusRule which alerts on the health
+	// exported by the manager.
+	AlerterPrometheus AlerterType = "prometheus"
+	// AlerterWebhook notifies webhook sinks of alarm state changes. It is
+	// selected when webhooks are listed.
+	AlerterWebhook AlerterType = "webhook"
+)
+
+const (
+	// WorkloadKindDeployment references an apps/v1 Deployment.
+	WorkloadKindDeployment = "Deployment"
+	// WorkloadKindStatefulSet references an apps/v1 StatefulSet.
+	WorkloadKindStatefulSet = "StatefulSet"
+)
+
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
@@ -36,6 +111,89 @@ type HealthCheckSpec struct {
 	AlarmDisabled bool     `json:"alarm_disabled,omitempty"`
 	AlarmActions  []string `json:"alarm_actions,omitempty"`
 	OKActions     []string `json:"ok_actions,omitempty"`
+	// SearchString must appear in the response body of HTTP_STR_MATCH and HTTPS_STR_MATCH checks.
+	SearchString string `json:"search_string,omitempty"`
+	// MeasureLatency publishes latency metrics, which are shown on dashboards.
+	// It is only applied when the health check is created.
+	MeasureLatency bool `json:"measure_latency,omitempty"`
+	// RequestInterval is the number of seconds between checks, 10 or 30.
+	RequestInterval int64 `json:"request_interval,omitempty"`
+	// FailureThreshold is the number of consecutive checks which must fail, or
+	// pass, to change the health.
+	FailureThreshold int64 `json:"failure_threshold,omitempty"`
+	// DriftPolicy is correct (the default) to revert changes made to the AWS
+	// resources outside of the controller, or report to only record them.
+	// Changes to the spec are applied either way.
+	// +kubebuilder:validation:Enum=correct;report
+	DriftPolicy string `json:"drift_policy,omitempty"`
+	// Backend performing the checks, route53 (the default) or incluster.
+	// +kubebuilder:validation:Enum=route53;incluster
+	Backend string `json:"backend,omitempty"`
+	// Alerters raising alerts for the checks, cloudwatch when not set. Alerters
+	// which are not listed are deleted.
+	Alerters []AlerterType `json:"alerters,omitempty"`
+	// Prometheus configures the PrometheusRule written by the prometheus alerter.
+	Prometheus *PrometheusAlert `json:"prometheus,omitempty"`
+	// Webhooks are notified when the state of the CloudWatch alarm changes,
+	// so they require the cloudwatch alerter.
+	Webhooks []WebhookSink `json:"webhooks,omitempty"`
+
+	// SLO is the availability objective which the error budget is calculated for.
+	SLO *SLO `json:"slo,omitempty"`
+
+	// MaintenanceWindows disable the health check and suppress alarm actions.
+	MaintenanceWindows []MaintenanceWindow `json:"maintenance_windows,omitempty"`
+
+	// Workload serving the domain. Alarm actions are suppressed while it is rolling out
+	// and the health check is disabled while it is scaled to zero.
+	Workload *WorkloadReference `json:"workload,omitempty"`
+}
+
+// WorkloadReference references a Deployment or StatefulSet in the same namespace.
+type WorkloadReference struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// MaxRolloutSuppression is the longest alarm actions are suppressed for a single rollout.
+	MaxRolloutSuppression *metav1.Duration `json:"max_rollout_suppression,omitempty"`
+}
+
+// PrometheusAlert configures the alert raised when the endpoint is unhealthy.
+type PrometheusAlert struct {
+	// For is how long the endpoint must be unhealthy before the alert fires, 1m when not set.
+	For *metav1.Duration `json:"for,omitempty"`
+	// Labels are added to the alert, eg. severity.
+	Labels map[string]string `json:"labels,omitempty"`
+	// RuleLabels are added to the PrometheusRule, so it is selected by the Prometheus instance.
+	RuleLabels map[string]string `json:"rule_labels,omitempty"`
+}
+
+// SLO is a service level objective for the availability of the endpoint.
+type SLO struct {
+	// Target availability as a percentage, eg. "99.9".
+	// +kubebuilder:validation:Pattern=`^[0-9]{1,2}(\.[0-9]+)?$`
+	Target string `json:"target"`
+	// Window the error budget is calculated over, 1d, 7d or 30d (the default).
+	// +kubebuilder:validation:Enum=1d;7d;30d
+	Window string `json:"window,omitempty"`
+}
+
+// WebhookSink receives a JSON payload when the alarm state changes.
+type WebhookSink struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// Secret holds the key which payloads are signed with, using HMAC-SHA256.
+	Secret *corev1.SecretKeySelector `json:"secret,omitempty"`
+}
+
+// MaintenanceWindow is either a recurring window (Schedule and Duration) or
+// an absolute window (Start and End).
+type MaintenanceWindow struct {
+	Name string `json:"name,omitempty"`
+	// Schedule is a cron expression (minute hour day-of-month month day-of-week) in UTC.
+	Schedule string           `json:"schedule,omitempty"`
+	Duration *metav1.Duration `json:"duration,omitempty"`
+	Start    *metav1.Time     `json:"start,omitempty"`
+	End      *metav1.Time     `json:"end,omitempty"`
 }
 
 // HealthCheckStatus defines the observed state of HealthCheck
@@ -46,6 +204,125 @@ type HealthCheckStatus struct {
 	HealthCheckId string `json:"id,omitempty"`
 	AlarmName     string `json:"alarm_name,omitempty"`
 	AlarmState    string `json:"alarm_state,omitempty"`
+
+	// ReplacedHealthCheckIds are the health checks which were replaced, as
+	// they could not be updated to the spec. Each is deleted once no
+	// DNSRecord uses it.
+	ReplacedHealthCheckIds []string `json:"replaced_ids,omitempty"`
+
+	// ObservedGeneration is the generation of the spec which was last applied.
+	ObservedGeneration int64 `json:"observed_generation,omitempty"`
+
+	// Drift lists the changes made to the AWS resources outside of the
+	// controller, as "field: live != desired".
+	Drift []string `json:"drift,omitempty"`
+
+	// PlannedChanges are the AWS calls which would have been made in dry-run mode.
+	PlannedChanges []string `json:"planned_changes,omitempty"`
+
+	// PrometheusRule is the name of the PrometheusRule written by the prometheus alerter.
+	PrometheusRule string `json:"prometheus_rule,omitempty"`
+
+	// AlarmTest is the last notification test requested by the test-alarm annotation.
+	AlarmTest *AlarmTest `json:"alarm_test,omitempty"`
+
+	// Uptime is the availability of the endpoint, calculated from CloudWatch metrics.
+	Uptime *Uptime `json:"uptime,omitempty"`
+
+	// Incidents are the most recent outages, oldest first.
+	Incidents []Incident `json:"incidents,omitempty"`
+
+	// WebhookDeliveries are the most recent notifications sent to webhook sinks.
+	WebhookDeliveries []WebhookDelivery `json:"webhook_deliveries,omitempty"`
+	// WebhookTransition is when the alarm changed to the state which webhook
+	// sinks were last notified of. It is saved before they are notified.
+	WebhookTransition *metav1.MicroTime `json:"webhook_transition,omitempty"`
+
+	// MaintenanceWindow is the currently active maintenance window.
+	MaintenanceWindow *ActiveMaintenanceWindow `json:"maintenance_window,omitempty"`
+
+	// RolloutStarted is when the workload was first observed rolling out.
+	RolloutStarted *metav1.Time `json:"rollout_started,omitempty"`
+
+	// Cost is the estimated monthly cost of the health check and its alarm.
+	Cost *CostEstimate `json:"cost,omitempty"`
+
+	Conditions []HealthCheckCondition `json:"conditions,omitempty"`
+}
+
+// ActiveMaintenanceWindow describes an occurrence of a maintenance window.
+type ActiveMaintenanceWindow struct {
+	Name  string      `json:"name,omitempty"`
+	Start metav1.Time `json:"start"`
+	End   metav1.Time `json:"end"`
+}
+
+// CostEstimate is the estimated monthly cost of the AWS resources of a HealthCheck.
+type CostEstimate struct {
+	// Monthly is the total, eg. "2.85".
+	Monthly  string `json:"monthly"`
+	Currency string `json:"currency,omitempty"`
+	// AWSEndpoint is true when the endpoint was priced as an AWS endpoint.
+	AWSEndpoint bool `json:"aws_endpoint,omitempty"`
+	// Items break the total down, as "item: price".
+	Items []string `json:"items,omitempty"`
+}
+
+// AlarmTest records when the alarm was forced into ALARM to test notifications.
+type AlarmTest struct {
+	// Nonce is the value of the test-alarm annotation.
+	Nonce string      `json:"nonce"`
+	Time  metav1.Time `json:"time"`
+	// ActionsEnabled is false when the alarm actions were suppressed, so no
+	// notifications were sent.
+	ActionsEnabled bool `json:"actions_enabled"`
+}
+
+// Incident is a period during which the alarm was in the ALARM state.
+type Incident struct {
+	Start metav1.Time `json:"start"`
+	// End is when the alarm returned to OK, empty while the incident is open.
+	End *metav1.Time `json:"end,omitempty"`
+	// Duration is how long the incident lasted, set when it ends.
+	Duration *metav1.Duration `json:"duration,omitempty"`
+	// FailingRegions are the Route53 health checker regions which reported failures.
+	FailingRegions []string `json:"failing_regions,omitempty"`
+	// FailureReasons are the distinct failures which were observed.
+	FailureReasons []string `json:"failure_reasons,omitempty"`
+}
+
+// Uptime is the availability of the endpoint over rolling windows, as percentages.
+type Uptime struct {
+	OneDay     string `json:"1d,omitempty"`
+	SevenDays  string `json:"7d,omitempty"`
+	ThirtyDays string `json:"30d,omitempty"`
+	// ErrorBudgetRemaining is the percentage of the SLO error budget which
+	// remains, negative once it has been overspent.
+	ErrorBudgetRemaining string `json:"error_budget_remaining,omitempty"`
+	// LastUpdated is when the availability was calculated.
+	LastUpdated metav1.Time `json:"last_updated"`
+}
+
+// WebhookDelivery records a notification sent to a webhook sink.
+type WebhookDelivery struct {
+	Sink     string      `json:"sink"`
+	Time     metav1.Time `json:"time"`
+	OldState string      `json:"old_state,omitempty"`
+	NewState string      `json:"new_state,omitempty"`
+	// Attempts is the number of requests which were made.
+	Attempts   int32  `json:"attempts"`
+	StatusCode int32  `json:"status_code,omitempty"`
+	Succeeded  bool   `json:"succeeded"`
+	Error      string `json:"error,omitempty"`
+}
+
+// HealthCheckCondition describes the state of a HealthCheck at a certain point.
+type HealthCheckCondition struct {
+	Type               string                 `json:"type"`
+	Status             corev1.ConditionStatus `json:"status"`
+	LastTransitionTime metav1.Time            `json:"last_transition_time,omitempty"`
+	Reason             string                 `json:"reason,omitempty"`
+	Message            string                 `json:"message,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -0,0 +1,74 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// ConditionDashboardRefused reports whether the dashboard was not written,
+	// because it selects namespaces it may not or another dashboard owns its name.
+	ConditionDashboardRefused = "Refused"
+)
+
+// HealthCheckDashboardSpec defines the desired state of HealthCheckDashboard
+type HealthCheckDashboardSpec struct {
+	// DashboardName is the name of the CloudWatch dashboard, defaults to <namespace>-<name>.
+	// +kubebuilder:validation:Pattern=`^[A-Za-z0-9_-]{1,255}$`
+	DashboardName string `json:"dashboard_name,omitempty"`
+	// Namespaces which HealthChecks are selected from, defaults to the namespace
+	// of the dashboard. Only dashboards in the namespaces the operator allows may
+	// select from other namespaces.
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Selector matches the labels of the HealthChecks to show. All HealthChecks
+	// in the namespaces are shown when it is empty.
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+}
+
+// HealthCheckDashboardStatus defines the observed state of HealthCheckDashboard
+type HealthCheckDashboardStatus struct {
+	// DashboardName is the name of the dashboard which was written.
+	DashboardName string `json:"dashboard_name,omitempty"`
+	// HealthChecks are the namespace/name of the HealthChecks on the dashboard.
+	HealthChecks []string `json:"health_checks,omitempty"`
+	// Conditions describe why the dashboard was not written.
+	Conditions []HealthCheckCondition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// HealthCheckDashboard is the Schema for the healthcheckdashboards API
+type HealthCheckDashboard struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   HealthCheckDashboardSpec   `json:"spec,omitempty"`
+	Status HealthCheckDashboardStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// HealthCheckDashboardList contains a list of HealthCheckDashboard
+type HealthCheckDashboardList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []HealthCheckDashboard `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&HealthCheckDashboard{}, &HealthCheckDashboardList{})
+}
@@ -0,0 +1,75 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// HealthCheckQuotaSpec defines the desired state of HealthCheckQuota
+type HealthCheckQuotaSpec struct {
+	// HealthChecks is the most HealthChecks in the namespace. Not limited when empty.
+	// +kubebuilder:validation:Minimum=0
+	HealthChecks *int64 `json:"health_checks,omitempty"`
+	// FastInterval is the most HealthChecks with a 10 second request interval,
+	// which cost more. Not limited when empty.
+	// +kubebuilder:validation:Minimum=0
+	FastInterval *int64 `json:"fast_interval,omitempty"`
+	// MeasureLatency is the most HealthChecks which measure latency, which
+	// cost more. Not limited when empty.
+	// +kubebuilder:validation:Minimum=0
+	MeasureLatency *int64 `json:"measure_latency,omitempty"`
+}
+
+// HealthCheckQuotaStatus defines the observed state of HealthCheckQuota
+type HealthCheckQuotaStatus struct {
+	// Used is what the HealthChecks in the namespace use.
+	Used HealthCheckUsage `json:"used,omitempty"`
+	// Exceeded lists the limits which are exceeded, eg. by HealthChecks which
+	// were created before the quota.
+	Exceeded []string `json:"exceeded,omitempty"`
+}
+
+// HealthCheckUsage counts HealthChecks, and the optional features they use.
+type HealthCheckUsage struct {
+	HealthChecks   int64 `json:"health_checks"`
+	FastInterval   int64 `json:"fast_interval"`
+	MeasureLatency int64 `json:"measure_latency"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// HealthCheckQuota is the Schema for the healthcheckquotas API
+type HealthCheckQuota struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   HealthCheckQuotaSpec   `json:"spec,omitempty"`
+	Status HealthCheckQuotaStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// HealthCheckQuotaList contains a list of HealthCheckQuota
+type HealthCheckQuotaList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []HealthCheckQuota `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&HealthCheckQuota{}, &HealthCheckQuotaList{})
+}
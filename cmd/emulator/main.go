@@ -0,0 +1,76 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command emulator serves in-memory Route53 and CloudWatch APIs for end to end
+// testing without an AWS account.
+//
+//	go run ./cmd/emulator --addr=:4580 --hosted-zone=Z0000000000000
+//	go run ./main.go --route53-endpoint=http://localhost:4580 --cloudwatch-endpoint=http://localhost:4580
+package main
+
+import (
+	"flag"
+	"net/http"
+	"os"
+	"strings"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	"github.com/skpr/r53-check/internal/awsfake"
+	"github.com/skpr/r53-check/internal/emulator"
+)
+
+// stringList is a flag which can be set more than once.
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+func main() {
+	var addr string
+	var hostedZones stringList
+	flag.StringVar(&addr, "addr", ":4580", "The address the emulator binds to.")
+	flag.Var(&hostedZones, "hosted-zone", "The ID of a hosted zone which records can be changed in. Can be set more than once.")
+	flag.Parse()
+
+	ctrl.SetLogger(zap.New(func(o *zap.Options) {
+		o.Development = true
+	}))
+
+	log := ctrl.Log.WithName("emulator")
+
+	route53Client := awsfake.NewRoute53()
+	for _, id := range hostedZones {
+		route53Client.AddHostedZone(id)
+	}
+
+	mux := http.NewServeMux()
+	// Route53 requests are versioned by path, everything else is a CloudWatch query.
+	mux.Handle("/2013-04-01/", emulator.NewRoute53Handler(log.WithName("route53"), route53Client))
+	mux.Handle("/", emulator.NewCloudWatchHandler(log.WithName("cloudwatch"), awsfake.NewCloudWatch()))
+
+	log.Info("starting emulator", "addr", addr, "hostedZones", hostedZones.String())
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Error(err, "problem running emulator")
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,333 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+
+	healthcheckv1 "github.com/skpr/r53-check/api/v1"
+	"github.com/skpr/r53-check/internal/prober"
+)
+
+// alarmTestReason is the start of the state reason of notification tests.
+const alarmTestReason = "Notification test "
+
+// cloudwatchAlerter alarms on the HealthCheckStatus metric in CloudWatch.
+type cloudwatchAlerter struct {
+	Log              logr.Logger
+	Recorder         record.EventRecorder
+	CloudwatchClient cloudwatchiface.CloudWatchAPI
+	// Prober publishes the metric for the incluster backend.
+	Prober *prober.Prober
+}
+
+// Ensure creates or updates the alarm.
+func (a *cloudwatchAlerter) Ensure(ctx context.Context, healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus, actionsEnabled bool) error {
+	alarmName, err := a.syncAlarm(healthCheck, status, actionsEnabled)
+	if err != nil {
+		return err
+	}
+	status.AlarmName = alarmName
+	if alarmName == "" {
+		status.AlarmState = ""
+		return nil
+	}
+	return a.testAlarm(healthCheck, status, actionsEnabled)
+}
+
+// Observe records the state of the alarm.
+func (a *cloudwatchAlerter) Observe(ctx context.Context, healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus) error {
+	alarmState, err := a.getAlarmState(status.AlarmName)
+	if err != nil {
+		return err
+	}
+	status.AlarmState = alarmState
+	return nil
+}
+
+// Delete deletes the alarm. The last alarm test is kept, so recreating the
+// alarm does not repeat it.
+func (a *cloudwatchAlerter) Delete(ctx context.Context, healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus) error {
+	err := a.deleteAlarm(status.AlarmName)
+	if err != nil {
+		return err
+	}
+	status.AlarmName = ""
+	status.AlarmState = ""
+	return nil
+}
+
+// syncAlarm syncs the health check alarm.
+func (a *cloudwatchAlerter) syncAlarm(healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus, actionsEnabled bool) (string, error) {
+	if !hasAlarm(healthCheck, a.Prober) {
+		return "", a.deleteAlarm(status.AlarmName)
+	}
+
+	alarm, err := describeAlarm(a.CloudwatchClient, getAlarmName(healthCheck))
+	if err != nil {
+		return "", err
+	}
+
+	// Alarm actions are toggled separately so that updating the alarm does
+	// not undo a suppression.
+	liveActionsEnabled := actionsEnabled
+	if alarm != nil {
+		liveActionsEnabled = aws.BoolValue(alarm.ActionsEnabled)
+	} else if status.AlarmName != "" {
+		a.Log.Info(fmt.Sprintf("Alarm was deleted outside of the controller: %s", status.AlarmName))
+		recordWarning(a.Recorder, healthCheck, "AlarmDeleted",
+			"CloudWatch alarm %s was deleted outside of the controller, recreating it", status.AlarmName)
+	}
+
+	input := getAlarmInput(healthCheck, status.HealthCheckId, liveActionsEnabled)
+	alarmName := aws.StringValue(input.AlarmName)
+
+	put := alarm == nil
+	if alarm != nil {
+		diff := diffAlarm(alarm, input)
+		recordDrift(healthCheck, status, "alarm", diff)
+		if len(diff) > 0 && shouldCorrect(healthCheck, status) {
+			a.Log.Info(fmt.Sprintf("Updating alarm %s: %s", alarmName, strings.Join(diff, ", ")))
+			put = true
+		}
+	}
+
+	if put {
+		_, err = a.CloudwatchClient.PutMetricAlarm(input)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if liveActionsEnabled != actionsEnabled {
+		err = a.setAlarmActions(alarmName, actionsEnabled)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return alarmName, nil
+}
+
+// testAlarm forces the alarm into ALARM once for each value of the test-alarm
+// annotation. CloudWatch returns it to OK when the metric is next evaluated.
+func (a *cloudwatchAlerter) testAlarm(healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus, actionsEnabled bool) error {
+	nonce := healthCheck.ObjectMeta.Annotations[healthcheckv1.AnnotationTestAlarm]
+	if nonce == "" || (status.AlarmTest != nil && status.AlarmTest.Nonce == nonce) {
+		return nil
+	}
+
+	if actionsEnabled {
+		a.Log.Info(fmt.Sprintf("Testing alarm %s: %s", status.AlarmName, nonce))
+	} else {
+		a.Log.Info(fmt.Sprintf("Testing alarm %s while its actions are suppressed: %s", status.AlarmName, nonce))
+	}
+
+	_, err := a.CloudwatchClient.SetAlarmState(&cloudwatch.SetAlarmStateInput{
+		AlarmName:   aws.String(status.AlarmName),
+		StateValue:  aws.String(cloudwatch.StateValueAlarm),
+		StateReason: aws.String(alarmTestReason + nonce),
+	})
+	if err != nil {
+		return err
+	}
+
+	status.AlarmTest = &healthcheckv1.AlarmTest{
+		Nonce:          nonce,
+		Time:           metav1.Now(),
+		ActionsEnabled: actionsEnabled,
+	}
+
+	return nil
+}
+
+// setAlarmActions enables or disables the actions of an alarm.
+func (a *cloudwatchAlerter) setAlarmActions(alarmName string, enabled bool) error {
+	alarmNames := []*string{aws.String(alarmName)}
+
+	if enabled {
+		a.Log.Info(fmt.Sprintf("Enabling alarm actions: %s", alarmName))
+		_, err := a.CloudwatchClient.EnableAlarmActions(&cloudwatch.EnableAlarmActionsInput{
+			AlarmNames: alarmNames,
+		})
+		return err
+	}
+
+	a.Log.Info(fmt.Sprintf("Disabling alarm actions: %s", alarmName))
+	_, err := a.CloudwatchClient.DisableAlarmActions(&cloudwatch.DisableAlarmActionsInput{
+		AlarmNames: alarmNames,
+	})
+	return err
+}
+
+// hasAlarm checks if an alarm is created for the health check.
+func hasAlarm(healthCheck *healthcheckv1.HealthCheck, p *prober.Prober) bool {
+	// Without CloudWatch metrics there is nothing to alarm on.
+	inClusterWithoutMetrics := getBackend(healthCheck) == healthcheckv1.BackendInCluster &&
+		(p == nil || !p.PublishesToCloudWatch())
+
+	return !healthCheck.Spec.AlarmDisabled && !inClusterWithoutMetrics
+}
+
+// getAlarmInput gets the desired alarm for the health check.
+func getAlarmInput(healthCheck *healthcheckv1.HealthCheck, healthCheckId string, actionsEnabled bool) *cloudwatch.PutMetricAlarmInput {
+	input := &cloudwatch.PutMetricAlarmInput{
+		AlarmName:          aws.String(getAlarmName(healthCheck)),
+		AlarmDescription:   aws.String("Route53 HealthCheck alarm for " + getHealthCheckName(healthCheck)),
+		ActionsEnabled:     aws.Bool(actionsEnabled),
+		AlarmActions:       aws.StringSlice(healthCheck.Spec.AlarmActions),
+		OKActions:          aws.StringSlice(healthCheck.Spec.OKActions),
+		Period:             aws.Int64(60),
+		EvaluationPeriods:  aws.Int64(1),
+		Threshold:          aws.Float64(1.0),
+		ComparisonOperator: aws.String("LessThanThreshold"),
+		Statistic:          aws.String("Minimum"),
+	}
+	input.Namespace, input.MetricName, input.Dimensions = getHealthMetric(healthCheck, healthCheckId)
+
+	if getBackend(healthCheck) == healthcheckv1.BackendInCluster {
+		input.AlarmDescription = aws.String("In-cluster HealthCheck alarm for " + getHealthCheckName(healthCheck))
+		// The manager stopped publishing, so nothing is checking the endpoint.
+		input.TreatMissingData = aws.String("breaching")
+	}
+
+	return input
+}
+
+// diffAlarm lists the fields of the desired alarm which differ from the live
+// alarm. Alarm actions are enabled and disabled by suppression, so they are
+// not compared.
+func diffAlarm(live *cloudwatch.MetricAlarm, desired *cloudwatch.PutMetricAlarmInput) []string {
+	var diff []string
+	diffString := func(field string, live, desired *string) {
+		if aws.StringValue(live) != aws.StringValue(desired) {
+			diff = append(diff, fmt.Sprintf("%s: %q != %q", field, aws.StringValue(live), aws.StringValue(desired)))
+		}
+	}
+	diffStrings := func(field string, live, desired []*string) {
+		if !reflect.DeepEqual(aws.StringValueSlice(live), aws.StringValueSlice(desired)) {
+			diff = append(diff, fmt.Sprintf("%s: %v != %v", field, aws.StringValueSlice(live), aws.StringValueSlice(desired)))
+		}
+	}
+
+	diffString("alarm_description", live.AlarmDescription, desired.AlarmDescription)
+	diffStrings("alarm_actions", live.AlarmActions, desired.AlarmActions)
+	diffStrings("ok_actions", live.OKActions, desired.OKActions)
+	diffString("namespace", live.Namespace, desired.Namespace)
+	diffString("metric_name", live.MetricName, desired.MetricName)
+	diffString("statistic", live.Statistic, desired.Statistic)
+	diffString("comparison_operator", live.ComparisonOperator, desired.ComparisonOperator)
+	if aws.Int64Value(live.Period) != aws.Int64Value(desired.Period) {
+		diff = append(diff, fmt.Sprintf("period: %d != %d", aws.Int64Value(live.Period), aws.Int64Value(desired.Period)))
+	}
+	if aws.Int64Value(live.EvaluationPeriods) != aws.Int64Value(desired.EvaluationPeriods) {
+		diff = append(diff, fmt.Sprintf("evaluation_periods: %d != %d", aws.Int64Value(live.EvaluationPeriods), aws.Int64Value(desired.EvaluationPeriods)))
+	}
+	if aws.Float64Value(live.Threshold) != aws.Float64Value(desired.Threshold) {
+		diff = append(diff, fmt.Sprintf("threshold: %g != %g", aws.Float64Value(live.Threshold), aws.Float64Value(desired.Threshold)))
+	}
+	// CloudWatch treats missing data as missing when it is not set.
+	if desired.TreatMissingData != nil {
+		diffString("treat_missing_data", live.TreatMissingData, desired.TreatMissingData)
+	}
+	var liveDimensions, desiredDimensions []string
+	for _, dimension := range live.Dimensions {
+		liveDimensions = append(liveDimensions, aws.StringValue(dimension.Name)+"="+aws.StringValue(dimension.Value))
+	}
+	for _, dimension := range desired.Dimensions {
+		desiredDimensions = append(desiredDimensions, aws.StringValue(dimension.Name)+"="+aws.StringValue(dimension.Value))
+	}
+	if !reflect.DeepEqual(liveDimensions, desiredDimensions) {
+		diff = append(diff, fmt.Sprintf("dimensions: %v != %v", liveDimensions, desiredDimensions))
+	}
+	return diff
+}
+
+// getHealthMetric gets the CloudWatch metric which is 1 while the endpoint is
+// healthy and 0 while it is not.
+func getHealthMetric(healthCheck *healthcheckv1.HealthCheck, healthCheckId string) (*string, *string, []*cloudwatch.Dimension) {
+	if getBackend(healthCheck) == healthcheckv1.BackendInCluster {
+		key := types.NamespacedName{Namespace: healthCheck.Namespace, Name: healthCheck.Name}
+		return aws.String(prober.MetricNamespace), aws.String(prober.MetricName), prober.Dimensions(key)
+	}
+
+	return aws.String("AWS/Route53"), aws.String("HealthCheckStatus"), []*cloudwatch.Dimension{
+		{
+			Name:  aws.String("HealthCheckId"),
+			Value: aws.String(healthCheckId),
+		},
+	}
+}
+
+// deleteAlarm deletes the alarms associated with the health check, which may
+// already have been deleted outside of the controller.
+func (a *cloudwatchAlerter) deleteAlarm(alarmName string) error {
+	if alarmName != "" {
+		a.Log.Info(fmt.Sprintf("Deleting alarm: %s", alarmName))
+		var alarmNames []*string
+		alarmNames = append(alarmNames, &alarmName)
+		_, err := a.CloudwatchClient.DeleteAlarms(&cloudwatch.DeleteAlarmsInput{
+			AlarmNames: alarmNames,
+		})
+		if err != nil && !isAWSErrorCode(err, cloudwatch.ErrCodeResourceNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// getAlarmState gets the current alarm state.
+func (a *cloudwatchAlerter) getAlarmState(alarmName string) (string, error) {
+	alarm, err := describeAlarm(a.CloudwatchClient, alarmName)
+	if err != nil {
+		return "", err
+	}
+	if alarm == nil {
+		return "", nil
+	}
+	return *alarm.StateValue, nil
+}
+
+// describeAlarm gets the alarm, or nil if it does not exist.
+func describeAlarm(cloudwatchClient cloudwatchiface.CloudWatchAPI, alarmName string) (*cloudwatch.MetricAlarm, error) {
+	if alarmName == "" {
+		return nil, nil
+	}
+	var alarmNames []*string
+	alarmNames = append(alarmNames, &alarmName)
+	output, err := cloudwatchClient.DescribeAlarms(&cloudwatch.DescribeAlarmsInput{
+		AlarmNames: alarmNames,
+		MaxRecords: aws.Int64(1),
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, alarm := range output.MetricAlarms {
+		return alarm, nil
+	}
+	return nil, nil
+}
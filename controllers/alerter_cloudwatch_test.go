@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	healthcheckv1 "github.com/skpr/r53-check/api/v1"
+	"github.com/skpr/r53-check/internal/awsfake"
+)
+
+func TestReconcileTestAlarm(t *testing.T) {
+	err := healthcheckv1.AddToScheme(scheme.Scheme)
+	assert.Nil(t, err)
+
+	healthcheck := newTestHealthCheck()
+	healthcheck.ObjectMeta.Annotations = map[string]string{healthcheckv1.AnnotationTestAlarm: "first"}
+
+	client := fake.NewFakeClientWithScheme(scheme.Scheme, healthcheck)
+	cloudwatchClient := awsfake.NewCloudWatch()
+
+	reconciler := HealthCheckReconciler{
+		Client:           client,
+		Log:              zap.New(),
+		Scheme:           scheme.Scheme,
+		Route53Client:    awsfake.NewRoute53(),
+		CloudwatchClient: cloudwatchClient,
+	}
+
+	query := types.NamespacedName{
+		Name:      healthcheck.ObjectMeta.Name,
+		Namespace: healthcheck.ObjectMeta.Namespace,
+	}
+
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+
+	if assert.Len(t, cloudwatchClient.Alarms(), 1) {
+		alarm := cloudwatchClient.Alarms()[0]
+		assert.Equal(t, cloudwatch.StateValueAlarm, *alarm.StateValue)
+		assert.Equal(t, "Notification test first", *alarm.StateReason)
+	}
+
+	healthcheck = &healthcheckv1.HealthCheck{}
+	err = client.Get(context.TODO(), query, healthcheck)
+	assert.Nil(t, err)
+	if assert.NotNil(t, healthcheck.Status.AlarmTest) {
+		assert.Equal(t, "first", healthcheck.Status.AlarmTest.Nonce)
+		assert.True(t, healthcheck.Status.AlarmTest.ActionsEnabled)
+	}
+	assert.Equal(t, cloudwatch.StateValueAlarm, healthcheck.Status.AlarmState)
+
+	// The test is not repeated once the alarm recovers.
+	err = cloudwatchClient.TransitionAlarm("example-site.prod-test-healthcheck", cloudwatch.StateValueOk, "Threshold Crossed")
+	assert.Nil(t, err)
+
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, cloudwatchClient.Faults.Calls("SetAlarmState"))
+
+	// A new nonce tests again.
+	healthcheck = &healthcheckv1.HealthCheck{}
+	err = client.Get(context.TODO(), query, healthcheck)
+	assert.Nil(t, err)
+	healthcheck.ObjectMeta.Annotations[healthcheckv1.AnnotationTestAlarm] = "second"
+	err = client.Update(context.TODO(), healthcheck)
+	assert.Nil(t, err)
+
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, cloudwatchClient.Faults.Calls("SetAlarmState"))
+	assert.Equal(t, cloudwatch.StateValueAlarm, *cloudwatchClient.Alarms()[0].StateValue)
+}
@@ -0,0 +1,253 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/aws/aws-sdk-go/service/route53/route53iface"
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	healthcheckv1 "github.com/skpr/r53-check/api/v1"
+	"github.com/skpr/r53-check/internal/dryrun"
+	"github.com/skpr/r53-check/internal/prober"
+)
+
+const (
+	// Route53HealthyMetric is the Prometheus gauge which is 1 when Route53
+	// reports the endpoint as healthy and 0 when it does not.
+	Route53HealthyMetric = "r53_check_route53_healthy"
+
+	// PrometheusAlertName is the name of the alert in the PrometheusRule.
+	PrometheusAlertName = "HealthCheckUnhealthy"
+
+	// defaultPrometheusFor matches the period of the CloudWatch alarm.
+	defaultPrometheusFor = time.Minute
+)
+
+var route53HealthyGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: Route53HealthyMetric,
+	Help: "Whether Route53 health checkers report the endpoint as healthy.",
+}, []string{"namespace", "name"})
+
+func init() {
+	metrics.Registry.MustRegister(route53HealthyGauge)
+}
+
+// prometheusAlerter writes a PrometheusRule which alerts on the health
+// exported by the manager. The rule is unstructured so the Prometheus
+// Operator is not a dependency.
+type prometheusAlerter struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+	// Route53Client reads the health reported by Route53 health checkers.
+	Route53Client route53iface.Route53API
+	// Plan records the changes to the PrometheusRule in dry-run mode, instead
+	// of making them.
+	Plan *dryrun.Plan
+}
+
+// Ensure creates or updates the PrometheusRule.
+func (a *prometheusAlerter) Ensure(ctx context.Context, healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus, actionsEnabled bool) error {
+	desired := getPrometheusRule(healthCheck, actionsEnabled)
+
+	existing := newPrometheusRule()
+	err := a.Get(ctx, types.NamespacedName{Namespace: desired.GetNamespace(), Name: desired.GetName()}, existing)
+	if errors.IsNotFound(err) {
+		a.Log.Info(fmt.Sprintf("Creating PrometheusRule: %s", desired.GetName()))
+
+		// The rule is garbage collected with the HealthCheck, even without the finalizer.
+		err = ctrl.SetControllerReference(healthCheck, desired, a.Scheme)
+		if err != nil {
+			return err
+		}
+
+		if a.Plan != nil {
+			a.Plan.Record("Kubernetes.CreatePrometheusRule", fmt.Sprintf("%s/%s", desired.GetNamespace(), desired.GetName()))
+			return nil
+		}
+
+		err = a.Create(ctx, desired)
+		if err != nil {
+			return err
+		}
+
+		status.PrometheusRule = desired.GetName()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if !metav1.IsControlledBy(existing, healthCheck) {
+		return fmt.Errorf("PrometheusRule %s already exists and is not managed by the HealthCheck", existing.GetName())
+	}
+
+	status.PrometheusRule = existing.GetName()
+
+	if equality.Semantic.DeepEqual(existing.Object["spec"], desired.Object["spec"]) &&
+		equality.Semantic.DeepEqual(existing.GetLabels(), desired.GetLabels()) {
+		return nil
+	}
+
+	if a.Plan != nil {
+		a.Plan.Record("Kubernetes.UpdatePrometheusRule", fmt.Sprintf("%s/%s", existing.GetNamespace(), existing.GetName()))
+		return nil
+	}
+
+	a.Log.Info(fmt.Sprintf("Updating PrometheusRule: %s", existing.GetName()))
+	existing.Object["spec"] = desired.Object["spec"]
+	existing.SetLabels(desired.GetLabels())
+	return a.Update(ctx, existing)
+}
+
+// Observe exports the health reported by Route53 to Prometheus. The prober
+// exports the health for the incluster backend.
+func (a *prometheusAlerter) Observe(ctx context.Context, healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus) error {
+	if getBackend(healthCheck) != healthcheckv1.BackendRoute53 || status.HealthCheckId == "" || dryrun.IsPlanned(status.HealthCheckId) {
+		return nil
+	}
+
+	output, err := a.Route53Client.GetHealthCheckStatus(&route53.GetHealthCheckStatusInput{
+		HealthCheckId: aws.String(status.HealthCheckId),
+	})
+	if err != nil {
+		return err
+	}
+
+	value := 0.0
+	if isRoute53Healthy(output.HealthCheckObservations) {
+		value = 1.0
+	}
+	route53HealthyGauge.WithLabelValues(healthCheck.Namespace, healthCheck.Name).Set(value)
+
+	return nil
+}
+
+// Delete deletes the PrometheusRule and stops exporting the health.
+func (a *prometheusAlerter) Delete(ctx context.Context, healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus) error {
+	route53HealthyGauge.DeleteLabelValues(healthCheck.Namespace, healthCheck.Name)
+
+	if status.PrometheusRule == "" {
+		return nil
+	}
+
+	if a.Plan != nil {
+		a.Plan.Record("Kubernetes.DeletePrometheusRule", fmt.Sprintf("%s/%s", healthCheck.Namespace, status.PrometheusRule))
+		return nil
+	}
+
+	a.Log.Info(fmt.Sprintf("Deleting PrometheusRule: %s", status.PrometheusRule))
+
+	rule := newPrometheusRule()
+	rule.SetNamespace(healthCheck.Namespace)
+	rule.SetName(status.PrometheusRule)
+
+	// Nothing to delete if the Prometheus Operator has since been uninstalled.
+	err := a.Client.Delete(ctx, rule)
+	if err != nil && !errors.IsNotFound(err) && !meta.IsNoMatchError(err) {
+		return err
+	}
+
+	status.PrometheusRule = ""
+	return nil
+}
+
+// newPrometheusRule creates an empty PrometheusRule.
+func newPrometheusRule() *unstructured.Unstructured {
+	rule := &unstructured.Unstructured{}
+	rule.SetAPIVersion("monitoring.coreos.com/v1")
+	rule.SetKind("PrometheusRule")
+	return rule
+}
+
+// getPrometheusRuleName gets the name of the PrometheusRule.
+func getPrometheusRuleName(healthCheck *healthcheckv1.HealthCheck) string {
+	return healthCheck.Name + "-healthcheck"
+}
+
+// getPrometheusRule gets the desired PrometheusRule. There are no rules while
+// alarm actions are suppressed, so nothing fires.
+func getPrometheusRule(healthCheck *healthcheckv1.HealthCheck, actionsEnabled bool) *unstructured.Unstructured {
+	config := healthCheck.Spec.Prometheus
+	if config == nil {
+		config = &healthcheckv1.PrometheusAlert{}
+	}
+
+	metric := Route53HealthyMetric
+	if getBackend(healthCheck) == healthcheckv1.BackendInCluster {
+		metric = prober.HealthyMetric
+	}
+
+	duration := defaultPrometheusFor
+	if config.For != nil {
+		duration = config.For.Duration
+	}
+
+	labels := map[string]interface{}{
+		"healthcheck": getHealthCheckName(healthCheck),
+	}
+	for key, value := range config.Labels {
+		labels[key] = value
+	}
+
+	rules := []interface{}{}
+	if actionsEnabled {
+		rules = append(rules, map[string]interface{}{
+			"alert":  PrometheusAlertName,
+			"expr":   fmt.Sprintf(`%s{namespace=%q,name=%q} == 0`, metric, healthCheck.Namespace, healthCheck.Name),
+			"for":    fmt.Sprintf("%ds", int64(duration.Seconds())),
+			"labels": labels,
+			"annotations": map[string]interface{}{
+				"summary":     fmt.Sprintf("%s is unhealthy", healthCheck.Spec.Domain),
+				"description": fmt.Sprintf("The %s health check has been failing for %s.", getHealthCheckName(healthCheck), duration),
+			},
+		})
+	}
+
+	rule := newPrometheusRule()
+	rule.SetNamespace(healthCheck.Namespace)
+	rule.SetName(getPrometheusRuleName(healthCheck))
+	if len(config.RuleLabels) > 0 {
+		rule.SetLabels(config.RuleLabels)
+	}
+	rule.Object["spec"] = map[string]interface{}{
+		"groups": []interface{}{
+			map[string]interface{}{
+				"name":  getHealthCheckName(healthCheck),
+				"rules": rules,
+			},
+		},
+	}
+
+	return rule
+}
@@ -0,0 +1,113 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	healthcheckv1 "github.com/skpr/r53-check/api/v1"
+	"github.com/skpr/r53-check/internal/awsfake"
+)
+
+func TestReconcilePrometheus(t *testing.T) {
+	err := healthcheckv1.AddToScheme(scheme.Scheme)
+	assert.Nil(t, err)
+
+	healthcheck := newTestHealthCheck()
+	healthcheck.Spec.Alerters = []healthcheckv1.AlerterType{healthcheckv1.AlerterPrometheus}
+	healthcheck.Spec.Prometheus = &healthcheckv1.PrometheusAlert{
+		For:        &metav1.Duration{Duration: time.Minute * 5},
+		Labels:     map[string]string{"severity": "critical"},
+		RuleLabels: map[string]string{"prometheus": "k8s"},
+	}
+
+	client := fake.NewFakeClientWithScheme(scheme.Scheme, healthcheck)
+	route53Client := awsfake.NewRoute53()
+	cloudwatchClient := awsfake.NewCloudWatch()
+
+	reconciler := HealthCheckReconciler{
+		Client:           client,
+		Log:              zap.New(),
+		Scheme:           scheme.Scheme,
+		Route53Client:    route53Client,
+		CloudwatchClient: cloudwatchClient,
+	}
+
+	query := types.NamespacedName{
+		Name:      healthcheck.ObjectMeta.Name,
+		Namespace: healthcheck.ObjectMeta.Namespace,
+	}
+
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+
+	assert.Empty(t, cloudwatchClient.Alarms(), "CloudWatch was not selected")
+
+	healthcheck = &healthcheckv1.HealthCheck{}
+	err = client.Get(context.TODO(), query, healthcheck)
+	assert.Nil(t, err)
+	assert.Equal(t, "test-healthcheck", healthcheck.Status.PrometheusRule)
+	assert.Equal(t, 1.0, getGaugeValue(t, route53HealthyGauge.WithLabelValues(query.Namespace, query.Name)))
+
+	rule := newPrometheusRule()
+	err = client.Get(context.TODO(), types.NamespacedName{Namespace: query.Namespace, Name: "test-healthcheck"}, rule)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"prometheus": "k8s"}, rule.GetLabels())
+	assert.True(t, metav1.IsControlledBy(rule, healthcheck))
+
+	rules, _, _ := unstructured.NestedSlice(rule.Object, "spec", "groups")
+	if assert.Len(t, rules, 1) {
+		alert := rules[0].(map[string]interface{})["rules"].([]interface{})[0].(map[string]interface{})
+		assert.Equal(t, PrometheusAlertName, alert["alert"])
+		assert.Equal(t, `r53_check_route53_healthy{namespace="default",name="test"} == 0`, alert["expr"])
+		assert.Equal(t, "300s", alert["for"])
+		assert.Equal(t, "critical", alert["labels"].(map[string]interface{})["severity"])
+	}
+
+	// The health reported by Route53 is exported.
+	route53Client.SetHealthCheckStatus(healthcheck.Status.HealthCheckId, "Failure: Connection timed out.", "Failure: Connection timed out.")
+
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+	assert.Equal(t, 0.0, getGaugeValue(t, route53HealthyGauge.WithLabelValues(query.Namespace, query.Name)))
+
+	// Switching back to CloudWatch deletes the rule.
+	healthcheck = &healthcheckv1.HealthCheck{}
+	err = client.Get(context.TODO(), query, healthcheck)
+	assert.Nil(t, err)
+	healthcheck.Spec.Alerters = []healthcheckv1.AlerterType{healthcheckv1.AlerterCloudWatch}
+	err = client.Update(context.TODO(), healthcheck)
+	assert.Nil(t, err)
+
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+
+	assert.Len(t, cloudwatchClient.Alarms(), 1)
+	err = client.Get(context.TODO(), types.NamespacedName{Namespace: query.Namespace, Name: "test-healthcheck"}, newPrometheusRule())
+	assert.True(t, errors.IsNotFound(err))
+
+	healthcheck = &healthcheckv1.HealthCheck{}
+	err = client.Get(context.TODO(), query, healthcheck)
+	assert.Nil(t, err)
+	assert.Empty(t, healthcheck.Status.PrometheusRule)
+}
+
+// getGaugeValue gets the current value of a gauge.
+func getGaugeValue(t *testing.T, gauge prometheus.Gauge) float64 {
+	var metric dto.Metric
+	err := gauge.Write(&metric)
+	assert.Nil(t, err)
+	return metric.GetGauge().GetValue()
+}
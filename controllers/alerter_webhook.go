@@ -0,0 +1,338 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/aws/aws-sdk-go/service/route53/route53iface"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	healthcheckv1 "github.com/skpr/r53-check/api/v1"
+	"github.com/skpr/r53-check/internal/dryrun"
+)
+
+const (
+	// WebhookSignatureHeader holds the HMAC-SHA256 of the body, eg. "sha256=<hex>".
+	WebhookSignatureHeader = "X-R53-Check-Signature"
+
+	// webhookAttempts is how many requests are made before a delivery fails.
+	webhookAttempts = 3
+	// webhookTimeout is how long a sink has to respond to each request.
+	webhookTimeout = time.Second * 5
+	// webhookBackoff is the delay before the first retry, which doubles for each retry.
+	webhookBackoff = time.Second
+	// webhookDeadline is how long the sinks of a HealthCheck have to be
+	// notified, so slow sinks do not hold up the other HealthChecks.
+	webhookDeadline = time.Second * 10
+	// maxWebhookDeliveries is how many deliveries are kept in the status.
+	maxWebhookDeliveries = 10
+)
+
+// webhookPayload is POSTed to webhook sinks when the alarm state changes.
+type webhookPayload struct {
+	Name           string     `json:"name"`
+	Namespace      string     `json:"namespace"`
+	HealthCheck    string     `json:"healthcheck"`
+	Domain         string     `json:"domain"`
+	AlarmName      string     `json:"alarm_name"`
+	OldState       string     `json:"old_state"`
+	NewState       string     `json:"new_state"`
+	Reason         string     `json:"reason,omitempty"`
+	FailureReasons []string   `json:"failure_reasons,omitempty"`
+	StateUpdated   *time.Time `json:"state_updated,omitempty"`
+	Timestamp      time.Time  `json:"timestamp"`
+}
+
+// webhookAlerter notifies webhook sinks when the alarm state changes.
+type webhookAlerter struct {
+	client.Client
+	// APIReader reads the signing keys, the client is used when nil.
+	APIReader        client.Reader
+	Log              logr.Logger
+	Route53Client    route53iface.Route53API
+	CloudwatchClient cloudwatchiface.CloudWatchAPI
+	HTTPClient       *http.Client
+	Backoff          time.Duration
+	// Plan records the notifications in dry-run mode, instead of sending them.
+	Plan *dryrun.Plan
+}
+
+// Ensure does nothing, the sinks are notified when the alarm state is observed.
+func (a *webhookAlerter) Ensure(ctx context.Context, healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus, actionsEnabled bool) error {
+	return nil
+}
+
+// Observe notifies the sinks when the alarm state changed since it was last
+// observed, unless the alarm actions are suppressed. Alerters are observed in
+// name order, so the cloudwatch alerter has already observed the new state.
+func (a *webhookAlerter) Observe(ctx context.Context, healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus) error {
+	oldState := healthCheck.Status.AlarmState
+	newState := status.AlarmState
+
+	// Alarms which were just created or deleted have not changed state.
+	if oldState == newState || oldState == "" || newState == "" {
+		return nil
+	}
+
+	// The alarm actions are suppressed, so the sinks are too.
+	if isAlarmSuppressed(status) {
+		a.Log.Info(fmt.Sprintf("Not notifying webhooks while alarm actions are suppressed: %s %s -> %s", healthCheck.Name, oldState, newState))
+		return nil
+	}
+
+	payload, err := a.getPayload(healthCheck, status, oldState, newState)
+	if err != nil {
+		return err
+	}
+
+	// The state is saved after the rest of the reconcile, which may fail. The
+	// transition is saved first, so the sinks are only notified of it once. The
+	// status keeps microseconds.
+	if payload.StateUpdated != nil && a.Plan == nil {
+		transition := metav1.NewMicroTime(payload.StateUpdated.Truncate(time.Microsecond))
+		if status.WebhookTransition != nil && !transition.After(status.WebhookTransition.Time) {
+			a.Log.Info(fmt.Sprintf("Webhooks were already notified: %s %s -> %s", healthCheck.Name, oldState, newState))
+			return nil
+		}
+		if err := a.saveTransition(ctx, healthCheck, transition); err != nil {
+			return fmt.Errorf("failed to save webhook transition: %w", err)
+		}
+		status.WebhookTransition = &transition
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, webhookDeadline)
+	defer cancel()
+
+	for _, sink := range healthCheck.Spec.Webhooks {
+		if a.Plan != nil {
+			a.Plan.Record("Webhook.POST", fmt.Sprintf("%s %s %s -> %s", sink.Name, sink.URL, oldState, newState))
+			continue
+		}
+
+		delivery := a.deliver(ctx, healthCheck, sink, body)
+		delivery.OldState = oldState
+		delivery.NewState = newState
+		status.WebhookDeliveries = appendWebhookDelivery(status.WebhookDeliveries, delivery)
+	}
+
+	return nil
+}
+
+// saveTransition records the transition which the sinks are notified of. The
+// resource version of the HealthCheck is updated, so its status can still be saved.
+func (a *webhookAlerter) saveTransition(ctx context.Context, healthCheck *healthcheckv1.HealthCheck, transition metav1.MicroTime) error {
+	saved := healthCheck.DeepCopy()
+	saved.Status.WebhookTransition = &transition
+	if err := a.Status().Update(ctx, saved); err != nil {
+		return err
+	}
+
+	healthCheck.ObjectMeta.ResourceVersion = saved.ObjectMeta.ResourceVersion
+	healthCheck.Status.WebhookTransition = saved.Status.WebhookTransition
+	return nil
+}
+
+// Delete clears the delivery log.
+func (a *webhookAlerter) Delete(ctx context.Context, healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus) error {
+	status.WebhookDeliveries = nil
+	status.WebhookTransition = nil
+	return nil
+}
+
+// getPayload describes the alarm state change.
+func (a *webhookAlerter) getPayload(healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus, oldState, newState string) (*webhookPayload, error) {
+	payload := &webhookPayload{
+		Name:        healthCheck.Name,
+		Namespace:   healthCheck.Namespace,
+		HealthCheck: getHealthCheckName(healthCheck),
+		Domain:      healthCheck.Spec.Domain,
+		AlarmName:   status.AlarmName,
+		OldState:    oldState,
+		NewState:    newState,
+		Timestamp:   time.Now().UTC(),
+	}
+
+	alarm, err := describeAlarm(a.CloudwatchClient, status.AlarmName)
+	if err != nil {
+		return nil, err
+	}
+	if alarm != nil {
+		payload.Reason = aws.StringValue(alarm.StateReason)
+		payload.StateUpdated = alarm.StateUpdatedTimestamp
+	}
+
+	switch getBackend(healthCheck) {
+	case healthcheckv1.BackendRoute53:
+		if status.HealthCheckId == "" || dryrun.IsPlanned(status.HealthCheckId) {
+			break
+		}
+		output, err := a.Route53Client.GetHealthCheckStatus(&route53.GetHealthCheckStatusInput{
+			HealthCheckId: aws.String(status.HealthCheckId),
+		})
+		if err != nil {
+			return nil, err
+		}
+		payload.FailureReasons = getRoute53Failures(output.HealthCheckObservations)
+
+	case healthcheckv1.BackendInCluster:
+		condition := getCondition(status.Conditions, healthcheckv1.ConditionHealthy)
+		if condition != nil && condition.Status == corev1.ConditionFalse {
+			payload.FailureReasons = []string{condition.Message}
+		}
+	}
+
+	return payload, nil
+}
+
+// deliver POSTs the payload to the sink, retrying server errors.
+func (a *webhookAlerter) deliver(ctx context.Context, healthCheck *healthcheckv1.HealthCheck, sink healthcheckv1.WebhookSink, body []byte) healthcheckv1.WebhookDelivery {
+	delivery := healthcheckv1.WebhookDelivery{
+		Sink: sink.Name,
+		Time: metav1.Now(),
+	}
+
+	var signature string
+	if sink.Secret != nil {
+		key, err := a.getSecretKey(ctx, healthCheck.Namespace, sink.Secret)
+		if err != nil {
+			delivery.Error = err.Error()
+			a.Log.Info(fmt.Sprintf("Failed to notify webhook %s: %s", sink.Name, delivery.Error))
+			return delivery
+		}
+		signature = signWebhookPayload(key, body)
+	}
+
+	backoff := a.Backoff
+	for attempt := 1; attempt <= webhookAttempts; attempt++ {
+		delivery.Attempts = int32(attempt)
+
+		statusCode, err := a.post(ctx, sink.URL, body, signature)
+		delivery.StatusCode = int32(statusCode)
+		if err == nil {
+			delivery.Succeeded = true
+			delivery.Error = ""
+			return delivery
+		}
+		delivery.Error = err.Error()
+
+		if !isRetryableStatus(statusCode) || attempt == webhookAttempts {
+			break
+		}
+
+		// Give up when the reconcile is cancelled, rather than holding the worker.
+		select {
+		case <-ctx.Done():
+			delivery.Error = ctx.Err().Error()
+			a.Log.Info(fmt.Sprintf("Failed to notify webhook %s: %s", sink.Name, delivery.Error))
+			return delivery
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+
+	a.Log.Info(fmt.Sprintf("Failed to notify webhook %s: %s", sink.Name, delivery.Error))
+	return delivery
+}
+
+// post makes a single request, returning the status code of the response.
+func (a *webhookAlerter) post(ctx context.Context, url string, body []byte, signature string) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "r53-check")
+	if signature != "" {
+		req.Header.Set(WebhookSignatureHeader, signature)
+	}
+
+	resp, err := a.HTTPClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// getSecretKey gets the signing key from a Secret in the namespace of the HealthCheck.
+func (a *webhookAlerter) getSecretKey(ctx context.Context, namespace string, selector *corev1.SecretKeySelector) ([]byte, error) {
+	var reader client.Reader = a.Client
+	if a.APIReader != nil {
+		reader = a.APIReader
+	}
+
+	secret := &corev1.Secret{}
+	err := reader.Get(ctx, types.NamespacedName{Namespace: namespace, Name: selector.Name}, secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Secret %s: %w", selector.Name, err)
+	}
+
+	key, ok := secret.Data[selector.Key]
+	if !ok {
+		return nil, fmt.Errorf("key %s not found in Secret %s", selector.Key, selector.Name)
+	}
+
+	return key, nil
+}
+
+// signWebhookPayload signs the body with HMAC-SHA256.
+func signWebhookPayload(key, body []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// isRetryableStatus checks if a request could succeed when retried. A status
+// code of 0 means no response was received.
+func isRetryableStatus(statusCode int) bool {
+	return statusCode == 0 || statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
+
+// appendWebhookDelivery appends a delivery, keeping the most recent.
+func appendWebhookDelivery(deliveries []healthcheckv1.WebhookDelivery, delivery healthcheckv1.WebhookDelivery) []healthcheckv1.WebhookDelivery {
+	deliveries = append(deliveries, delivery)
+	if len(deliveries) > maxWebhookDeliveries {
+		deliveries = deliveries[len(deliveries)-maxWebhookDeliveries:]
+	}
+	return deliveries
+}
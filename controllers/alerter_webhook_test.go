@@ -0,0 +1,242 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	healthcheckv1 "github.com/skpr/r53-check/api/v1"
+	"github.com/skpr/r53-check/internal/awsfake"
+)
+
+func TestReconcileWebhook(t *testing.T) {
+	err := healthcheckv1.AddToScheme(scheme.Scheme)
+	assert.Nil(t, err)
+
+	var (
+		requests   []*http.Request
+		payloads   []webhookPayload
+		signatures []string
+		failures   int
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		assert.Nil(t, err)
+		signatures = append(signatures, signWebhookPayload([]byte("secret"), body))
+
+		var payload webhookPayload
+		assert.Nil(t, json.Unmarshal(body, &payload))
+		payloads = append(payloads, payload)
+	}))
+	defer server.Close()
+
+	healthcheck := newTestHealthCheck()
+	healthcheck.Spec.Webhooks = []healthcheckv1.WebhookSink{
+		{
+			Name: "ops",
+			URL:  server.URL,
+			Secret: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "webhook"},
+				Key:                  "key",
+			},
+		},
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "webhook",
+			Namespace: corev1.NamespaceDefault,
+		},
+		Data: map[string][]byte{
+			"key": []byte("secret"),
+		},
+	}
+
+	// Secrets are read from the API server, not the cache of the client.
+	client := fake.NewFakeClientWithScheme(scheme.Scheme, healthcheck)
+	route53Client := awsfake.NewRoute53()
+	cloudwatchClient := awsfake.NewCloudWatch()
+
+	reconciler := HealthCheckReconciler{
+		Client:           client,
+		Log:              zap.New(),
+		Scheme:           scheme.Scheme,
+		Route53Client:    route53Client,
+		CloudwatchClient: cloudwatchClient,
+		APIReader:        fake.NewFakeClientWithScheme(scheme.Scheme, secret),
+	}
+
+	query := types.NamespacedName{
+		Name:      healthcheck.ObjectMeta.Name,
+		Namespace: healthcheck.ObjectMeta.Namespace,
+	}
+
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+	assert.Empty(t, requests, "creating the alarm is not a state change")
+
+	healthcheck = &healthcheckv1.HealthCheck{}
+	err = client.Get(context.TODO(), query, healthcheck)
+	assert.Nil(t, err)
+
+	err = cloudwatchClient.TransitionAlarm(healthcheck.Status.AlarmName, "ALARM", "Threshold Crossed")
+	assert.Nil(t, err)
+	route53Client.SetHealthCheckStatus(healthcheck.Status.HealthCheckId, "Failure: Connection timed out.")
+
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+
+	if assert.Len(t, payloads, 1) {
+		assert.Equal(t, "example-site.prod-test", payloads[0].HealthCheck)
+		assert.Equal(t, "test.example.skpr.io", payloads[0].Domain)
+		assert.Equal(t, "INSUFFICIENT_DATA", payloads[0].OldState)
+		assert.Equal(t, "ALARM", payloads[0].NewState)
+		assert.Equal(t, "Threshold Crossed", payloads[0].Reason)
+		assert.Equal(t, []string{"us-east-1: Failure: Connection timed out."}, payloads[0].FailureReasons)
+		assert.NotNil(t, payloads[0].StateUpdated)
+		assert.Equal(t, signatures[0], requests[0].Header.Get(WebhookSignatureHeader))
+	}
+
+	// Nothing is sent when the state has not changed.
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+	assert.Len(t, requests, 1)
+
+	// Server errors are retried.
+	failures = 1
+	err = cloudwatchClient.TransitionAlarm(healthcheck.Status.AlarmName, "OK", "Threshold Crossed")
+	assert.Nil(t, err)
+
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+	assert.Len(t, requests, 3)
+
+	healthcheck = &healthcheckv1.HealthCheck{}
+	err = client.Get(context.TODO(), query, healthcheck)
+	assert.Nil(t, err)
+
+	if assert.Len(t, healthcheck.Status.WebhookDeliveries, 2) {
+		delivery := healthcheck.Status.WebhookDeliveries[1]
+		assert.Equal(t, "ops", delivery.Sink)
+		assert.Equal(t, "ALARM", delivery.OldState)
+		assert.Equal(t, "OK", delivery.NewState)
+		assert.Equal(t, int32(2), delivery.Attempts)
+		assert.Equal(t, int32(http.StatusOK), delivery.StatusCode)
+		assert.True(t, delivery.Succeeded)
+	}
+
+	// A transition is not sent again when the reconcile which sent it fails.
+	err = cloudwatchClient.TransitionAlarm(healthcheck.Status.AlarmName, "ALARM", "Threshold Crossed")
+	assert.Nil(t, err)
+	cloudwatchClient.Faults.Inject("DescribeAlarmHistory", awsfake.NewError(cloudwatch.ErrCodeInternalServiceFault, "Internal error", http.StatusInternalServerError))
+
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.NotNil(t, err)
+	assert.Len(t, requests, 4)
+
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+	assert.Len(t, requests, 4)
+
+	healthcheck = &healthcheckv1.HealthCheck{}
+	err = client.Get(context.TODO(), query, healthcheck)
+	assert.Nil(t, err)
+	assert.Equal(t, "ALARM", healthcheck.Status.AlarmState)
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	alerter := &webhookAlerter{
+		Client:     fake.NewFakeClientWithScheme(scheme.Scheme),
+		Log:        zap.New(),
+		HTTPClient: server.Client(),
+	}
+
+	healthcheck := &healthcheckv1.HealthCheck{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: corev1.NamespaceDefault},
+	}
+
+	// Client errors are not retried.
+	delivery := alerter.deliver(context.TODO(), healthcheck, healthcheckv1.WebhookSink{Name: "ops", URL: server.URL}, []byte("{}"))
+	assert.False(t, delivery.Succeeded)
+	assert.Equal(t, int32(1), delivery.Attempts)
+	assert.Equal(t, int32(http.StatusBadRequest), delivery.StatusCode)
+	assert.Equal(t, 1, requests)
+
+	// Nothing is sent without the signing key.
+	delivery = alerter.deliver(context.TODO(), healthcheck, healthcheckv1.WebhookSink{
+		Name: "ops",
+		URL:  server.URL,
+		Secret: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "missing"},
+			Key:                  "key",
+		},
+	}, []byte("{}"))
+	assert.False(t, delivery.Succeeded)
+	assert.Equal(t, int32(0), delivery.Attempts)
+	assert.Contains(t, delivery.Error, "failed to get Secret missing")
+	assert.Equal(t, 1, requests)
+
+	// Retries stop when the context is done, instead of waiting out the backoff.
+	var unavailable int
+	busy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		unavailable++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer busy.Close()
+
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Millisecond*100)
+	defer cancel()
+
+	alerter.Backoff = time.Hour
+	delivery = alerter.deliver(ctx, healthcheck, healthcheckv1.WebhookSink{Name: "ops", URL: busy.URL}, []byte("{}"))
+	assert.False(t, delivery.Succeeded)
+	assert.Equal(t, int32(1), delivery.Attempts)
+	assert.Equal(t, context.DeadlineExceeded.Error(), delivery.Error)
+	assert.Equal(t, 1, unavailable)
+
+	// Sinks are not notified while alarm actions are suppressed.
+	healthcheck.Spec.Webhooks = []healthcheckv1.WebhookSink{{Name: "ops", URL: server.URL}}
+	healthcheck.Status.AlarmState = "OK"
+	status := healthcheck.Status.DeepCopy()
+	status.AlarmState = "ALARM"
+	status.Conditions = setCondition(status.Conditions, healthcheckv1.ConditionAlarmSuppressed, corev1.ConditionTrue, suppressionReasonMaintenance, "")
+	assert.Nil(t, alerter.Observe(context.TODO(), healthcheck, status))
+	assert.Equal(t, 1, requests)
+	assert.Empty(t, status.WebhookDeliveries)
+
+	var deliveries []healthcheckv1.WebhookDelivery
+	for i := 0; i < maxWebhookDeliveries+5; i++ {
+		deliveries = appendWebhookDelivery(deliveries, healthcheckv1.WebhookDelivery{Attempts: int32(i)})
+	}
+	assert.Len(t, deliveries, maxWebhookDeliveries)
+	assert.Equal(t, int32(5), deliveries[0].Attempts)
+}
@@ -0,0 +1,223 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+
+	healthcheckv1 "github.com/skpr/r53-check/api/v1"
+)
+
+// Checker checks the health of the endpoint.
+type Checker interface {
+	// Ensure creates or updates the check, recording what it created in the status.
+	Ensure(ctx context.Context, healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus, disabled bool) error
+	// Observe records the result of the check in the status.
+	Observe(ctx context.Context, healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus) error
+	// Delete deletes the check, clearing what it recorded in the status.
+	Delete(ctx context.Context, healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus) error
+}
+
+// Alerter raises alerts when the endpoint is unhealthy.
+type Alerter interface {
+	// Ensure creates or updates the alert, recording what it created in the status.
+	Ensure(ctx context.Context, healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus, actionsEnabled bool) error
+	// Observe records the state of the alert in the status.
+	Observe(ctx context.Context, healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus) error
+	// Delete deletes the alert, clearing what it recorded in the status.
+	Delete(ctx context.Context, healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus) error
+}
+
+// backends are the checkers and alerters which a HealthCheck can select.
+type backends struct {
+	checkers map[string]Checker
+	alerters map[string]Alerter
+}
+
+// getBackends gets the backends which are available to the reconciler.
+func (r *HealthCheckReconciler) getBackends() backends {
+	return backends{
+		checkers: map[string]Checker{
+			healthcheckv1.BackendRoute53: &route53Checker{
+				Client:        r.Client,
+				Log:           r.Log,
+				Recorder:      r.Recorder,
+				Route53Client: r.Route53Client,
+			},
+			healthcheckv1.BackendInCluster: &inclusterChecker{
+				Prober: r.Prober,
+			},
+		},
+		alerters: map[string]Alerter{
+			string(healthcheckv1.AlerterCloudWatch): &cloudwatchAlerter{
+				Log:              r.Log,
+				Recorder:         r.Recorder,
+				CloudwatchClient: r.CloudwatchClient,
+				Prober:           r.Prober,
+			},
+			string(healthcheckv1.AlerterPrometheus): &prometheusAlerter{
+				Client:        r.Client,
+				Log:           r.Log,
+				Scheme:        r.Scheme,
+				Route53Client: r.Route53Client,
+				Plan:          r.plan,
+			},
+			string(healthcheckv1.AlerterWebhook): &webhookAlerter{
+				Client:           r.Client,
+				APIReader:        r.APIReader,
+				Log:              r.Log,
+				Route53Client:    r.Route53Client,
+				CloudwatchClient: r.CloudwatchClient,
+				HTTPClient:       &http.Client{Timeout: webhookTimeout},
+				Backoff:          webhookBackoff,
+				Plan:             r.plan,
+			},
+		},
+	}
+}
+
+// getBackend gets the backend which performs the checks.
+func getBackend(healthCheck *healthcheckv1.HealthCheck) string {
+	if healthCheck.Spec.Backend == "" {
+		return healthcheckv1.BackendRoute53
+	}
+	return healthCheck.Spec.Backend
+}
+
+// getAlerters gets the alerters selected by the spec.
+func getAlerters(healthCheck *healthcheckv1.HealthCheck) map[string]bool {
+	selected := make(map[string]bool)
+	if healthCheck.Spec.Alerters == nil {
+		selected[string(healthcheckv1.AlerterCloudWatch)] = true
+	}
+	for _, alerter := range healthCheck.Spec.Alerters {
+		selected[string(alerter)] = true
+	}
+	if len(healthCheck.Spec.Webhooks) > 0 {
+		selected[string(healthcheckv1.AlerterWebhook)] = true
+	}
+	return selected
+}
+
+// ensure deletes the backends which are no longer selected, then creates or
+// updates the selected backends and observes them.
+func (b backends) ensure(ctx context.Context, healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus, disabled, actionsEnabled bool) error {
+	backend := getBackend(healthCheck)
+	if _, ok := b.checkers[backend]; !ok {
+		return fmt.Errorf("unknown backend: %s", backend)
+	}
+
+	selected := getAlerters(healthCheck)
+	for name := range selected {
+		if _, ok := b.alerters[name]; !ok {
+			return fmt.Errorf("unknown alerter: %s", name)
+		}
+	}
+
+	// The sinks are notified of the state of the CloudWatch alarm.
+	if selected[string(healthcheckv1.AlerterWebhook)] && !selected[string(healthcheckv1.AlerterCloudWatch)] {
+		return fmt.Errorf("webhooks require the %s alerter", healthcheckv1.AlerterCloudWatch)
+	}
+
+	// Clean up first, so switching backends does not leave two checks running.
+	for _, name := range sortedCheckers(b.checkers) {
+		if name == backend {
+			continue
+		}
+		if err := b.checkers[name].Delete(ctx, healthCheck, status); err != nil {
+			return err
+		}
+	}
+
+	if err := b.checkers[backend].Ensure(ctx, healthCheck, status, disabled); err != nil {
+		return err
+	}
+
+	// Alerters are ensured after the checker, which they may alert on.
+	for _, name := range sortedAlerters(b.alerters) {
+		var err error
+		if selected[name] {
+			err = b.alerters[name].Ensure(ctx, healthCheck, status, actionsEnabled)
+		} else {
+			err = b.alerters[name].Delete(ctx, healthCheck, status)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return b.observe(ctx, healthCheck, status)
+}
+
+// observe records the state of the selected backends without changing them.
+func (b backends) observe(ctx context.Context, healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus) error {
+	if checker, ok := b.checkers[getBackend(healthCheck)]; ok {
+		if err := checker.Observe(ctx, healthCheck, status); err != nil {
+			return err
+		}
+	}
+
+	selected := getAlerters(healthCheck)
+	for _, name := range sortedAlerters(b.alerters) {
+		if !selected[name] {
+			continue
+		}
+		if err := b.alerters[name].Observe(ctx, healthCheck, status); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// delete deletes all backends, alerters first so they do not fire while the
+// checks are deleted.
+func (b backends) delete(ctx context.Context, healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus) error {
+	for _, name := range sortedAlerters(b.alerters) {
+		if err := b.alerters[name].Delete(ctx, healthCheck, status); err != nil {
+			return err
+		}
+	}
+	for _, name := range sortedCheckers(b.checkers) {
+		if err := b.checkers[name].Delete(ctx, healthCheck, status); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sortedCheckers gets the names of the checkers in a stable order.
+func sortedCheckers(checkers map[string]Checker) []string {
+	var names []string
+	for name := range checkers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sortedAlerters gets the names of the alerters in a stable order.
+func sortedAlerters(alerters map[string]Alerter) []string {
+	var names []string
+	for name := range alerters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,120 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	healthcheckv1 "github.com/skpr/r53-check/api/v1"
+)
+
+// recorder records the calls made to a fake backend.
+type recorder struct {
+	name  string
+	calls *[]string
+}
+
+func (f *recorder) record(call string) error {
+	*f.calls = append(*f.calls, f.name+"."+call)
+	return nil
+}
+
+type fakeChecker struct{ recorder }
+
+func (f *fakeChecker) Ensure(ctx context.Context, healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus, disabled bool) error {
+	return f.record("ensure")
+}
+
+func (f *fakeChecker) Observe(ctx context.Context, healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus) error {
+	return f.record("observe")
+}
+
+func (f *fakeChecker) Delete(ctx context.Context, healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus) error {
+	return f.record("delete")
+}
+
+type fakeAlerter struct{ recorder }
+
+func (f *fakeAlerter) Ensure(ctx context.Context, healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus, actionsEnabled bool) error {
+	return f.record("ensure")
+}
+
+func (f *fakeAlerter) Observe(ctx context.Context, healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus) error {
+	return f.record("observe")
+}
+
+func (f *fakeAlerter) Delete(ctx context.Context, healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus) error {
+	return f.record("delete")
+}
+
+func TestBackends(t *testing.T) {
+	var calls []string
+
+	b := backends{
+		checkers: map[string]Checker{
+			healthcheckv1.BackendRoute53:   &fakeChecker{recorder{"route53", &calls}},
+			healthcheckv1.BackendInCluster: &fakeChecker{recorder{"incluster", &calls}},
+		},
+		alerters: map[string]Alerter{
+			"cloudwatch": &fakeAlerter{recorder{"cloudwatch", &calls}},
+			"other":      &fakeAlerter{recorder{"other", &calls}},
+		},
+	}
+
+	healthCheck := &healthcheckv1.HealthCheck{}
+	status := &healthcheckv1.HealthCheckStatus{}
+
+	// Defaults to Route53 and CloudWatch.
+	assert.Nil(t, b.ensure(context.TODO(), healthCheck, status, false, true))
+	assert.Equal(t, []string{
+		"incluster.delete",
+		"route53.ensure",
+		"cloudwatch.ensure",
+		"other.delete",
+		"route53.observe",
+		"cloudwatch.observe",
+	}, calls)
+
+	calls = nil
+	healthCheck.Spec.Backend = healthcheckv1.BackendInCluster
+	healthCheck.Spec.Alerters = []healthcheckv1.AlerterType{"other"}
+	assert.Nil(t, b.ensure(context.TODO(), healthCheck, status, false, true))
+	assert.Equal(t, []string{
+		"route53.delete",
+		"incluster.ensure",
+		"cloudwatch.delete",
+		"other.ensure",
+		"incluster.observe",
+		"other.observe",
+	}, calls)
+
+	calls = nil
+	assert.Nil(t, b.observe(context.TODO(), healthCheck, status))
+	assert.Equal(t, []string{"incluster.observe", "other.observe"}, calls)
+
+	// Alerters are deleted before the checks.
+	calls = nil
+	assert.Nil(t, b.delete(context.TODO(), healthCheck, status))
+	assert.Equal(t, []string{"cloudwatch.delete", "other.delete", "incluster.delete", "route53.delete"}, calls)
+
+	// An empty list disables alerting.
+	calls = nil
+	healthCheck.Spec.Alerters = []healthcheckv1.AlerterType{}
+	assert.Nil(t, b.ensure(context.TODO(), healthCheck, status, false, true))
+	assert.Contains(t, calls, "cloudwatch.delete")
+	assert.Contains(t, calls, "other.delete")
+
+	// Nothing is changed when a backend does not exist.
+	calls = nil
+	healthCheck.Spec.Alerters = []healthcheckv1.AlerterType{"missing"}
+	assert.EqualError(t, b.ensure(context.TODO(), healthCheck, status, false, true), "unknown alerter: missing")
+	assert.Empty(t, calls)
+
+	// Webhooks are notified of the state of the CloudWatch alarm.
+	b.alerters["webhook"] = &fakeAlerter{recorder{"webhook", &calls}}
+	healthCheck.Spec.Alerters = []healthcheckv1.AlerterType{"other"}
+	healthCheck.Spec.Webhooks = []healthcheckv1.WebhookSink{{Name: "ops", URL: "https://example.com"}}
+	assert.EqualError(t, b.ensure(context.TODO(), healthCheck, status, false, true), "webhooks require the cloudwatch alerter")
+	assert.Empty(t, calls)
+}
@@ -0,0 +1,107 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	healthcheckv1 "github.com/skpr/r53-check/api/v1"
+	"github.com/skpr/r53-check/internal/prober"
+)
+
+// Defaults which match Route53.
+const (
+	defaultRequestInterval  = 30
+	defaultFailureThreshold = 3
+)
+
+// getProbeConfig gets the configuration for the in-cluster prober.
+func getProbeConfig(healthCheck *healthcheckv1.HealthCheck, disabled bool) prober.Config {
+	interval := healthCheck.Spec.RequestInterval
+	if interval <= 0 {
+		interval = defaultRequestInterval
+	}
+
+	threshold := healthCheck.Spec.FailureThreshold
+	if threshold <= 0 {
+		threshold = defaultFailureThreshold
+	}
+
+	return prober.Config{
+		Type:             healthCheck.Spec.Type,
+		Host:             healthCheck.Spec.Domain,
+		Port:             healthCheck.Spec.Port,
+		ResourcePath:     healthCheck.Spec.ResourcePath,
+		SearchString:     healthCheck.Spec.SearchString,
+		Interval:         time.Duration(interval) * time.Second,
+		FailureThreshold: int(threshold),
+		Disabled:         disabled,
+	}
+}
+
+// inclusterChecker checks the endpoint from the manager instead of Route53.
+type inclusterChecker struct {
+	Prober *prober.Prober
+}
+
+// Ensure starts probing the endpoint, or updates the probe.
+func (c *inclusterChecker) Ensure(ctx context.Context, healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus, disabled bool) error {
+	if c.Prober == nil {
+		return fmt.Errorf("the %s backend is not enabled", healthcheckv1.BackendInCluster)
+	}
+	c.Prober.Ensure(getProbeKey(healthCheck), getProbeConfig(healthCheck, disabled))
+	return nil
+}
+
+// Observe records the health reported by the prober.
+func (c *inclusterChecker) Observe(ctx context.Context, healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus) error {
+	if c.Prober == nil {
+		return nil
+	}
+
+	// Not probed by this manager, eg. while paused after a restart.
+	result, ok := c.Prober.Result(getProbeKey(healthCheck))
+	if !ok {
+		return nil
+	}
+
+	if result.Healthy {
+		status.Conditions = setCondition(status.Conditions, healthcheckv1.ConditionHealthy, corev1.ConditionTrue, "ProbeSucceeded", "")
+	} else {
+		status.Conditions = setCondition(status.Conditions, healthcheckv1.ConditionHealthy, corev1.ConditionFalse, "ProbeFailed", result.Message)
+	}
+
+	return nil
+}
+
+// Delete stops probing the endpoint.
+func (c *inclusterChecker) Delete(ctx context.Context, healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus) error {
+	if c.Prober != nil {
+		c.Prober.Remove(getProbeKey(healthCheck))
+	}
+	status.Conditions = removeCondition(status.Conditions, healthcheckv1.ConditionHealthy)
+	return nil
+}
+
+// getProbeKey gets the key which the prober tracks the endpoint by.
+func getProbeKey(healthCheck *healthcheckv1.HealthCheck) types.NamespacedName {
+	return types.NamespacedName{Namespace: healthCheck.Namespace, Name: healthCheck.Name}
+}
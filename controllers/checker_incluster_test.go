@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	healthcheckv1 "github.com/skpr/r53-check/api/v1"
+	"github.com/skpr/r53-check/internal/awsfake"
+	"github.com/skpr/r53-check/internal/prober"
+)
+
+func TestReconcileInCluster(t *testing.T) {
+	err := healthcheckv1.AddToScheme(scheme.Scheme)
+	assert.Nil(t, err)
+
+	healthcheck := newTestHealthCheck()
+	healthcheck.Spec.Domain = "internal.svc.cluster.local"
+	healthcheck.Spec.Type = "HTTP"
+	healthcheck.Spec.Port = 80
+	healthcheck.Spec.Backend = healthcheckv1.BackendInCluster
+
+	client := fake.NewFakeClientWithScheme(scheme.Scheme, healthcheck)
+	route53Client := awsfake.NewRoute53()
+	cloudwatchClient := awsfake.NewCloudWatch()
+
+	p := prober.New(zap.New(), cloudwatchClient)
+	p.Probe = func(context.Context, prober.Config) error {
+		return nil
+	}
+
+	reconciler := HealthCheckReconciler{
+		Client:           client,
+		Log:              zap.New(),
+		Scheme:           scheme.Scheme,
+		Route53Client:    route53Client,
+		CloudwatchClient: cloudwatchClient,
+		Prober:           p,
+	}
+
+	// The backend was switched from Route53.
+	_, err = route53Client.CreateHealthCheck(&route53.CreateHealthCheckInput{
+		CallerReference:   aws.String("previous"),
+		HealthCheckConfig: getHealthCheckConfig(healthcheck, false),
+	})
+	assert.Nil(t, err)
+	healthcheck.Status.HealthCheckId = *route53Client.HealthChecks()[0].Id
+	err = client.Status().Update(context.TODO(), healthcheck)
+	assert.Nil(t, err)
+
+	query := types.NamespacedName{
+		Name:      healthcheck.ObjectMeta.Name,
+		Namespace: healthcheck.ObjectMeta.Namespace,
+	}
+
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+
+	assert.Empty(t, route53Client.HealthChecks())
+
+	_, ok := p.Result(query)
+	assert.True(t, ok, "the endpoint is probed from the manager")
+
+	alarms := cloudwatchClient.Alarms()
+	if assert.Len(t, alarms, 1) {
+		assert.Equal(t, prober.MetricNamespace, *alarms[0].Namespace)
+		assert.Equal(t, "breaching", *alarms[0].TreatMissingData)
+	}
+
+	healthcheck = &healthcheckv1.HealthCheck{}
+	err = client.Get(context.TODO(), query, healthcheck)
+	assert.Nil(t, err)
+	assert.Empty(t, healthcheck.Status.HealthCheckId)
+	assert.Equal(t, corev1.ConditionTrue, getCondition(healthcheck.Status.Conditions, healthcheckv1.ConditionHealthy).Status)
+
+	// Deleting the HealthCheck stops probing.
+	now := metav1.Now()
+	healthcheck.ObjectMeta.DeletionTimestamp = &now
+	err = client.Update(context.TODO(), healthcheck)
+	assert.Nil(t, err)
+
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+
+	_, ok = p.Result(query)
+	assert.False(t, ok)
+	assert.Empty(t, cloudwatchClient.Alarms())
+}
@@ -0,0 +1,458 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/aws/aws-sdk-go/service/route53/route53iface"
+	"github.com/go-logr/logr"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	healthcheckv1 "github.com/skpr/r53-check/api/v1"
+)
+
+// healthyCheckerRatio is the share of health checkers which must report the
+// endpoint as healthy for Route53 to consider it healthy.
+const healthyCheckerRatio = 0.18
+
+// route53Checker checks the endpoint with Route53 health checkers.
+type route53Checker struct {
+	Client        client.Reader
+	Log           logr.Logger
+	Recorder      record.EventRecorder
+	Route53Client route53iface.Route53API
+}
+
+// Ensure creates the health check, or corrects any drift from the spec.
+func (c *route53Checker) Ensure(ctx context.Context, healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus, disabled bool) error {
+	healthCheckId, err := c.syncHealthCheck(healthCheck, status, disabled)
+	if err != nil {
+		return err
+	}
+	status.HealthCheckId = healthCheckId
+	return c.deleteReplaced(ctx, healthCheck, status)
+}
+
+// Observe does nothing, the health is reported by the alarm.
+func (c *route53Checker) Observe(ctx context.Context, healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus) error {
+	return nil
+}
+
+// Delete deletes the health check.
+func (c *route53Checker) Delete(ctx context.Context, healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus) error {
+	for _, healthCheckId := range status.ReplacedHealthCheckIds {
+		err := c.deleteHealthCheck(healthCheckId)
+		if err != nil {
+			return err
+		}
+	}
+	status.ReplacedHealthCheckIds = nil
+
+	if status.HealthCheckId == "" {
+		return nil
+	}
+	err := c.deleteHealthCheck(status.HealthCheckId)
+	if err != nil {
+		return err
+	}
+	status.HealthCheckId = ""
+	return nil
+}
+
+// syncHealthCheck syncs a health check.
+func (c *route53Checker) syncHealthCheck(healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus, disabled bool) (string, error) {
+	healthCheckId := status.HealthCheckId
+
+	if healthCheckId != "" {
+		// Correct any drift between the live health check and the spec.
+		immutable, err := c.updateHealthCheck(healthCheck, status, healthCheckId, disabled)
+		if isAWSErrorCode(err, route53.ErrCodeNoSuchHealthCheck) {
+			c.Log.Info(fmt.Sprintf("Health check was deleted outside of the controller: %s", healthCheckId))
+			recordWarning(c.Recorder, healthCheck, "HealthCheckDeleted",
+				"Route53 health check %s was deleted outside of the controller, recreating it", healthCheckId)
+			healthCheckId = ""
+		} else if err != nil {
+			return "", err
+		} else if len(immutable) > 0 {
+			c.Log.Info(fmt.Sprintf("Replacing health check %s: %s", healthCheckId, strings.Join(immutable, ", ")))
+			recordWarning(c.Recorder, healthCheck, "HealthCheckReplaced",
+				"Route53 health check %s cannot be updated, replacing it: %s", healthCheckId, strings.Join(immutable, ", "))
+			// The replaced health check is kept until the DNSRecords use the new one.
+			if !containsString(status.ReplacedHealthCheckIds, healthCheckId) {
+				status.ReplacedHealthCheckIds = append(status.ReplacedHealthCheckIds, healthCheckId)
+			}
+			healthCheckId = ""
+		}
+	}
+
+	created := false
+	if healthCheckId == "" {
+		id, err := c.createHealthCheck(healthCheck, disabled)
+		if err != nil {
+			return "", err
+		}
+		healthCheckId = id
+		created = true
+	}
+
+	err := c.syncTags(healthCheck, status, healthCheckId, created)
+	if err != nil {
+		return "", err
+	}
+	return healthCheckId, nil
+}
+
+// syncTags syncs the 'Name' tag of the health check.
+func (c *route53Checker) syncTags(healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus, healthCheckId string, created bool) error {
+	name := getHealthCheckName(healthCheck)
+
+	if !created {
+		output, err := c.Route53Client.ListTagsForResource(&route53.ListTagsForResourceInput{
+			ResourceId:   aws.String(healthCheckId),
+			ResourceType: aws.String(route53.TagResourceTypeHealthcheck),
+		})
+		if err != nil {
+			return err
+		}
+
+		var live string
+		if output.ResourceTagSet != nil {
+			for _, tag := range output.ResourceTagSet.Tags {
+				if aws.StringValue(tag.Key) == "Name" {
+					live = aws.StringValue(tag.Value)
+				}
+			}
+		}
+		if live == name {
+			return nil
+		}
+
+		recordDrift(healthCheck, status, "health_check", []string{fmt.Sprintf("tags.Name: %q != %q", live, name)})
+		if !shouldCorrect(healthCheck, status) {
+			return nil
+		}
+	}
+
+	// Health Check 'Name' is a tag.
+	_, err := c.Route53Client.ChangeTagsForResource(&route53.ChangeTagsForResourceInput{
+		AddTags: []*route53.Tag{
+			{Key: aws.String("Name"), Value: aws.String(name)},
+		},
+		ResourceId:   aws.String(healthCheckId),
+		ResourceType: aws.String(route53.TagResourceTypeHealthcheck),
+	})
+	return err
+}
+
+// createHealthCheck creates the health check. The caller reference includes the
+// generation, as Route53 does not allow the caller reference of a deleted
+// health check to be reused.
+func (c *route53Checker) createHealthCheck(healthCheck *healthcheckv1.HealthCheck, disabled bool) (string, error) {
+	token, err := getToken(healthCheck.ObjectMeta.UID)
+	if err != nil {
+		return "", err
+	}
+
+	callerReference := fmt.Sprintf("%s-%d", token, healthCheck.ObjectMeta.Generation)
+
+	output, err := c.Route53Client.CreateHealthCheck(&route53.CreateHealthCheckInput{
+		CallerReference:   aws.String(callerReference),
+		HealthCheckConfig: getHealthCheckConfig(healthCheck, disabled),
+	})
+	if isAWSErrorCode(err, route53.ErrCodeHealthCheckAlreadyExists) {
+		// The health check for this generation was deleted, or was created
+		// with a different configuration but its id was never saved. A health
+		// check which still exists is deleted, so it is not leaked.
+		var existing string
+		existing, err = c.findHealthCheck(callerReference)
+		if err != nil {
+			return "", err
+		}
+		if existing != "" {
+			c.Log.Info(fmt.Sprintf("Deleting health check which was not recorded in the status: %s", existing))
+			err = c.deleteHealthCheck(existing)
+			if err != nil {
+				return "", err
+			}
+		}
+
+		// The caller reference of a deleted health check cannot be reused.
+		callerReference = fmt.Sprintf("%s-%s", callerReference, strconv.FormatInt(time.Now().UnixNano(), 36))
+		output, err = c.Route53Client.CreateHealthCheck(&route53.CreateHealthCheckInput{
+			CallerReference:   aws.String(callerReference),
+			HealthCheckConfig: getHealthCheckConfig(healthCheck, disabled),
+		})
+	}
+	if err != nil {
+		return "", err
+	}
+
+	c.Log.Info(fmt.Sprintf("Created health check %s: %s", *output.HealthCheck.Id, callerReference))
+	return *output.HealthCheck.Id, nil
+}
+
+// findHealthCheck gets the id of the health check created with a caller
+// reference, or an empty id if it was deleted.
+func (c *route53Checker) findHealthCheck(callerReference string) (string, error) {
+	var id string
+	err := c.Route53Client.ListHealthChecksPages(&route53.ListHealthChecksInput{}, func(output *route53.ListHealthChecksOutput, lastPage bool) bool {
+		for _, healthCheck := range output.HealthChecks {
+			if aws.StringValue(healthCheck.CallerReference) == callerReference {
+				id = aws.StringValue(healthCheck.Id)
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to list health checks: %w", err)
+	}
+	return id, nil
+}
+
+// updateHealthCheck updates the live health check when it differs from the
+// spec. Disabling the health check is managed by the controller, so it is not
+// drift and is applied whatever the drift policy. The fields which cannot be
+// updated are returned, so the health check can be replaced.
+func (c *route53Checker) updateHealthCheck(healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus, healthCheckId string, disabled bool) ([]string, error) {
+	output, err := c.Route53Client.GetHealthCheck(&route53.GetHealthCheckInput{
+		HealthCheckId: aws.String(healthCheckId),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	live := output.HealthCheck.HealthCheckConfig
+	if live == nil {
+		live = &route53.HealthCheckConfig{}
+	}
+
+	desired := getHealthCheckConfig(healthCheck, disabled)
+
+	if immutable := diffImmutableConfig(live, desired); len(immutable) > 0 {
+		return immutable, nil
+	}
+
+	input := &route53.UpdateHealthCheckInput{
+		HealthCheckId:      aws.String(healthCheckId),
+		HealthCheckVersion: output.HealthCheck.HealthCheckVersion,
+	}
+
+	diff := diffHealthCheckConfig(live, desired)
+	recordDrift(healthCheck, status, "health_check", diff)
+
+	if !shouldCorrect(healthCheck, status) {
+		diff = nil
+	}
+	if len(diff) > 0 {
+		input.FullyQualifiedDomainName = desired.FullyQualifiedDomainName
+		input.Port = desired.Port
+		input.ResourcePath = desired.ResourcePath
+		input.EnableSNI = desired.EnableSNI
+		input.SearchString = desired.SearchString
+		input.FailureThreshold = desired.FailureThreshold
+	}
+	if aws.BoolValue(live.Disabled) != disabled {
+		diff = append(diff, fmt.Sprintf("disabled: %t != %t", aws.BoolValue(live.Disabled), disabled))
+		input.Disabled = desired.Disabled
+	}
+	if len(diff) == 0 {
+		return nil, nil
+	}
+
+	c.Log.Info(fmt.Sprintf("Updating health check %s: %s", healthCheckId, strings.Join(diff, ", ")))
+	_, err = c.Route53Client.UpdateHealthCheck(input)
+	return nil, err
+}
+
+// deleteReplaced deletes the replaced health checks which no DNSRecord uses.
+// The DNSRecords are enqueued when the new id is saved in the status, so the
+// rest are deleted by a later reconcile.
+func (c *route53Checker) deleteReplaced(ctx context.Context, healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus) error {
+	if len(status.ReplacedHealthCheckIds) == 0 {
+		return nil
+	}
+
+	records := &healthcheckv1.DNSRecordList{}
+	if err := c.Client.List(ctx, records, client.InNamespace(healthCheck.Namespace)); err != nil {
+		return err
+	}
+
+	var remaining []string
+	for _, healthCheckId := range status.ReplacedHealthCheckIds {
+		if isHealthCheckUsed(records, healthCheckId) {
+			c.Log.Info(fmt.Sprintf("Keeping replaced health check until DNSRecords are updated: %s", healthCheckId))
+			remaining = append(remaining, healthCheckId)
+			continue
+		}
+
+		err := c.deleteHealthCheck(healthCheckId)
+		if isAWSErrorCode(err, route53.ErrCodeHealthCheckInUse) {
+			// A record set which is not managed by a DNSRecord still uses it.
+			c.Log.Info(fmt.Sprintf("Keeping replaced health check which is in use: %s", healthCheckId))
+			remaining = append(remaining, healthCheckId)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	status.ReplacedHealthCheckIds = remaining
+
+	return nil
+}
+
+// isHealthCheckUsed checks if any of the DNSRecords applied the health check.
+func isHealthCheckUsed(records *healthcheckv1.DNSRecordList, healthCheckId string) bool {
+	for _, record := range records.Items {
+		if record.Status.HealthCheckId == healthCheckId {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteHealthCheck deletes the health check, which may already have been
+// deleted outside of the controller.
+func (c *route53Checker) deleteHealthCheck(healthCheckId string) error {
+	c.Log.Info(fmt.Sprintf("Deleting health check: %s", healthCheckId))
+	_, err := c.Route53Client.DeleteHealthCheck(&route53.DeleteHealthCheckInput{
+		HealthCheckId: aws.String(healthCheckId),
+	})
+	if isAWSErrorCode(err, route53.ErrCodeNoSuchHealthCheck) {
+		return nil
+	}
+	return err
+}
+
+// getHealthCheckConfig gets the desired Route53 health check configuration.
+func getHealthCheckConfig(healthCheck *healthcheckv1.HealthCheck, disabled bool) *route53.HealthCheckConfig {
+	config := &route53.HealthCheckConfig{
+		Type:                     aws.String(healthCheck.Spec.Type),
+		FullyQualifiedDomainName: aws.String(healthCheck.Spec.Domain),
+		Port:                     aws.Int64(healthCheck.Spec.Port),
+		ResourcePath:             aws.String(healthCheck.Spec.ResourcePath),
+		EnableSNI:                aws.Bool(true),
+		Disabled:                 aws.Bool(disabled),
+	}
+	// Optional fields are left to the Route53 defaults.
+	if healthCheck.Spec.SearchString != "" {
+		config.SearchString = aws.String(healthCheck.Spec.SearchString)
+	}
+	if healthCheck.Spec.RequestInterval > 0 {
+		config.RequestInterval = aws.Int64(healthCheck.Spec.RequestInterval)
+	}
+	if healthCheck.Spec.FailureThreshold > 0 {
+		config.FailureThreshold = aws.Int64(healthCheck.Spec.FailureThreshold)
+	}
+	if healthCheck.Spec.MeasureLatency {
+		config.MeasureLatency = aws.Bool(true)
+	}
+	return config
+}
+
+// diffHealthCheckConfig lists the fields from the spec which differ.
+func diffHealthCheckConfig(live, desired *route53.HealthCheckConfig) []string {
+	if live == nil {
+		live = &route53.HealthCheckConfig{}
+	}
+
+	var diff []string
+	if aws.StringValue(live.FullyQualifiedDomainName) != aws.StringValue(desired.FullyQualifiedDomainName) {
+		diff = append(diff, fmt.Sprintf("domain: %q != %q", aws.StringValue(live.FullyQualifiedDomainName), aws.StringValue(desired.FullyQualifiedDomainName)))
+	}
+	if aws.Int64Value(live.Port) != aws.Int64Value(desired.Port) {
+		diff = append(diff, fmt.Sprintf("port: %d != %d", aws.Int64Value(live.Port), aws.Int64Value(desired.Port)))
+	}
+	if aws.StringValue(live.ResourcePath) != aws.StringValue(desired.ResourcePath) {
+		diff = append(diff, fmt.Sprintf("resource_path: %q != %q", aws.StringValue(live.ResourcePath), aws.StringValue(desired.ResourcePath)))
+	}
+	if aws.BoolValue(live.EnableSNI) != aws.BoolValue(desired.EnableSNI) {
+		diff = append(diff, fmt.Sprintf("enable_sni: %t != %t", aws.BoolValue(live.EnableSNI), aws.BoolValue(desired.EnableSNI)))
+	}
+	if desired.SearchString != nil && aws.StringValue(live.SearchString) != aws.StringValue(desired.SearchString) {
+		diff = append(diff, fmt.Sprintf("search_string: %q != %q", aws.StringValue(live.SearchString), aws.StringValue(desired.SearchString)))
+	}
+	if desired.FailureThreshold != nil && aws.Int64Value(live.FailureThreshold) != aws.Int64Value(desired.FailureThreshold) {
+		diff = append(diff, fmt.Sprintf("failure_threshold: %d != %d", aws.Int64Value(live.FailureThreshold), aws.Int64Value(desired.FailureThreshold)))
+	}
+	// The request interval and latency measurement cannot be updated, see diffImmutableConfig.
+	return diff
+}
+
+// diffImmutableConfig lists the fields from the spec which differ, but cannot
+// be changed once the health check is created. Fields which are not read are
+// not compared.
+func diffImmutableConfig(live, desired *route53.HealthCheckConfig) []string {
+	var diff []string
+	if live.RequestInterval != nil {
+		// Route53 checks every 30 seconds by default.
+		interval := aws.Int64Value(desired.RequestInterval)
+		if interval == 0 {
+			interval = 30
+		}
+		if aws.Int64Value(live.RequestInterval) != interval {
+			diff = append(diff, fmt.Sprintf("request_interval: %d != %d", aws.Int64Value(live.RequestInterval), interval))
+		}
+	}
+	if live.MeasureLatency != nil && aws.BoolValue(live.MeasureLatency) != aws.BoolValue(desired.MeasureLatency) {
+		diff = append(diff, fmt.Sprintf("measure_latency: %t != %t", aws.BoolValue(live.MeasureLatency), aws.BoolValue(desired.MeasureLatency)))
+	}
+	return diff
+}
+
+// isRoute53Healthy checks if enough health checkers report the endpoint as healthy.
+func isRoute53Healthy(observations []*route53.HealthCheckObservation) bool {
+	if len(observations) == 0 {
+		return false
+	}
+
+	var healthy int
+	for _, observation := range observations {
+		if observation.StatusReport == nil {
+			continue
+		}
+		if strings.HasPrefix(aws.StringValue(observation.StatusReport.Status), "Success") {
+			healthy++
+		}
+	}
+
+	return float64(healthy)/float64(len(observations)) > healthyCheckerRatio
+}
+
+// getRoute53Failures lists the failures reported by health checkers, by region.
+func getRoute53Failures(observations []*route53.HealthCheckObservation) []string {
+	var failures []string
+	for _, observation := range observations {
+		if observation.StatusReport == nil {
+			continue
+		}
+		status := aws.StringValue(observation.StatusReport.Status)
+		if strings.HasPrefix(status, "Success") {
+			continue
+		}
+		failures = append(failures, fmt.Sprintf("%s: %s", aws.StringValue(observation.Region), status))
+	}
+	return failures
+}
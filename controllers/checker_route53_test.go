@@ -0,0 +1,298 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	healthcheckv1 "github.com/skpr/r53-check/api/v1"
+	"github.com/skpr/r53-check/internal/awsfake"
+)
+
+func TestReconcileOutOfBandDeletion(t *testing.T) {
+	err := healthcheckv1.AddToScheme(scheme.Scheme)
+	assert.Nil(t, err)
+
+	healthcheck := newTestHealthCheck()
+
+	client := fake.NewFakeClientWithScheme(scheme.Scheme, healthcheck)
+	route53Client := awsfake.NewRoute53()
+	cloudwatchClient := awsfake.NewCloudWatch()
+	recorder := record.NewFakeRecorder(10)
+
+	reconciler := HealthCheckReconciler{
+		Client:           client,
+		Log:              zap.New(),
+		Scheme:           scheme.Scheme,
+		Route53Client:    route53Client,
+		CloudwatchClient: cloudwatchClient,
+		Recorder:         recorder,
+	}
+
+	query := types.NamespacedName{
+		Name:      healthcheck.ObjectMeta.Name,
+		Namespace: healthcheck.ObjectMeta.Namespace,
+	}
+
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+
+	healthcheck = &healthcheckv1.HealthCheck{}
+	err = client.Get(context.TODO(), query, healthcheck)
+	assert.Nil(t, err)
+	id := healthcheck.Status.HealthCheckId
+	assert.NotEmpty(t, id)
+	assert.Equal(t, "xxxxxxxxxxxxxxxxxxxxxxxxxxx-1", *route53Client.HealthChecks()[0].CallerReference)
+
+	// The health check and alarm are recreated after being deleted in the console,
+	// even though the caller reference of the deleted health check cannot be reused.
+	for i := 0; i < 2; i++ {
+		route53Client.DeleteHealthCheckOutOfBand(healthcheck.Status.HealthCheckId)
+		cloudwatchClient.DeleteAlarmOutOfBand(healthcheck.Status.AlarmName)
+
+		_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+		assert.Nil(t, err)
+
+		healthcheck = &healthcheckv1.HealthCheck{}
+		err = client.Get(context.TODO(), query, healthcheck)
+		assert.Nil(t, err)
+		assert.Len(t, route53Client.HealthChecks(), 1)
+		assert.Equal(t, route53Client.HealthChecks()[0].Id, aws.String(healthcheck.Status.HealthCheckId))
+		assert.NotEqual(t, id, healthcheck.Status.HealthCheckId)
+		if assert.Len(t, cloudwatchClient.Alarms(), 1) {
+			assert.Equal(t, healthcheck.Status.HealthCheckId, *cloudwatchClient.Alarms()[0].Dimensions[0].Value)
+		}
+
+		assert.Contains(t, <-recorder.Events, "HealthCheckDeleted")
+		assert.Contains(t, <-recorder.Events, "AlarmDeleted")
+		id = healthcheck.Status.HealthCheckId
+	}
+
+	// Resources which are already gone do not block the finalizer.
+	route53Client.DeleteHealthCheckOutOfBand(healthcheck.Status.HealthCheckId)
+	cloudwatchClient.DeleteAlarmOutOfBand(healthcheck.Status.AlarmName)
+
+	now := metav1.Now()
+	healthcheck.ObjectMeta.DeletionTimestamp = &now
+	err = client.Update(context.TODO(), healthcheck)
+	assert.Nil(t, err)
+
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+
+	healthcheck = &healthcheckv1.HealthCheck{}
+	err = client.Get(context.TODO(), query, healthcheck)
+	assert.Nil(t, err)
+	assert.NotContains(t, healthcheck.ObjectMeta.Finalizers, finalizerName)
+}
+
+func TestReconcileUnrecordedHealthCheck(t *testing.T) {
+	err := healthcheckv1.AddToScheme(scheme.Scheme)
+	assert.Nil(t, err)
+
+	healthcheck := newTestHealthCheck()
+
+	client := fake.NewFakeClientWithScheme(scheme.Scheme, healthcheck)
+	route53Client := awsfake.NewRoute53()
+
+	// An earlier reconcile created the health check while it was disabled, but
+	// its id was never saved.
+	output, err := route53Client.CreateHealthCheck(&route53.CreateHealthCheckInput{
+		CallerReference:   aws.String("xxxxxxxxxxxxxxxxxxxxxxxxxxx-1"),
+		HealthCheckConfig: getHealthCheckConfig(healthcheck, true),
+	})
+	assert.Nil(t, err)
+	unrecorded := aws.StringValue(output.HealthCheck.Id)
+
+	reconciler := HealthCheckReconciler{
+		Client:           client,
+		Log:              zap.New(),
+		Scheme:           scheme.Scheme,
+		Route53Client:    route53Client,
+		CloudwatchClient: awsfake.NewCloudWatch(),
+	}
+
+	query := types.NamespacedName{
+		Name:      healthcheck.ObjectMeta.Name,
+		Namespace: healthcheck.ObjectMeta.Namespace,
+	}
+
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+
+	// The unrecorded health check is replaced, rather than leaked.
+	healthcheck = &healthcheckv1.HealthCheck{}
+	err = client.Get(context.TODO(), query, healthcheck)
+	assert.Nil(t, err)
+	if assert.Len(t, route53Client.HealthChecks(), 1) {
+		assert.Equal(t, healthcheck.Status.HealthCheckId, aws.StringValue(route53Client.HealthChecks()[0].Id))
+	}
+	assert.NotEqual(t, unrecorded, healthcheck.Status.HealthCheckId)
+}
+
+func TestReconcileImmutableChange(t *testing.T) {
+	err := healthcheckv1.AddToScheme(scheme.Scheme)
+	assert.Nil(t, err)
+
+	healthcheck := newTestHealthCheck()
+
+	client := fake.NewFakeClientWithScheme(scheme.Scheme, healthcheck)
+	route53Client := awsfake.NewRoute53()
+	cloudwatchClient := awsfake.NewCloudWatch()
+	recorder := record.NewFakeRecorder(10)
+
+	reconciler := HealthCheckReconciler{
+		Client:           client,
+		Log:              zap.New(),
+		Scheme:           scheme.Scheme,
+		Route53Client:    route53Client,
+		CloudwatchClient: cloudwatchClient,
+		Recorder:         recorder,
+	}
+
+	query := types.NamespacedName{
+		Name:      healthcheck.ObjectMeta.Name,
+		Namespace: healthcheck.ObjectMeta.Namespace,
+	}
+
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+
+	healthcheck = &healthcheckv1.HealthCheck{}
+	err = client.Get(context.TODO(), query, healthcheck)
+	assert.Nil(t, err)
+	original := healthcheck.Status.HealthCheckId
+
+	// Latency measurement cannot be turned on, so the health check is replaced.
+	healthcheck.Spec.MeasureLatency = true
+	healthcheck.ObjectMeta.Generation = 2
+	err = client.Update(context.TODO(), healthcheck)
+	assert.Nil(t, err)
+
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+	assert.Equal(t, "Warning HealthCheckReplaced Route53 health check "+original+" cannot be updated, replacing it: measure_latency: false != true", <-recorder.Events)
+
+	healthcheck = &healthcheckv1.HealthCheck{}
+	err = client.Get(context.TODO(), query, healthcheck)
+	assert.Nil(t, err)
+	assert.NotEqual(t, original, healthcheck.Status.HealthCheckId)
+	if assert.Len(t, route53Client.HealthChecks(), 1) {
+		live := route53Client.HealthChecks()[0]
+		assert.Equal(t, healthcheck.Status.HealthCheckId, aws.StringValue(live.Id))
+		assert.True(t, aws.BoolValue(live.HealthCheckConfig.MeasureLatency))
+	}
+
+	// The alarm follows the replacement.
+	if alarms := cloudwatchClient.Alarms(); assert.Len(t, alarms, 1) {
+		assert.Equal(t, healthcheck.Status.HealthCheckId, aws.StringValue(alarms[0].Dimensions[0].Value))
+	}
+}
+
+func TestReconcileImmutableChangeWithDNSRecord(t *testing.T) {
+	err := healthcheckv1.AddToScheme(scheme.Scheme)
+	assert.Nil(t, err)
+
+	healthcheck := newTestHealthCheck()
+
+	record := &healthcheckv1.DNSRecord{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: corev1.NamespaceDefault,
+		},
+		Spec: healthcheckv1.DNSRecordSpec{
+			HostedZoneID:  "Z123",
+			Name:          "test.example.skpr.io",
+			Type:          "A",
+			TTL:           60,
+			Values:        []string{"192.0.2.1"},
+			RoutingPolicy: healthcheckv1.RoutingPolicyFailover,
+			SetIdentifier: "primary",
+			Failover:      "PRIMARY",
+			HealthCheck:   healthcheck.Name,
+		},
+	}
+
+	client := fake.NewFakeClientWithScheme(scheme.Scheme, healthcheck, record)
+	route53Client := awsfake.NewRoute53()
+	route53Client.AddHostedZone("Z123")
+
+	reconciler := HealthCheckReconciler{
+		Client:           client,
+		Log:              zap.New(),
+		Scheme:           scheme.Scheme,
+		Route53Client:    route53Client,
+		CloudwatchClient: awsfake.NewCloudWatch(),
+	}
+
+	recordReconciler := DNSRecordReconciler{
+		Client:        client,
+		Log:           zap.New(),
+		Scheme:        scheme.Scheme,
+		Route53Client: route53Client,
+	}
+
+	query := types.NamespacedName{
+		Name:      healthcheck.ObjectMeta.Name,
+		Namespace: healthcheck.ObjectMeta.Namespace,
+	}
+
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+	_, err = recordReconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+
+	healthcheck = &healthcheckv1.HealthCheck{}
+	err = client.Get(context.TODO(), query, healthcheck)
+	assert.Nil(t, err)
+	original := healthcheck.Status.HealthCheckId
+
+	healthcheck.Spec.MeasureLatency = true
+	healthcheck.ObjectMeta.Generation = 2
+	err = client.Update(context.TODO(), healthcheck)
+	assert.Nil(t, err)
+
+	// The replaced health check is kept while the record set uses it.
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+
+	healthcheck = &healthcheckv1.HealthCheck{}
+	err = client.Get(context.TODO(), query, healthcheck)
+	assert.Nil(t, err)
+	replacement := healthcheck.Status.HealthCheckId
+	assert.NotEqual(t, original, replacement)
+	assert.Equal(t, []string{original}, healthcheck.Status.ReplacedHealthCheckIds)
+	assert.Len(t, route53Client.HealthChecks(), 2)
+	assert.Equal(t, 0, route53Client.Faults.Calls("DeleteHealthCheck"))
+
+	// The DNSRecord moves to the replacement, then the replaced health check is deleted.
+	_, err = recordReconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+
+	record = &healthcheckv1.DNSRecord{}
+	err = client.Get(context.TODO(), query, record)
+	assert.Nil(t, err)
+	assert.Equal(t, replacement, record.Status.HealthCheckId)
+
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+
+	healthcheck = &healthcheckv1.HealthCheck{}
+	err = client.Get(context.TODO(), query, healthcheck)
+	assert.Nil(t, err)
+	assert.Empty(t, healthcheck.Status.ReplacedHealthCheckIds)
+	if assert.Len(t, route53Client.HealthChecks(), 1) {
+		assert.Equal(t, replacement, aws.StringValue(route53Client.HealthChecks()[0].Id))
+	}
+}
@@ -0,0 +1,69 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	healthcheckv1 "github.com/skpr/r53-check/api/v1"
+)
+
+// setCondition adds or updates a condition, only moving the transition time
+// when the condition status changes.
+func setCondition(conditions []healthcheckv1.HealthCheckCondition, conditionType string, status corev1.ConditionStatus, reason, message string) []healthcheckv1.HealthCheckCondition {
+	for i, condition := range conditions {
+		if condition.Type != conditionType {
+			continue
+		}
+		if condition.Status != status {
+			conditions[i].Status = status
+			conditions[i].LastTransitionTime = metav1.Now()
+		}
+		conditions[i].Reason = reason
+		conditions[i].Message = message
+		return conditions
+	}
+
+	return append(conditions, healthcheckv1.HealthCheckCondition{
+		Type:               conditionType,
+		Status:             status,
+		LastTransitionTime: metav1.Now(),
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// getCondition gets a condition by type.
+func getCondition(conditions []healthcheckv1.HealthCheckCondition, conditionType string) *healthcheckv1.HealthCheckCondition {
+	for i := range conditions {
+		if conditions[i].Type == conditionType {
+			return &conditions[i]
+		}
+	}
+	return nil
+}
+
+// removeCondition removes a condition by type.
+func removeCondition(conditions []healthcheckv1.HealthCheckCondition, conditionType string) []healthcheckv1.HealthCheckCondition {
+	var result []healthcheckv1.HealthCheckCondition
+	for _, condition := range conditions {
+		if condition.Type != conditionType {
+			result = append(result, condition)
+		}
+	}
+	return result
+}
@@ -0,0 +1,92 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	healthcheckv1 "github.com/skpr/r53-check/api/v1"
+	"github.com/skpr/r53-check/internal/cost"
+)
+
+// syncCost estimates the monthly cost of the health check from its spec, and
+// adds it to the total of the namespace.
+func (r *HealthCheckReconciler) syncCost(ctx context.Context, healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus) {
+	prices, err := r.getPrices(ctx)
+	if err != nil {
+		// A broken price table does not hold back the health checks, so the
+		// last estimate is kept until it is fixed.
+		r.Log.Error(err, "failed to get prices")
+		return
+	}
+
+	alarm := getAlerters(healthCheck)[string(healthcheckv1.AlerterCloudWatch)] && hasAlarm(healthCheck, r.Prober)
+
+	estimate, monthly := cost.Estimate(prices, healthCheck, alarm)
+	status.Cost = &estimate
+	r.Costs.Set(types.NamespacedName{Namespace: healthCheck.Namespace, Name: healthCheck.Name}, monthly)
+}
+
+// getPrices gets the price table from the ConfigMap, or the list prices when
+// there is none.
+func (r *HealthCheckReconciler) getPrices(ctx context.Context) (cost.Prices, error) {
+	if r.PriceConfigMap.Name == "" {
+		return cost.DefaultPrices(), nil
+	}
+
+	configMap := &corev1.ConfigMap{}
+	if err := r.Get(ctx, r.PriceConfigMap, configMap); err != nil {
+		return cost.Prices{}, fmt.Errorf("failed to get price table %s: %w", r.PriceConfigMap, err)
+	}
+
+	prices, err := cost.FromConfigMap(configMap.Data)
+	if err != nil {
+		return cost.Prices{}, fmt.Errorf("invalid price table %s: %w", r.PriceConfigMap, err)
+	}
+	return prices, nil
+}
+
+// mapPrices enqueues every HealthCheck when the price table changes.
+func (r *HealthCheckReconciler) mapPrices(obj handler.MapObject) []reconcile.Request {
+	if obj.Meta.GetNamespace() != r.PriceConfigMap.Namespace || obj.Meta.GetName() != r.PriceConfigMap.Name {
+		return nil
+	}
+
+	healthChecks := &healthcheckv1.HealthCheckList{}
+
+	err := r.List(context.Background(), healthChecks)
+	if err != nil {
+		r.Log.Error(err, "failed to list health checks")
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, healthCheck := range healthChecks.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Namespace: healthCheck.Namespace,
+				Name:      healthCheck.Name,
+			},
+		})
+	}
+	return requests
+}
@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	healthcheckv1 "github.com/skpr/r53-check/api/v1"
+	"github.com/skpr/r53-check/internal/awsfake"
+	"github.com/skpr/r53-check/internal/cost"
+)
+
+func TestReconcileCost(t *testing.T) {
+	err := healthcheckv1.AddToScheme(scheme.Scheme)
+	assert.Nil(t, err)
+
+	healthcheck := newTestHealthCheck()
+	healthcheck.Spec.MeasureLatency = true
+
+	prices := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "r53-check-prices",
+			Namespace: "r53-check-system",
+		},
+		Data: map[string]string{
+			"currency":             "AUD",
+			"non_aws_health_check": "1.00",
+			"non_aws_https":        "3.00",
+		},
+	}
+
+	client := fake.NewFakeClientWithScheme(scheme.Scheme, healthcheck, prices)
+	costs := cost.NewTotals()
+
+	reconciler := HealthCheckReconciler{
+		Client:           client,
+		Log:              zap.New(),
+		Scheme:           scheme.Scheme,
+		Route53Client:    awsfake.NewRoute53(),
+		CloudwatchClient: awsfake.NewCloudWatch(),
+		PriceConfigMap:   types.NamespacedName{Namespace: prices.Namespace, Name: prices.Name},
+		Costs:            costs,
+	}
+
+	query := types.NamespacedName{
+		Name:      healthcheck.ObjectMeta.Name,
+		Namespace: healthcheck.ObjectMeta.Namespace,
+	}
+
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+
+	healthcheck = &healthcheckv1.HealthCheck{}
+	err = client.Get(context.TODO(), query, healthcheck)
+	assert.Nil(t, err)
+	assert.Equal(t, &healthcheckv1.CostEstimate{
+		Monthly:  "6.10",
+		Currency: "AUD",
+		Items:    []string{"health_check: 1.00", "https: 3.00", "measure_latency: 2.00", "alarm: 0.10"},
+	}, healthcheck.Status.Cost)
+	assert.InDelta(t, 6.10, costs.Namespace(corev1.NamespaceDefault), 0.001)
+
+	// Every HealthCheck is estimated again when the prices change.
+	requests := reconciler.mapPrices(handler.MapObject{Meta: prices})
+	assert.Equal(t, []reconcile.Request{{NamespacedName: query}}, requests)
+
+	// Deleted HealthChecks are removed from the total.
+	err = client.Delete(context.TODO(), healthcheck)
+	assert.Nil(t, err)
+
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+	assert.Equal(t, 0.0, costs.Namespace(corev1.NamespaceDefault))
+}
@@ -0,0 +1,174 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a parsed five field cron expression evaluated in UTC.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// domStar and dowStar track wildcards, which change how the day fields combine.
+	domStar, dowStar bool
+}
+
+type cronBounds struct {
+	min, max uint
+}
+
+var (
+	cronMinutes = cronBounds{0, 59}
+	cronHours   = cronBounds{0, 23}
+	cronDom     = cronBounds{1, 31}
+	cronMonths  = cronBounds{1, 12}
+	cronDow     = cronBounds{0, 7}
+)
+
+// parseCron parses a standard "minute hour day-of-month month day-of-week" expression.
+func parseCron(expression string) (*cronSchedule, error) {
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected 5 fields in cron expression %q, found %d", expression, len(fields))
+	}
+
+	var (
+		schedule cronSchedule
+		err      error
+	)
+
+	if schedule.minute, err = parseCronField(fields[0], cronMinutes); err != nil {
+		return nil, err
+	}
+	if schedule.hour, err = parseCronField(fields[1], cronHours); err != nil {
+		return nil, err
+	}
+	if schedule.dom, err = parseCronField(fields[2], cronDom); err != nil {
+		return nil, err
+	}
+	if schedule.month, err = parseCronField(fields[3], cronMonths); err != nil {
+		return nil, err
+	}
+	if schedule.dow, err = parseCronField(fields[4], cronDow); err != nil {
+		return nil, err
+	}
+
+	// Sunday can be written as 0 or 7.
+	if schedule.dow&(1<<7) != 0 {
+		schedule.dow |= 1
+	}
+
+	schedule.domStar = fields[2] == "*" || fields[2] == "?"
+	schedule.dowStar = fields[4] == "*" || fields[4] == "?"
+
+	return &schedule, nil
+}
+
+// parseCronField parses a comma separated list of values, ranges and steps into a bitset.
+func parseCronField(field string, bounds cronBounds) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(field, ",") {
+		step := uint(1)
+		if i := strings.Index(part, "/"); i >= 0 {
+			s, err := strconv.ParseUint(part[i+1:], 10, 8)
+			if err != nil || s == 0 {
+				return 0, fmt.Errorf("invalid step in cron field %q", field)
+			}
+			step = uint(s)
+			part = part[:i]
+		}
+
+		start, end := bounds.min, bounds.max
+		switch {
+		case part == "*" || part == "?":
+		case strings.Contains(part, "-"):
+			r := strings.SplitN(part, "-", 2)
+			low, err := strconv.ParseUint(r[0], 10, 8)
+			if err != nil {
+				return 0, fmt.Errorf("invalid range in cron field %q", field)
+			}
+			high, err := strconv.ParseUint(r[1], 10, 8)
+			if err != nil {
+				return 0, fmt.Errorf("invalid range in cron field %q", field)
+			}
+			start, end = uint(low), uint(high)
+		default:
+			value, err := strconv.ParseUint(part, 10, 8)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value in cron field %q", field)
+			}
+			start = uint(value)
+			if step == 1 {
+				end = start
+			}
+		}
+
+		if start < bounds.min || end > bounds.max || start > end {
+			return 0, fmt.Errorf("cron field %q out of range %d-%d", field, bounds.min, bounds.max)
+		}
+
+		for i := start; i <= end; i += step {
+			bits |= 1 << i
+		}
+	}
+
+	return bits, nil
+}
+
+// next returns the first activation strictly after t.
+func (s *cronSchedule) next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+
+	// Give up if nothing matches within five years eg. February 30th.
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = t.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+
+	return time.Time{}
+}
+
+// dayMatches applies the cron rule where a restricted day-of-month and
+// day-of-week match when either of them does.
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
@@ -0,0 +1,423 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/aws/aws-sdk-go/service/route53/route53iface"
+	"github.com/go-logr/logr"
+	"github.com/go-test/deep"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	healthcheckv1 "github.com/skpr/r53-check/api/v1"
+	"github.com/skpr/r53-check/internal/dryrun"
+	"github.com/skpr/r53-check/internal/scope"
+)
+
+const (
+	dnsRecordFinalizerName = "dnsrecord.route53.finalizers.skpr.io"
+
+	// healthCheckIndexKey indexes DNSRecords by the HealthCheck they reference.
+	healthCheckIndexKey = "spec.health_check"
+)
+
+// DNSRecordReconciler reconciles a DNSRecord object
+type DNSRecordReconciler struct {
+	client.Client
+	Log           logr.Logger
+	Scheme        *runtime.Scheme
+	Route53Client route53iface.Route53API
+	// DryRun logs the Route53 changes, without making them.
+	DryRun bool
+	// Scope selects the objects reconciled by this manager.
+	Scope *scope.Scope
+	// MaxConcurrentReconciles is the number of objects reconciled at once.
+	MaxConcurrentReconciles int
+}
+
+// +kubebuilder:rbac:groups=route53.skpr.io,resources=dnsrecords,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=route53.skpr.io,resources=dnsrecords/status,verbs=get;update;patch
+
+func (r *DNSRecordReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+
+	if ok, err := r.Scope.Contains(ctx, r, req.NamespacedName); !ok || err != nil {
+		// Another manager reconciles it.
+		return ctrl.Result{}, err
+	}
+
+	record := &healthcheckv1.DNSRecord{}
+
+	if err := r.Get(ctx, req.NamespacedName, record); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	if r.DryRun {
+		planner := *r
+		planner.Route53Client = dryrun.NewRoute53(r.Route53Client, dryrun.NewPlan(r.Log.WithValues("dnsrecord", req.NamespacedName)))
+		r = &planner
+	}
+
+	if record.ObjectMeta.DeletionTimestamp.IsZero() {
+		// The record is not being deleted. Register the finalizer.
+		if !containsString(record.ObjectMeta.Finalizers, dnsRecordFinalizerName) {
+			record.ObjectMeta.Finalizers = append(record.ObjectMeta.Finalizers, dnsRecordFinalizerName)
+			if err := r.Update(ctx, record); err != nil {
+				return ctrl.Result{}, fmt.Errorf("failed to add finalizer %w", err)
+			}
+		}
+	} else {
+		// The record is being deleted. Remove the record set from the hosted zone.
+		if containsString(record.ObjectMeta.Finalizers, dnsRecordFinalizerName) {
+			if record.Status.Applied != nil {
+				if err := r.deleteRecordSet(*record.Status.Applied); err != nil {
+					return ctrl.Result{}, fmt.Errorf("failed to delete record set %w", err)
+				}
+			}
+
+			record.ObjectMeta.Finalizers = removeString(record.ObjectMeta.Finalizers, dnsRecordFinalizerName)
+			if err := r.Update(ctx, record); err != nil {
+				return ctrl.Result{}, fmt.Errorf("failed to removed finalizer %w", err)
+			}
+		}
+
+		return ctrl.Result{}, nil
+	}
+
+	healthCheckId, err := r.getHealthCheckId(ctx, record)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if record.Spec.HealthCheck != "" && healthCheckId == "" {
+		// The health check has not been provisioned yet. We will be notified
+		// through the HealthCheck watch once it has an id.
+		r.Log.Info(fmt.Sprintf("Waiting for health check: %s", record.Spec.HealthCheck))
+		return ctrl.Result{RequeueAfter: time.Second * 30}, nil
+	}
+
+	desired, err := buildResourceRecordSet(record.Spec, healthCheckId)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	ref := getDNSRecordRef(record.Spec)
+
+	// The record set was renamed, remove the previous one before upserting.
+	if record.Status.Applied != nil && *record.Status.Applied != ref {
+		if err := r.deleteRecordSet(*record.Status.Applied); err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to delete previous record set %w", err)
+		}
+	}
+
+	status := healthcheckv1.DNSRecordStatus{
+		HealthCheckId: healthCheckId,
+		ChangeId:      record.Status.ChangeId,
+		ChangeStatus:  record.Status.ChangeStatus,
+		Applied:       &ref,
+	}
+
+	live, err := r.findRecordSet(ref)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if diff := deep.Equal(live, desired); diff != nil {
+		r.Log.Info(fmt.Sprintf("Upserting record set %s: %s", ref.Name, diff))
+		output, err := r.Route53Client.ChangeResourceRecordSets(&route53.ChangeResourceRecordSetsInput{
+			HostedZoneId: aws.String(ref.HostedZoneID),
+			ChangeBatch: &route53.ChangeBatch{
+				Comment: aws.String("Managed by r53-check " + record.Namespace + "/" + record.Name),
+				Changes: []*route53.Change{
+					{
+						Action:            aws.String(route53.ChangeActionUpsert),
+						ResourceRecordSet: desired,
+					},
+				},
+			},
+		})
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		// A planned change is not recorded, so it is planned again until it is made.
+		if output.ChangeInfo != nil && !dryrun.IsPlanned(aws.StringValue(output.ChangeInfo.Id)) {
+			status.ChangeId = aws.StringValue(output.ChangeInfo.Id)
+			status.ChangeStatus = aws.StringValue(output.ChangeInfo.Status)
+		}
+	}
+
+	if diff := deep.Equal(record.Status, status); diff != nil {
+		r.Log.Info(fmt.Sprintf("Status change dectected: %s", diff))
+		record.Status = status
+		if err := r.Status().Update(ctx, record); err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to sync status %v %w", record, err)
+		}
+	}
+
+	return ctrl.Result{RequeueAfter: time.Second * 30}, nil
+}
+
+// getHealthCheckId gets the Route53 health check id of the referenced HealthCheck.
+func (r *DNSRecordReconciler) getHealthCheckId(ctx context.Context, record *healthcheckv1.DNSRecord) (string, error) {
+	if record.Spec.HealthCheck == "" {
+		return "", nil
+	}
+
+	healthCheck := &healthcheckv1.HealthCheck{}
+
+	err := r.Get(ctx, types.NamespacedName{
+		Namespace: record.Namespace,
+		Name:      record.Spec.HealthCheck,
+	}, healthCheck)
+	if errors.IsNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return healthCheck.Status.HealthCheckId, nil
+}
+
+// findRecordSet looks up the live record set for a reference.
+func (r *DNSRecordReconciler) findRecordSet(ref healthcheckv1.DNSRecordRef) (*route53.ResourceRecordSet, error) {
+	input := &route53.ListResourceRecordSetsInput{
+		HostedZoneId:    aws.String(ref.HostedZoneID),
+		StartRecordName: aws.String(ref.Name),
+		StartRecordType: aws.String(ref.Type),
+		MaxItems:        aws.String("1"),
+	}
+	if ref.SetIdentifier != "" {
+		input.StartRecordIdentifier = aws.String(ref.SetIdentifier)
+	}
+
+	output, err := r.Route53Client.ListResourceRecordSets(input)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, set := range output.ResourceRecordSets {
+		if normaliseDNSName(aws.StringValue(set.Name)) != ref.Name {
+			continue
+		}
+		if aws.StringValue(set.Type) != ref.Type || aws.StringValue(set.SetIdentifier) != ref.SetIdentifier {
+			continue
+		}
+		return set, nil
+	}
+
+	return nil, nil
+}
+
+// deleteRecordSet deletes the live record set for a reference, if it exists.
+func (r *DNSRecordReconciler) deleteRecordSet(ref healthcheckv1.DNSRecordRef) error {
+	live, err := r.findRecordSet(ref)
+	if err != nil {
+		return err
+	}
+	if live == nil {
+		return nil
+	}
+
+	r.Log.Info(fmt.Sprintf("Deleting record set: %s %s", ref.Name, ref.Type))
+	_, err = r.Route53Client.ChangeResourceRecordSets(&route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(ref.HostedZoneID),
+		ChangeBatch: &route53.ChangeBatch{
+			Changes: []*route53.Change{
+				{
+					Action:            aws.String(route53.ChangeActionDelete),
+					ResourceRecordSet: live,
+				},
+			},
+		},
+	})
+	return err
+}
+
+func (r *DNSRecordReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	err := mgr.GetFieldIndexer().IndexField(&healthcheckv1.DNSRecord{}, healthCheckIndexKey, func(obj runtime.Object) []string {
+		record := obj.(*healthcheckv1.DNSRecord)
+		if record.Spec.HealthCheck == "" {
+			return nil
+		}
+		return []string{record.Spec.HealthCheck}
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&healthcheckv1.DNSRecord{}).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
+		Watches(&source.Kind{Type: &healthcheckv1.HealthCheck{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(r.mapHealthCheck),
+		}).
+		Complete(r)
+}
+
+// mapHealthCheck enqueues the DNSRecords which reference a HealthCheck so
+// that a replaced health check id is propagated to the record sets.
+func (r *DNSRecordReconciler) mapHealthCheck(obj handler.MapObject) []reconcile.Request {
+	records := &healthcheckv1.DNSRecordList{}
+
+	err := r.List(context.Background(), records,
+		client.InNamespace(obj.Meta.GetNamespace()),
+		client.MatchingFields{healthCheckIndexKey: obj.Meta.GetName()})
+	if err != nil {
+		r.Log.Error(err, "failed to list dns records", "healthcheck", obj.Meta.GetName())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, record := range records.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Namespace: record.Namespace,
+				Name:      record.Name,
+			},
+		})
+	}
+	return requests
+}
+
+// buildResourceRecordSet builds the desired record set from the spec.
+func buildResourceRecordSet(spec healthcheckv1.DNSRecordSpec, healthCheckId string) (*route53.ResourceRecordSet, error) {
+	set := &route53.ResourceRecordSet{
+		Name: aws.String(normaliseDNSName(spec.Name)),
+		Type: aws.String(spec.Type),
+	}
+
+	if spec.Alias != nil {
+		set.AliasTarget = &route53.AliasTarget{
+			HostedZoneId:         aws.String(spec.Alias.HostedZoneID),
+			DNSName:              aws.String(normaliseDNSName(spec.Alias.DNSName)),
+			EvaluateTargetHealth: aws.Bool(spec.Alias.EvaluateTargetHealth),
+		}
+	} else {
+		set.TTL = aws.Int64(spec.TTL)
+		for _, value := range spec.Values {
+			set.ResourceRecords = append(set.ResourceRecords, &route53.ResourceRecord{
+				Value: aws.String(value),
+			})
+		}
+	}
+
+	if healthCheckId != "" {
+		set.HealthCheckId = aws.String(healthCheckId)
+	}
+
+	policy := spec.RoutingPolicy
+	if policy == "" {
+		policy = healthcheckv1.RoutingPolicySimple
+	}
+
+	if policy != healthcheckv1.RoutingPolicySimple {
+		if spec.SetIdentifier == "" {
+			return nil, fmt.Errorf("set_identifier is required for the %s routing policy", policy)
+		}
+		set.SetIdentifier = aws.String(spec.SetIdentifier)
+	}
+
+	switch policy {
+	case healthcheckv1.RoutingPolicySimple:
+	case healthcheckv1.RoutingPolicyFailover:
+		if spec.Failover == "" {
+			return nil, fmt.Errorf("failover is required for the %s routing policy", policy)
+		}
+		set.Failover = aws.String(spec.Failover)
+	case healthcheckv1.RoutingPolicyWeighted:
+		if spec.Weight == nil {
+			return nil, fmt.Errorf("weight is required for the %s routing policy", policy)
+		}
+		set.Weight = aws.Int64(*spec.Weight)
+	case healthcheckv1.RoutingPolicyLatency:
+		if spec.Region == "" {
+			return nil, fmt.Errorf("region is required for the %s routing policy", policy)
+		}
+		set.Region = aws.String(spec.Region)
+	case healthcheckv1.RoutingPolicyMultiValue:
+		set.MultiValueAnswer = aws.Bool(true)
+	default:
+		return nil, fmt.Errorf("unknown routing policy: %s", policy)
+	}
+
+	return set, nil
+}
+
+// getDNSRecordRef gets the reference which identifies the record set.
+func getDNSRecordRef(spec healthcheckv1.DNSRecordSpec) healthcheckv1.DNSRecordRef {
+	ref := healthcheckv1.DNSRecordRef{
+		HostedZoneID: spec.HostedZoneID,
+		Name:         normaliseDNSName(spec.Name),
+		Type:         spec.Type,
+	}
+	if spec.RoutingPolicy != "" && spec.RoutingPolicy != healthcheckv1.RoutingPolicySimple {
+		ref.SetIdentifier = spec.SetIdentifier
+	}
+	return ref
+}
+
+// normaliseDNSName converts a name into the fully qualified form returned by
+// Route53, which escapes characters other than a-z, 0-9, hyphens, underscores
+// and dots as octal codes, eg. "*" as "\052".
+func normaliseDNSName(name string) string {
+	name = strings.ToLower(name)
+	if !strings.HasSuffix(name, ".") {
+		name = name + "."
+	}
+
+	var escaped strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+			escaped.WriteByte(c)
+		case c == '\\' && isOctalEscape(name[i+1:]):
+			// Already escaped.
+			escaped.WriteString(name[i : i+4])
+			i += 3
+		default:
+			fmt.Fprintf(&escaped, "\\%03o", c)
+		}
+	}
+	return escaped.String()
+}
+
+// isOctalEscape checks if a name starts with the three digits of an octal escape code.
+func isOctalEscape(name string) bool {
+	if len(name) < 3 {
+		return false
+	}
+	for _, c := range name[:3] {
+		if c < '0' || c > '7' {
+			return false
+		}
+	}
+	return true
+}
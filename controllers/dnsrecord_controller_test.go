@@ -0,0 +1,279 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/client-go/kubernetes/scheme"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	healthcheckv1 "github.com/skpr/r53-check/api/v1"
+	"github.com/skpr/r53-check/internal/awsfake"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+func TestReconcileDNSRecord(t *testing.T) {
+	err := healthcheckv1.AddToScheme(scheme.Scheme)
+	assert.Nil(t, err)
+
+	route53Client := awsfake.NewRoute53()
+	route53Client.AddHostedZone("Z123")
+
+	output, err := route53Client.CreateHealthCheck(&route53.CreateHealthCheckInput{
+		CallerReference: aws.String("test"),
+		HealthCheckConfig: &route53.HealthCheckConfig{
+			FullyQualifiedDomainName: aws.String("test.example.skpr.io"),
+			Type:                     aws.String(route53.HealthCheckTypeHttps),
+		},
+	})
+	assert.Nil(t, err)
+	healthCheckId := *output.HealthCheck.Id
+
+	healthcheck := &healthcheckv1.HealthCheck{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: corev1.NamespaceDefault,
+		},
+		Status: healthcheckv1.HealthCheckStatus{
+			HealthCheckId: healthCheckId,
+		},
+	}
+
+	record := &healthcheckv1.DNSRecord{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: corev1.NamespaceDefault,
+		},
+		Spec: healthcheckv1.DNSRecordSpec{
+			HostedZoneID:  "Z123",
+			Name:          "test.example.skpr.io",
+			Type:          "A",
+			TTL:           60,
+			Values:        []string{"192.0.2.1"},
+			RoutingPolicy: healthcheckv1.RoutingPolicyFailover,
+			SetIdentifier: "primary",
+			Failover:      "PRIMARY",
+			HealthCheck:   healthcheck.Name,
+		},
+	}
+
+	client := fake.NewFakeClientWithScheme(scheme.Scheme, healthcheck, record)
+
+	reconciler := DNSRecordReconciler{
+		Client:        client,
+		Log:           zap.New(),
+		Scheme:        scheme.Scheme,
+		Route53Client: route53Client,
+	}
+
+	query := types.NamespacedName{
+		Name:      record.ObjectMeta.Name,
+		Namespace: record.ObjectMeta.Namespace,
+	}
+
+	_, err = reconciler.Reconcile(ctrl.Request{
+		NamespacedName: query,
+	})
+	assert.Nil(t, err)
+
+	err = client.Get(context.TODO(), query, record)
+	assert.Nil(t, err)
+	assert.Equal(t, healthCheckId, record.Status.HealthCheckId)
+	assert.Contains(t, record.Status.ChangeId, "/change/")
+	assert.Equal(t, "test.example.skpr.io.", record.Status.Applied.Name)
+}
+
+func TestBuildResourceRecordSet(t *testing.T) {
+	spec := healthcheckv1.DNSRecordSpec{
+		HostedZoneID:  "Z123",
+		Name:          "Test.Example.skpr.io",
+		Type:          "CNAME",
+		TTL:           60,
+		Values:        []string{"origin.example.skpr.io"},
+		RoutingPolicy: healthcheckv1.RoutingPolicyWeighted,
+		SetIdentifier: "blue",
+	}
+
+	_, err := buildResourceRecordSet(spec, "")
+	assert.NotNil(t, err, "weight is required")
+
+	weight := int64(10)
+	spec.Weight = &weight
+
+	set, err := buildResourceRecordSet(spec, "abcdefg")
+	assert.Nil(t, err)
+	assert.Equal(t, "test.example.skpr.io.", *set.Name)
+	assert.Equal(t, int64(10), *set.Weight)
+	assert.Equal(t, "blue", *set.SetIdentifier)
+	assert.Equal(t, "abcdefg", *set.HealthCheckId)
+}
+
+func TestReconcileDNSRecordDryRun(t *testing.T) {
+	err := healthcheckv1.AddToScheme(scheme.Scheme)
+	assert.Nil(t, err)
+
+	record := &healthcheckv1.DNSRecord{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: corev1.NamespaceDefault,
+		},
+		Spec: healthcheckv1.DNSRecordSpec{
+			HostedZoneID: "Z123",
+			Name:         "test.example.skpr.io",
+			Type:         "A",
+			TTL:          60,
+			Values:       []string{"192.0.2.1"},
+		},
+	}
+
+	client := fake.NewFakeClientWithScheme(scheme.Scheme, record)
+	route53Client := awsfake.NewRoute53()
+	route53Client.AddHostedZone("Z123")
+
+	reconciler := DNSRecordReconciler{
+		Client:        client,
+		Log:           zap.New(),
+		Scheme:        scheme.Scheme,
+		Route53Client: route53Client,
+		DryRun:        true,
+	}
+
+	query := types.NamespacedName{
+		Name:      record.ObjectMeta.Name,
+		Namespace: record.ObjectMeta.Namespace,
+	}
+
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+
+	// The record set is not written, and no change is recorded.
+	output, err := route53Client.ListResourceRecordSets(&route53.ListResourceRecordSetsInput{HostedZoneId: aws.String("Z123")})
+	assert.Nil(t, err)
+	assert.Empty(t, output.ResourceRecordSets)
+
+	err = client.Get(context.TODO(), query, record)
+	assert.Nil(t, err)
+	assert.Empty(t, record.Status.ChangeId)
+}
+
+func TestReconcileDNSRecordLifecycle(t *testing.T) {
+	err := healthcheckv1.AddToScheme(scheme.Scheme)
+	assert.Nil(t, err)
+
+	route53Client := awsfake.NewRoute53()
+	route53Client.AddHostedZone("Z123")
+
+	// createHealthCheck creates a health check which record sets can use.
+	createHealthCheck := func(callerReference string) string {
+		output, err := route53Client.CreateHealthCheck(&route53.CreateHealthCheckInput{
+			CallerReference: aws.String(callerReference),
+			HealthCheckConfig: &route53.HealthCheckConfig{
+				FullyQualifiedDomainName: aws.String("test.example.skpr.io"),
+				Type:                     aws.String(route53.HealthCheckTypeHttps),
+			},
+		})
+		assert.Nil(t, err)
+		return *output.HealthCheck.Id
+	}
+	first := createHealthCheck("first")
+	second := createHealthCheck("second")
+
+	healthcheck := &healthcheckv1.HealthCheck{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: corev1.NamespaceDefault,
+		},
+		Status: healthcheckv1.HealthCheckStatus{
+			HealthCheckId: first,
+		},
+	}
+
+	record := &healthcheckv1.DNSRecord{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: corev1.NamespaceDefault,
+		},
+		Spec: healthcheckv1.DNSRecordSpec{
+			HostedZoneID:  "Z123",
+			Name:          "*.example.skpr.io",
+			Type:          "A",
+			TTL:           60,
+			Values:        []string{"192.0.2.1"},
+			RoutingPolicy: healthcheckv1.RoutingPolicyFailover,
+			SetIdentifier: "primary",
+			Failover:      "PRIMARY",
+			HealthCheck:   healthcheck.Name,
+		},
+	}
+
+	client := fake.NewFakeClientWithScheme(scheme.Scheme, healthcheck, record)
+
+	reconciler := DNSRecordReconciler{
+		Client:        client,
+		Log:           zap.New(),
+		Scheme:        scheme.Scheme,
+		Route53Client: route53Client,
+	}
+
+	query := types.NamespacedName{
+		Name:      record.ObjectMeta.Name,
+		Namespace: record.ObjectMeta.Namespace,
+	}
+
+	// getRecordSets gets the record sets in the hosted zone.
+	getRecordSets := func() []*route53.ResourceRecordSet {
+		output, err := route53Client.ListResourceRecordSets(&route53.ListResourceRecordSetsInput{HostedZoneId: aws.String("Z123")})
+		assert.Nil(t, err)
+		return output.ResourceRecordSets
+	}
+
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+
+	// Route53 escapes the wildcard, which is not a change.
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, route53Client.Faults.Calls("ChangeResourceRecordSets"))
+	if sets := getRecordSets(); assert.Len(t, sets, 1) {
+		assert.Equal(t, `\052.example.skpr.io.`, *sets[0].Name)
+		assert.Equal(t, first, *sets[0].HealthCheckId)
+	}
+
+	// A replaced health check id is applied to the record set.
+	healthcheck.Status.HealthCheckId = second
+	err = client.Status().Update(context.TODO(), healthcheck)
+	assert.Nil(t, err)
+
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+	if sets := getRecordSets(); assert.Len(t, sets, 1) {
+		assert.Equal(t, second, *sets[0].HealthCheckId)
+	}
+
+	err = client.Get(context.TODO(), query, record)
+	assert.Nil(t, err)
+	assert.Equal(t, second, record.Status.HealthCheckId)
+	assert.Equal(t, `\052.example.skpr.io.`, record.Status.Applied.Name)
+
+	// Deleting the DNSRecord deletes the record set.
+	now := metav1.Now()
+	record.ObjectMeta.DeletionTimestamp = &now
+	err = client.Update(context.TODO(), record)
+	assert.Nil(t, err)
+
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+	assert.Empty(t, getRecordSets())
+
+	record = &healthcheckv1.DNSRecord{}
+	err = client.Get(context.TODO(), query, record)
+	assert.Nil(t, err)
+	assert.NotContains(t, record.ObjectMeta.Finalizers, dnsRecordFinalizerName)
+}
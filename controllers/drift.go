@@ -0,0 +1,74 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	healthcheckv1 "github.com/skpr/r53-check/api/v1"
+)
+
+// maxDrift is the most differences recorded in the status.
+const maxDrift = 10
+
+// isSpecChanged checks if the spec changed since it was last applied, in which
+// case differences from the live resources are not drift.
+func isSpecChanged(healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus) bool {
+	return healthCheck.ObjectMeta.Generation != status.ObservedGeneration
+}
+
+// shouldCorrect checks if the live resources should be updated to match the spec.
+func shouldCorrect(healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus) bool {
+	return healthCheck.Spec.DriftPolicy != healthcheckv1.DriftPolicyReport || isSpecChanged(healthCheck, status)
+}
+
+// recordDrift records the differences found in a resource, unless they were
+// caused by a change to the spec.
+func recordDrift(healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus, resource string, diff []string) {
+	if isSpecChanged(healthCheck, status) {
+		return
+	}
+	for _, d := range diff {
+		if len(status.Drift) >= maxDrift {
+			return
+		}
+		status.Drift = append(status.Drift, resource+"."+d)
+	}
+}
+
+// syncDrift sets the Drifted condition from the differences recorded by the
+// backends. Nothing is reverted in dry-run mode.
+func (r *HealthCheckReconciler) syncDrift(healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus, dryRun bool) {
+	if len(status.Drift) == 0 {
+		status.Conditions = setCondition(status.Conditions, healthcheckv1.ConditionDrifted, corev1.ConditionFalse,
+			"InSync", "")
+		return
+	}
+
+	if healthCheck.Spec.DriftPolicy == healthcheckv1.DriftPolicyReport || dryRun {
+		status.Conditions = setCondition(status.Conditions, healthcheckv1.ConditionDrifted, corev1.ConditionTrue,
+			"Reported", fmt.Sprintf("%d changes were made outside of the controller", len(status.Drift)))
+		return
+	}
+
+	recordWarning(r.Recorder, healthCheck, "DriftCorrected",
+		"Reverted changes made outside of the controller: %s", strings.Join(status.Drift, ", "))
+	status.Conditions = setCondition(status.Conditions, healthcheckv1.ConditionDrifted, corev1.ConditionTrue,
+		"Corrected", fmt.Sprintf("%d changes made outside of the controller were reverted", len(status.Drift)))
+}
@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	healthcheckv1 "github.com/skpr/r53-check/api/v1"
+	"github.com/skpr/r53-check/internal/awsfake"
+)
+
+func TestReconcileDrift(t *testing.T) {
+	err := healthcheckv1.AddToScheme(scheme.Scheme)
+	assert.Nil(t, err)
+
+	healthcheck := newTestHealthCheck()
+	healthcheck.Spec.AlarmActions = []string{"arn:aws:sns:us-east-1:123456789012:alarm", "arn:aws:sns:us-east-1:123456789012:pager"}
+
+	client := fake.NewFakeClientWithScheme(scheme.Scheme, healthcheck)
+	route53Client := awsfake.NewRoute53()
+	cloudwatchClient := awsfake.NewCloudWatch()
+	recorder := record.NewFakeRecorder(10)
+
+	reconciler := HealthCheckReconciler{
+		Client:           client,
+		Log:              zap.New(),
+		Scheme:           scheme.Scheme,
+		Route53Client:    route53Client,
+		CloudwatchClient: cloudwatchClient,
+		Recorder:         recorder,
+	}
+
+	query := types.NamespacedName{
+		Name:      healthcheck.ObjectMeta.Name,
+		Namespace: healthcheck.ObjectMeta.Namespace,
+	}
+
+	// reconcile reconciles the HealthCheck and gets the result.
+	reconcile := func() *healthcheckv1.HealthCheck {
+		_, err := reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+		assert.Nil(t, err)
+
+		healthcheck := &healthcheckv1.HealthCheck{}
+		err = client.Get(context.TODO(), query, healthcheck)
+		assert.Nil(t, err)
+		return healthcheck
+	}
+
+	// edit changes the resources as if someone had used the console.
+	edit := func(healthCheckId, resourcePath string) {
+		_, err := route53Client.UpdateHealthCheck(&route53.UpdateHealthCheckInput{
+			HealthCheckId: aws.String(healthCheckId),
+			ResourcePath:  aws.String(resourcePath),
+		})
+		assert.Nil(t, err)
+
+		input := getAlarmInput(healthcheck, healthCheckId, true)
+		input.Threshold = aws.Float64(2)
+		_, err = cloudwatchClient.PutMetricAlarm(input)
+		assert.Nil(t, err)
+	}
+
+	healthcheck = reconcile()
+	assert.Empty(t, healthcheck.Status.Drift)
+	assert.Equal(t, int64(1), healthcheck.Status.ObservedGeneration)
+	assert.Equal(t, corev1.ConditionFalse, getCondition(healthcheck.Status.Conditions, healthcheckv1.ConditionDrifted).Status)
+	id := healthcheck.Status.HealthCheckId
+
+	// Changes made outside of the controller are reverted by default.
+	edit(id, "/console")
+
+	healthcheck = reconcile()
+	assert.Equal(t, []string{
+		`health_check.resource_path: "/console" != "/healthz"`,
+		"alarm.threshold: 2 != 1",
+	}, healthcheck.Status.Drift)
+	condition := getCondition(healthcheck.Status.Conditions, healthcheckv1.ConditionDrifted)
+	assert.Equal(t, corev1.ConditionTrue, condition.Status)
+	assert.Equal(t, "Corrected", condition.Reason)
+	assert.Contains(t, <-recorder.Events, "DriftCorrected")
+	assert.Equal(t, "/healthz", *route53Client.HealthChecks()[0].HealthCheckConfig.ResourcePath)
+	assert.Equal(t, float64(1), *cloudwatchClient.Alarms()[0].Threshold)
+
+	healthcheck = reconcile()
+	assert.Empty(t, healthcheck.Status.Drift)
+	assert.Equal(t, corev1.ConditionFalse, getCondition(healthcheck.Status.Conditions, healthcheckv1.ConditionDrifted).Status)
+	assert.Equal(t, 3, cloudwatchClient.Faults.Calls("PutMetricAlarm"), "the alarm is only put when it is created, edited or corrected")
+
+	// The report policy only records changes made outside of the controller.
+	healthcheck.Spec.DriftPolicy = healthcheckv1.DriftPolicyReport
+	healthcheck.ObjectMeta.Generation = 2
+	err = client.Update(context.TODO(), healthcheck)
+	assert.Nil(t, err)
+	healthcheck = reconcile()
+	assert.Empty(t, healthcheck.Status.Drift)
+
+	edit(id, "/console")
+
+	healthcheck = reconcile()
+	assert.Len(t, healthcheck.Status.Drift, 2)
+	assert.Equal(t, "Reported", getCondition(healthcheck.Status.Conditions, healthcheckv1.ConditionDrifted).Reason)
+	assert.Equal(t, "/console", *route53Client.HealthChecks()[0].HealthCheckConfig.ResourcePath)
+	assert.Equal(t, float64(2), *cloudwatchClient.Alarms()[0].Threshold)
+
+	// Changes to the spec are still applied.
+	healthcheck.Spec.ResourcePath = "/status"
+	healthcheck.ObjectMeta.Generation = 3
+	err = client.Update(context.TODO(), healthcheck)
+	assert.Nil(t, err)
+
+	healthcheck = reconcile()
+	assert.Empty(t, healthcheck.Status.Drift)
+	assert.Equal(t, int64(3), healthcheck.Status.ObservedGeneration)
+	assert.Equal(t, "/status", *route53Client.HealthChecks()[0].HealthCheckConfig.ResourcePath)
+	assert.Equal(t, float64(1), *cloudwatchClient.Alarms()[0].Threshold)
+}
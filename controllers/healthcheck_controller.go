@@ -17,27 +17,59 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
 	"github.com/aws/aws-sdk-go/service/route53"
 	"github.com/aws/aws-sdk-go/service/route53/route53iface"
 	"github.com/go-logr/logr"
 	"github.com/go-test/deep"
+	"github.com/prometheus/client_golang/prometheus"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	healthcheckv1 "github.com/skpr/r53-check/api/v1"
+	"github.com/skpr/r53-check/internal/cost"
+	"github.com/skpr/r53-check/internal/dryrun"
+	"github.com/skpr/r53-check/internal/prober"
+	"github.com/skpr/r53-check/internal/quota"
+	"github.com/skpr/r53-check/internal/scope"
+	"github.com/skpr/r53-check/internal/throttle"
 )
 
 const finalizerName = "healthcheck.route53.finalizers.skpr.io"
 
+// throttledRequeueAfter is the shortest time a throttled reconcile is requeued for.
+const throttledRequeueAfter = time.Second * 30
+
+// ThrottledRequeuesMetric counts the reconciles which were requeued because
+// AWS throttled them.
+const ThrottledRequeuesMetric = "r53_check_throttled_requeues_total"
+
+var throttledRequeues = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: ThrottledRequeuesMetric,
+	Help: "Reconciles which were requeued because AWS throttled them.",
+})
+
+func init() {
+	metrics.Registry.MustRegister(throttledRequeues)
+}
+
 // HealthCheckReconciler reconciles a HealthCheck object
 type HealthCheckReconciler struct {
 	client.Client
@@ -45,23 +77,91 @@ type HealthCheckReconciler struct {
 	Scheme           *runtime.Scheme
 	Route53Client    route53iface.Route53API
 	CloudwatchClient cloudwatchiface.CloudWatchAPI
+	Recorder         record.EventRecorder
+	// APIReader reads the signing keys of webhooks from the API server, so
+	// Secrets are not cached and watched. The client is used when nil.
+	APIReader client.Reader
+	// Prober performs checks for the incluster backend.
+	Prober *prober.Prober
+	// DryRun plans the AWS changes for every HealthCheck, without making them.
+	DryRun bool
+	// Account refuses to create health checks near the account limit. The
+	// limit is not checked when nil.
+	Account *quota.Account
+	// Admissions serializes the quota checks of each namespace. Concurrent
+	// reconciles may exceed a quota when nil.
+	Admissions *quota.Admissions
+	// PriceConfigMap holds the price table costs are estimated with. The list
+	// prices are used when it is not set.
+	PriceConfigMap types.NamespacedName
+	// Costs adds up the estimated costs of each namespace.
+	Costs *cost.Totals
+	// Scope selects the objects reconciled by this manager.
+	Scope *scope.Scope
+	// MaxConcurrentReconciles is the number of objects reconciled at once.
+	MaxConcurrentReconciles int
+
+	// plan records the changes made outside of AWS in dry-run mode.
+	plan *dryrun.Plan
 }
 
 // +kubebuilder:rbac:groups=route53.skpr.io,resources=healthchecks,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=route53.skpr.io,resources=healthchecks/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=route53.skpr.io,resources=healthcheckquotas,verbs=get;list;watch
+// +kubebuilder:rbac:groups=route53.skpr.io,resources=dnsrecords,verbs=get;list;watch
+// +kubebuilder:rbac:groups=apps,resources=deployments;statefulsets,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get
+// +kubebuilder:rbac:groups=monitoring.coreos.com,resources=prometheusrules,verbs=get;list;watch;create;update;patch;delete
 
 func (r *HealthCheckReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	result, err := r.reconcile(req)
+	if code, ok := throttle.ErrorCode(err); ok {
+		return r.requeueThrottled(req, code, err)
+	}
+	if isAWSErrorCode(err, route53.ErrCodeTooManyHealthChecks) {
+		err = &quota.ExceededError{Reason: quota.ReasonAccountLimit, Message: err.Error()}
+	}
+	var exceeded *quota.ExceededError
+	if errors.As(err, &exceeded) {
+		return r.requeueQuotaExceeded(req, exceeded)
+	}
+	return result, err
+}
+
+func (r *HealthCheckReconciler) reconcile(req ctrl.Request) (ctrl.Result, error) {
 	ctx := context.Background()
 
+	if ok, err := r.Scope.Contains(ctx, r, req.NamespacedName); !ok || err != nil {
+		// Another manager reconciles it.
+		if err == nil {
+			r.Costs.Delete(req.NamespacedName)
+		}
+		return ctrl.Result{}, err
+	}
+
 	healthCheck := &healthcheckv1.HealthCheck{}
 
 	if err := r.Get(ctx, req.NamespacedName, healthCheck); err != nil {
+		if apierrors.IsNotFound(err) {
+			r.Costs.Delete(req.NamespacedName)
+			r.Admissions.Forget(req.Namespace, req.Name)
+		}
 		// we'll ignore not-found errors, since they can't be fixed by an immediate
 		// requeue (we'll need to wait for a new notification), and we can get them
 		// on deleted requests.
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
+	dryRun := r.isDryRun(healthCheck)
+
+	plan := dryrun.NewPlan(r.Log.WithValues("healthcheck", req.NamespacedName))
+	if dryRun {
+		r = r.withPlan(plan)
+	}
+
 	if healthCheck.ObjectMeta.DeletionTimestamp.IsZero() {
 		// The health check is not being deleted. Register the finalizer.
 		if !containsString(healthCheck.ObjectMeta.Finalizers, finalizerName) {
@@ -71,10 +171,24 @@ func (r *HealthCheckReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error)
 			}
 		}
 	} else {
+		r.Costs.Delete(req.NamespacedName)
+		r.Admissions.Forget(req.Namespace, req.Name)
+
 		// The health check is being deleted. Handled external resources.
 		if containsString(healthCheck.ObjectMeta.Finalizers, finalizerName) {
+			if isPaused(healthCheck) {
+				// Nothing is deleted while paused, so the finalizer is kept
+				// until the annotation is removed.
+				return r.pauseDeletion(ctx, healthCheck)
+			}
+
+			if dryRun {
+				// Nothing is deleted, so the finalizer is kept.
+				return r.planDeletion(ctx, healthCheck, plan)
+			}
+
 			// our finalizer is present, so lets handle any external dependency
-			if err := r.deleteExternalResources(healthCheck); err != nil {
+			if err := r.deleteExternalResources(ctx, healthCheck); err != nil {
 				// if fail to delete the external dependency here, return with error
 				// so that it can be retried
 				return ctrl.Result{}, fmt.Errorf("failed to delete exeternal resources %w", err)
@@ -90,190 +204,177 @@ func (r *HealthCheckReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error)
 		return ctrl.Result{}, nil
 	}
 
-	healthCheckId, err := r.syncHealthCheck(healthCheck)
+	status := *healthCheck.Status.DeepCopy()
+
+	now := time.Now()
+
+	suppress, err := r.getSuppression(ctx, healthCheck, &status, now)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
 
-	alarmName, err := r.syncAlarm(healthCheck, healthCheckId)
+	if isPaused(healthCheck) {
+		// Someone is managing the health check by hand. Only refresh what we observe.
+		status.Conditions = setCondition(status.Conditions, healthcheckv1.ConditionPaused, corev1.ConditionTrue,
+			"Annotation", fmt.Sprintf("Reconciliation is paused by the %s annotation", healthcheckv1.AnnotationPaused))
+
+		err = r.getBackends().observe(ctx, healthCheck, &status)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	} else {
+		if condition := getCondition(status.Conditions, healthcheckv1.ConditionPaused); condition != nil && condition.Status == corev1.ConditionTrue {
+			r.Log.Info(fmt.Sprintf("Resuming reconciliation: %s", healthCheck.Name))
+		}
+		status.Conditions = setCondition(status.Conditions, healthcheckv1.ConditionPaused, corev1.ConditionFalse, "Reconciling", "")
+
+		disabled := healthCheck.Spec.Disabled || suppress.DisableCheck
+
+		err = r.checkQuota(ctx, healthCheck, &status)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+
+		// The backends record any drift they find.
+		status.Drift = nil
+
+		err = r.getBackends().ensure(ctx, healthCheck, &status, disabled, !suppress.DisableAlarmActions)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+
+		r.syncDrift(healthCheck, &status, dryRun)
+		status.ObservedGeneration = healthCheck.ObjectMeta.Generation
+
+		if getCondition(status.Conditions, healthcheckv1.ConditionThrottled) != nil {
+			status.Conditions = setCondition(status.Conditions, healthcheckv1.ConditionThrottled, corev1.ConditionFalse, "Reconciled", "")
+		}
+		if getCondition(status.Conditions, healthcheckv1.ConditionQuotaExceeded) != nil {
+			status.Conditions = setCondition(status.Conditions, healthcheckv1.ConditionQuotaExceeded, corev1.ConditionFalse, "WithinQuota", "")
+		}
+	}
+
+	status.PlannedChanges = nil
+	if dryRun {
+		// Nothing was created or applied, so only what was observed is recorded.
+		status.HealthCheckId = healthCheck.Status.HealthCheckId
+		status.ReplacedHealthCheckIds = healthCheck.Status.ReplacedHealthCheckIds
+		status.AlarmName = healthCheck.Status.AlarmName
+		status.AlarmTest = healthCheck.Status.AlarmTest
+		status.PrometheusRule = healthCheck.Status.PrometheusRule
+		status.ObservedGeneration = healthCheck.Status.ObservedGeneration
+		status.PlannedChanges = plan.Changes()
+	}
+
+	r.syncCost(ctx, healthCheck, &status)
+
+	err = r.syncUptime(healthCheck, &status, now)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
 
-	// Get alarm state.
-	alarmState, err := r.getAlarmState(alarmName)
+	err = r.syncIncidents(healthCheck, &status, now)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
 
-	err = r.syncStatus(healthCheck, healthcheckv1.HealthCheckStatus{
-		HealthCheckId: healthCheckId,
-		AlarmName:     alarmName,
-		AlarmState:    alarmState,
-	}, ctx)
+	err = r.syncStatus(healthCheck, status, ctx)
 	if err != nil {
 		return ctrl.Result{}, fmt.Errorf("failed to sync status %v %w", healthCheck, err)
 	}
 
 	result := ctrl.Result{
 		Requeue:      false,
-		RequeueAfter: time.Second * 30,
+		RequeueAfter: getRequeueAfter(suppress.Boundary, now),
 	}
 
 	return result, nil
 }
 
-// getAlarmState gets the current alarm state.
-func (r *HealthCheckReconciler) getAlarmState(alarmName string) (string, error) {
-	var alarmNames []*string
-	alarmNames = append(alarmNames, &alarmName)
-	output, err := r.CloudwatchClient.DescribeAlarms(&cloudwatch.DescribeAlarmsInput{
-		AlarmNames: alarmNames,
-		MaxRecords: aws.Int64(1),
-	})
-	if err != nil {
-		return "", err
-	}
-	for _, alarm := range output.MetricAlarms {
-		return *alarm.StateValue, nil
-	}
-	return "", nil
-}
+// requeueThrottled records that AWS throttled the reconcile, which is retried
+// later rather than reported as an error.
+func (r *HealthCheckReconciler) requeueThrottled(req ctrl.Request, code string, throttled error) (ctrl.Result, error) {
+	ctx := context.Background()
 
-// deleteExternalResources deletes external resources on health check deletion.
-func (r *HealthCheckReconciler) deleteExternalResources(healthCheck *healthcheckv1.HealthCheck) error {
-	err := r.deleteAlarm(healthCheck)
-	if err != nil {
-		return err
+	throttledRequeues.Inc()
+	r.Log.Info(fmt.Sprintf("Requeuing throttled reconcile: %s", req.NamespacedName), "code", code)
+
+	healthCheck := &healthcheckv1.HealthCheck{}
+	if err := r.Get(ctx, req.NamespacedName, healthCheck); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
-	err = r.deleteHealthCheck(healthCheck)
+
+	status := *healthCheck.Status.DeepCopy()
+	status.Conditions = setCondition(status.Conditions, healthcheckv1.ConditionThrottled, corev1.ConditionTrue, code, throttled.Error())
+
+	err := r.syncStatus(healthCheck, status, ctx)
 	if err != nil {
-		return err
+		return ctrl.Result{}, fmt.Errorf("failed to sync status %v %w", healthCheck, err)
 	}
 
-	return nil
+	// Requeues are spread out, so they are not throttled again.
+	return ctrl.Result{RequeueAfter: wait.Jitter(throttledRequeueAfter, 1.0)}, nil
 }
 
-// deleteAlarm deletes the alarms associated with the health check.
-func (r *HealthCheckReconciler) deleteHealthCheck(healthCheck *healthcheckv1.HealthCheck) error {
-	r.Log.Info(fmt.Sprintf("Deleting health check: %s", healthCheck.Status.HealthCheckId))
-	_, err := r.Route53Client.DeleteHealthCheck(&route53.DeleteHealthCheckInput{
-		HealthCheckId: &healthCheck.Status.HealthCheckId,
-	})
-	return err
+// isDryRun checks if AWS changes are planned, instead of made, for the health check.
+func (r *HealthCheckReconciler) isDryRun(healthCheck *healthcheckv1.HealthCheck) bool {
+	return r.DryRun || healthCheck.ObjectMeta.Annotations[healthcheckv1.AnnotationDryRun] == "true"
 }
 
-// syncStatus syncs the health check status.
-func (r *HealthCheckReconciler) syncStatus(healthCheck *healthcheckv1.HealthCheck, status healthcheckv1.HealthCheckStatus, ctx context.Context) error {
-	if diff := deep.Equal(healthCheck.Status, status); diff != nil {
-		r.Log.Info(fmt.Sprintf("Status change dectected: %s", diff))
-		healthCheck.Status = status
-		err := r.Status().Update(ctx, healthCheck)
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+// withPlan gets a copy of the reconciler which records mutating AWS calls in
+// the plan, instead of making them.
+func (r *HealthCheckReconciler) withPlan(plan *dryrun.Plan) *HealthCheckReconciler {
+	planner := *r
+	planner.Route53Client = dryrun.NewRoute53(r.Route53Client, plan)
+	planner.CloudwatchClient = dryrun.NewCloudWatch(r.CloudwatchClient, plan)
+	planner.plan = plan
+	return &planner
 }
 
-// syncHealthCheck syncs a health check.
-func (r *HealthCheckReconciler) syncHealthCheck(healthCheck *healthcheckv1.HealthCheck) (string, error) {
-	callerReference, err := getToken(healthCheck.ObjectMeta.UID)
-	if err != nil {
-		return "", err
-	}
+// planDeletion records the AWS calls which deleting the health check would make.
+func (r *HealthCheckReconciler) planDeletion(ctx context.Context, healthCheck *healthcheckv1.HealthCheck, plan *dryrun.Plan) (ctrl.Result, error) {
+	status := *healthCheck.Status.DeepCopy()
 
-	output, err := r.Route53Client.CreateHealthCheck(&route53.CreateHealthCheckInput{
-		CallerReference: &callerReference,
-		HealthCheckConfig: &route53.HealthCheckConfig{
-			Type:                     &healthCheck.Spec.Type,
-			FullyQualifiedDomainName: &healthCheck.Spec.Domain,
-			Port:                     &healthCheck.Spec.Port,
-			ResourcePath:             &healthCheck.Spec.ResourcePath,
-			EnableSNI:                aws.Bool(true),
-			Disabled:                 &healthCheck.Spec.Disabled,
-		},
-	})
+	err := r.getBackends().delete(ctx, healthCheck, healthCheck.Status.DeepCopy())
 	if err != nil {
-		return "", err
+		return ctrl.Result{}, err
 	}
+	status.PlannedChanges = plan.Changes()
 
-	// Health Check 'Name' is a tag.
-	healthCheckId := *output.HealthCheck.Id
-	_, err = r.Route53Client.ChangeTagsForResource(&route53.ChangeTagsForResourceInput{
-		AddTags: []*route53.Tag{
-			{Key: aws.String("Name"), Value: aws.String(getHealthCheckName(healthCheck))},
-		},
-		ResourceId:   &healthCheckId,
-		ResourceType: aws.String(route53.TagResourceTypeHealthcheck),
-	})
+	err = r.syncStatus(healthCheck, status, ctx)
 	if err != nil {
-		return "", err
+		return ctrl.Result{}, fmt.Errorf("failed to sync status %v %w", healthCheck, err)
 	}
-	return healthCheckId, nil
-}
 
-// syncAlarm syncs the health check alarm.
-func (r *HealthCheckReconciler) syncAlarm(healthCheck *healthcheckv1.HealthCheck, healthCheckId string) (string, error) {
-	var (
-		alarmName string
-		err       error
-	)
-	if healthCheck.Spec.AlarmDisabled {
-		err = r.deleteAlarm(healthCheck)
-	} else {
-		alarmName, err = r.createAlarm(healthCheck, healthCheckId)
-	}
-	if err != nil {
-		return "", err
-	}
-	return alarmName, nil
+	return ctrl.Result{RequeueAfter: getRequeueAfter(time.Time{}, time.Now())}, nil
 }
 
-// createAlarm creates an alarm for the health check.
-func (r *HealthCheckReconciler) createAlarm(healthCheck *healthcheckv1.HealthCheck, healthCheckId string) (string, error) {
+// pauseDeletion records that deleting the health check waits for the paused
+// annotation to be removed.
+func (r *HealthCheckReconciler) pauseDeletion(ctx context.Context, healthCheck *healthcheckv1.HealthCheck) (ctrl.Result, error) {
+	status := *healthCheck.Status.DeepCopy()
+	status.Conditions = setCondition(status.Conditions, healthcheckv1.ConditionPaused, corev1.ConditionTrue,
+		"Annotation", fmt.Sprintf("Deletion is paused by the %s annotation", healthcheckv1.AnnotationPaused))
 
-	var alarmActions, okActions []*string
-	for _, action := range healthCheck.Spec.AlarmActions {
-		alarmActions = append(alarmActions, &action)
-	}
-	for _, action := range healthCheck.Spec.OKActions {
-		okActions = append(okActions, &action)
-	}
-	_, err := r.CloudwatchClient.PutMetricAlarm(&cloudwatch.PutMetricAlarmInput{
-		AlarmName:          aws.String(getAlarmName(healthCheck)),
-		AlarmDescription:   aws.String("Route53 HealthCheck alarm for " + getHealthCheckName(healthCheck)),
-		AlarmActions:       alarmActions,
-		OKActions:          okActions,
-		Period:             aws.Int64(60),
-		EvaluationPeriods:  aws.Int64(1),
-		Threshold:          aws.Float64(1.0),
-		ComparisonOperator: aws.String("LessThanThreshold"),
-		Namespace:          aws.String("AWS/Route53"),
-		MetricName:         aws.String("HealthCheckStatus"),
-		Statistic:          aws.String("Minimum"),
-		Dimensions: []*cloudwatch.Dimension{
-			{
-				Name:  aws.String("HealthCheckId"),
-				Value: aws.String(healthCheckId),
-			},
-		},
-	})
+	err := r.syncStatus(healthCheck, status, ctx)
 	if err != nil {
-		return "", err
+		return ctrl.Result{}, fmt.Errorf("failed to sync status %v %w", healthCheck, err)
 	}
-	return getAlarmName(healthCheck), nil
+
+	return ctrl.Result{}, nil
 }
 
-// deleteAlarm deletes the alarms associated with the health check.
-func (r *HealthCheckReconciler) deleteAlarm(healthCheck *healthcheckv1.HealthCheck) error {
-	if healthCheck.Status.AlarmName != "" {
-		r.Log.Info(fmt.Sprintf("Deleting alarm: %s", healthCheck.Status.AlarmName))
-		var alarmNames []*string
-		alarmNames = append(alarmNames, &healthCheck.Status.AlarmName)
-		_, err := r.CloudwatchClient.DeleteAlarms(&cloudwatch.DeleteAlarmsInput{
-			AlarmNames: alarmNames,
-		})
+// deleteExternalResources deletes external resources on health check deletion.
+func (r *HealthCheckReconciler) deleteExternalResources(ctx context.Context, healthCheck *healthcheckv1.HealthCheck) error {
+	return r.getBackends().delete(ctx, healthCheck, &healthCheck.Status)
+}
+
+// syncStatus syncs the health check status.
+func (r *HealthCheckReconciler) syncStatus(healthCheck *healthcheckv1.HealthCheck, status healthcheckv1.HealthCheckStatus, ctx context.Context) error {
+	if diff := deep.Equal(healthCheck.Status, status); diff != nil {
+		r.Log.Info(fmt.Sprintf("Status change dectected: %s", diff))
+		healthCheck.Status = status
+		err := r.Status().Update(ctx, healthCheck)
 		if err != nil {
 			return err
 		}
@@ -282,9 +383,37 @@ func (r *HealthCheckReconciler) deleteAlarm(healthCheck *healthcheckv1.HealthChe
 }
 
 func (r *HealthCheckReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	err := mgr.GetFieldIndexer().IndexField(&healthcheckv1.HealthCheck{}, workloadIndexKey, indexWorkload)
+	if err != nil {
+		return err
+	}
+
+	builder := ctrl.NewControllerManagedBy(mgr).
 		For(&healthcheckv1.HealthCheck{}).
-		Complete(r)
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
+		Watches(&source.Kind{Type: &appsv1.Deployment{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: r.mapWorkload(healthcheckv1.WorkloadKindDeployment),
+		}).
+		Watches(&source.Kind{Type: &appsv1.StatefulSet{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: r.mapWorkload(healthcheckv1.WorkloadKindStatefulSet),
+		}).
+		Watches(&source.Kind{Type: &corev1.Namespace{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(r.mapNamespace),
+		})
+
+	// Estimate costs again when the price table changes.
+	if r.PriceConfigMap.Name != "" {
+		builder = builder.Watches(&source.Kind{Type: &corev1.ConfigMap{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(r.mapPrices),
+		})
+	}
+
+	// Update the status when the health reported by the prober changes.
+	if r.Prober != nil {
+		builder = builder.Watches(&source.Channel{Source: r.Prober.Events}, &handler.EnqueueRequestForObject{})
+	}
+
+	return builder.Complete(r)
 }
 
 // GetToken converts a Kubernetes UID into a 32 character which can be used as a token.
@@ -299,6 +428,32 @@ func getToken(uid types.UID) (string, error) {
 	return token, nil
 }
 
+// isAWSErrorCode checks if the error is an AWS error with the code.
+func isAWSErrorCode(err error, code string) bool {
+	if aerr, ok := err.(awserr.Error); ok {
+		return aerr.Code() == code
+	}
+	return false
+}
+
+// recordEvent records an event, when there is a recorder.
+func recordEvent(recorder record.EventRecorder, object runtime.Object, eventType, reason, messageFmt string, args ...interface{}) {
+	if recorder == nil {
+		return
+	}
+	recorder.Eventf(object, eventType, reason, messageFmt, args...)
+}
+
+// recordWarning records a warning event, when there is a recorder.
+func recordWarning(recorder record.EventRecorder, object runtime.Object, reason, messageFmt string, args ...interface{}) {
+	recordEvent(recorder, object, corev1.EventTypeWarning, reason, messageFmt, args...)
+}
+
+// isPaused checks if reconciliation has been paused by annotation.
+func isPaused(healthCheck *healthcheckv1.HealthCheck) bool {
+	return healthCheck.ObjectMeta.Annotations[healthcheckv1.AnnotationPaused] == "true"
+}
+
 // getHealthCheckName gets the healthcheck name.
 func getHealthCheckName(healthCheck *healthcheckv1.HealthCheck) string {
 	return healthCheck.Spec.NamePrefix + "-" + healthCheck.Name
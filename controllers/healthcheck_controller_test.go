@@ -1,13 +1,21 @@
 package controllers
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"k8s.io/client-go/kubernetes/scheme"
 	"testing"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
 	healthcheckv1 "github.com/skpr/r53-check/api/v1"
-	"github.com/skpr/r53-check/controllers/mock"
+	"github.com/skpr/r53-check/internal/awsfake"
+	"github.com/skpr/r53-check/internal/scope"
 	"github.com/stretchr/testify/assert"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -20,28 +28,15 @@ func TestReconcile(t *testing.T) {
 	assert.Nil(t, err)
 
 	logger := zap.New()
-	route53Client := mock.NewMockRoute53Client()
-	cloudwatchClient := mock.NewMockCloudwatchClient()
+	route53Client := awsfake.NewRoute53()
+	cloudwatchClient := awsfake.NewCloudWatch()
 
 	var actions []string
 	actions = append(actions, "example.action.arn")
 
-	healthcheck := &healthcheckv1.HealthCheck{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      "test",
-			Namespace: corev1.NamespaceDefault,
-			UID:       types.UID("xxxxxxxxxxxxxxxxxxxxxxxxxxx"),
-		},
-		Spec: healthcheckv1.HealthCheckSpec{
-			NamePrefix:   "example-site.prod",
-			Domain:       "test.example.skpr.io",
-			Type:         "HTTPS",
-			Port:         443,
-			ResourcePath: "/healthz",
-			AlarmActions: actions,
-			OKActions:    actions,
-		},
-	}
+	healthcheck := newTestHealthCheck()
+	healthcheck.Spec.AlarmActions = actions
+	healthcheck.Spec.OKActions = actions
 
 	client := fake.NewFakeClientWithScheme(scheme.Scheme, healthcheck)
 
@@ -65,3 +60,457 @@ func TestReconcile(t *testing.T) {
 	assert.Nil(t, err)
 
 }
+
+func TestReconcilePaused(t *testing.T) {
+	err := healthcheckv1.AddToScheme(scheme.Scheme)
+	assert.Nil(t, err)
+
+	healthcheck := newTestHealthCheck()
+	healthcheck.ObjectMeta.Annotations = map[string]string{healthcheckv1.AnnotationPaused: "true"}
+
+	client := fake.NewFakeClientWithScheme(scheme.Scheme, healthcheck)
+	route53Client := awsfake.NewRoute53()
+
+	reconciler := HealthCheckReconciler{
+		Client:           client,
+		Log:              zap.New(),
+		Scheme:           scheme.Scheme,
+		Route53Client:    route53Client,
+		CloudwatchClient: awsfake.NewCloudWatch(),
+	}
+
+	query := types.NamespacedName{
+		Name:      healthcheck.ObjectMeta.Name,
+		Namespace: healthcheck.ObjectMeta.Namespace,
+	}
+
+	_, err = reconciler.Reconcile(ctrl.Request{
+		NamespacedName: query,
+	})
+	assert.Nil(t, err)
+
+	err = client.Get(context.TODO(), query, healthcheck)
+	assert.Nil(t, err)
+	assert.Empty(t, healthcheck.Status.HealthCheckId, "no health check is created while paused")
+	assert.Empty(t, route53Client.HealthChecks())
+
+	condition := getCondition(healthcheck.Status.Conditions, healthcheckv1.ConditionPaused)
+	assert.NotNil(t, condition)
+	assert.Equal(t, corev1.ConditionTrue, condition.Status)
+
+	// Removing the annotation resumes reconciliation.
+	healthcheck.ObjectMeta.Annotations = nil
+	err = client.Update(context.TODO(), healthcheck)
+	assert.Nil(t, err)
+
+	_, err = reconciler.Reconcile(ctrl.Request{
+		NamespacedName: query,
+	})
+	assert.Nil(t, err)
+
+	err = client.Get(context.TODO(), query, healthcheck)
+	assert.Nil(t, err)
+	if assert.Len(t, route53Client.HealthChecks(), 1) {
+		assert.Equal(t, aws.StringValue(route53Client.HealthChecks()[0].Id), healthcheck.Status.HealthCheckId)
+	}
+	assert.Equal(t, corev1.ConditionFalse, getCondition(healthcheck.Status.Conditions, healthcheckv1.ConditionPaused).Status)
+}
+
+func TestReconcilePausedDeletion(t *testing.T) {
+	err := healthcheckv1.AddToScheme(scheme.Scheme)
+	assert.Nil(t, err)
+
+	healthcheck := newTestHealthCheck()
+
+	client := fake.NewFakeClientWithScheme(scheme.Scheme, healthcheck)
+	route53Client := awsfake.NewRoute53()
+	cloudwatchClient := awsfake.NewCloudWatch()
+
+	reconciler := HealthCheckReconciler{
+		Client:           client,
+		Log:              zap.New(),
+		Scheme:           scheme.Scheme,
+		Route53Client:    route53Client,
+		CloudwatchClient: cloudwatchClient,
+	}
+
+	query := types.NamespacedName{
+		Name:      healthcheck.ObjectMeta.Name,
+		Namespace: healthcheck.ObjectMeta.Namespace,
+	}
+
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+
+	// Deleting a paused HealthCheck keeps the health check and alarm.
+	healthcheck = &healthcheckv1.HealthCheck{}
+	err = client.Get(context.TODO(), query, healthcheck)
+	assert.Nil(t, err)
+	healthcheck.ObjectMeta.Annotations = map[string]string{healthcheckv1.AnnotationPaused: "true"}
+	now := metav1.Now()
+	healthcheck.ObjectMeta.DeletionTimestamp = &now
+	err = client.Update(context.TODO(), healthcheck)
+	assert.Nil(t, err)
+
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+	assert.Len(t, route53Client.HealthChecks(), 1)
+	assert.Len(t, cloudwatchClient.Alarms(), 1)
+
+	healthcheck = &healthcheckv1.HealthCheck{}
+	err = client.Get(context.TODO(), query, healthcheck)
+	assert.Nil(t, err)
+	assert.Contains(t, healthcheck.ObjectMeta.Finalizers, finalizerName)
+	condition := getCondition(healthcheck.Status.Conditions, healthcheckv1.ConditionPaused)
+	assert.Equal(t, corev1.ConditionTrue, condition.Status)
+	assert.Equal(t, "Deletion is paused by the route53.skpr.io/paused annotation", condition.Message)
+
+	// Removing the annotation deletes them.
+	healthcheck.ObjectMeta.Annotations = nil
+	err = client.Update(context.TODO(), healthcheck)
+	assert.Nil(t, err)
+
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+	assert.Empty(t, route53Client.HealthChecks())
+	assert.Empty(t, cloudwatchClient.Alarms())
+}
+
+func TestReconcileLifecycle(t *testing.T) {
+	err := healthcheckv1.AddToScheme(scheme.Scheme)
+	assert.Nil(t, err)
+
+	healthcheck := newTestHealthCheck()
+
+	client := fake.NewFakeClientWithScheme(scheme.Scheme, healthcheck)
+	route53Client := awsfake.NewRoute53()
+	cloudwatchClient := awsfake.NewCloudWatch()
+
+	reconciler := HealthCheckReconciler{
+		Client:           client,
+		Log:              zap.New(),
+		Scheme:           scheme.Scheme,
+		Route53Client:    route53Client,
+		CloudwatchClient: cloudwatchClient,
+	}
+
+	query := types.NamespacedName{
+		Name:      healthcheck.ObjectMeta.Name,
+		Namespace: healthcheck.ObjectMeta.Namespace,
+	}
+
+	// Reconciling twice must not create duplicate resources.
+	for i := 0; i < 2; i++ {
+		_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+		assert.Nil(t, err)
+	}
+	assert.Len(t, route53Client.HealthChecks(), 1)
+	assert.Len(t, cloudwatchClient.Alarms(), 1)
+	assert.Equal(t, 1, route53Client.Faults.Calls("CreateHealthCheck"))
+	assert.Equal(t, 0, route53Client.Faults.Calls("UpdateHealthCheck"))
+
+	// The alarm state is reported in the status.
+	err = cloudwatchClient.TransitionAlarm(getAlarmName(healthcheck), "ALARM", "Threshold Crossed")
+	assert.Nil(t, err)
+
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+
+	healthcheck = &healthcheckv1.HealthCheck{}
+	err = client.Get(context.TODO(), query, healthcheck)
+	assert.Nil(t, err)
+	assert.Equal(t, "ALARM", healthcheck.Status.AlarmState)
+
+	// Changes to the spec update the existing health check.
+	healthcheck.Spec.ResourcePath = "/status"
+	err = client.Update(context.TODO(), healthcheck)
+	assert.Nil(t, err)
+
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+	assert.Len(t, route53Client.HealthChecks(), 1)
+	assert.Equal(t, "/status", *route53Client.HealthChecks()[0].HealthCheckConfig.ResourcePath)
+	assert.Equal(t, int64(2), *route53Client.HealthChecks()[0].HealthCheckVersion)
+
+	// Deleting the HealthCheck deletes the external resources.
+	healthcheck = &healthcheckv1.HealthCheck{}
+	err = client.Get(context.TODO(), query, healthcheck)
+	assert.Nil(t, err)
+	now := metav1.Now()
+	healthcheck.ObjectMeta.DeletionTimestamp = &now
+	err = client.Update(context.TODO(), healthcheck)
+	assert.Nil(t, err)
+
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+	assert.Empty(t, route53Client.HealthChecks())
+	assert.Empty(t, cloudwatchClient.Alarms())
+}
+
+func TestReconcileDryRun(t *testing.T) {
+	err := healthcheckv1.AddToScheme(scheme.Scheme)
+	assert.Nil(t, err)
+
+	healthcheck := newTestHealthCheck()
+	healthcheck.ObjectMeta.Annotations = map[string]string{healthcheckv1.AnnotationDryRun: "true"}
+
+	client := fake.NewFakeClientWithScheme(scheme.Scheme, healthcheck)
+	route53Client := awsfake.NewRoute53()
+	cloudwatchClient := awsfake.NewCloudWatch()
+
+	reconciler := HealthCheckReconciler{
+		Client:           client,
+		Log:              zap.New(),
+		Scheme:           scheme.Scheme,
+		Route53Client:    route53Client,
+		CloudwatchClient: cloudwatchClient,
+	}
+
+	query := types.NamespacedName{
+		Name:      healthcheck.ObjectMeta.Name,
+		Namespace: healthcheck.ObjectMeta.Namespace,
+	}
+
+	// reconcile reconciles the HealthCheck and gets the result.
+	reconcile := func() *healthcheckv1.HealthCheck {
+		_, err := reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+		assert.Nil(t, err)
+
+		healthcheck := &healthcheckv1.HealthCheck{}
+		err = client.Get(context.TODO(), query, healthcheck)
+		assert.Nil(t, err)
+		return healthcheck
+	}
+
+	// operations gets the operations of the planned changes.
+	operations := func(healthcheck *healthcheckv1.HealthCheck) []string {
+		var operations []string
+		for _, change := range healthcheck.Status.PlannedChanges {
+			operations = append(operations, strings.Fields(change)[0])
+		}
+		return operations
+	}
+
+	// Creating the health check and alarm is planned.
+	healthcheck = reconcile()
+	assert.Empty(t, route53Client.HealthChecks())
+	assert.Empty(t, cloudwatchClient.Alarms())
+	assert.Empty(t, healthcheck.Status.HealthCheckId)
+	assert.Empty(t, healthcheck.Status.AlarmName)
+	assert.Equal(t, []string{
+		"Route53.CreateHealthCheck",
+		"Route53.ChangeTagsForResource",
+		"CloudWatch.PutMetricAlarm",
+	}, operations(healthcheck))
+	assert.Contains(t, healthcheck.Status.PlannedChanges[0], `ResourcePath: "/healthz"`)
+
+	// The changes are made once the annotation is removed.
+	delete(healthcheck.ObjectMeta.Annotations, healthcheckv1.AnnotationDryRun)
+	err = client.Update(context.TODO(), healthcheck)
+	assert.Nil(t, err)
+
+	healthcheck = reconcile()
+	assert.Len(t, route53Client.HealthChecks(), 1)
+	assert.Len(t, cloudwatchClient.Alarms(), 1)
+	assert.Empty(t, healthcheck.Status.PlannedChanges)
+
+	// Updates are planned by the manager flag, while what is read is still reported.
+	reconciler.DryRun = true
+	healthcheck.Spec.ResourcePath = "/status"
+	err = client.Update(context.TODO(), healthcheck)
+	assert.Nil(t, err)
+	err = cloudwatchClient.TransitionAlarm(getAlarmName(healthcheck), cloudwatch.StateValueAlarm, "Threshold Crossed")
+	assert.Nil(t, err)
+
+	healthcheck = reconcile()
+	assert.Equal(t, []string{"Route53.UpdateHealthCheck"}, operations(healthcheck))
+	assert.Equal(t, "/healthz", *route53Client.HealthChecks()[0].HealthCheckConfig.ResourcePath)
+	assert.Equal(t, cloudwatch.StateValueAlarm, healthcheck.Status.AlarmState)
+	assert.NotEmpty(t, healthcheck.Status.HealthCheckId)
+
+	// Deleting is planned, and the finalizer is kept.
+	now := metav1.Now()
+	healthcheck.ObjectMeta.DeletionTimestamp = &now
+	err = client.Update(context.TODO(), healthcheck)
+	assert.Nil(t, err)
+
+	healthcheck = reconcile()
+	assert.Contains(t, healthcheck.ObjectMeta.Finalizers, finalizerName)
+	assert.Equal(t, []string{"CloudWatch.DeleteAlarms", "Route53.DeleteHealthCheck"}, operations(healthcheck))
+	assert.Len(t, route53Client.HealthChecks(), 1)
+	assert.Len(t, cloudwatchClient.Alarms(), 1)
+}
+
+func TestReconcileDryRunAlerters(t *testing.T) {
+	err := healthcheckv1.AddToScheme(scheme.Scheme)
+	assert.Nil(t, err)
+
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer server.Close()
+
+	healthcheck := newTestHealthCheck()
+	healthcheck.ObjectMeta.Annotations = map[string]string{healthcheckv1.AnnotationDryRun: "true"}
+	healthcheck.Spec.Alerters = []healthcheckv1.AlerterType{healthcheckv1.AlerterCloudWatch, healthcheckv1.AlerterPrometheus}
+	healthcheck.Spec.Webhooks = []healthcheckv1.WebhookSink{{Name: "pager", URL: server.URL}}
+
+	client := fake.NewFakeClientWithScheme(scheme.Scheme, healthcheck)
+	route53Client := awsfake.NewRoute53()
+	cloudwatchClient := awsfake.NewCloudWatch()
+
+	reconciler := HealthCheckReconciler{
+		Client:           client,
+		Log:              zap.New(),
+		Scheme:           scheme.Scheme,
+		Route53Client:    route53Client,
+		CloudwatchClient: cloudwatchClient,
+	}
+
+	query := types.NamespacedName{
+		Name:      healthcheck.ObjectMeta.Name,
+		Namespace: healthcheck.ObjectMeta.Namespace,
+	}
+
+	// The planned health check is not read, and the PrometheusRule is planned.
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+
+	healthcheck = &healthcheckv1.HealthCheck{}
+	err = client.Get(context.TODO(), query, healthcheck)
+	assert.Nil(t, err)
+	assert.Contains(t, healthcheck.Status.PlannedChanges, "Kubernetes.CreatePrometheusRule default/test-healthcheck")
+	assert.Empty(t, healthcheck.Status.PrometheusRule)
+
+	rule := newPrometheusRule()
+	err = client.Get(context.TODO(), types.NamespacedName{Namespace: query.Namespace, Name: "test-healthcheck"}, rule)
+	assert.True(t, errors.IsNotFound(err))
+
+	// Once created, notifications are planned rather than sent.
+	delete(healthcheck.ObjectMeta.Annotations, healthcheckv1.AnnotationDryRun)
+	err = client.Update(context.TODO(), healthcheck)
+	assert.Nil(t, err)
+
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+
+	reconciler.DryRun = true
+	err = cloudwatchClient.TransitionAlarm(getAlarmName(healthcheck), cloudwatch.StateValueAlarm, "Threshold Crossed")
+	assert.Nil(t, err)
+
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+
+	healthcheck = &healthcheckv1.HealthCheck{}
+	err = client.Get(context.TODO(), query, healthcheck)
+	assert.Nil(t, err)
+	assert.Contains(t, healthcheck.Status.PlannedChanges, "Webhook.POST pager "+server.URL+" INSUFFICIENT_DATA -> ALARM")
+	assert.Empty(t, healthcheck.Status.WebhookDeliveries)
+	assert.Equal(t, 0, requests)
+}
+
+func TestReconcileThrottled(t *testing.T) {
+	err := healthcheckv1.AddToScheme(scheme.Scheme)
+	assert.Nil(t, err)
+
+	healthcheck := newTestHealthCheck()
+
+	client := fake.NewFakeClientWithScheme(scheme.Scheme, healthcheck)
+	route53Client := awsfake.NewRoute53()
+
+	reconciler := HealthCheckReconciler{
+		Client:           client,
+		Log:              zap.New(),
+		Scheme:           scheme.Scheme,
+		Route53Client:    route53Client,
+		CloudwatchClient: awsfake.NewCloudWatch(),
+	}
+
+	query := types.NamespacedName{
+		Name:      healthcheck.ObjectMeta.Name,
+		Namespace: healthcheck.ObjectMeta.Namespace,
+	}
+
+	// Throttled reconciles are requeued rather than failing.
+	route53Client.Faults.Throttle("CreateHealthCheck", "Throttling", 1)
+	result, err := reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+	assert.True(t, result.RequeueAfter >= throttledRequeueAfter)
+
+	healthcheck = &healthcheckv1.HealthCheck{}
+	err = client.Get(context.TODO(), query, healthcheck)
+	assert.Nil(t, err)
+	assert.Empty(t, healthcheck.Status.HealthCheckId)
+	condition := getCondition(healthcheck.Status.Conditions, healthcheckv1.ConditionThrottled)
+	assert.Equal(t, corev1.ConditionTrue, condition.Status)
+	assert.Equal(t, "Throttling", condition.Reason)
+
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+
+	healthcheck = &healthcheckv1.HealthCheck{}
+	err = client.Get(context.TODO(), query, healthcheck)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, healthcheck.Status.HealthCheckId)
+	condition = getCondition(healthcheck.Status.Conditions, healthcheckv1.ConditionThrottled)
+	assert.Equal(t, corev1.ConditionFalse, condition.Status)
+	assert.Equal(t, "Reconciled", condition.Reason)
+}
+
+func TestReconcileOutOfScope(t *testing.T) {
+	err := healthcheckv1.AddToScheme(scheme.Scheme)
+	assert.Nil(t, err)
+
+	healthcheck := newTestHealthCheck()
+
+	client := fake.NewFakeClientWithScheme(scheme.Scheme, healthcheck)
+	route53Client := awsfake.NewRoute53()
+
+	otherTenant, err := scope.New([]string{"tenant"}, "", 0, 1)
+	assert.Nil(t, err)
+
+	reconciler := HealthCheckReconciler{
+		Client:           client,
+		Log:              zap.New(),
+		Scheme:           scheme.Scheme,
+		Route53Client:    route53Client,
+		CloudwatchClient: awsfake.NewCloudWatch(),
+		Scope:            otherTenant,
+	}
+
+	query := types.NamespacedName{
+		Name:      healthcheck.ObjectMeta.Name,
+		Namespace: healthcheck.ObjectMeta.Namespace,
+	}
+
+	// HealthChecks reconciled by another manager are left alone.
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+	assert.Empty(t, route53Client.HealthChecks())
+
+	healthcheck = &healthcheckv1.HealthCheck{}
+	err = client.Get(context.TODO(), query, healthcheck)
+	assert.Nil(t, err)
+	assert.Empty(t, healthcheck.ObjectMeta.Finalizers)
+}
+
+// newTestHealthCheck gets the HealthCheck which the tests reconcile, for each
+// test to change as it needs.
+func newTestHealthCheck() *healthcheckv1.HealthCheck {
+	return &healthcheckv1.HealthCheck{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "test",
+			Namespace:  corev1.NamespaceDefault,
+			UID:        types.UID("xxxxxxxxxxxxxxxxxxxxxxxxxxx"),
+			Generation: 1,
+		},
+		Spec: healthcheckv1.HealthCheckSpec{
+			NamePrefix:   "example-site.prod",
+			Domain:       "test.example.skpr.io",
+			Type:         "HTTPS",
+			Port:         443,
+			ResourcePath: "/healthz",
+		},
+	}
+}
@@ -0,0 +1,225 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/route53"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	healthcheckv1 "github.com/skpr/r53-check/api/v1"
+	"github.com/skpr/r53-check/internal/awsfake"
+)
+
+const (
+	timeout  = time.Second * 10
+	interval = time.Millisecond * 250
+)
+
+// getLiveHealthCheck gets a health check from the fake, or nil.
+func getLiveHealthCheck(id string) *route53.HealthCheck {
+	for _, healthCheck := range route53Fake.HealthChecks() {
+		if *healthCheck.Id == id {
+			return healthCheck
+		}
+	}
+	return nil
+}
+
+// getLiveAlarm gets an alarm from the fake, or nil.
+func getLiveAlarm(name string) *cloudwatch.MetricAlarm {
+	for _, alarm := range cloudwatchFake.Alarms() {
+		if *alarm.AlarmName == name {
+			return alarm
+		}
+	}
+	return nil
+}
+
+// getConditionStatus gets the status of a condition, or "" when it is not set.
+func getConditionStatus(healthCheck *healthcheckv1.HealthCheck, conditionType string) corev1.ConditionStatus {
+	condition := getCondition(healthCheck.Status.Conditions, conditionType)
+	if condition == nil {
+		return ""
+	}
+	return condition.Status
+}
+
+// touch changes an annotation so the HealthCheck is reconciled again.
+func touch(key types.NamespacedName) {
+	healthCheck := &healthcheckv1.HealthCheck{}
+	Expect(k8sClient.Get(context.Background(), key, healthCheck)).To(Succeed())
+	if healthCheck.ObjectMeta.Annotations == nil {
+		healthCheck.ObjectMeta.Annotations = make(map[string]string)
+	}
+	healthCheck.ObjectMeta.Annotations["test.skpr.io/touched"] = time.Now().Format(time.RFC3339Nano)
+	Expect(k8sClient.Update(context.Background(), healthCheck)).To(Succeed())
+}
+
+var _ = Describe("HealthCheck lifecycle", func() {
+	ctx := context.Background()
+
+	newHealthCheck := func(name string) *healthcheckv1.HealthCheck {
+		return &healthcheckv1.HealthCheck{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: corev1.NamespaceDefault,
+			},
+			Spec: healthcheckv1.HealthCheckSpec{
+				NamePrefix:   "example-site.prod",
+				Domain:       "test.example.skpr.io",
+				Type:         "HTTPS",
+				Port:         443,
+				ResourcePath: "/healthz",
+				AlarmActions: []string{"arn:aws:sns:us-east-1:123456789012:alarm"},
+				OKActions:    []string{"arn:aws:sns:us-east-1:123456789012:ok"},
+			},
+		}
+	}
+
+	// fetch gets the HealthCheck, failing the spec if it does not exist.
+	fetch := func(key types.NamespacedName) func() *healthcheckv1.HealthCheck {
+		return func() *healthcheckv1.HealthCheck {
+			healthCheck := &healthcheckv1.HealthCheck{}
+			Expect(k8sClient.Get(ctx, key, healthCheck)).To(Succeed())
+			return healthCheck
+		}
+	}
+
+	It("creates, updates, toggles alarms and deletes", func() {
+		key := types.NamespacedName{Name: "lifecycle", Namespace: corev1.NamespaceDefault}
+		Expect(k8sClient.Create(ctx, newHealthCheck(key.Name))).To(Succeed())
+
+		By("creating the health check and alarm")
+		Eventually(func() string {
+			return fetch(key)().Status.AlarmName
+		}, timeout, interval).ShouldNot(BeEmpty())
+
+		healthCheck := fetch(key)()
+		Expect(healthCheck.ObjectMeta.Finalizers).To(ContainElement(finalizerName))
+		Expect(healthCheck.Status.HealthCheckId).NotTo(BeEmpty())
+		Expect(healthCheck.Status.AlarmName).To(Equal(getAlarmName(healthCheck)))
+		Expect(healthCheck.Status.AlarmState).To(Equal(cloudwatch.StateValueInsufficientData))
+		Expect(getConditionStatus(healthCheck, healthcheckv1.ConditionPaused)).To(Equal(corev1.ConditionFalse))
+		Expect(getConditionStatus(healthCheck, healthcheckv1.ConditionAlarmSuppressed)).To(Equal(corev1.ConditionFalse))
+
+		id := healthCheck.Status.HealthCheckId
+		live := getLiveHealthCheck(id)
+		Expect(live).NotTo(BeNil())
+		Expect(*live.HealthCheckConfig.FullyQualifiedDomainName).To(Equal("test.example.skpr.io"))
+		Expect(*live.HealthCheckConfig.ResourcePath).To(Equal("/healthz"))
+
+		alarm := getLiveAlarm(healthCheck.Status.AlarmName)
+		Expect(alarm).NotTo(BeNil())
+		Expect(*alarm.ActionsEnabled).To(BeTrue())
+
+		By("updating the health check when the spec changes")
+		healthCheck.Spec.ResourcePath = "/status"
+		Expect(k8sClient.Update(ctx, healthCheck)).To(Succeed())
+
+		Eventually(func() string {
+			return *getLiveHealthCheck(id).HealthCheckConfig.ResourcePath
+		}, timeout, interval).Should(Equal("/status"))
+		Expect(fetch(key)().Status.HealthCheckId).To(Equal(id), "the health check is updated in place")
+
+		By("reporting alarm state transitions")
+		Expect(cloudwatchFake.TransitionAlarm(healthCheck.Status.AlarmName, cloudwatch.StateValueAlarm, "Threshold Crossed")).To(Succeed())
+		touch(key)
+
+		Eventually(func() string {
+			return fetch(key)().Status.AlarmState
+		}, timeout, interval).Should(Equal(cloudwatch.StateValueAlarm))
+
+		By("suppressing alarm actions during a maintenance window")
+		healthCheck = fetch(key)()
+		start := metav1.NewTime(time.Now().Add(-time.Minute))
+		end := metav1.NewTime(time.Now().Add(time.Hour))
+		healthCheck.Spec.MaintenanceWindows = []healthcheckv1.MaintenanceWindow{
+			{Name: "upgrade", Start: &start, End: &end},
+		}
+		Expect(k8sClient.Update(ctx, healthCheck)).To(Succeed())
+
+		Eventually(func() corev1.ConditionStatus {
+			return getConditionStatus(fetch(key)(), healthcheckv1.ConditionAlarmSuppressed)
+		}, timeout, interval).Should(Equal(corev1.ConditionTrue))
+
+		healthCheck = fetch(key)()
+		Expect(getCondition(healthCheck.Status.Conditions, healthcheckv1.ConditionAlarmSuppressed).Reason).To(Equal(suppressionReasonMaintenance))
+		Expect(healthCheck.Status.MaintenanceWindow).NotTo(BeNil())
+		Expect(healthCheck.Status.MaintenanceWindow.Name).To(Equal("upgrade"))
+		Expect(*getLiveAlarm(healthCheck.Status.AlarmName).ActionsEnabled).To(BeFalse())
+		Expect(*getLiveHealthCheck(id).HealthCheckConfig.Disabled).To(BeTrue())
+
+		By("restoring alarm actions when the window is removed")
+		healthCheck.Spec.MaintenanceWindows = nil
+		Expect(k8sClient.Update(ctx, healthCheck)).To(Succeed())
+
+		Eventually(func() bool {
+			return *getLiveAlarm(healthCheck.Status.AlarmName).ActionsEnabled
+		}, timeout, interval).Should(BeTrue())
+
+		healthCheck = fetch(key)()
+		Expect(getConditionStatus(healthCheck, healthcheckv1.ConditionAlarmSuppressed)).To(Equal(corev1.ConditionFalse))
+		Expect(healthCheck.Status.MaintenanceWindow).To(BeNil())
+		Expect(*getLiveHealthCheck(id).HealthCheckConfig.Disabled).To(BeFalse())
+
+		By("deleting the health check and alarm with the finalizer")
+		alarmName := healthCheck.Status.AlarmName
+		Expect(k8sClient.Delete(ctx, healthCheck)).To(Succeed())
+
+		Eventually(func() bool {
+			return errors.IsNotFound(k8sClient.Get(ctx, key, &healthcheckv1.HealthCheck{}))
+		}, timeout, interval).Should(BeTrue())
+		Expect(getLiveHealthCheck(id)).To(BeNil())
+		Expect(getLiveAlarm(alarmName)).To(BeNil())
+	})
+
+	It("keeps the finalizer until AWS resources are deleted", func() {
+		key := types.NamespacedName{Name: "delete-failure", Namespace: corev1.NamespaceDefault}
+		Expect(k8sClient.Create(ctx, newHealthCheck(key.Name))).To(Succeed())
+
+		Eventually(func() string {
+			return fetch(key)().Status.AlarmName
+		}, timeout, interval).ShouldNot(BeEmpty())
+
+		healthCheck := fetch(key)()
+		id := healthCheck.Status.HealthCheckId
+
+		By("failing to delete the alarm")
+		var failures []error
+		for i := 0; i < 1000; i++ {
+			failures = append(failures, awsfake.NewError("ServiceUnavailable", "Service unavailable", 503))
+		}
+		cloudwatchFake.Faults.Inject("DeleteAlarms", failures...)
+		defer cloudwatchFake.Faults.Reset()
+
+		Expect(k8sClient.Delete(ctx, healthCheck)).To(Succeed())
+
+		Eventually(func() int {
+			return cloudwatchFake.Faults.Calls("DeleteAlarms")
+		}, timeout, interval).Should(BeNumerically(">", 1), "deletion is retried")
+
+		Consistently(func() []string {
+			return fetch(key)().ObjectMeta.Finalizers
+		}, time.Second*2, interval).Should(ContainElement(finalizerName))
+		Expect(fetch(key)().ObjectMeta.DeletionTimestamp).NotTo(BeNil())
+		Expect(getLiveAlarm(healthCheck.Status.AlarmName)).NotTo(BeNil())
+		Expect(getLiveHealthCheck(id)).NotTo(BeNil())
+
+		By("removing the finalizer once AWS recovers")
+		cloudwatchFake.Faults.Reset()
+		touch(key)
+
+		Eventually(func() bool {
+			return errors.IsNotFound(k8sClient.Get(ctx, key, &healthcheckv1.HealthCheck{}))
+		}, timeout, interval).Should(BeTrue())
+		Expect(getLiveHealthCheck(id)).To(BeNil())
+		Expect(getLiveAlarm(healthCheck.Status.AlarmName)).To(BeNil())
+	})
+})
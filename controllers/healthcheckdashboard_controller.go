@@ -0,0 +1,495 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+	"github.com/go-logr/logr"
+	"github.com/go-test/deep"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	healthcheckv1 "github.com/skpr/r53-check/api/v1"
+	"github.com/skpr/r53-check/internal/dryrun"
+	"github.com/skpr/r53-check/internal/scope"
+)
+
+const (
+	dashboardFinalizerName = "healthcheckdashboard.route53.finalizers.skpr.io"
+
+	// dashboardRegion is where Route53 publishes health check metrics.
+	dashboardRegion = "us-east-1"
+	// dashboardWidgetWidth and dashboardWidgetHeight size each widget, so
+	// the status, percentage healthy and latency of a check fit on one row.
+	dashboardWidgetWidth  = 8
+	dashboardWidgetHeight = 6
+
+	// dashboardOwnerPrefix starts the text widget which records the
+	// HealthCheckDashboard that owns a dashboard, as `namespace/name`.
+	dashboardOwnerPrefix = "Generated by r53-check from HealthCheckDashboard "
+
+	// Reasons a dashboard is refused.
+	dashboardReasonNamespace = "NamespaceNotAllowed"
+	dashboardReasonNameInUse = "NameInUse"
+)
+
+// dashboardBody is the CloudWatch dashboard body structure.
+type dashboardBody struct {
+	Widgets []dashboardWidget `json:"widgets"`
+}
+
+// dashboardWidget is a metric graph on a dashboard.
+type dashboardWidget struct {
+	Type       string                    `json:"type"`
+	X          int                       `json:"x"`
+	Y          int                       `json:"y"`
+	Width      int                       `json:"width"`
+	Height     int                       `json:"height"`
+	Properties dashboardWidgetProperties `json:"properties"`
+}
+
+// dashboardWidgetProperties describes the metric which a widget graphs, or
+// the markdown of a text widget.
+type dashboardWidgetProperties struct {
+	Title    string     `json:"title,omitempty"`
+	Metrics  [][]string `json:"metrics,omitempty"`
+	Stat     string     `json:"stat,omitempty"`
+	Period   int        `json:"period,omitempty"`
+	Region   string     `json:"region,omitempty"`
+	View     string     `json:"view,omitempty"`
+	Markdown string     `json:"markdown,omitempty"`
+}
+
+// HealthCheckDashboardReconciler reconciles a HealthCheckDashboard object
+type HealthCheckDashboardReconciler struct {
+	client.Client
+	Log              logr.Logger
+	Scheme           *runtime.Scheme
+	CloudwatchClient cloudwatchiface.CloudWatchAPI
+	// DryRun logs the CloudWatch changes, without making them.
+	DryRun bool
+	// Scope selects the objects reconciled by this manager.
+	Scope *scope.Scope
+	// MaxConcurrentReconciles is the number of objects reconciled at once.
+	MaxConcurrentReconciles int
+	// AdminNamespaces are the namespaces whose dashboards may select HealthChecks
+	// from other namespaces. Every other dashboard only shows its own namespace.
+	AdminNamespaces []string
+}
+
+// +kubebuilder:rbac:groups=route53.skpr.io,resources=healthcheckdashboards,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=route53.skpr.io,resources=healthcheckdashboards/status,verbs=get;update;patch
+
+func (r *HealthCheckDashboardReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+
+	if ok, err := r.Scope.Contains(ctx, r, req.NamespacedName); !ok || err != nil {
+		// Another manager reconciles it.
+		return ctrl.Result{}, err
+	}
+
+	dashboard := &healthcheckv1.HealthCheckDashboard{}
+
+	if err := r.Get(ctx, req.NamespacedName, dashboard); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	if r.DryRun {
+		planner := *r
+		planner.CloudwatchClient = dryrun.NewCloudWatch(r.CloudwatchClient, dryrun.NewPlan(r.Log.WithValues("dashboard", req.NamespacedName)))
+		r = &planner
+	}
+
+	if dashboard.ObjectMeta.DeletionTimestamp.IsZero() {
+		// The dashboard is not being deleted. Register the finalizer.
+		if !containsString(dashboard.ObjectMeta.Finalizers, dashboardFinalizerName) {
+			dashboard.ObjectMeta.Finalizers = append(dashboard.ObjectMeta.Finalizers, dashboardFinalizerName)
+			if err := r.Update(ctx, dashboard); err != nil {
+				return ctrl.Result{}, fmt.Errorf("failed to add finalizer %w", err)
+			}
+		}
+	} else {
+		// The dashboard is being deleted. Remove it from CloudWatch.
+		if containsString(dashboard.ObjectMeta.Finalizers, dashboardFinalizerName) {
+			if err := r.deleteDashboard(dashboard, dashboard.Status.DashboardName); err != nil {
+				return ctrl.Result{}, fmt.Errorf("failed to delete dashboard %w", err)
+			}
+
+			dashboard.ObjectMeta.Finalizers = removeString(dashboard.ObjectMeta.Finalizers, dashboardFinalizerName)
+			if err := r.Update(ctx, dashboard); err != nil {
+				return ctrl.Result{}, fmt.Errorf("failed to removed finalizer %w", err)
+			}
+		}
+
+		return ctrl.Result{}, nil
+	}
+
+	name := getDashboardName(dashboard)
+
+	if namespace := r.getForbiddenNamespace(dashboard); namespace != "" {
+		return r.refuse(ctx, dashboard, dashboardReasonNamespace,
+			fmt.Sprintf("HealthChecks cannot be selected from namespace %s", namespace))
+	}
+
+	live, err := r.getDashboardBody(name)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Dashboard names are global to the account, so one written for another
+	// HealthCheckDashboard is left alone. Dashboards written before owners were
+	// recorded are adopted by the HealthCheckDashboard which wrote them.
+	if owner := getDashboardOwner(live); live != "" && owner != getDashboardKey(dashboard) &&
+		(owner != "" || dashboard.Status.DashboardName != name) {
+		message := fmt.Sprintf("Dashboard %s is not owned by this HealthCheckDashboard", name)
+		if owner != "" {
+			message = fmt.Sprintf("Dashboard %s is owned by HealthCheckDashboard %s", name, owner)
+		}
+		return r.refuse(ctx, dashboard, dashboardReasonNameInUse, message)
+	}
+
+	// The dashboard was renamed, remove the previous one.
+	if dashboard.Status.DashboardName != "" && dashboard.Status.DashboardName != name {
+		if err := r.deleteDashboard(dashboard, dashboard.Status.DashboardName); err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to delete previous dashboard %w", err)
+		}
+	}
+
+	healthChecks, err := r.getDashboardHealthChecks(ctx, dashboard)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	body, err := getDashboardBody(dashboard, healthChecks)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Hand edits are overwritten, the dashboard is generated from the HealthChecks.
+	if live != body {
+		r.Log.Info(fmt.Sprintf("Writing dashboard %s with %d health checks", name, len(healthChecks)))
+		_, err := r.CloudwatchClient.PutDashboard(&cloudwatch.PutDashboardInput{
+			DashboardName: aws.String(name),
+			DashboardBody: aws.String(body),
+		})
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	status := healthcheckv1.HealthCheckDashboardStatus{
+		DashboardName: name,
+		Conditions: setCondition(dashboard.Status.DeepCopy().Conditions, healthcheckv1.ConditionDashboardRefused,
+			corev1.ConditionFalse, "", ""),
+	}
+	for _, healthCheck := range healthChecks {
+		status.HealthChecks = append(status.HealthChecks, healthCheck.Namespace+"/"+healthCheck.Name)
+	}
+
+	if diff := deep.Equal(dashboard.Status, status); diff != nil {
+		r.Log.Info(fmt.Sprintf("Status change dectected: %s", diff))
+		dashboard.Status = status
+		if err := r.Status().Update(ctx, dashboard); err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to sync status %v %w", dashboard, err)
+		}
+	}
+
+	return ctrl.Result{RequeueAfter: time.Second * 30}, nil
+}
+
+// refuse reports why the dashboard was not written. The dashboard which was
+// last written is kept in the status, so it is still deleted with the
+// HealthCheckDashboard.
+func (r *HealthCheckDashboardReconciler) refuse(ctx context.Context, dashboard *healthcheckv1.HealthCheckDashboard, reason, message string) (ctrl.Result, error) {
+	r.Log.Info(fmt.Sprintf("Refusing dashboard %s: %s", getDashboardName(dashboard), message))
+
+	status := dashboard.Status.DeepCopy()
+	status.Conditions = setCondition(status.Conditions, healthcheckv1.ConditionDashboardRefused, corev1.ConditionTrue, reason, message)
+
+	if diff := deep.Equal(dashboard.Status, *status); diff != nil {
+		r.Log.Info(fmt.Sprintf("Status change dectected: %s", diff))
+		dashboard.Status = *status
+		if err := r.Status().Update(ctx, dashboard); err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to sync status %v %w", dashboard, err)
+		}
+	}
+
+	// The name may be released by the other HealthCheckDashboard.
+	return ctrl.Result{RequeueAfter: time.Second * 30}, nil
+}
+
+// getForbiddenNamespace gets a namespace which the dashboard selects from but
+// may not, or "" when every namespace is allowed.
+func (r *HealthCheckDashboardReconciler) getForbiddenNamespace(dashboard *healthcheckv1.HealthCheckDashboard) string {
+	if containsString(r.AdminNamespaces, dashboard.Namespace) {
+		return ""
+	}
+	for _, namespace := range getDashboardNamespaces(dashboard) {
+		if namespace != dashboard.Namespace {
+			return namespace
+		}
+	}
+	return ""
+}
+
+// getDashboardHealthChecks gets the HealthChecks selected by the dashboard,
+// ordered by namespace and name.
+func (r *HealthCheckDashboardReconciler) getDashboardHealthChecks(ctx context.Context, dashboard *healthcheckv1.HealthCheckDashboard) ([]healthcheckv1.HealthCheck, error) {
+	selector := labels.Everything()
+	if dashboard.Spec.Selector != nil {
+		var err error
+		selector, err = metav1.LabelSelectorAsSelector(dashboard.Spec.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector: %w", err)
+		}
+	}
+
+	var healthChecks []healthcheckv1.HealthCheck
+	for _, namespace := range getDashboardNamespaces(dashboard) {
+		list := &healthcheckv1.HealthCheckList{}
+		err := r.List(ctx, list, client.InNamespace(namespace), client.MatchingLabelsSelector{Selector: selector})
+		if err != nil {
+			return nil, err
+		}
+		for _, healthCheck := range list.Items {
+			// Route53 health checks have no metrics until they are created.
+			if getBackend(&healthCheck) == healthcheckv1.BackendRoute53 && healthCheck.Status.HealthCheckId == "" {
+				continue
+			}
+			healthChecks = append(healthChecks, healthCheck)
+		}
+	}
+
+	sort.Slice(healthChecks, func(i, j int) bool {
+		if healthChecks[i].Namespace != healthChecks[j].Namespace {
+			return healthChecks[i].Namespace < healthChecks[j].Namespace
+		}
+		return healthChecks[i].Name < healthChecks[j].Name
+	})
+
+	return healthChecks, nil
+}
+
+// getDashboardBody gets the live body of a dashboard, or "" when it does not exist.
+func (r *HealthCheckDashboardReconciler) getDashboardBody(name string) (string, error) {
+	output, err := r.CloudwatchClient.GetDashboard(&cloudwatch.GetDashboardInput{
+		DashboardName: aws.String(name),
+	})
+	if isAWSErrorCode(err, cloudwatch.ErrCodeDashboardNotFoundError) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(output.DashboardBody), nil
+}
+
+// deleteDashboard deletes a dashboard, if it exists and is not owned by
+// another HealthCheckDashboard.
+func (r *HealthCheckDashboardReconciler) deleteDashboard(dashboard *healthcheckv1.HealthCheckDashboard, name string) error {
+	if name == "" {
+		return nil
+	}
+
+	live, err := r.getDashboardBody(name)
+	if err != nil {
+		return err
+	}
+	if owner := getDashboardOwner(live); live == "" || (owner != "" && owner != getDashboardKey(dashboard)) {
+		return nil
+	}
+
+	r.Log.Info(fmt.Sprintf("Deleting dashboard: %s", name))
+	_, err = r.CloudwatchClient.DeleteDashboards(&cloudwatch.DeleteDashboardsInput{
+		DashboardNames: aws.StringSlice([]string{name}),
+	})
+	if isAWSErrorCode(err, cloudwatch.ErrCodeDashboardNotFoundError) {
+		return nil
+	}
+	return err
+}
+
+func (r *HealthCheckDashboardReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&healthcheckv1.HealthCheckDashboard{}).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
+		Watches(&source.Kind{Type: &healthcheckv1.HealthCheck{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(r.mapHealthCheck),
+		}).
+		Complete(r)
+}
+
+// mapHealthCheck enqueues the dashboards which select from the namespace of a
+// HealthCheck. Labels are not matched, so a check whose labels changed is
+// removed from the dashboards which no longer select it.
+func (r *HealthCheckDashboardReconciler) mapHealthCheck(obj handler.MapObject) []reconcile.Request {
+	dashboards := &healthcheckv1.HealthCheckDashboardList{}
+
+	err := r.List(context.Background(), dashboards)
+	if err != nil {
+		r.Log.Error(err, "failed to list dashboards", "healthcheck", obj.Meta.GetName())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, dashboard := range dashboards.Items {
+		if !containsString(getDashboardNamespaces(&dashboard), obj.Meta.GetNamespace()) {
+			continue
+		}
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Namespace: dashboard.Namespace,
+				Name:      dashboard.Name,
+			},
+		})
+	}
+	return requests
+}
+
+// getDashboardName gets the name of the CloudWatch dashboard.
+func getDashboardName(dashboard *healthcheckv1.HealthCheckDashboard) string {
+	if dashboard.Spec.DashboardName != "" {
+		return dashboard.Spec.DashboardName
+	}
+	return dashboard.Namespace + "-" + dashboard.Name
+}
+
+// getDashboardKey gets the namespace/name recorded as the owner of the dashboard.
+func getDashboardKey(dashboard *healthcheckv1.HealthCheckDashboard) string {
+	return dashboard.Namespace + "/" + dashboard.Name
+}
+
+// getDashboardOwner gets the namespace/name of the HealthCheckDashboard which
+// wrote a dashboard body, or "" when it was not recorded.
+func getDashboardOwner(body string) string {
+	var parsed dashboardBody
+	if err := json.Unmarshal([]byte(body), &parsed); err != nil {
+		return ""
+	}
+	for _, widget := range parsed.Widgets {
+		if widget.Type != "text" || !strings.HasPrefix(widget.Properties.Markdown, dashboardOwnerPrefix) {
+			continue
+		}
+		owner := strings.TrimPrefix(widget.Properties.Markdown, dashboardOwnerPrefix)
+		if parts := strings.SplitN(owner, "`", 3); len(parts) == 3 {
+			return parts[1]
+		}
+	}
+	return ""
+}
+
+// getDashboardNamespaces gets the namespaces which HealthChecks are selected from.
+func getDashboardNamespaces(dashboard *healthcheckv1.HealthCheckDashboard) []string {
+	if len(dashboard.Spec.Namespaces) == 0 {
+		return []string{dashboard.Namespace}
+	}
+	return dashboard.Spec.Namespaces
+}
+
+// getDashboardBody builds a row of widgets for each HealthCheck, followed by
+// the text widget which records the owner of the dashboard.
+func getDashboardBody(dashboard *healthcheckv1.HealthCheckDashboard, healthChecks []healthcheckv1.HealthCheck) (string, error) {
+	body := dashboardBody{
+		Widgets: []dashboardWidget{},
+	}
+
+	for i := range healthChecks {
+		healthCheck := &healthChecks[i]
+		title := healthCheck.Namespace + "/" + healthCheck.Name
+
+		namespace, metricName, dimensions := getHealthMetric(healthCheck, healthCheck.Status.HealthCheckId)
+		row := []dashboardWidgetProperties{
+			{
+				Title:   title + " status",
+				Metrics: [][]string{getDashboardMetric(*namespace, *metricName, dimensions)},
+				Stat:    "Minimum",
+			},
+		}
+
+		if getBackend(healthCheck) == healthcheckv1.BackendRoute53 {
+			row = append(row, dashboardWidgetProperties{
+				Title:   title + " percentage healthy",
+				Metrics: [][]string{getDashboardMetric("AWS/Route53", "HealthCheckPercentageHealthy", dimensions)},
+				Stat:    "Average",
+			})
+			if healthCheck.Spec.MeasureLatency {
+				row = append(row, dashboardWidgetProperties{
+					Title:   title + " time to first byte",
+					Metrics: [][]string{getDashboardMetric("AWS/Route53", "TimeToFirstByte", dimensions)},
+					Stat:    "Average",
+				})
+			}
+		}
+
+		for column, properties := range row {
+			properties.Period = 60
+			properties.Region = dashboardRegion
+			properties.View = "timeSeries"
+			body.Widgets = append(body.Widgets, dashboardWidget{
+				Type:       "metric",
+				X:          column * dashboardWidgetWidth,
+				Y:          i * dashboardWidgetHeight,
+				Width:      dashboardWidgetWidth,
+				Height:     dashboardWidgetHeight,
+				Properties: properties,
+			})
+		}
+	}
+
+	body.Widgets = append(body.Widgets, dashboardWidget{
+		Type:   "text",
+		Y:      len(healthChecks) * dashboardWidgetHeight,
+		Width:  dashboardWidgetWidth * 3,
+		Height: 1,
+		Properties: dashboardWidgetProperties{
+			Markdown: fmt.Sprintf("%s`%s`. Edits are overwritten.", dashboardOwnerPrefix, getDashboardKey(dashboard)),
+		},
+	})
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// getDashboardMetric gets a metric in the dashboard array form of namespace,
+// name, then each dimension name and value.
+func getDashboardMetric(namespace, metricName string, dimensions []*cloudwatch.Dimension) []string {
+	metric := []string{namespace, metricName}
+	for _, dimension := range dimensions {
+		metric = append(metric, aws.StringValue(dimension.Name), aws.StringValue(dimension.Value))
+	}
+	return metric
+}
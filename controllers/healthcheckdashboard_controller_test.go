@@ -0,0 +1,204 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	healthcheckv1 "github.com/skpr/r53-check/api/v1"
+	"github.com/skpr/r53-check/internal/awsfake"
+)
+
+func TestReconcileHealthCheckDashboard(t *testing.T) {
+	err := healthcheckv1.AddToScheme(scheme.Scheme)
+	assert.Nil(t, err)
+
+	selected := map[string]string{"client": "pnx"}
+
+	dashboard := &healthcheckv1.HealthCheckDashboard{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: corev1.NamespaceDefault,
+		},
+		Spec: healthcheckv1.HealthCheckDashboardSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: selected},
+		},
+	}
+
+	client := fake.NewFakeClientWithScheme(scheme.Scheme,
+		dashboard,
+		&healthcheckv1.HealthCheck{
+			ObjectMeta: metav1.ObjectMeta{Name: "route53", Namespace: corev1.NamespaceDefault, Labels: selected},
+			Spec:       healthcheckv1.HealthCheckSpec{MeasureLatency: true},
+			Status:     healthcheckv1.HealthCheckStatus{HealthCheckId: "abc"},
+		},
+		&healthcheckv1.HealthCheck{
+			ObjectMeta: metav1.ObjectMeta{Name: "incluster", Namespace: corev1.NamespaceDefault, Labels: selected},
+			Spec:       healthcheckv1.HealthCheckSpec{Backend: healthcheckv1.BackendInCluster},
+		},
+		&healthcheckv1.HealthCheck{
+			ObjectMeta: metav1.ObjectMeta{Name: "pending", Namespace: corev1.NamespaceDefault, Labels: selected},
+		},
+		&healthcheckv1.HealthCheck{
+			ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: corev1.NamespaceDefault},
+			Status:     healthcheckv1.HealthCheckStatus{HealthCheckId: "def"},
+		},
+	)
+	cloudwatchClient := awsfake.NewCloudWatch()
+
+	reconciler := HealthCheckDashboardReconciler{
+		Client:           client,
+		Log:              zap.New(),
+		Scheme:           scheme.Scheme,
+		CloudwatchClient: cloudwatchClient,
+	}
+
+	query := types.NamespacedName{
+		Name:      dashboard.ObjectMeta.Name,
+		Namespace: dashboard.ObjectMeta.Namespace,
+	}
+
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+
+	dashboard = &healthcheckv1.HealthCheckDashboard{}
+	err = client.Get(context.TODO(), query, dashboard)
+	assert.Nil(t, err)
+	assert.Equal(t, "default-test", dashboard.Status.DashboardName)
+	assert.Equal(t, []string{"default/incluster", "default/route53"}, dashboard.Status.HealthChecks)
+
+	var body dashboardBody
+	err = json.Unmarshal([]byte(cloudwatchClient.Dashboards()["default-test"]), &body)
+	assert.Nil(t, err)
+	if assert.Len(t, body.Widgets, 5) {
+		assert.Equal(t, []string{"R53Check", "HealthCheckStatus", "Namespace", "default", "Name", "incluster"}, body.Widgets[0].Properties.Metrics[0])
+
+		assert.Equal(t, []string{"AWS/Route53", "HealthCheckStatus", "HealthCheckId", "abc"}, body.Widgets[1].Properties.Metrics[0])
+		assert.Equal(t, dashboardWidgetHeight, body.Widgets[1].Y)
+		assert.Equal(t, "HealthCheckPercentageHealthy", body.Widgets[2].Properties.Metrics[0][1])
+		assert.Equal(t, dashboardWidgetWidth, body.Widgets[2].X)
+		assert.Equal(t, "TimeToFirstByte", body.Widgets[3].Properties.Metrics[0][1])
+	}
+	assert.Equal(t, "default/test", getDashboardOwner(cloudwatchClient.Dashboards()["default-test"]))
+
+	// Renaming replaces the dashboard.
+	dashboard.Spec.DashboardName = "renamed"
+	err = client.Update(context.TODO(), dashboard)
+	assert.Nil(t, err)
+
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+	assert.Len(t, cloudwatchClient.Dashboards(), 1)
+	assert.Contains(t, cloudwatchClient.Dashboards(), "renamed")
+
+	// Nothing is written when the dashboard is up to date.
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, cloudwatchClient.Faults.Calls("PutDashboard"))
+
+	dashboard = &healthcheckv1.HealthCheckDashboard{}
+	err = client.Get(context.TODO(), query, dashboard)
+	assert.Nil(t, err)
+	now := metav1.Now()
+	dashboard.ObjectMeta.DeletionTimestamp = &now
+	err = client.Update(context.TODO(), dashboard)
+	assert.Nil(t, err)
+
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+	assert.Empty(t, cloudwatchClient.Dashboards())
+}
+
+func TestReconcileHealthCheckDashboardRefused(t *testing.T) {
+	err := healthcheckv1.AddToScheme(scheme.Scheme)
+	assert.Nil(t, err)
+
+	tenant := &healthcheckv1.HealthCheckDashboard{
+		ObjectMeta: metav1.ObjectMeta{Name: "tenant", Namespace: "tenant"},
+		Spec: healthcheckv1.HealthCheckDashboardSpec{
+			DashboardName: "shared",
+			Namespaces:    []string{"tenant", "other"},
+		},
+	}
+	admin := &healthcheckv1.HealthCheckDashboard{
+		ObjectMeta: metav1.ObjectMeta{Name: "admin", Namespace: "ops"},
+		Spec: healthcheckv1.HealthCheckDashboardSpec{
+			DashboardName: "shared",
+			Namespaces:    []string{"tenant", "other"},
+		},
+	}
+
+	client := fake.NewFakeClientWithScheme(scheme.Scheme,
+		tenant,
+		admin,
+		&healthcheckv1.HealthCheck{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "other"},
+			Status:     healthcheckv1.HealthCheckStatus{HealthCheckId: "abc"},
+		},
+	)
+	cloudwatchClient := awsfake.NewCloudWatch()
+
+	reconciler := HealthCheckDashboardReconciler{
+		Client:           client,
+		Log:              zap.New(),
+		Scheme:           scheme.Scheme,
+		CloudwatchClient: cloudwatchClient,
+		AdminNamespaces:  []string{"ops"},
+	}
+
+	// refused gets the reason a dashboard was refused.
+	refused := func(key types.NamespacedName) string {
+		dashboard := &healthcheckv1.HealthCheckDashboard{}
+		assert.Nil(t, client.Get(context.TODO(), key, dashboard))
+		condition := getCondition(dashboard.Status.Conditions, healthcheckv1.ConditionDashboardRefused)
+		if condition == nil || condition.Status != corev1.ConditionTrue {
+			return ""
+		}
+		return condition.Reason
+	}
+
+	tenantKey := types.NamespacedName{Namespace: tenant.Namespace, Name: tenant.Name}
+	adminKey := types.NamespacedName{Namespace: admin.Namespace, Name: admin.Name}
+
+	// Tenants cannot see the HealthChecks of other namespaces.
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: tenantKey})
+	assert.Nil(t, err)
+	assert.Equal(t, dashboardReasonNamespace, refused(tenantKey))
+	assert.Empty(t, cloudwatchClient.Dashboards())
+
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: adminKey})
+	assert.Nil(t, err)
+	assert.Equal(t, "", refused(adminKey))
+	assert.Equal(t, "ops/admin", getDashboardOwner(cloudwatchClient.Dashboards()["shared"]))
+
+	// The name is owned by the admin dashboard, so it is neither overwritten nor deleted.
+	tenant = &healthcheckv1.HealthCheckDashboard{}
+	assert.Nil(t, client.Get(context.TODO(), tenantKey, tenant))
+	tenant.Spec.Namespaces = nil
+	assert.Nil(t, client.Update(context.TODO(), tenant))
+
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: tenantKey})
+	assert.Nil(t, err)
+	assert.Equal(t, dashboardReasonNameInUse, refused(tenantKey))
+	assert.Equal(t, "ops/admin", getDashboardOwner(cloudwatchClient.Dashboards()["shared"]))
+
+	tenant = &healthcheckv1.HealthCheckDashboard{}
+	assert.Nil(t, client.Get(context.TODO(), tenantKey, tenant))
+	tenant.Status.DashboardName = "shared"
+	now := metav1.Now()
+	tenant.ObjectMeta.DeletionTimestamp = &now
+	assert.Nil(t, client.Update(context.TODO(), tenant))
+
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: tenantKey})
+	assert.Nil(t, err)
+	assert.Contains(t, cloudwatchClient.Dashboards(), "shared")
+}
@@ -0,0 +1,117 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"github.com/go-test/deep"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	healthcheckv1 "github.com/skpr/r53-check/api/v1"
+	"github.com/skpr/r53-check/internal/quota"
+	"github.com/skpr/r53-check/internal/scope"
+)
+
+// HealthCheckQuotaReconciler reconciles a HealthCheckQuota object
+type HealthCheckQuotaReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+	// Scope selects the objects reconciled by this manager.
+	Scope *scope.Scope
+	// MaxConcurrentReconciles is the number of objects reconciled at once.
+	MaxConcurrentReconciles int
+}
+
+// +kubebuilder:rbac:groups=route53.skpr.io,resources=healthcheckquotas,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=route53.skpr.io,resources=healthcheckquotas/status,verbs=get;update;patch
+
+func (r *HealthCheckQuotaReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+
+	if ok, err := r.Scope.Contains(ctx, r, req.NamespacedName); !ok || err != nil {
+		// Another manager reconciles it.
+		return ctrl.Result{}, err
+	}
+
+	healthCheckQuota := &healthcheckv1.HealthCheckQuota{}
+
+	if err := r.Get(ctx, req.NamespacedName, healthCheckQuota); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	healthChecks := &healthcheckv1.HealthCheckList{}
+	if err := r.List(ctx, healthChecks, client.InNamespace(req.Namespace)); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to list health checks %w", err)
+	}
+
+	status := healthcheckv1.HealthCheckQuotaStatus{
+		Used: quota.Sum(quota.Counted(healthChecks.Items, nil, nil)),
+	}
+	status.Exceeded = quota.Exceeded(healthCheckQuota.Spec, status.Used)
+
+	if diff := deep.Equal(healthCheckQuota.Status, status); diff != nil {
+		r.Log.Info(fmt.Sprintf("Status change dectected: %s", diff))
+		healthCheckQuota.Status = status
+		if err := r.Status().Update(ctx, healthCheckQuota); err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to sync status %v %w", healthCheckQuota, err)
+		}
+	}
+
+	return ctrl.Result{}, nil
+}
+
+func (r *HealthCheckQuotaReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&healthcheckv1.HealthCheckQuota{}).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
+		Watches(&source.Kind{Type: &healthcheckv1.HealthCheck{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(r.mapHealthCheck),
+		}).
+		Complete(r)
+}
+
+// mapHealthCheck enqueues the quotas in the namespace of a HealthCheck.
+func (r *HealthCheckQuotaReconciler) mapHealthCheck(obj handler.MapObject) []reconcile.Request {
+	quotas := &healthcheckv1.HealthCheckQuotaList{}
+
+	err := r.List(context.Background(), quotas, client.InNamespace(obj.Meta.GetNamespace()))
+	if err != nil {
+		r.Log.Error(err, "failed to list quotas", "namespace", obj.Meta.GetNamespace())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, q := range quotas.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Namespace: q.Namespace,
+				Name:      q.Name,
+			},
+		})
+	}
+	return requests
+}
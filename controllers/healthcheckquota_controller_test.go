@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/pointer"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	healthcheckv1 "github.com/skpr/r53-check/api/v1"
+)
+
+func TestReconcileHealthCheckQuota(t *testing.T) {
+	err := healthcheckv1.AddToScheme(scheme.Scheme)
+	assert.Nil(t, err)
+
+	quota := &healthcheckv1.HealthCheckQuota{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: corev1.NamespaceDefault,
+		},
+		Spec: healthcheckv1.HealthCheckQuotaSpec{
+			HealthChecks:   pointer.Int64Ptr(5),
+			MeasureLatency: pointer.Int64Ptr(1),
+		},
+	}
+
+	client := fake.NewFakeClientWithScheme(scheme.Scheme,
+		quota,
+		&healthcheckv1.HealthCheck{
+			ObjectMeta: metav1.ObjectMeta{Name: "fast", Namespace: corev1.NamespaceDefault},
+			Spec:       healthcheckv1.HealthCheckSpec{RequestInterval: 10, MeasureLatency: true},
+		},
+		&healthcheckv1.HealthCheck{
+			ObjectMeta: metav1.ObjectMeta{Name: "latency", Namespace: corev1.NamespaceDefault},
+			Spec:       healthcheckv1.HealthCheckSpec{MeasureLatency: true},
+		},
+		&healthcheckv1.HealthCheck{
+			ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "other"},
+		},
+	)
+
+	reconciler := HealthCheckQuotaReconciler{
+		Client: client,
+		Log:    zap.New(),
+		Scheme: scheme.Scheme,
+	}
+
+	query := types.NamespacedName{
+		Name:      quota.ObjectMeta.Name,
+		Namespace: quota.ObjectMeta.Namespace,
+	}
+
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+
+	quota = &healthcheckv1.HealthCheckQuota{}
+	err = client.Get(context.TODO(), query, quota)
+	assert.Nil(t, err)
+	assert.Equal(t, healthcheckv1.HealthCheckUsage{HealthChecks: 2, FastInterval: 1, MeasureLatency: 2}, quota.Status.Used)
+	assert.Equal(t, []string{"measure_latency: 2 > 1"}, quota.Status.Exceeded)
+}
@@ -0,0 +1,245 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/route53"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	healthcheckv1 "github.com/skpr/r53-check/api/v1"
+)
+
+const (
+	// maxIncidents is how many incidents are kept in the status.
+	maxIncidents = 20
+	// maxIncidentReasons is how many distinct failure reasons are kept per incident.
+	maxIncidentReasons = 5
+	// alarmTestWindow is how long the observed ALARM state is put down to a
+	// notification test, until CloudWatch evaluates the alarm again.
+	alarmTestWindow = time.Minute * 5
+)
+
+// alarmTransition is a change of alarm state read from the alarm history.
+type alarmTransition struct {
+	State string
+	Time  time.Time
+	// Test is set when the state was forced by a notification test.
+	Test bool
+}
+
+// alarmHistoryData is the part of a StateUpdate history item which we use.
+type alarmHistoryData struct {
+	NewState struct {
+		StateValue  string `json:"stateValue"`
+		StateReason string `json:"stateReason"`
+	} `json:"newState"`
+}
+
+// syncIncidents records outages from the alarm history, falling back to the
+// observed alarm state for transitions which are not in the history yet.
+// Notification tests are not outages, so they are skipped. The history is only
+// read while the alarm fires or an incident is open, so alarms which stay OK
+// do not poll CloudWatch.
+func (r *HealthCheckReconciler) syncIncidents(healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus, now time.Time) error {
+	if status.AlarmName == "" {
+		return nil
+	}
+
+	incidents := status.Incidents
+
+	var testing bool
+	if status.AlarmState == cloudwatch.StateValueAlarm || isIncidentOpen(incidents) {
+		transitions, err := r.getAlarmTransitions(status.AlarmName, getIncidentsSince(incidents))
+		if err != nil {
+			return fmt.Errorf("failed to get alarm history: %w", err)
+		}
+		for _, transition := range transitions {
+			testing = transition.Test
+			if transition.Test {
+				continue
+			}
+			incidents = applyAlarmTransition(incidents, transition.State, transition.Time)
+		}
+	}
+
+	// The alarm stays in ALARM after a notification test until CloudWatch
+	// evaluates it again, and the test may not be in the history yet.
+	testing = testing || (status.AlarmTest != nil && now.Sub(status.AlarmTest.Time.Time) < alarmTestWindow)
+	if status.AlarmState != cloudwatch.StateValueAlarm || !testing {
+		incidents = applyAlarmTransition(incidents, status.AlarmState, now)
+	}
+
+	if isIncidentOpen(incidents) {
+		err := r.recordIncidentFailures(healthCheck, status, &incidents[len(incidents)-1])
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(incidents) > maxIncidents {
+		incidents = incidents[len(incidents)-maxIncidents:]
+	}
+	status.Incidents = incidents
+
+	return nil
+}
+
+// getAlarmTransitions gets the state changes of an alarm, oldest first.
+// CloudWatch returns the history newest first, so every page is read.
+func (r *HealthCheckReconciler) getAlarmTransitions(alarmName string, since *time.Time) ([]alarmTransition, error) {
+	input := &cloudwatch.DescribeAlarmHistoryInput{
+		AlarmName:       aws.String(alarmName),
+		HistoryItemType: aws.String(cloudwatch.HistoryItemTypeStateUpdate),
+		StartDate:       since,
+		MaxRecords:      aws.Int64(100),
+	}
+
+	var transitions []alarmTransition
+	for {
+		output, err := r.CloudwatchClient.DescribeAlarmHistory(input)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range output.AlarmHistoryItems {
+			var data alarmHistoryData
+			if err := json.Unmarshal([]byte(aws.StringValue(item.HistoryData)), &data); err != nil {
+				r.Log.Info(fmt.Sprintf("Skipping unreadable alarm history for %s: %s", alarmName, err))
+				continue
+			}
+			transitions = append(transitions, alarmTransition{
+				State: data.NewState.StateValue,
+				Time:  aws.TimeValue(item.Timestamp),
+				Test:  strings.HasPrefix(data.NewState.StateReason, alarmTestReason),
+			})
+		}
+
+		if aws.StringValue(output.NextToken) == "" {
+			break
+		}
+		input.NextToken = output.NextToken
+	}
+
+	sort.SliceStable(transitions, func(i, j int) bool {
+		return transitions[i].Time.Before(transitions[j].Time)
+	})
+
+	return transitions, nil
+}
+
+// isIncidentOpen checks if the last incident has not ended.
+func isIncidentOpen(incidents []healthcheckv1.Incident) bool {
+	return len(incidents) > 0 && incidents[len(incidents)-1].End == nil
+}
+
+// getIncidentsSince gets the time from which the history has not been read.
+func getIncidentsSince(incidents []healthcheckv1.Incident) *time.Time {
+	if len(incidents) == 0 {
+		return nil
+	}
+	last := incidents[len(incidents)-1]
+	if last.End == nil {
+		return aws.Time(last.Start.Time)
+	}
+	return aws.Time(last.End.Time)
+}
+
+// applyAlarmTransition opens an incident when the alarm fires and closes it
+// when the alarm returns to OK. Transitions which were already applied are ignored.
+func applyAlarmTransition(incidents []healthcheckv1.Incident, state string, at time.Time) []healthcheckv1.Incident {
+	var last *healthcheckv1.Incident
+	if len(incidents) > 0 {
+		last = &incidents[len(incidents)-1]
+	}
+
+	switch state {
+	case cloudwatch.StateValueAlarm:
+		if last != nil && (last.End == nil || !at.After(last.End.Time)) {
+			return incidents
+		}
+		return append(incidents, healthcheckv1.Incident{
+			Start: metav1.NewTime(at),
+		})
+
+	case cloudwatch.StateValueOk:
+		if last == nil || last.End != nil || !at.After(last.Start.Time) {
+			return incidents
+		}
+		end := metav1.NewTime(at)
+		last.End = &end
+		last.Duration = &metav1.Duration{Duration: at.Sub(last.Start.Time).Round(time.Second)}
+	}
+
+	return incidents
+}
+
+// recordIncidentFailures adds what is currently failing to an open incident.
+func (r *HealthCheckReconciler) recordIncidentFailures(healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus, incident *healthcheckv1.Incident) error {
+	switch getBackend(healthCheck) {
+	case healthcheckv1.BackendRoute53:
+		if status.HealthCheckId == "" {
+			return nil
+		}
+		output, err := r.Route53Client.GetHealthCheckStatus(&route53.GetHealthCheckStatusInput{
+			HealthCheckId: aws.String(status.HealthCheckId),
+		})
+		if err != nil {
+			return err
+		}
+		for _, observation := range output.HealthCheckObservations {
+			if observation.StatusReport == nil {
+				continue
+			}
+			reason := aws.StringValue(observation.StatusReport.Status)
+			if strings.HasPrefix(reason, "Success") {
+				continue
+			}
+			incident.FailingRegions = appendUnique(incident.FailingRegions, aws.StringValue(observation.Region), len(output.HealthCheckObservations))
+			incident.FailureReasons = appendUnique(incident.FailureReasons, reason, maxIncidentReasons)
+		}
+		sort.Strings(incident.FailingRegions)
+
+	case healthcheckv1.BackendInCluster:
+		condition := getCondition(status.Conditions, healthcheckv1.ConditionHealthy)
+		if condition != nil && condition.Status == corev1.ConditionFalse && condition.Message != "" {
+			incident.FailureReasons = appendUnique(incident.FailureReasons, condition.Message, maxIncidentReasons)
+		}
+	}
+
+	return nil
+}
+
+// appendUnique appends a value which is not already in the list, up to a limit.
+func appendUnique(values []string, value string, limit int) []string {
+	if len(values) >= limit {
+		return values
+	}
+	for _, existing := range values {
+		if existing == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
@@ -0,0 +1,187 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	healthcheckv1 "github.com/skpr/r53-check/api/v1"
+	"github.com/skpr/r53-check/internal/awsfake"
+)
+
+func TestSyncIncidents(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := start
+
+	cloudwatchClient := awsfake.NewCloudWatch()
+	cloudwatchClient.Now = func() time.Time { return clock }
+	route53Client := awsfake.NewRoute53()
+
+	reconciler := HealthCheckReconciler{
+		Log:              zap.New(),
+		Route53Client:    route53Client,
+		CloudwatchClient: cloudwatchClient,
+	}
+
+	output, err := route53Client.CreateHealthCheck(&route53.CreateHealthCheckInput{
+		CallerReference: aws.String("test"),
+		HealthCheckConfig: &route53.HealthCheckConfig{
+			FullyQualifiedDomainName: aws.String("www.example.com"),
+			Type:                     aws.String(route53.HealthCheckTypeHttps),
+		},
+	})
+	assert.Nil(t, err)
+	route53Client.SetHealthCheckStatus(*output.HealthCheck.Id,
+		"Success: HTTP Status Code 200, OK",
+		"Failure: HTTP Status Code 503, Service Unavailable")
+
+	_, err = cloudwatchClient.PutMetricAlarm(&cloudwatch.PutMetricAlarmInput{
+		AlarmName:          aws.String("test-healthcheck"),
+		EvaluationPeriods:  aws.Int64(1),
+		ComparisonOperator: aws.String(cloudwatch.ComparisonOperatorLessThanThreshold),
+	})
+	assert.Nil(t, err)
+
+	// transition moves the alarm into a state some minutes after the start.
+	transition := func(minutes int, state string) {
+		clock = start.Add(time.Duration(minutes) * time.Minute)
+		assert.Nil(t, cloudwatchClient.TransitionAlarm("test-healthcheck", state, "Threshold Crossed"))
+	}
+
+	transition(1, cloudwatch.StateValueAlarm)
+	transition(6, cloudwatch.StateValueOk)
+	transition(10, cloudwatch.StateValueAlarm)
+
+	healthCheck := &healthcheckv1.HealthCheck{}
+	status := healthcheckv1.HealthCheckStatus{
+		HealthCheckId: *output.HealthCheck.Id,
+		AlarmName:     "test-healthcheck",
+		AlarmState:    cloudwatch.StateValueAlarm,
+	}
+
+	// The outage which ended before we looked is read from the history.
+	assert.Nil(t, reconciler.syncIncidents(healthCheck, &status, start.Add(time.Minute*11)))
+	if assert.Len(t, status.Incidents, 2) {
+		assert.Equal(t, start.Add(time.Minute), status.Incidents[0].Start.Time)
+		assert.Equal(t, start.Add(time.Minute*6), status.Incidents[0].End.Time)
+		assert.Equal(t, time.Minute*5, status.Incidents[0].Duration.Duration)
+		assert.Empty(t, status.Incidents[0].FailureReasons)
+
+		assert.Equal(t, start.Add(time.Minute*10), status.Incidents[1].Start.Time)
+		assert.Nil(t, status.Incidents[1].End)
+		assert.Equal(t, []string{route53.HealthCheckRegionUsWest1}, status.Incidents[1].FailingRegions)
+		assert.Equal(t, []string{"Failure: HTTP Status Code 503, Service Unavailable"}, status.Incidents[1].FailureReasons)
+	}
+
+	transition(20, cloudwatch.StateValueOk)
+	status.AlarmState = cloudwatch.StateValueOk
+
+	for i := 0; i < 2; i++ {
+		assert.Nil(t, reconciler.syncIncidents(healthCheck, &status, start.Add(time.Minute*21)))
+		if assert.Len(t, status.Incidents, 2, "history is not applied twice") {
+			assert.Equal(t, start.Add(time.Minute*20), status.Incidents[1].End.Time)
+			assert.Equal(t, time.Minute*10, status.Incidents[1].Duration.Duration)
+		}
+	}
+
+	// Notification tests are not outages.
+	clock = start.Add(time.Minute * 30)
+	_, err = cloudwatchClient.SetAlarmState(&cloudwatch.SetAlarmStateInput{
+		AlarmName:   aws.String("test-healthcheck"),
+		StateValue:  aws.String(cloudwatch.StateValueAlarm),
+		StateReason: aws.String(alarmTestReason + "abc"),
+	})
+	assert.Nil(t, err)
+	status.AlarmState = cloudwatch.StateValueAlarm
+	status.AlarmTest = &healthcheckv1.AlarmTest{Nonce: "abc", Time: metav1.NewTime(clock)}
+
+	assert.Nil(t, reconciler.syncIncidents(healthCheck, &status, start.Add(time.Minute*31)))
+	assert.Len(t, status.Incidents, 2)
+
+	transition(32, cloudwatch.StateValueOk)
+	status.AlarmState = cloudwatch.StateValueOk
+	assert.Nil(t, reconciler.syncIncidents(healthCheck, &status, start.Add(time.Minute*33)))
+	assert.Len(t, status.Incidents, 2)
+
+	// The history is not read while the alarm stays OK.
+	calls := cloudwatchClient.Faults.Calls("DescribeAlarmHistory")
+	assert.Nil(t, reconciler.syncIncidents(healthCheck, &status, start.Add(time.Minute*34)))
+	assert.Equal(t, calls, cloudwatchClient.Faults.Calls("DescribeAlarmHistory"))
+
+	// The observed state is used when the history is missing.
+	status = healthcheckv1.HealthCheckStatus{
+		AlarmName:  "missing-healthcheck",
+		AlarmState: cloudwatch.StateValueAlarm,
+	}
+	assert.Nil(t, reconciler.syncIncidents(healthCheck, &status, start))
+	if assert.Len(t, status.Incidents, 1) {
+		assert.Equal(t, start, status.Incidents[0].Start.Time)
+	}
+}
+
+func TestSyncIncidentsPaged(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := start
+
+	cloudwatchClient := awsfake.NewCloudWatch()
+	cloudwatchClient.Now = func() time.Time { return clock }
+
+	reconciler := HealthCheckReconciler{
+		Log:              zap.New(),
+		CloudwatchClient: cloudwatchClient,
+	}
+
+	_, err := cloudwatchClient.PutMetricAlarm(&cloudwatch.PutMetricAlarmInput{
+		AlarmName:          aws.String("test-healthcheck"),
+		EvaluationPeriods:  aws.Int64(1),
+		ComparisonOperator: aws.String(cloudwatch.ComparisonOperatorLessThanThreshold),
+	})
+	assert.Nil(t, err)
+
+	// The open incident ends with the oldest of more than a page of transitions.
+	clock = start.Add(time.Minute)
+	assert.Nil(t, cloudwatchClient.TransitionAlarm("test-healthcheck", cloudwatch.StateValueOk, "Threshold Crossed"))
+	for i := 0; i < 110; i++ {
+		clock = start.Add(time.Duration(i+2) * time.Minute)
+		state := cloudwatch.StateValueInsufficientData
+		if i%2 == 1 {
+			state = cloudwatch.StateValueOk
+		}
+		assert.Nil(t, cloudwatchClient.TransitionAlarm("test-healthcheck", state, "Threshold Crossed"))
+	}
+
+	status := healthcheckv1.HealthCheckStatus{
+		AlarmName:  "test-healthcheck",
+		AlarmState: cloudwatch.StateValueOk,
+		Incidents:  []healthcheckv1.Incident{{Start: metav1.NewTime(start)}},
+	}
+
+	assert.Nil(t, reconciler.syncIncidents(&healthcheckv1.HealthCheck{}, &status, clock))
+	if assert.Len(t, status.Incidents, 1) && assert.NotNil(t, status.Incidents[0].End) {
+		assert.Equal(t, start.Add(time.Minute), status.Incidents[0].End.Time)
+	}
+	assert.Equal(t, 2, cloudwatchClient.Faults.Calls("DescribeAlarmHistory"))
+}
+
+func TestApplyAlarmTransition(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var incidents []healthcheckv1.Incident
+	for i := 0; i < maxIncidents; i++ {
+		incidents = applyAlarmTransition(incidents, cloudwatch.StateValueAlarm, start.Add(time.Duration(i*2)*time.Minute))
+		incidents = applyAlarmTransition(incidents, cloudwatch.StateValueInsufficientData, start.Add(time.Duration(i*2)*time.Minute+time.Second))
+		incidents = applyAlarmTransition(incidents, cloudwatch.StateValueOk, start.Add(time.Duration(i*2+1)*time.Minute))
+	}
+	assert.Len(t, incidents, maxIncidents)
+	assert.Equal(t, &metav1.Duration{Duration: time.Minute}, incidents[0].Duration)
+
+	// Transitions at or before the end of the last incident were already applied.
+	incidents = applyAlarmTransition(incidents, cloudwatch.StateValueAlarm, start)
+	assert.Len(t, incidents, maxIncidents)
+}
@@ -0,0 +1,114 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	healthcheckv1 "github.com/skpr/r53-check/api/v1"
+)
+
+// getMaintenanceWindow gets the maintenance window which is active at the
+// given time, along with the next time a window starts or ends.
+func getMaintenanceWindow(windows []healthcheckv1.MaintenanceWindow, now time.Time) (*healthcheckv1.ActiveMaintenanceWindow, time.Time, error) {
+	var (
+		active   *healthcheckv1.ActiveMaintenanceWindow
+		boundary time.Time
+	)
+
+	for _, window := range windows {
+		start, end, err := getMaintenanceWindowOccurrence(window, now)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("invalid maintenance window %q: %w", window.Name, err)
+		}
+		if start.IsZero() {
+			continue
+		}
+
+		next := start
+		if !now.Before(start) {
+			next = end
+		}
+		if !next.After(now) {
+			// The window has passed.
+			continue
+		}
+		if boundary.IsZero() || next.Before(boundary) {
+			boundary = next
+		}
+
+		if !now.Before(start) && (active == nil || end.After(active.End.Time)) {
+			active = &healthcheckv1.ActiveMaintenanceWindow{
+				Name:  window.Name,
+				Start: metav1.NewTime(start),
+				End:   metav1.NewTime(end),
+			}
+		}
+	}
+
+	return active, boundary, nil
+}
+
+// getMaintenanceWindowOccurrence gets the occurrence of a window which is
+// either active at the given time or the next one to start.
+func getMaintenanceWindowOccurrence(window healthcheckv1.MaintenanceWindow, now time.Time) (time.Time, time.Time, error) {
+	if window.Schedule != "" {
+		if window.Start != nil || window.End != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("schedule cannot be combined with start and end")
+		}
+		if window.Duration == nil || window.Duration.Duration <= 0 {
+			return time.Time{}, time.Time{}, fmt.Errorf("schedule requires a positive duration")
+		}
+
+		schedule, err := parseCron(window.Schedule)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+
+		// An occurrence which started within the last duration is still active.
+		// Otherwise this is the next occurrence to start.
+		start := schedule.next(now.Add(-window.Duration.Duration))
+		if start.IsZero() {
+			return time.Time{}, time.Time{}, nil
+		}
+		return start, start.Add(window.Duration.Duration), nil
+	}
+
+	if window.Start == nil || window.End == nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("either schedule and duration or start and end are required")
+	}
+	if !window.End.After(window.Start.Time) {
+		return time.Time{}, time.Time{}, fmt.Errorf("end must be after start")
+	}
+
+	return window.Start.Time, window.End.Time, nil
+}
+
+// getRequeueAfter requeues at the regular interval, or sooner if a
+// maintenance window starts or ends before then.
+func getRequeueAfter(boundary time.Time, now time.Time) time.Duration {
+	requeueAfter := time.Second * 30
+	if boundary.IsZero() {
+		return requeueAfter
+	}
+	if until := boundary.Sub(now); until < requeueAfter {
+		return until
+	}
+	return requeueAfter
+}
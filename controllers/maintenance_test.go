@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	healthcheckv1 "github.com/skpr/r53-check/api/v1"
+)
+
+func TestCronNext(t *testing.T) {
+	now := time.Date(2020, time.January, 15, 10, 30, 0, 0, time.UTC) // Wednesday
+
+	schedule, err := parseCron("0 2 * * *")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2020, time.January, 16, 2, 0, 0, 0, time.UTC), schedule.next(now))
+
+	schedule, err = parseCron("*/15 9-17 * * 1-5")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2020, time.January, 15, 10, 45, 0, 0, time.UTC), schedule.next(now))
+
+	// Sunday can be written as 7.
+	schedule, err = parseCron("30 23 * * 7")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2020, time.January, 19, 23, 30, 0, 0, time.UTC), schedule.next(now))
+
+	// Restricted day-of-month and day-of-week match either.
+	schedule, err = parseCron("0 0 1 * 5")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2020, time.January, 17, 0, 0, 0, 0, time.UTC), schedule.next(now))
+
+	_, err = parseCron("0 24 * * *")
+	assert.NotNil(t, err)
+
+	_, err = parseCron("0 0 * *")
+	assert.NotNil(t, err)
+}
+
+func TestGetMaintenanceWindow(t *testing.T) {
+	now := time.Date(2020, time.January, 15, 2, 30, 0, 0, time.UTC)
+
+	windows := []healthcheckv1.MaintenanceWindow{
+		{
+			Name:     "nightly",
+			Schedule: "0 2 * * *",
+			Duration: &metav1.Duration{Duration: time.Hour},
+		},
+		{
+			Name:  "migration",
+			Start: &metav1.Time{Time: time.Date(2020, time.January, 20, 0, 0, 0, 0, time.UTC)},
+			End:   &metav1.Time{Time: time.Date(2020, time.January, 20, 6, 0, 0, 0, time.UTC)},
+		},
+	}
+
+	active, boundary, err := getMaintenanceWindow(windows, now)
+	assert.Nil(t, err)
+	assert.Equal(t, "nightly", active.Name)
+	assert.Equal(t, time.Date(2020, time.January, 15, 3, 0, 0, 0, time.UTC), active.End.Time)
+	assert.Equal(t, active.End.Time, boundary)
+
+	// Between windows the boundary is the next start.
+	active, boundary, err = getMaintenanceWindow(windows, now.Add(time.Hour))
+	assert.Nil(t, err)
+	assert.Nil(t, active)
+	assert.Equal(t, time.Date(2020, time.January, 16, 2, 0, 0, 0, time.UTC), boundary)
+
+	active, _, err = getMaintenanceWindow(windows, time.Date(2020, time.January, 20, 5, 0, 0, 0, time.UTC))
+	assert.Nil(t, err)
+	assert.Equal(t, "migration", active.Name)
+
+	assert.Equal(t, 10*time.Second, getRequeueAfter(now.Add(10*time.Second), now))
+	assert.Equal(t, 30*time.Second, getRequeueAfter(time.Time{}, now))
+
+	_, _, err = getMaintenanceWindow([]healthcheckv1.MaintenanceWindow{{Name: "invalid", Schedule: "0 2 * * *"}}, now)
+	assert.NotNil(t, err)
+}
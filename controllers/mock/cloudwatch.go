@@ -24,3 +24,39 @@ func (c *CloudwatchClient) PutMetricAlarm(*cloudwatch.PutMetricAlarmInput) (*clo
 func (c *CloudwatchClient) DeleteAlarms(*cloudwatch.DeleteAlarmsInput) (*cloudwatch.DeleteAlarmsOutput, error) {
 	return &cloudwatch.DeleteAlarmsOutput{}, nil
 }
+
+func (c *CloudwatchClient) EnableAlarmActions(*cloudwatch.EnableAlarmActionsInput) (*cloudwatch.EnableAlarmActionsOutput, error) {
+	return &cloudwatch.EnableAlarmActionsOutput{}, nil
+}
+
+func (c *CloudwatchClient) DisableAlarmActions(*cloudwatch.DisableAlarmActionsInput) (*cloudwatch.DisableAlarmActionsOutput, error) {
+	return &cloudwatch.DisableAlarmActionsOutput{}, nil
+}
+
+func (c *CloudwatchClient) PutMetricData(*cloudwatch.PutMetricDataInput) (*cloudwatch.PutMetricDataOutput, error) {
+	return &cloudwatch.PutMetricDataOutput{}, nil
+}
+
+func (c *CloudwatchClient) GetMetricStatistics(*cloudwatch.GetMetricStatisticsInput) (*cloudwatch.GetMetricStatisticsOutput, error) {
+	return &cloudwatch.GetMetricStatisticsOutput{}, nil
+}
+
+func (c *CloudwatchClient) DescribeAlarmHistory(*cloudwatch.DescribeAlarmHistoryInput) (*cloudwatch.DescribeAlarmHistoryOutput, error) {
+	return &cloudwatch.DescribeAlarmHistoryOutput{}, nil
+}
+
+func (c *CloudwatchClient) PutDashboard(*cloudwatch.PutDashboardInput) (*cloudwatch.PutDashboardOutput, error) {
+	return &cloudwatch.PutDashboardOutput{}, nil
+}
+
+func (c *CloudwatchClient) GetDashboard(*cloudwatch.GetDashboardInput) (*cloudwatch.GetDashboardOutput, error) {
+	return &cloudwatch.GetDashboardOutput{}, nil
+}
+
+func (c *CloudwatchClient) DeleteDashboards(*cloudwatch.DeleteDashboardsInput) (*cloudwatch.DeleteDashboardsOutput, error) {
+	return &cloudwatch.DeleteDashboardsOutput{}, nil
+}
+
+func (c *CloudwatchClient) SetAlarmState(*cloudwatch.SetAlarmStateInput) (*cloudwatch.SetAlarmStateOutput, error) {
+	return &cloudwatch.SetAlarmStateOutput{}, nil
+}
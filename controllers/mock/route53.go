@@ -26,6 +26,55 @@ func (r *Route53Client) ChangeTagsForResource(*route53.ChangeTagsForResourceInpu
 	return &route53.ChangeTagsForResourceOutput{}, nil
 }
 
+func (r *Route53Client) ListTagsForResource(input *route53.ListTagsForResourceInput) (*route53.ListTagsForResourceOutput, error) {
+	return &route53.ListTagsForResourceOutput{
+		ResourceTagSet: &route53.ResourceTagSet{
+			ResourceId:   input.ResourceId,
+			ResourceType: input.ResourceType,
+		},
+	}, nil
+}
+
 func (r *Route53Client) DeleteHealthCheck(*route53.DeleteHealthCheckInput) (*route53.DeleteHealthCheckOutput, error) {
 	return &route53.DeleteHealthCheckOutput{}, nil
 }
+
+func (r *Route53Client) ChangeResourceRecordSets(*route53.ChangeResourceRecordSetsInput) (*route53.ChangeResourceRecordSetsOutput, error) {
+	return &route53.ChangeResourceRecordSetsOutput{
+		ChangeInfo: &route53.ChangeInfo{
+			Id:     aws.String("/change/C123"),
+			Status: aws.String(route53.ChangeStatusPending),
+		},
+	}, nil
+}
+
+func (r *Route53Client) ListResourceRecordSets(*route53.ListResourceRecordSetsInput) (*route53.ListResourceRecordSetsOutput, error) {
+	return &route53.ListResourceRecordSetsOutput{}, nil
+}
+
+func (r *Route53Client) GetHealthCheck(input *route53.GetHealthCheckInput) (*route53.GetHealthCheckOutput, error) {
+	return &route53.GetHealthCheckOutput{
+		HealthCheck: &route53.HealthCheck{
+			Id:                 input.HealthCheckId,
+			HealthCheckVersion: aws.Int64(1),
+			HealthCheckConfig:  &route53.HealthCheckConfig{},
+		},
+	}, nil
+}
+
+func (r *Route53Client) UpdateHealthCheck(*route53.UpdateHealthCheckInput) (*route53.UpdateHealthCheckOutput, error) {
+	return &route53.UpdateHealthCheckOutput{}, nil
+}
+
+func (r *Route53Client) GetHealthCheckStatus(*route53.GetHealthCheckStatusInput) (*route53.GetHealthCheckStatusOutput, error) {
+	return &route53.GetHealthCheckStatusOutput{
+		HealthCheckObservations: []*route53.HealthCheckObservation{
+			{
+				Region: aws.String(route53.HealthCheckRegionUsEast1),
+				StatusReport: &route53.StatusReport{
+					Status: aws.String("Success: HTTP Status Code 200, OK"),
+				},
+			},
+		},
+	}, nil
+}
@@ -0,0 +1,115 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	healthcheckv1 "github.com/skpr/r53-check/api/v1"
+	"github.com/skpr/r53-check/internal/quota"
+)
+
+// quotaRequeueAfter is how long a health check which exceeds a quota waits
+// for health checks to be freed.
+const quotaRequeueAfter = time.Minute * 5
+
+// checkQuota refuses to create a Route53 health check near the account limit,
+// or over the quotas of the namespace. The webhook denies HealthChecks over
+// the quotas, but not those created before the quota or while it was down.
+// Admissions are not shared between shards, see quota.Admissions.
+func (r *HealthCheckReconciler) checkQuota(ctx context.Context, healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus) error {
+	if status.HealthCheckId != "" || healthCheck.Spec.Backend == healthcheckv1.BackendInCluster {
+		// The created health check is counted from the cache from now on.
+		r.Admissions.Forget(healthCheck.Namespace, healthCheck.Name)
+		return nil
+	}
+
+	// Admissions are serialized, so concurrent reconciles of the namespace
+	// see each other's health checks before they are in the cache.
+	err := r.Admissions.Admit(healthCheck.Namespace, healthCheck.Name, func(admitted map[string]bool) error {
+		return r.checkNamespaceQuotas(ctx, healthCheck, admitted)
+	})
+	if err != nil {
+		return err
+	}
+
+	if r.Account != nil {
+		return r.Account.Check()
+	}
+	return nil
+}
+
+// checkNamespaceQuotas refuses to create a health check over the quotas of the
+// namespace. The same HealthChecks are counted as by the webhook.
+func (r *HealthCheckReconciler) checkNamespaceQuotas(ctx context.Context, healthCheck *healthcheckv1.HealthCheck, admitted map[string]bool) error {
+	quotas := &healthcheckv1.HealthCheckQuotaList{}
+	if err := r.List(ctx, quotas, client.InNamespace(healthCheck.Namespace)); err != nil {
+		return fmt.Errorf("failed to list quotas: %w", err)
+	}
+	if len(quotas.Items) == 0 {
+		return nil
+	}
+
+	healthChecks := &healthcheckv1.HealthCheckList{}
+	if err := r.List(ctx, healthChecks, client.InNamespace(healthCheck.Namespace)); err != nil {
+		return fmt.Errorf("failed to list health checks: %w", err)
+	}
+
+	before := quota.Sum(quota.Counted(healthChecks.Items, healthCheck, admitted))
+	after := quota.Add(before, quota.UsageOf(healthCheck))
+	for _, q := range quotas.Items {
+		if denied := quota.Admit(q.Spec, before, after); len(denied) > 0 {
+			return &quota.ExceededError{
+				Reason:  quota.ReasonNamespaceQuota,
+				Message: fmt.Sprintf("HealthCheckQuota %s would be exceeded: %s", q.Name, strings.Join(denied, ", ")),
+			}
+		}
+	}
+
+	return nil
+}
+
+// requeueQuotaExceeded records that the health check was not created because
+// of a quota, and checks again later.
+func (r *HealthCheckReconciler) requeueQuotaExceeded(req ctrl.Request, exceeded *quota.ExceededError) (ctrl.Result, error) {
+	ctx := context.Background()
+
+	healthCheck := &healthcheckv1.HealthCheck{}
+	if err := r.Get(ctx, req.NamespacedName, healthCheck); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	if condition := getCondition(healthCheck.Status.Conditions, healthcheckv1.ConditionQuotaExceeded); condition == nil || condition.Status != corev1.ConditionTrue {
+		recordWarning(r.Recorder, healthCheck, "QuotaExceeded", "Health check was not created: %s", exceeded.Message)
+	}
+
+	status := *healthCheck.Status.DeepCopy()
+	status.Conditions = setCondition(status.Conditions, healthcheckv1.ConditionQuotaExceeded, corev1.ConditionTrue, exceeded.Reason, exceeded.Message)
+
+	err := r.syncStatus(healthCheck, status, ctx)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to sync status %v %w", healthCheck, err)
+	}
+
+	return ctrl.Result{RequeueAfter: quotaRequeueAfter}, nil
+}
@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	healthcheckv1 "github.com/skpr/r53-check/api/v1"
+	"github.com/skpr/r53-check/internal/awsfake"
+	"github.com/skpr/r53-check/internal/quota"
+)
+
+func TestReconcileQuotaExceeded(t *testing.T) {
+	err := healthcheckv1.AddToScheme(scheme.Scheme)
+	assert.Nil(t, err)
+
+	newHealthCheck := func(name string) *healthcheckv1.HealthCheck {
+		healthcheck := newTestHealthCheck()
+		healthcheck.ObjectMeta.Name = name
+		healthcheck.ObjectMeta.UID = types.UID(name + "xxxxxxxxxxxxxxxxxxxxxxx")
+		healthcheck.Spec.NamePrefix = name
+		healthcheck.Spec.Domain = name + ".example.skpr.io"
+		return healthcheck
+	}
+
+	healthCheckQuota := &healthcheckv1.HealthCheckQuota{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "tenant",
+			Namespace: corev1.NamespaceDefault,
+		},
+		Spec: healthcheckv1.HealthCheckQuotaSpec{
+			HealthChecks: pointer.Int64Ptr(1),
+		},
+	}
+
+	client := fake.NewFakeClientWithScheme(scheme.Scheme, newHealthCheck("first"), newHealthCheck("second"), healthCheckQuota)
+	route53Client := awsfake.NewRoute53()
+	recorder := record.NewFakeRecorder(10)
+
+	// The limit is read every time, so it can be raised during the test.
+	account := quota.NewAccount(route53Client, 1)
+	account.LimitTTL = 0
+
+	reconciler := HealthCheckReconciler{
+		Client:           client,
+		Log:              zap.New(),
+		Scheme:           scheme.Scheme,
+		Route53Client:    route53Client,
+		CloudwatchClient: awsfake.NewCloudWatch(),
+		Recorder:         recorder,
+		Account:          account,
+	}
+
+	// reconcile reconciles a HealthCheck, and gets its QuotaExceeded condition.
+	reconcile := func(name string) *healthcheckv1.HealthCheckCondition {
+		query := types.NamespacedName{Name: name, Namespace: corev1.NamespaceDefault}
+
+		_, err := reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+		assert.Nil(t, err)
+
+		healthcheck := &healthcheckv1.HealthCheck{}
+		err = client.Get(context.TODO(), query, healthcheck)
+		assert.Nil(t, err)
+		return getCondition(healthcheck.Status.Conditions, healthcheckv1.ConditionQuotaExceeded)
+	}
+
+	assert.Nil(t, reconcile("first"))
+	assert.Len(t, route53Client.HealthChecks(), 1)
+
+	// The namespace quota is used up by the first health check.
+	condition := reconcile("second")
+	assert.Equal(t, corev1.ConditionTrue, condition.Status)
+	assert.Equal(t, quota.ReasonNamespaceQuota, condition.Reason)
+	assert.Equal(t, "HealthCheckQuota tenant would be exceeded: health_checks: 2 > 1", condition.Message)
+	assert.Len(t, route53Client.HealthChecks(), 1)
+	assert.Equal(t, "Warning QuotaExceeded Health check was not created: HealthCheckQuota tenant would be exceeded: health_checks: 2 > 1", <-recorder.Events)
+
+	// The account limit, less the headroom, is used up too.
+	healthCheckQuota.Spec.HealthChecks = pointer.Int64Ptr(2)
+	err = client.Update(context.TODO(), healthCheckQuota)
+	assert.Nil(t, err)
+	route53Client.SetHealthCheckLimit(2)
+
+	condition = reconcile("second")
+	assert.Equal(t, quota.ReasonAccountLimit, condition.Reason)
+	assert.Len(t, route53Client.HealthChecks(), 1)
+
+	route53Client.SetHealthCheckLimit(3)
+
+	condition = reconcile("second")
+	assert.Equal(t, corev1.ConditionFalse, condition.Status)
+	assert.Equal(t, "WithinQuota", condition.Reason)
+	assert.Len(t, route53Client.HealthChecks(), 2)
+}
+
+func TestCheckQuotaAdmissions(t *testing.T) {
+	err := healthcheckv1.AddToScheme(scheme.Scheme)
+	assert.Nil(t, err)
+
+	first := &healthcheckv1.HealthCheck{ObjectMeta: metav1.ObjectMeta{Name: "first", Namespace: corev1.NamespaceDefault}}
+	second := &healthcheckv1.HealthCheck{ObjectMeta: metav1.ObjectMeta{Name: "second", Namespace: corev1.NamespaceDefault}}
+	healthCheckQuota := &healthcheckv1.HealthCheckQuota{
+		ObjectMeta: metav1.ObjectMeta{Name: "tenant", Namespace: corev1.NamespaceDefault},
+		Spec:       healthcheckv1.HealthCheckQuotaSpec{HealthChecks: pointer.Int64Ptr(1)},
+	}
+
+	reconciler := HealthCheckReconciler{
+		Client:     fake.NewFakeClientWithScheme(scheme.Scheme, first, second, healthCheckQuota),
+		Log:        zap.New(),
+		Admissions: quota.NewAdmissions(),
+	}
+
+	// The first health check is counted before its id is in the cache.
+	assert.Nil(t, reconciler.checkQuota(context.TODO(), first, &first.Status))
+	err = reconciler.checkQuota(context.TODO(), second, &second.Status)
+	assert.IsType(t, &quota.ExceededError{}, err)
+}
@@ -23,8 +23,10 @@ import (
 	. "github.com/onsi/gomega"
 
 	route53v1 "github.com/skpr/r53-check/api/v1"
+	"github.com/skpr/r53-check/internal/awsfake"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/envtest"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
@@ -39,6 +41,11 @@ var cfg *rest.Config
 var k8sClient client.Client
 var testEnv *envtest.Environment
 
+// The manager runs against these fakes, which specs inspect and inject faults into.
+var route53Fake *awsfake.Route53
+var cloudwatchFake *awsfake.CloudWatch
+var stopManager chan struct{}
+
 func TestAPIs(t *testing.T) {
 	RegisterFailHandler(Fail)
 
@@ -69,11 +76,57 @@ var _ = BeforeSuite(func(done Done) {
 	Expect(err).ToNot(HaveOccurred())
 	Expect(k8sClient).ToNot(BeNil())
 
+	By("starting the manager")
+	route53Fake = awsfake.NewRoute53()
+	cloudwatchFake = awsfake.NewCloudWatch()
+
+	mgr, err := ctrl.NewManager(cfg, ctrl.Options{
+		Scheme:             scheme.Scheme,
+		MetricsBindAddress: "0",
+	})
+	Expect(err).ToNot(HaveOccurred())
+
+	err = (&HealthCheckReconciler{
+		Client:           mgr.GetClient(),
+		Log:              ctrl.Log.WithName("controllers").WithName("HealthCheck"),
+		Scheme:           mgr.GetScheme(),
+		Route53Client:    route53Fake,
+		CloudwatchClient: cloudwatchFake,
+		Recorder:         mgr.GetEventRecorderFor("healthcheck-controller"),
+	}).SetupWithManager(mgr)
+	Expect(err).ToNot(HaveOccurred())
+
+	err = (&DNSRecordReconciler{
+		Client:        mgr.GetClient(),
+		Log:           ctrl.Log.WithName("controllers").WithName("DNSRecord"),
+		Scheme:        mgr.GetScheme(),
+		Route53Client: route53Fake,
+	}).SetupWithManager(mgr)
+	Expect(err).ToNot(HaveOccurred())
+
+	err = (&HealthCheckDashboardReconciler{
+		Client:           mgr.GetClient(),
+		Log:              ctrl.Log.WithName("controllers").WithName("HealthCheckDashboard"),
+		Scheme:           mgr.GetScheme(),
+		CloudwatchClient: cloudwatchFake,
+	}).SetupWithManager(mgr)
+	Expect(err).ToNot(HaveOccurred())
+
+	stopManager = make(chan struct{})
+	go func() {
+		defer GinkgoRecover()
+		err := mgr.Start(stopManager)
+		Expect(err).ToNot(HaveOccurred())
+	}()
+
 	close(done)
 }, 60)
 
 var _ = AfterSuite(func() {
 	By("tearing down the test environment")
+	if stopManager != nil {
+		close(stopManager)
+	}
 	err := testEnv.Stop()
 	Expect(err).ToNot(HaveOccurred())
 })
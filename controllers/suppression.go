@@ -0,0 +1,164 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	healthcheckv1 "github.com/skpr/r53-check/api/v1"
+)
+
+// defaultMaxRolloutSuppression is used when the workload reference does not set one.
+const defaultMaxRolloutSuppression = time.Minute * 10
+
+// Reasons for the AlarmSuppressed condition.
+const (
+	suppressionReasonMaintenance = "Maintenance"
+	suppressionReasonRollout     = "Rollout"
+	suppressionReasonScaledDown  = "ScaledToZero"
+	suppressionReasonSleeping    = "NamespaceSleeping"
+)
+
+// suppression describes whether the health check should be disabled and its
+// alarm actions suppressed.
+type suppression struct {
+	DisableCheck        bool
+	DisableAlarmActions bool
+	// Boundary is the next time the suppression will change on its own.
+	Boundary time.Time
+
+	reasons  []string
+	messages []string
+}
+
+// add records a reason for the suppression.
+func (s *suppression) add(reason, message string, disableCheck bool) {
+	s.DisableAlarmActions = true
+	s.DisableCheck = s.DisableCheck || disableCheck
+	s.reasons = append(s.reasons, reason)
+	s.messages = append(s.messages, message)
+}
+
+// until moves the boundary forward to t when it is sooner.
+func (s *suppression) until(t time.Time) {
+	if t.IsZero() {
+		return
+	}
+	if s.Boundary.IsZero() || t.Before(s.Boundary) {
+		s.Boundary = t
+	}
+}
+
+// getSuppression works out whether the health check and its alarm should be
+// quietened, recording why in the status.
+func (r *HealthCheckReconciler) getSuppression(ctx context.Context, healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus, now time.Time) (suppression, error) {
+	var result suppression
+
+	window, boundary, err := getMaintenanceWindow(healthCheck.Spec.MaintenanceWindows, now)
+	if err != nil {
+		return result, err
+	}
+	if window != nil && status.MaintenanceWindow == nil {
+		r.Log.Info(fmt.Sprintf("Entering maintenance window: %s", healthCheck.Name), "window", window.Name, "end", window.End)
+	}
+	status.MaintenanceWindow = window
+	result.until(boundary)
+	if window != nil {
+		result.add(suppressionReasonMaintenance, fmt.Sprintf("Maintenance window %q until %s", window.Name, window.End.UTC().Format(time.RFC3339)), true)
+	}
+
+	workload, err := r.getWorkloadStatus(ctx, healthCheck)
+	if err != nil {
+		return result, err
+	}
+	r.syncRolloutSuppression(healthCheck, status, workload, now, &result)
+
+	// Idle environments should not alert, or cost money checking sites which are down.
+	if workload.ScaledToZero {
+		ref := healthCheck.Spec.Workload
+		result.add(suppressionReasonScaledDown, fmt.Sprintf("%s %s is scaled to zero", ref.Kind, ref.Name), true)
+	}
+
+	sleeping, err := r.isNamespaceSleeping(ctx, healthCheck.Namespace)
+	if err != nil {
+		return result, err
+	}
+	if sleeping {
+		result.add(suppressionReasonSleeping, fmt.Sprintf("Namespace %s has the %s annotation", healthCheck.Namespace, healthcheckv1.AnnotationSleep), true)
+	}
+
+	if len(result.reasons) > 0 {
+		status.Conditions = setCondition(status.Conditions, healthcheckv1.ConditionAlarmSuppressed, corev1.ConditionTrue,
+			result.reasons[0], strings.Join(result.messages, "; "))
+	} else {
+		status.Conditions = setCondition(status.Conditions, healthcheckv1.ConditionAlarmSuppressed, corev1.ConditionFalse, "", "")
+	}
+
+	return result, nil
+}
+
+// isAlarmSuppressed checks if getSuppression suppressed the alarm actions.
+func isAlarmSuppressed(status *healthcheckv1.HealthCheckStatus) bool {
+	condition := getCondition(status.Conditions, healthcheckv1.ConditionAlarmSuppressed)
+	return condition != nil && condition.Status == corev1.ConditionTrue
+}
+
+// syncRolloutSuppression suppresses alarm actions while the workload rolls
+// out, for at most the configured duration, and records each suppression as an event.
+func (r *HealthCheckReconciler) syncRolloutSuppression(healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus, workload workloadStatus, now time.Time, result *suppression) {
+	ref := healthCheck.Spec.Workload
+
+	if !workload.RollingOut {
+		if status.RolloutStarted != nil {
+			recordEvent(r.Recorder, healthCheck, corev1.EventTypeNormal, "RolloutFinished",
+				"%s %s finished rolling out after %s, alarm actions are no longer suppressed", ref.Kind, ref.Name, now.Sub(status.RolloutStarted.Time).Round(time.Second))
+			status.RolloutStarted = nil
+		}
+		return
+	}
+
+	if status.RolloutStarted == nil {
+		started := metav1.NewTime(now)
+		status.RolloutStarted = &started
+		recordEvent(r.Recorder, healthCheck, corev1.EventTypeNormal, "RolloutStarted",
+			"%s %s is rolling out, suppressing alarm actions", ref.Kind, ref.Name)
+	}
+
+	max := defaultMaxRolloutSuppression
+	if ref.MaxRolloutSuppression != nil {
+		max = ref.MaxRolloutSuppression.Duration
+	}
+
+	expires := status.RolloutStarted.Add(max)
+	if now.Before(expires) {
+		result.add(suppressionReasonRollout, fmt.Sprintf("%s %s is rolling out", ref.Kind, ref.Name), false)
+		result.until(expires)
+		return
+	}
+
+	// Only report the expiry once, when the suppression is lifted.
+	if condition := getCondition(status.Conditions, healthcheckv1.ConditionAlarmSuppressed); condition != nil &&
+		condition.Status == corev1.ConditionTrue && condition.Reason == suppressionReasonRollout {
+		recordWarning(r.Recorder, healthCheck, "RolloutSuppressionExpired",
+			"%s %s is still rolling out after %s, alarm actions are no longer suppressed", ref.Kind, ref.Name, max)
+	}
+}
@@ -0,0 +1,194 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	healthcheckv1 "github.com/skpr/r53-check/api/v1"
+)
+
+const (
+	// uptimeRefreshInterval is how often the availability is pulled from CloudWatch.
+	uptimeRefreshInterval = time.Hour
+	// uptimePeriod is the granularity of the statistics, in seconds.
+	uptimePeriod = 3600
+	// defaultSLOWindow is the window the error budget is calculated over.
+	defaultSLOWindow = "30d"
+)
+
+// uptimeWindows are the rolling windows availability is reported for.
+var uptimeWindows = map[string]time.Duration{
+	"1d":  time.Hour * 24,
+	"7d":  time.Hour * 24 * 7,
+	"30d": time.Hour * 24 * 30,
+}
+
+// syncUptime refreshes the availability when it is stale and calculates the
+// error budget from it.
+func (r *HealthCheckReconciler) syncUptime(healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus, now time.Time) error {
+	if status.Uptime == nil || now.Sub(status.Uptime.LastUpdated.Time) >= uptimeRefreshInterval {
+		uptime, err := r.getUptime(healthCheck, status, now)
+		if err != nil {
+			// The availability is only reported, so it does not hold back the
+			// health check. The last uptime is kept until it can be refreshed.
+			r.Log.Error(err, "failed to get uptime")
+			status.Conditions = setCondition(status.Conditions, healthcheckv1.ConditionUptimeUnavailable, corev1.ConditionTrue,
+				"MetricsUnavailable", err.Error())
+		} else {
+			if uptime != nil {
+				status.Uptime = uptime
+			}
+			if getCondition(status.Conditions, healthcheckv1.ConditionUptimeUnavailable) != nil {
+				status.Conditions = setCondition(status.Conditions, healthcheckv1.ConditionUptimeUnavailable, corev1.ConditionFalse, "Refreshed", "")
+			}
+		}
+	}
+
+	return syncErrorBudget(healthCheck, status)
+}
+
+// getUptime gets the availability over each window from the health metric,
+// or nil when nothing is publishing it.
+func (r *HealthCheckReconciler) getUptime(healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus, now time.Time) (*healthcheckv1.Uptime, error) {
+	switch getBackend(healthCheck) {
+	case healthcheckv1.BackendRoute53:
+		if status.HealthCheckId == "" {
+			return nil, nil
+		}
+	case healthcheckv1.BackendInCluster:
+		if r.Prober == nil || !r.Prober.PublishesToCloudWatch() {
+			return nil, nil
+		}
+	}
+
+	namespace, metricName, dimensions := getHealthMetric(healthCheck, status.HealthCheckId)
+
+	// The metric is 1 while healthy, so the average of all samples is the availability.
+	output, err := r.CloudwatchClient.GetMetricStatistics(&cloudwatch.GetMetricStatisticsInput{
+		Namespace:  namespace,
+		MetricName: metricName,
+		Dimensions: dimensions,
+		StartTime:  aws.Time(now.Add(-uptimeWindows["30d"])),
+		EndTime:    aws.Time(now),
+		Period:     aws.Int64(uptimePeriod),
+		Statistics: aws.StringSlice([]string{cloudwatch.StatisticSum, cloudwatch.StatisticSampleCount}),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &healthcheckv1.Uptime{
+		OneDay:      getAvailability(output.Datapoints, now.Add(-uptimeWindows["1d"])),
+		SevenDays:   getAvailability(output.Datapoints, now.Add(-uptimeWindows["7d"])),
+		ThirtyDays:  getAvailability(output.Datapoints, now.Add(-uptimeWindows["30d"])),
+		LastUpdated: metav1.NewTime(now),
+	}, nil
+}
+
+// getAvailability gets the percentage of healthy samples since a time, or ""
+// when there are no samples.
+func getAvailability(datapoints []*cloudwatch.Datapoint, since time.Time) string {
+	var sum, count float64
+	for _, datapoint := range datapoints {
+		if aws.TimeValue(datapoint.Timestamp).Before(since) {
+			continue
+		}
+		sum += aws.Float64Value(datapoint.Sum)
+		count += aws.Float64Value(datapoint.SampleCount)
+	}
+	if count == 0 {
+		return ""
+	}
+	return formatPercentage(sum / count * 100)
+}
+
+// syncErrorBudget calculates how much of the error budget remains and whether
+// it has been exhausted.
+func syncErrorBudget(healthCheck *healthcheckv1.HealthCheck, status *healthcheckv1.HealthCheckStatus) error {
+	slo := healthCheck.Spec.SLO
+	if slo == nil {
+		if status.Uptime != nil {
+			status.Uptime.ErrorBudgetRemaining = ""
+		}
+		status.Conditions = removeCondition(status.Conditions, healthcheckv1.ConditionErrorBudgetExhausted)
+		return nil
+	}
+
+	target, err := strconv.ParseFloat(slo.Target, 64)
+	if err != nil || target < 0 || target >= 100 {
+		return fmt.Errorf("invalid SLO target: %s", slo.Target)
+	}
+
+	window := slo.Window
+	if window == "" {
+		window = defaultSLOWindow
+	}
+
+	var availability string
+	if status.Uptime != nil {
+		switch window {
+		case "1d":
+			availability = status.Uptime.OneDay
+		case "7d":
+			availability = status.Uptime.SevenDays
+		case "30d":
+			availability = status.Uptime.ThirtyDays
+		default:
+			return fmt.Errorf("invalid SLO window: %s", window)
+		}
+	}
+
+	if availability == "" {
+		if status.Uptime != nil {
+			status.Uptime.ErrorBudgetRemaining = ""
+		}
+		status.Conditions = setCondition(status.Conditions, healthcheckv1.ConditionErrorBudgetExhausted, corev1.ConditionUnknown,
+			"NoData", fmt.Sprintf("No availability has been reported over %s", window))
+		return nil
+	}
+
+	actual, err := strconv.ParseFloat(availability, 64)
+	if err != nil {
+		return err
+	}
+
+	budget := 100 - target
+	remaining := (budget - (100 - actual)) / budget * 100
+	status.Uptime.ErrorBudgetRemaining = formatPercentage(remaining)
+
+	if remaining <= 0 {
+		status.Conditions = setCondition(status.Conditions, healthcheckv1.ConditionErrorBudgetExhausted, corev1.ConditionTrue,
+			"BelowTarget", fmt.Sprintf("Availability over %s is %s%%, below the %s%% target", window, availability, slo.Target))
+	} else {
+		status.Conditions = setCondition(status.Conditions, healthcheckv1.ConditionErrorBudgetExhausted, corev1.ConditionFalse,
+			"WithinBudget", fmt.Sprintf("%s%% of the error budget over %s remains", status.Uptime.ErrorBudgetRemaining, window))
+	}
+
+	return nil
+}
+
+// formatPercentage formats a percentage for the status.
+func formatPercentage(value float64) string {
+	return strconv.FormatFloat(value, 'f', 3, 64)
+}
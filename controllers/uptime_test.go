@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	healthcheckv1 "github.com/skpr/r53-check/api/v1"
+	"github.com/skpr/r53-check/internal/awsfake"
+)
+
+func TestSyncUptime(t *testing.T) {
+	cloudwatchClient := awsfake.NewCloudWatch()
+
+	reconciler := HealthCheckReconciler{
+		Log:              zap.New(),
+		CloudwatchClient: cloudwatchClient,
+	}
+
+	healthcheck := &healthcheckv1.HealthCheck{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: corev1.NamespaceDefault,
+		},
+		Spec: healthcheckv1.HealthCheckSpec{
+			SLO: &healthcheckv1.SLO{
+				Target: "99",
+				Window: "7d",
+			},
+		},
+	}
+
+	now := time.Date(2020, 1, 31, 0, 0, 0, 0, time.UTC)
+
+	// putStatus publishes a sample of the Route53 health metric.
+	putStatus := func(timestamp time.Time, value float64) {
+		_, err := cloudwatchClient.PutMetricData(&cloudwatch.PutMetricDataInput{
+			Namespace: aws.String("AWS/Route53"),
+			MetricData: []*cloudwatch.MetricDatum{
+				{
+					MetricName: aws.String("HealthCheckStatus"),
+					Dimensions: []*cloudwatch.Dimension{{Name: aws.String("HealthCheckId"), Value: aws.String("abc")}},
+					Timestamp:  aws.Time(timestamp),
+					Value:      aws.Float64(value),
+				},
+			},
+		})
+		assert.Nil(t, err)
+	}
+
+	// Nothing is reported until the health check exists.
+	status := healthcheckv1.HealthCheckStatus{}
+	assert.Nil(t, reconciler.syncUptime(healthcheck, &status, now))
+	assert.Nil(t, status.Uptime)
+	assert.Equal(t, corev1.ConditionUnknown, getCondition(status.Conditions, healthcheckv1.ConditionErrorBudgetExhausted).Status)
+
+	// Healthy for the last day, unhealthy for a quarter of the samples 3 days ago
+	// and for all of the samples 20 days ago.
+	for i := 0; i < 100; i++ {
+		offset := time.Duration(i) * time.Minute
+		putStatus(now.Add(-time.Hour*12+offset), 1)
+		if i%4 == 0 {
+			putStatus(now.Add(-time.Hour*72+offset), 0)
+		} else {
+			putStatus(now.Add(-time.Hour*72+offset), 1)
+		}
+		putStatus(now.Add(-time.Hour*480+offset), 0)
+	}
+
+	status.HealthCheckId = "abc"
+	assert.Nil(t, reconciler.syncUptime(healthcheck, &status, now))
+	assert.Equal(t, &healthcheckv1.Uptime{
+		OneDay:               "100.000",
+		SevenDays:            "87.500",
+		ThirtyDays:           "58.333",
+		ErrorBudgetRemaining: "-1150.000",
+		LastUpdated:          metav1.NewTime(now),
+	}, status.Uptime)
+	assert.Equal(t, corev1.ConditionTrue, getCondition(status.Conditions, healthcheckv1.ConditionErrorBudgetExhausted).Status)
+
+	// The budget follows the SLO between refreshes.
+	for i := 0; i < 100; i++ {
+		putStatus(now.Add(-time.Hour+time.Duration(i)*time.Second), 1)
+	}
+	healthcheck.Spec.SLO.Window = "1d"
+	assert.Nil(t, reconciler.syncUptime(healthcheck, &status, now.Add(time.Minute*30)))
+	assert.Equal(t, "87.500", status.Uptime.SevenDays)
+	assert.Equal(t, "100.000", status.Uptime.ErrorBudgetRemaining)
+	assert.Equal(t, corev1.ConditionFalse, getCondition(status.Conditions, healthcheckv1.ConditionErrorBudgetExhausted).Status)
+
+	// The availability is refreshed hourly.
+	assert.Nil(t, reconciler.syncUptime(healthcheck, &status, now.Add(time.Hour)))
+	assert.Equal(t, "91.667", status.Uptime.SevenDays)
+	assert.Nil(t, getCondition(status.Conditions, healthcheckv1.ConditionUptimeUnavailable))
+
+	// The last uptime is kept when it cannot be refreshed.
+	cloudwatchClient.Faults.Inject("GetMetricStatistics", awsfake.NewError("InternalServiceError", "failed", 500))
+	assert.Nil(t, reconciler.syncUptime(healthcheck, &status, now.Add(time.Hour*2)))
+	assert.Equal(t, metav1.NewTime(now.Add(time.Hour)), status.Uptime.LastUpdated)
+	assert.Equal(t, "91.667", status.Uptime.SevenDays)
+	assert.Equal(t, corev1.ConditionTrue, getCondition(status.Conditions, healthcheckv1.ConditionUptimeUnavailable).Status)
+
+	assert.Nil(t, reconciler.syncUptime(healthcheck, &status, now.Add(time.Hour*2)))
+	assert.Equal(t, metav1.NewTime(now.Add(time.Hour*2)), status.Uptime.LastUpdated)
+	assert.Equal(t, corev1.ConditionFalse, getCondition(status.Conditions, healthcheckv1.ConditionUptimeUnavailable).Status)
+
+	healthcheck.Spec.SLO = nil
+	assert.Nil(t, reconciler.syncUptime(healthcheck, &status, now.Add(time.Hour*2)))
+	assert.Empty(t, status.Uptime.ErrorBudgetRemaining)
+	assert.Nil(t, getCondition(status.Conditions, healthcheckv1.ConditionErrorBudgetExhausted))
+}
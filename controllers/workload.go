@@ -0,0 +1,208 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	healthcheckv1 "github.com/skpr/r53-check/api/v1"
+)
+
+// workloadIndexKey indexes HealthChecks by the workload they reference.
+const workloadIndexKey = "spec.workload"
+
+// workloadStatus is what the controller observes about a referenced workload.
+type workloadStatus struct {
+	// Found is false when the workload does not exist.
+	Found bool
+	// RollingOut is true while pods are being replaced.
+	RollingOut bool
+	// ScaledToZero is true when no replicas are desired.
+	ScaledToZero bool
+}
+
+// getWorkloadStatus observes the workload referenced by the health check.
+func (r *HealthCheckReconciler) getWorkloadStatus(ctx context.Context, healthCheck *healthcheckv1.HealthCheck) (workloadStatus, error) {
+	ref := healthCheck.Spec.Workload
+	if ref == nil {
+		return workloadStatus{}, nil
+	}
+
+	key := types.NamespacedName{
+		Namespace: healthCheck.Namespace,
+		Name:      ref.Name,
+	}
+
+	switch ref.Kind {
+	case healthcheckv1.WorkloadKindDeployment:
+		deployment := &appsv1.Deployment{}
+		if err := r.Get(ctx, key, deployment); err != nil {
+			if errors.IsNotFound(err) {
+				return workloadStatus{}, nil
+			}
+			return workloadStatus{}, err
+		}
+		return workloadStatus{
+			Found:        true,
+			RollingOut:   isDeploymentRollingOut(deployment),
+			ScaledToZero: getReplicas(deployment.Spec.Replicas) == 0,
+		}, nil
+
+	case healthcheckv1.WorkloadKindStatefulSet:
+		statefulSet := &appsv1.StatefulSet{}
+		if err := r.Get(ctx, key, statefulSet); err != nil {
+			if errors.IsNotFound(err) {
+				return workloadStatus{}, nil
+			}
+			return workloadStatus{}, err
+		}
+		return workloadStatus{
+			Found:        true,
+			RollingOut:   isStatefulSetRollingOut(statefulSet),
+			ScaledToZero: getReplicas(statefulSet.Spec.Replicas) == 0,
+		}, nil
+	}
+
+	return workloadStatus{}, fmt.Errorf("unsupported workload kind: %s", ref.Kind)
+}
+
+// isDeploymentRollingOut mirrors the checks made by "kubectl rollout status".
+func isDeploymentRollingOut(deployment *appsv1.Deployment) bool {
+	if deployment.Generation > deployment.Status.ObservedGeneration {
+		return true
+	}
+
+	replicas := getReplicas(deployment.Spec.Replicas)
+
+	if deployment.Status.UpdatedReplicas < replicas {
+		return true
+	}
+	// Old replicas are still terminating.
+	if deployment.Status.Replicas > deployment.Status.UpdatedReplicas {
+		return true
+	}
+	if deployment.Status.AvailableReplicas < deployment.Status.UpdatedReplicas {
+		return true
+	}
+
+	return false
+}
+
+// isStatefulSetRollingOut mirrors the checks made by "kubectl rollout status".
+func isStatefulSetRollingOut(statefulSet *appsv1.StatefulSet) bool {
+	if statefulSet.Generation > statefulSet.Status.ObservedGeneration {
+		return true
+	}
+
+	if statefulSet.Status.ReadyReplicas < getReplicas(statefulSet.Spec.Replicas) {
+		return true
+	}
+
+	if statefulSet.Spec.UpdateStrategy.Type == appsv1.RollingUpdateStatefulSetStrategyType &&
+		statefulSet.Status.UpdateRevision != statefulSet.Status.CurrentRevision {
+		return true
+	}
+
+	return false
+}
+
+// isNamespaceSleeping checks if the namespace has been put to sleep by annotation.
+func (r *HealthCheckReconciler) isNamespaceSleeping(ctx context.Context, namespace string) (bool, error) {
+	ns := &corev1.Namespace{}
+	if err := r.Get(ctx, types.NamespacedName{Name: namespace}, ns); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	return ns.ObjectMeta.Annotations[healthcheckv1.AnnotationSleep] == "true", nil
+}
+
+// getReplicas gets the desired replicas, which default to 1.
+func getReplicas(replicas *int32) int32 {
+	if replicas == nil {
+		return 1
+	}
+	return *replicas
+}
+
+// indexWorkload indexes a HealthCheck by the workload it references.
+func indexWorkload(obj runtime.Object) []string {
+	healthCheck := obj.(*healthcheckv1.HealthCheck)
+	if healthCheck.Spec.Workload == nil {
+		return nil
+	}
+	return []string{healthCheck.Spec.Workload.Kind + "/" + healthCheck.Spec.Workload.Name}
+}
+
+// mapWorkload returns a function which enqueues the HealthChecks that reference a workload.
+func (r *HealthCheckReconciler) mapWorkload(kind string) handler.ToRequestsFunc {
+	return func(obj handler.MapObject) []reconcile.Request {
+		healthChecks := &healthcheckv1.HealthCheckList{}
+
+		err := r.List(context.Background(), healthChecks,
+			client.InNamespace(obj.Meta.GetNamespace()),
+			client.MatchingFields{workloadIndexKey: kind + "/" + obj.Meta.GetName()})
+		if err != nil {
+			r.Log.Error(err, "failed to list health checks", "workload", obj.Meta.GetName())
+			return nil
+		}
+
+		var requests []reconcile.Request
+		for _, healthCheck := range healthChecks.Items {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Namespace: healthCheck.Namespace,
+					Name:      healthCheck.Name,
+				},
+			})
+		}
+		return requests
+	}
+}
+
+// mapNamespace enqueues all HealthChecks in a namespace.
+func (r *HealthCheckReconciler) mapNamespace(obj handler.MapObject) []reconcile.Request {
+	if !r.Scope.AllowsNamespace(obj.Meta.GetName()) {
+		return nil
+	}
+
+	healthChecks := &healthcheckv1.HealthCheckList{}
+
+	err := r.List(context.Background(), healthChecks, client.InNamespace(obj.Meta.GetName()))
+	if err != nil {
+		r.Log.Error(err, "failed to list health checks", "namespace", obj.Meta.GetName())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, healthCheck := range healthChecks.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Namespace: healthCheck.Namespace,
+				Name:      healthCheck.Name,
+			},
+		})
+	}
+	return requests
+}
@@ -0,0 +1,212 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	healthcheckv1 "github.com/skpr/r53-check/api/v1"
+	"github.com/skpr/r53-check/internal/awsfake"
+)
+
+func TestReconcileRollout(t *testing.T) {
+	err := healthcheckv1.AddToScheme(scheme.Scheme)
+	assert.Nil(t, err)
+
+	replicas := int32(1)
+
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "web",
+			Namespace:  corev1.NamespaceDefault,
+			Generation: 2,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+		},
+		Status: appsv1.DeploymentStatus{
+			ObservedGeneration: 1,
+			Replicas:           1,
+			UpdatedReplicas:    1,
+			AvailableReplicas:  1,
+		},
+	}
+
+	healthcheck := newTestHealthCheck()
+	healthcheck.Spec.Workload = &healthcheckv1.WorkloadReference{
+		Kind: healthcheckv1.WorkloadKindDeployment,
+		Name: deployment.Name,
+	}
+
+	client := fake.NewFakeClientWithScheme(scheme.Scheme, healthcheck, deployment)
+	recorder := record.NewFakeRecorder(10)
+
+	reconciler := HealthCheckReconciler{
+		Client:           client,
+		Log:              zap.New(),
+		Scheme:           scheme.Scheme,
+		Route53Client:    awsfake.NewRoute53(),
+		CloudwatchClient: awsfake.NewCloudWatch(),
+		Recorder:         recorder,
+	}
+
+	query := types.NamespacedName{
+		Name:      healthcheck.ObjectMeta.Name,
+		Namespace: healthcheck.ObjectMeta.Namespace,
+	}
+
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+
+	err = client.Get(context.TODO(), query, healthcheck)
+	assert.Nil(t, err)
+	assert.NotNil(t, healthcheck.Status.RolloutStarted)
+	assert.Empty(t, healthcheck.Status.Drift)
+
+	condition := getCondition(healthcheck.Status.Conditions, healthcheckv1.ConditionAlarmSuppressed)
+	assert.Equal(t, corev1.ConditionTrue, condition.Status)
+	assert.Equal(t, suppressionReasonRollout, condition.Reason)
+	assert.Contains(t, <-recorder.Events, "RolloutStarted")
+
+	// The rollout completes.
+	deployment.Status.ObservedGeneration = 2
+	err = client.Update(context.TODO(), deployment)
+	assert.Nil(t, err)
+
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+
+	healthcheck = &healthcheckv1.HealthCheck{}
+	err = client.Get(context.TODO(), query, healthcheck)
+	assert.Nil(t, err)
+	assert.Nil(t, healthcheck.Status.RolloutStarted)
+	assert.Equal(t, corev1.ConditionFalse, getCondition(healthcheck.Status.Conditions, healthcheckv1.ConditionAlarmSuppressed).Status)
+	assert.Contains(t, <-recorder.Events, "RolloutFinished")
+
+	// Rollouts are still suppressed without a recorder.
+	reconciler.Recorder = nil
+	deployment.Generation = 3
+	err = client.Update(context.TODO(), deployment)
+	assert.Nil(t, err)
+
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+
+	healthcheck = &healthcheckv1.HealthCheck{}
+	err = client.Get(context.TODO(), query, healthcheck)
+	assert.Nil(t, err)
+	assert.NotNil(t, healthcheck.Status.RolloutStarted)
+}
+
+func TestIsStatefulSetRollingOut(t *testing.T) {
+	replicas := int32(2)
+
+	statefulSet := &appsv1.StatefulSet{
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: &replicas,
+			UpdateStrategy: appsv1.StatefulSetUpdateStrategy{
+				Type: appsv1.RollingUpdateStatefulSetStrategyType,
+			},
+		},
+		Status: appsv1.StatefulSetStatus{
+			ReadyReplicas:   2,
+			CurrentRevision: "web-1",
+			UpdateRevision:  "web-2",
+		},
+	}
+	assert.True(t, isStatefulSetRollingOut(statefulSet))
+
+	statefulSet.Status.CurrentRevision = "web-2"
+	assert.False(t, isStatefulSetRollingOut(statefulSet))
+
+	statefulSet.Status.ReadyReplicas = 1
+	assert.True(t, isStatefulSetRollingOut(statefulSet))
+}
+
+func TestReconcileScaledToZero(t *testing.T) {
+	err := healthcheckv1.AddToScheme(scheme.Scheme)
+	assert.Nil(t, err)
+
+	replicas := int32(0)
+
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "web",
+			Namespace: "preview",
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+		},
+	}
+
+	namespace := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "preview",
+		},
+	}
+
+	healthcheck := newTestHealthCheck()
+	healthcheck.ObjectMeta.Namespace = "preview"
+	healthcheck.Spec.NamePrefix = "example-site.preview"
+	healthcheck.Spec.Domain = "preview.example.skpr.io"
+	healthcheck.Spec.Workload = &healthcheckv1.WorkloadReference{
+		Kind: healthcheckv1.WorkloadKindDeployment,
+		Name: deployment.Name,
+	}
+
+	client := fake.NewFakeClientWithScheme(scheme.Scheme, healthcheck, deployment, namespace)
+
+	reconciler := HealthCheckReconciler{
+		Client:           client,
+		Log:              zap.New(),
+		Scheme:           scheme.Scheme,
+		Route53Client:    awsfake.NewRoute53(),
+		CloudwatchClient: awsfake.NewCloudWatch(),
+		Recorder:         record.NewFakeRecorder(10),
+	}
+
+	query := types.NamespacedName{
+		Name:      healthcheck.ObjectMeta.Name,
+		Namespace: healthcheck.ObjectMeta.Namespace,
+	}
+
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+
+	err = client.Get(context.TODO(), query, healthcheck)
+	assert.Nil(t, err)
+
+	condition := getCondition(healthcheck.Status.Conditions, healthcheckv1.ConditionAlarmSuppressed)
+	assert.Equal(t, corev1.ConditionTrue, condition.Status)
+	assert.Equal(t, suppressionReasonScaledDown, condition.Reason)
+
+	// Scaling back up while the namespace is asleep keeps the check disabled.
+	replicas = 1
+	deployment.Status = appsv1.DeploymentStatus{Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1}
+	err = client.Update(context.TODO(), deployment)
+	assert.Nil(t, err)
+
+	namespace.ObjectMeta.Annotations = map[string]string{healthcheckv1.AnnotationSleep: "true"}
+	err = client.Update(context.TODO(), namespace)
+	assert.Nil(t, err)
+
+	_, err = reconciler.Reconcile(ctrl.Request{NamespacedName: query})
+	assert.Nil(t, err)
+
+	err = client.Get(context.TODO(), query, healthcheck)
+	assert.Nil(t, err)
+
+	condition = getCondition(healthcheck.Status.Conditions, healthcheckv1.ConditionAlarmSuppressed)
+	assert.Equal(t, corev1.ConditionTrue, condition.Status)
+	assert.Equal(t, suppressionReasonSleeping, condition.Reason)
+}
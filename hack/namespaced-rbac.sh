@@ -0,0 +1,50 @@
+#!/bin/sh
+# Generates a Role and RoleBinding in each namespace passed to --namespaces, with
+# the rules of the manager ClusterRole, for installs without cluster wide access.
+#
+# Usage: hack/namespaced-rbac.sh config/rbac/role.yaml tenant-a,tenant-b [r53-check-system]
+
+set -e
+
+ROLE=$1
+NAMESPACES=$2
+MANAGER_NAMESPACE=${3:-r53-check-system}
+
+if [ -z "$NAMESPACES" ]; then
+	echo "usage: $0 ROLE NAMESPACES [MANAGER_NAMESPACE]" >&2
+	exit 1
+fi
+
+for NAMESPACE in $(echo "$NAMESPACES" | tr ',' ' '); do
+	cat <<YAML
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: r53-check-manager-role
+  namespace: ${NAMESPACE}
+YAML
+	# Namespaces are cluster scoped, so they are read with namespace_reader_role.yaml instead.
+	sed -n '/^rules:/,$p' "$ROLE" | awk '
+		/^- apiGroups:/ { if (rule != "" && rule !~ /- namespaces\n/) printf "%s", rule; rule = "" }
+		/^rules:/ { print; next }
+		{ rule = rule $0 "\n" }
+		END { if (rule !~ /- namespaces\n/) printf "%s", rule }
+	'
+	cat <<YAML
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: r53-check-manager-rolebinding
+  namespace: ${NAMESPACE}
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: Role
+  name: r53-check-manager-role
+subjects:
+- kind: ServiceAccount
+  name: default
+  namespace: ${MANAGER_NAMESPACE}
+YAML
+done
@@ -0,0 +1,651 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package awsfake
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awsutil"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+)
+
+// CloudWatch is an in-memory implementation of the CloudWatch API. Operations
+// which are not implemented panic.
+type CloudWatch struct {
+	cloudwatchiface.CloudWatchAPI
+
+	// Faults injects errors and counts calls.
+	Faults Faults
+	// Now is the clock used for timestamps.
+	Now func() time.Time
+
+	mu      sync.Mutex
+	alarms  map[string]*cloudwatch.MetricAlarm
+	history []*cloudwatch.AlarmHistoryItem
+	metrics map[string][]*cloudwatch.MetricDatum
+	// dashboards are the dashboard bodies by name.
+	dashboards map[string]string
+}
+
+// NewCloudWatch creates an empty fake.
+func NewCloudWatch() *CloudWatch {
+	return &CloudWatch{
+		Now:        time.Now,
+		alarms:     make(map[string]*cloudwatch.MetricAlarm),
+		metrics:    make(map[string][]*cloudwatch.MetricDatum),
+		dashboards: make(map[string]string),
+	}
+}
+
+// Alarms gets a copy of every alarm, ordered by name.
+func (c *CloudWatch) Alarms() []*cloudwatch.MetricAlarm {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var alarms []*cloudwatch.MetricAlarm
+	for _, name := range c.alarmNames() {
+		alarms = append(alarms, awsutil.CopyOf(c.alarms[name]).(*cloudwatch.MetricAlarm))
+	}
+	return alarms
+}
+
+// TransitionAlarm moves an alarm into a new state, as if CloudWatch had
+// evaluated its metric.
+func (c *CloudWatch) TransitionAlarm(name, state, reason string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.setAlarmState(name, state, reason)
+}
+
+// DeleteAlarmOutOfBand deletes an alarm without going through the API, as if
+// someone had used the console.
+func (c *CloudWatch) DeleteAlarmOutOfBand(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.alarms, name)
+}
+
+func (c *CloudWatch) PutMetricAlarm(input *cloudwatch.PutMetricAlarmInput) (*cloudwatch.PutMetricAlarmOutput, error) {
+	if err := c.Faults.call("PutMetricAlarm"); err != nil {
+		return nil, err
+	}
+	if aws.StringValue(input.AlarmName) == "" {
+		return nil, NewError(cloudwatch.ErrCodeMissingRequiredParameterException, "The parameter AlarmName is required.", http.StatusBadRequest)
+	}
+	if input.EvaluationPeriods == nil || input.ComparisonOperator == nil {
+		return nil, NewError(cloudwatch.ErrCodeMissingRequiredParameterException, "The parameters EvaluationPeriods and ComparisonOperator are required.", http.StatusBadRequest)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.Now()
+
+	alarm, exists := c.alarms[*input.AlarmName]
+	if !exists {
+		alarm = &cloudwatch.MetricAlarm{
+			AlarmArn:              aws.String("arn:aws:cloudwatch:us-east-1:123456789012:alarm:" + *input.AlarmName),
+			AlarmName:             aws.String(*input.AlarmName),
+			StateValue:            aws.String(cloudwatch.StateValueInsufficientData),
+			StateReason:           aws.String("Unchecked: Initial alarm creation"),
+			StateUpdatedTimestamp: aws.Time(now),
+		}
+		c.alarms[*input.AlarmName] = alarm
+	}
+
+	alarm.AlarmDescription = input.AlarmDescription
+	alarm.ActionsEnabled = aws.Bool(aws.BoolValue(input.ActionsEnabled) || input.ActionsEnabled == nil)
+	alarm.AlarmActions = copyStrings(input.AlarmActions)
+	alarm.OKActions = copyStrings(input.OKActions)
+	alarm.InsufficientDataActions = copyStrings(input.InsufficientDataActions)
+	alarm.Period = input.Period
+	alarm.EvaluationPeriods = input.EvaluationPeriods
+	alarm.DatapointsToAlarm = input.DatapointsToAlarm
+	alarm.Threshold = input.Threshold
+	alarm.ComparisonOperator = input.ComparisonOperator
+	alarm.TreatMissingData = input.TreatMissingData
+	alarm.Namespace = input.Namespace
+	alarm.MetricName = input.MetricName
+	alarm.Statistic = input.Statistic
+	alarm.ExtendedStatistic = input.ExtendedStatistic
+	alarm.Unit = input.Unit
+	alarm.Dimensions = nil
+	for _, dimension := range input.Dimensions {
+		alarm.Dimensions = append(alarm.Dimensions, awsutil.CopyOf(dimension).(*cloudwatch.Dimension))
+	}
+	alarm.AlarmConfigurationUpdatedTimestamp = aws.Time(now)
+
+	summary := "Alarm \"" + *input.AlarmName + "\" updated"
+	if !exists {
+		summary = "Alarm \"" + *input.AlarmName + "\" created"
+	}
+	c.addHistory(*input.AlarmName, cloudwatch.HistoryItemTypeConfigurationUpdate, summary, nil)
+
+	return &cloudwatch.PutMetricAlarmOutput{}, nil
+}
+
+func (c *CloudWatch) DescribeAlarms(input *cloudwatch.DescribeAlarmsInput) (*cloudwatch.DescribeAlarmsOutput, error) {
+	if err := c.Faults.call("DescribeAlarms"); err != nil {
+		return nil, err
+	}
+	if len(input.AlarmNames) > 100 {
+		return nil, NewError(cloudwatch.ErrCodeInvalidParameterValueException, "AlarmNames may contain at most 100 items", http.StatusBadRequest)
+	}
+	if len(input.AlarmNames) > 0 && input.AlarmNamePrefix != nil {
+		return nil, NewError(cloudwatch.ErrCodeInvalidParameterCombinationException, "AlarmNames and AlarmNamePrefix cannot be combined", http.StatusBadRequest)
+	}
+
+	maxRecords := int(aws.Int64Value(input.MaxRecords))
+	if maxRecords == 0 {
+		maxRecords = 50
+	}
+	if maxRecords < 1 || maxRecords > 100 {
+		return nil, NewError(cloudwatch.ErrCodeInvalidParameterValueException, "MaxRecords must be between 1 and 100", http.StatusBadRequest)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	names := make(map[string]bool)
+	for _, name := range input.AlarmNames {
+		names[aws.StringValue(name)] = true
+	}
+
+	var matches []*cloudwatch.MetricAlarm
+	for _, name := range c.alarmNames() {
+		alarm := c.alarms[name]
+		if len(names) > 0 && !names[name] {
+			continue
+		}
+		if input.AlarmNamePrefix != nil && !strings.HasPrefix(name, *input.AlarmNamePrefix) {
+			continue
+		}
+		if input.StateValue != nil && *input.StateValue != aws.StringValue(alarm.StateValue) {
+			continue
+		}
+		if input.ActionPrefix != nil && !hasPrefixedAction(alarm, *input.ActionPrefix) {
+			continue
+		}
+		matches = append(matches, alarm)
+	}
+
+	start, err := parseNextToken(input.NextToken, len(matches))
+	if err != nil {
+		return nil, err
+	}
+
+	output := &cloudwatch.DescribeAlarmsOutput{}
+	for i := start; i < len(matches); i++ {
+		if len(output.MetricAlarms) == maxRecords {
+			output.NextToken = aws.String(strconv.Itoa(i))
+			break
+		}
+		output.MetricAlarms = append(output.MetricAlarms, awsutil.CopyOf(matches[i]).(*cloudwatch.MetricAlarm))
+	}
+
+	return output, nil
+}
+
+func (c *CloudWatch) DescribeAlarmsPages(input *cloudwatch.DescribeAlarmsInput, fn func(*cloudwatch.DescribeAlarmsOutput, bool) bool) error {
+	input = awsutil.CopyOf(input).(*cloudwatch.DescribeAlarmsInput)
+	for {
+		output, err := c.DescribeAlarms(input)
+		if err != nil {
+			return err
+		}
+		lastPage := output.NextToken == nil
+		if !fn(output, lastPage) || lastPage {
+			return nil
+		}
+		input.NextToken = output.NextToken
+	}
+}
+
+func (c *CloudWatch) DeleteAlarms(input *cloudwatch.DeleteAlarmsInput) (*cloudwatch.DeleteAlarmsOutput, error) {
+	if err := c.Faults.call("DeleteAlarms"); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, name := range input.AlarmNames {
+		if _, ok := c.alarms[aws.StringValue(name)]; !ok {
+			return nil, NewError(cloudwatch.ErrCodeResourceNotFound, "Alarm "+aws.StringValue(name)+" does not exist", http.StatusNotFound)
+		}
+	}
+	for _, name := range input.AlarmNames {
+		delete(c.alarms, *name)
+		c.addHistory(*name, cloudwatch.HistoryItemTypeConfigurationUpdate, "Alarm \""+*name+"\" deleted", nil)
+	}
+
+	return &cloudwatch.DeleteAlarmsOutput{}, nil
+}
+
+func (c *CloudWatch) EnableAlarmActions(input *cloudwatch.EnableAlarmActionsInput) (*cloudwatch.EnableAlarmActionsOutput, error) {
+	if err := c.Faults.call("EnableAlarmActions"); err != nil {
+		return nil, err
+	}
+
+	c.setActionsEnabled(input.AlarmNames, true)
+
+	return &cloudwatch.EnableAlarmActionsOutput{}, nil
+}
+
+func (c *CloudWatch) DisableAlarmActions(input *cloudwatch.DisableAlarmActionsInput) (*cloudwatch.DisableAlarmActionsOutput, error) {
+	if err := c.Faults.call("DisableAlarmActions"); err != nil {
+		return nil, err
+	}
+
+	c.setActionsEnabled(input.AlarmNames, false)
+
+	return &cloudwatch.DisableAlarmActionsOutput{}, nil
+}
+
+func (c *CloudWatch) SetAlarmState(input *cloudwatch.SetAlarmStateInput) (*cloudwatch.SetAlarmStateOutput, error) {
+	if err := c.Faults.call("SetAlarmState"); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.alarms[aws.StringValue(input.AlarmName)]; !ok {
+		return nil, NewError(cloudwatch.ErrCodeResourceNotFound, "Alarm "+aws.StringValue(input.AlarmName)+" does not exist", http.StatusNotFound)
+	}
+
+	err := c.setAlarmState(*input.AlarmName, aws.StringValue(input.StateValue), aws.StringValue(input.StateReason))
+	if err != nil {
+		return nil, err
+	}
+
+	return &cloudwatch.SetAlarmStateOutput{}, nil
+}
+
+func (c *CloudWatch) DescribeAlarmHistory(input *cloudwatch.DescribeAlarmHistoryInput) (*cloudwatch.DescribeAlarmHistoryOutput, error) {
+	if err := c.Faults.call("DescribeAlarmHistory"); err != nil {
+		return nil, err
+	}
+
+	maxRecords := int(aws.Int64Value(input.MaxRecords))
+	if maxRecords == 0 {
+		maxRecords = 100
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// History is returned newest first.
+	var matches []*cloudwatch.AlarmHistoryItem
+	for i := len(c.history) - 1; i >= 0; i-- {
+		item := c.history[i]
+		if input.AlarmName != nil && *input.AlarmName != aws.StringValue(item.AlarmName) {
+			continue
+		}
+		if input.HistoryItemType != nil && *input.HistoryItemType != aws.StringValue(item.HistoryItemType) {
+			continue
+		}
+		if input.StartDate != nil && item.Timestamp.Before(*input.StartDate) {
+			continue
+		}
+		if input.EndDate != nil && item.Timestamp.After(*input.EndDate) {
+			continue
+		}
+		matches = append(matches, item)
+	}
+
+	start, err := parseNextToken(input.NextToken, len(matches))
+	if err != nil {
+		return nil, err
+	}
+
+	output := &cloudwatch.DescribeAlarmHistoryOutput{}
+	for i := start; i < len(matches); i++ {
+		if len(output.AlarmHistoryItems) == maxRecords {
+			output.NextToken = aws.String(strconv.Itoa(i))
+			break
+		}
+		output.AlarmHistoryItems = append(output.AlarmHistoryItems, awsutil.CopyOf(matches[i]).(*cloudwatch.AlarmHistoryItem))
+	}
+
+	return output, nil
+}
+
+// MetricData gets a copy of the data points published to a namespace, oldest first.
+func (c *CloudWatch) MetricData(namespace string) []*cloudwatch.MetricDatum {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var data []*cloudwatch.MetricDatum
+	for _, datum := range c.metrics[namespace] {
+		data = append(data, awsutil.CopyOf(datum).(*cloudwatch.MetricDatum))
+	}
+	return data
+}
+
+func (c *CloudWatch) PutMetricData(input *cloudwatch.PutMetricDataInput) (*cloudwatch.PutMetricDataOutput, error) {
+	if err := c.Faults.call("PutMetricData"); err != nil {
+		return nil, err
+	}
+	if aws.StringValue(input.Namespace) == "" {
+		return nil, NewError(cloudwatch.ErrCodeMissingRequiredParameterException, "The parameter Namespace is required.", http.StatusBadRequest)
+	}
+	if len(input.MetricData) == 0 || len(input.MetricData) > 20 {
+		return nil, NewError(cloudwatch.ErrCodeInvalidParameterValueException, "The collection MetricData must contain between 1 and 20 items.", http.StatusBadRequest)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, datum := range input.MetricData {
+		datum = awsutil.CopyOf(datum).(*cloudwatch.MetricDatum)
+		if datum.Timestamp == nil {
+			datum.Timestamp = aws.Time(c.Now())
+		}
+		c.metrics[*input.Namespace] = append(c.metrics[*input.Namespace], datum)
+	}
+
+	return &cloudwatch.PutMetricDataOutput{}, nil
+}
+
+func (c *CloudWatch) GetMetricStatistics(input *cloudwatch.GetMetricStatisticsInput) (*cloudwatch.GetMetricStatisticsOutput, error) {
+	if err := c.Faults.call("GetMetricStatistics"); err != nil {
+		return nil, err
+	}
+	if aws.StringValue(input.Namespace) == "" || aws.StringValue(input.MetricName) == "" ||
+		input.StartTime == nil || input.EndTime == nil || input.Period == nil {
+		return nil, NewError(cloudwatch.ErrCodeMissingRequiredParameterException,
+			"The parameters Namespace, MetricName, StartTime, EndTime and Period are required.", http.StatusBadRequest)
+	}
+	if len(input.Statistics) == 0 {
+		return nil, NewError(cloudwatch.ErrCodeMissingRequiredParameterException, "The parameter Statistics is required.", http.StatusBadRequest)
+	}
+	if *input.Period < 60 || *input.Period%60 != 0 {
+		return nil, NewError(cloudwatch.ErrCodeInvalidParameterValueException, "The parameter Period must be a multiple of 60.", http.StatusBadRequest)
+	}
+
+	period := time.Duration(*input.Period) * time.Second
+	if input.EndTime.Sub(*input.StartTime)/period > 1440 {
+		return nil, NewError(cloudwatch.ErrCodeInvalidParameterCombinationException,
+			"You have requested up to 1,440 datapoints, which exceeds the limit of 1,440.", http.StatusBadRequest)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Data points are aggregated into periods starting from the start time.
+	buckets := make(map[time.Time][]float64)
+	for _, datum := range c.metrics[*input.Namespace] {
+		if aws.StringValue(datum.MetricName) != *input.MetricName || !equalDimensions(datum.Dimensions, input.Dimensions) {
+			continue
+		}
+		timestamp := *datum.Timestamp
+		if timestamp.Before(*input.StartTime) || !timestamp.Before(*input.EndTime) {
+			continue
+		}
+		start := input.StartTime.Add(timestamp.Sub(*input.StartTime) / period * period)
+		buckets[start] = append(buckets[start], aws.Float64Value(datum.Value))
+	}
+
+	output := &cloudwatch.GetMetricStatisticsOutput{
+		Label: input.MetricName,
+	}
+
+	var starts []time.Time
+	for start := range buckets {
+		starts = append(starts, start)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i].Before(starts[j]) })
+
+	for _, start := range starts {
+		values := buckets[start]
+		datapoint := &cloudwatch.Datapoint{
+			Timestamp: aws.Time(start),
+			Unit:      aws.String(cloudwatch.StandardUnitNone),
+		}
+
+		sum, min, max := 0.0, values[0], values[0]
+		for _, value := range values {
+			sum += value
+			min = math.Min(min, value)
+			max = math.Max(max, value)
+		}
+
+		for _, statistic := range input.Statistics {
+			switch *statistic {
+			case cloudwatch.StatisticSampleCount:
+				datapoint.SampleCount = aws.Float64(float64(len(values)))
+			case cloudwatch.StatisticSum:
+				datapoint.Sum = aws.Float64(sum)
+			case cloudwatch.StatisticAverage:
+				datapoint.Average = aws.Float64(sum / float64(len(values)))
+			case cloudwatch.StatisticMinimum:
+				datapoint.Minimum = aws.Float64(min)
+			case cloudwatch.StatisticMaximum:
+				datapoint.Maximum = aws.Float64(max)
+			}
+		}
+
+		output.Datapoints = append(output.Datapoints, datapoint)
+	}
+
+	return output, nil
+}
+
+// Dashboards gets a copy of every dashboard body, by name.
+func (c *CloudWatch) Dashboards() map[string]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	dashboards := make(map[string]string, len(c.dashboards))
+	for name, body := range c.dashboards {
+		dashboards[name] = body
+	}
+	return dashboards
+}
+
+func (c *CloudWatch) PutDashboard(input *cloudwatch.PutDashboardInput) (*cloudwatch.PutDashboardOutput, error) {
+	if err := c.Faults.call("PutDashboard"); err != nil {
+		return nil, err
+	}
+	if aws.StringValue(input.DashboardName) == "" || input.DashboardBody == nil {
+		return nil, NewError(cloudwatch.ErrCodeDashboardInvalidInputError, "The parameters DashboardName and DashboardBody are required.", http.StatusBadRequest)
+	}
+
+	var body struct {
+		Widgets []map[string]interface{} `json:"widgets"`
+	}
+	if err := json.Unmarshal([]byte(*input.DashboardBody), &body); err != nil {
+		return nil, NewError(cloudwatch.ErrCodeDashboardInvalidInputError, "The field DashboardBody must be a valid JSON object: "+err.Error(), http.StatusBadRequest)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.dashboards[*input.DashboardName] = *input.DashboardBody
+
+	return &cloudwatch.PutDashboardOutput{}, nil
+}
+
+func (c *CloudWatch) GetDashboard(input *cloudwatch.GetDashboardInput) (*cloudwatch.GetDashboardOutput, error) {
+	if err := c.Faults.call("GetDashboard"); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	name := aws.StringValue(input.DashboardName)
+	body, ok := c.dashboards[name]
+	if !ok {
+		return nil, NewError(cloudwatch.ErrCodeDashboardNotFoundError, "Dashboard "+name+" does not exist", http.StatusNotFound)
+	}
+
+	return &cloudwatch.GetDashboardOutput{
+		DashboardArn:  aws.String("arn:aws:cloudwatch::123456789012:dashboard/" + name),
+		DashboardBody: aws.String(body),
+		DashboardName: aws.String(name),
+	}, nil
+}
+
+func (c *CloudWatch) DeleteDashboards(input *cloudwatch.DeleteDashboardsInput) (*cloudwatch.DeleteDashboardsOutput, error) {
+	if err := c.Faults.call("DeleteDashboards"); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Nothing is deleted when any of the dashboards does not exist.
+	for _, name := range input.DashboardNames {
+		if _, ok := c.dashboards[aws.StringValue(name)]; !ok {
+			return nil, NewError(cloudwatch.ErrCodeDashboardNotFoundError, "Dashboard "+aws.StringValue(name)+" does not exist", http.StatusNotFound)
+		}
+	}
+	for _, name := range input.DashboardNames {
+		delete(c.dashboards, aws.StringValue(name))
+	}
+
+	return &cloudwatch.DeleteDashboardsOutput{}, nil
+}
+
+// setAlarmState changes the state of an alarm. The caller must hold the lock.
+func (c *CloudWatch) setAlarmState(name, state, reason string) error {
+	alarm, ok := c.alarms[name]
+	if !ok {
+		return NewError(cloudwatch.ErrCodeResourceNotFound, "Alarm "+name+" does not exist", http.StatusNotFound)
+	}
+
+	switch state {
+	case cloudwatch.StateValueOk, cloudwatch.StateValueAlarm, cloudwatch.StateValueInsufficientData:
+	default:
+		return NewError(cloudwatch.ErrCodeInvalidParameterValueException, "Invalid state value: "+state, http.StatusBadRequest)
+	}
+
+	previous := aws.StringValue(alarm.StateValue)
+	if previous == state {
+		return nil
+	}
+
+	alarm.StateValue = aws.String(state)
+	alarm.StateReason = aws.String(reason)
+	alarm.StateUpdatedTimestamp = aws.Time(c.Now())
+
+	data, _ := json.Marshal(map[string]interface{}{
+		"version":  "1.0",
+		"oldState": map[string]string{"stateValue": previous},
+		"newState": map[string]string{"stateValue": state, "stateReason": reason},
+	})
+	c.addHistory(name, cloudwatch.HistoryItemTypeStateUpdate,
+		fmt.Sprintf("Alarm updated from %s to %s", previous, state), data)
+
+	return nil
+}
+
+// setActionsEnabled toggles the actions of existing alarms. Unknown names are ignored.
+func (c *CloudWatch) setActionsEnabled(names []*string, enabled bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, name := range names {
+		if alarm, ok := c.alarms[aws.StringValue(name)]; ok {
+			alarm.ActionsEnabled = aws.Bool(enabled)
+		}
+	}
+}
+
+// addHistory records an alarm history item. The caller must hold the lock.
+func (c *CloudWatch) addHistory(name, itemType, summary string, data []byte) {
+	item := &cloudwatch.AlarmHistoryItem{
+		AlarmName:       aws.String(name),
+		HistoryItemType: aws.String(itemType),
+		HistorySummary:  aws.String(summary),
+		Timestamp:       aws.Time(c.Now()),
+	}
+	if data != nil {
+		item.HistoryData = aws.String(string(data))
+	}
+	c.history = append(c.history, item)
+}
+
+// alarmNames gets the sorted alarm names. The caller must hold the lock.
+func (c *CloudWatch) alarmNames() []string {
+	names := make([]string, 0, len(c.alarms))
+	for name := range c.alarms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func hasPrefixedAction(alarm *cloudwatch.MetricAlarm, prefix string) bool {
+	for _, actions := range [][]*string{alarm.AlarmActions, alarm.OKActions, alarm.InsufficientDataActions} {
+		for _, action := range actions {
+			if strings.HasPrefix(aws.StringValue(action), prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// equalDimensions checks if two sets of dimensions are the same, in any order.
+func equalDimensions(a, b []*cloudwatch.Dimension) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	values := make(map[string]string)
+	for _, dimension := range a {
+		values[aws.StringValue(dimension.Name)] = aws.StringValue(dimension.Value)
+	}
+	for _, dimension := range b {
+		value, ok := values[aws.StringValue(dimension.Name)]
+		if !ok || value != aws.StringValue(dimension.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+func copyStrings(values []*string) []*string {
+	if values == nil {
+		return nil
+	}
+	return aws.StringSlice(aws.StringValueSlice(values))
+}
+
+func parseNextToken(token *string, length int) (int, error) {
+	if token == nil {
+		return 0, nil
+	}
+	start, err := strconv.Atoi(*token)
+	if err != nil || start < 0 || start > length {
+		return 0, NewError(cloudwatch.ErrCodeInvalidNextToken, "The service returned an invalid next token", http.StatusBadRequest)
+	}
+	return start, nil
+}
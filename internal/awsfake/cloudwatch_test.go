@@ -0,0 +1,178 @@
+package awsfake
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/stretchr/testify/assert"
+)
+
+func putAlarm(t *testing.T, client *CloudWatch, name string) {
+	_, err := client.PutMetricAlarm(&cloudwatch.PutMetricAlarmInput{
+		AlarmName:          aws.String(name),
+		EvaluationPeriods:  aws.Int64(1),
+		ComparisonOperator: aws.String(cloudwatch.ComparisonOperatorLessThanThreshold),
+		Threshold:          aws.Float64(1),
+	})
+	assert.Nil(t, err)
+}
+
+func TestAlarmLifecycle(t *testing.T) {
+	client := NewCloudWatch()
+	putAlarm(t, client, "example")
+
+	output, err := client.DescribeAlarms(&cloudwatch.DescribeAlarmsInput{AlarmNames: aws.StringSlice([]string{"example"})})
+	assert.Nil(t, err)
+	assert.Equal(t, cloudwatch.StateValueInsufficientData, *output.MetricAlarms[0].StateValue)
+	assert.True(t, *output.MetricAlarms[0].ActionsEnabled)
+
+	_, err = client.DisableAlarmActions(&cloudwatch.DisableAlarmActionsInput{AlarmNames: aws.StringSlice([]string{"example"})})
+	assert.Nil(t, err)
+	assert.False(t, *client.Alarms()[0].ActionsEnabled)
+
+	err = client.TransitionAlarm("example", cloudwatch.StateValueAlarm, "Threshold Crossed")
+	assert.Nil(t, err)
+	assert.Equal(t, cloudwatch.StateValueAlarm, *client.Alarms()[0].StateValue)
+
+	history, err := client.DescribeAlarmHistory(&cloudwatch.DescribeAlarmHistoryInput{
+		AlarmName:       aws.String("example"),
+		HistoryItemType: aws.String(cloudwatch.HistoryItemTypeStateUpdate),
+	})
+	assert.Nil(t, err)
+	assert.Len(t, history.AlarmHistoryItems, 1)
+	assert.Contains(t, *history.AlarmHistoryItems[0].HistoryData, "INSUFFICIENT_DATA")
+
+	_, err = client.DeleteAlarms(&cloudwatch.DeleteAlarmsInput{AlarmNames: aws.StringSlice([]string{"example"})})
+	assert.Nil(t, err)
+
+	_, err = client.DeleteAlarms(&cloudwatch.DeleteAlarmsInput{AlarmNames: aws.StringSlice([]string{"example"})})
+	assertErrorCode(t, cloudwatch.ErrCodeResourceNotFound, err)
+}
+
+func TestDescribeAlarmsPagination(t *testing.T) {
+	client := NewCloudWatch()
+
+	var names []string
+	for i := 0; i < 150; i++ {
+		name := fmt.Sprintf("alarm-%03d", i)
+		names = append(names, name)
+		putAlarm(t, client, name)
+	}
+
+	_, err := client.DescribeAlarms(&cloudwatch.DescribeAlarmsInput{AlarmNames: aws.StringSlice(names)})
+	assertErrorCode(t, cloudwatch.ErrCodeInvalidParameterValueException, err)
+
+	var pages, total int
+	err = client.DescribeAlarmsPages(&cloudwatch.DescribeAlarmsInput{
+		AlarmNamePrefix: aws.String("alarm-"),
+		MaxRecords:      aws.Int64(100),
+	}, func(output *cloudwatch.DescribeAlarmsOutput, lastPage bool) bool {
+		pages++
+		total += len(output.MetricAlarms)
+		return true
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, pages)
+	assert.Equal(t, 150, total)
+}
+
+func TestGetMetricStatistics(t *testing.T) {
+	client := NewCloudWatch()
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	dimensions := []*cloudwatch.Dimension{{Name: aws.String("HealthCheckId"), Value: aws.String("abc")}}
+
+	// Healthy for the first hour, then unhealthy for half of the second.
+	for i := 0; i < 120; i++ {
+		value := 1.0
+		if i >= 90 {
+			value = 0.0
+		}
+		_, err := client.PutMetricData(&cloudwatch.PutMetricDataInput{
+			Namespace: aws.String("AWS/Route53"),
+			MetricData: []*cloudwatch.MetricDatum{
+				{
+					MetricName: aws.String("HealthCheckStatus"),
+					Dimensions: dimensions,
+					Timestamp:  aws.Time(start.Add(time.Duration(i) * time.Minute)),
+					Value:      aws.Float64(value),
+				},
+			},
+		})
+		assert.Nil(t, err)
+	}
+
+	output, err := client.GetMetricStatistics(&cloudwatch.GetMetricStatisticsInput{
+		Namespace:  aws.String("AWS/Route53"),
+		MetricName: aws.String("HealthCheckStatus"),
+		Dimensions: dimensions,
+		StartTime:  aws.Time(start),
+		EndTime:    aws.Time(start.Add(time.Hour * 3)),
+		Period:     aws.Int64(3600),
+		Statistics: aws.StringSlice([]string{cloudwatch.StatisticSum, cloudwatch.StatisticSampleCount, cloudwatch.StatisticMinimum}),
+	})
+	assert.Nil(t, err)
+	if assert.Len(t, output.Datapoints, 2) {
+		assert.Equal(t, start, *output.Datapoints[0].Timestamp)
+		assert.Equal(t, 60.0, *output.Datapoints[0].Sum)
+		assert.Equal(t, 1.0, *output.Datapoints[0].Minimum)
+		assert.Equal(t, 30.0, *output.Datapoints[1].Sum)
+		assert.Equal(t, 60.0, *output.Datapoints[1].SampleCount)
+		assert.Nil(t, output.Datapoints[1].Average)
+	}
+
+	// Other dimensions are separate metrics.
+	output, err = client.GetMetricStatistics(&cloudwatch.GetMetricStatisticsInput{
+		Namespace:  aws.String("AWS/Route53"),
+		MetricName: aws.String("HealthCheckStatus"),
+		StartTime:  aws.Time(start),
+		EndTime:    aws.Time(start.Add(time.Hour * 3)),
+		Period:     aws.Int64(3600),
+		Statistics: aws.StringSlice([]string{cloudwatch.StatisticSum}),
+	})
+	assert.Nil(t, err)
+	assert.Empty(t, output.Datapoints)
+
+	_, err = client.GetMetricStatistics(&cloudwatch.GetMetricStatisticsInput{
+		Namespace:  aws.String("AWS/Route53"),
+		MetricName: aws.String("HealthCheckStatus"),
+		StartTime:  aws.Time(start),
+		EndTime:    aws.Time(start.Add(time.Hour * 48)),
+		Period:     aws.Int64(60),
+		Statistics: aws.StringSlice([]string{cloudwatch.StatisticSum}),
+	})
+	assertErrorCode(t, cloudwatch.ErrCodeInvalidParameterCombinationException, err)
+}
+
+func TestDashboards(t *testing.T) {
+	client := NewCloudWatch()
+
+	_, err := client.PutDashboard(&cloudwatch.PutDashboardInput{
+		DashboardName: aws.String("example"),
+		DashboardBody: aws.String("not json"),
+	})
+	assertErrorCode(t, cloudwatch.ErrCodeDashboardInvalidInputError, err)
+
+	_, err = client.PutDashboard(&cloudwatch.PutDashboardInput{
+		DashboardName: aws.String("example"),
+		DashboardBody: aws.String(`{"widgets":[]}`),
+	})
+	assert.Nil(t, err)
+
+	output, err := client.GetDashboard(&cloudwatch.GetDashboardInput{DashboardName: aws.String("example")})
+	assert.Nil(t, err)
+	assert.Equal(t, `{"widgets":[]}`, *output.DashboardBody)
+
+	_, err = client.DeleteDashboards(&cloudwatch.DeleteDashboardsInput{DashboardNames: aws.StringSlice([]string{"example", "missing"})})
+	assertErrorCode(t, cloudwatch.ErrCodeDashboardNotFoundError, err)
+	assert.Len(t, client.Dashboards(), 1, "nothing is deleted when a dashboard is missing")
+
+	_, err = client.DeleteDashboards(&cloudwatch.DeleteDashboardsInput{DashboardNames: aws.StringSlice([]string{"example"})})
+	assert.Nil(t, err)
+
+	_, err = client.GetDashboard(&cloudwatch.GetDashboardInput{DashboardName: aws.String("example")})
+	assertErrorCode(t, cloudwatch.ErrCodeDashboardNotFoundError, err)
+}
@@ -0,0 +1,119 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package awsfake provides stateful, in-memory implementations of the Route53
+// and CloudWatch APIs used by the controllers.
+package awsfake
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+// AnyOperation matches every operation when injecting faults.
+const AnyOperation = "*"
+
+// Faults injects errors into API calls and counts the calls which were made.
+type Faults struct {
+	mu     sync.Mutex
+	errors map[string][]error
+	calls  map[string]int
+}
+
+// Inject queues errors which are returned by the next calls to an operation,
+// eg. "CreateHealthCheck", before it succeeds again.
+func (f *Faults) Inject(operation string, errs ...error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.errors == nil {
+		f.errors = make(map[string][]error)
+	}
+	f.errors[operation] = append(f.errors[operation], errs...)
+}
+
+// Throttle makes the next n calls to an operation fail with a throttling error.
+func (f *Faults) Throttle(operation, code string, n int) {
+	for i := 0; i < n; i++ {
+		f.Inject(operation, NewError(code, "Rate exceeded", http.StatusBadRequest))
+	}
+}
+
+// Calls gets the number of calls made to an operation, including failed calls.
+func (f *Faults) Calls(operation string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if operation == AnyOperation {
+		var total int
+		for _, n := range f.calls {
+			total += n
+		}
+		return total
+	}
+	return f.calls[operation]
+}
+
+// Reset clears queued errors and call counts.
+func (f *Faults) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.errors = nil
+	f.calls = nil
+}
+
+// call records a call to an operation and returns an injected error, if any.
+func (f *Faults) call(operation string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.calls == nil {
+		f.calls = make(map[string]int)
+	}
+	f.calls[operation]++
+
+	for _, key := range []string{operation, AnyOperation} {
+		if errs := f.errors[key]; len(errs) > 0 {
+			f.errors[key] = errs[1:]
+			return errs[0]
+		}
+	}
+
+	return nil
+}
+
+// NewError creates an error in the same form as those returned by the SDK.
+func NewError(code, message string, statusCode int) error {
+	return awserr.NewRequestFailure(awserr.New(code, message, nil), statusCode, NewRequestID())
+}
+
+var requestCounter struct {
+	sync.Mutex
+	n int
+}
+
+// NewRequestID generates a unique request id.
+func NewRequestID() string {
+	requestCounter.Lock()
+	defer requestCounter.Unlock()
+
+	requestCounter.n++
+	return fmt.Sprintf("%08x-0000-4000-8000-%012x", time.Now().Unix(), requestCounter.n)
+}
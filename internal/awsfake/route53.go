@@ -0,0 +1,796 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package awsfake
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awsutil"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/aws/aws-sdk-go/service/route53/route53iface"
+)
+
+// Route53 is an in-memory implementation of the Route53 API. Operations
+// which are not implemented panic.
+type Route53 struct {
+	route53iface.Route53API
+
+	// Faults injects errors and counts calls.
+	Faults Faults
+
+	mu               sync.Mutex
+	nextId           int
+	healthChecks     map[string]*route53.HealthCheck
+	callerReferences map[string]*callerReference
+	tags             map[string]map[string]string
+	zones            map[string]map[string]*route53.ResourceRecordSet
+	changes          map[string]*route53.ChangeInfo
+	statuses         map[string][]string
+	healthCheckLimit int64
+}
+
+// DefaultHealthCheckLimit is the number of health checks an account can create.
+const DefaultHealthCheckLimit = 200
+
+// healthCheckerRegions are the regions which observations are reported from.
+var healthCheckerRegions = []string{
+	route53.HealthCheckRegionUsEast1,
+	route53.HealthCheckRegionUsWest1,
+	route53.HealthCheckRegionUsWest2,
+	route53.HealthCheckRegionEuWest1,
+	route53.HealthCheckRegionApSoutheast1,
+	route53.HealthCheckRegionApSoutheast2,
+	route53.HealthCheckRegionApNortheast1,
+	route53.HealthCheckRegionSaEast1,
+}
+
+// callerReference remembers the request which created a health check.
+type callerReference struct {
+	healthCheckId string
+	config        *route53.HealthCheckConfig
+	deleted       bool
+}
+
+// NewRoute53 creates an empty fake.
+func NewRoute53() *Route53 {
+	return &Route53{
+		healthChecks:     make(map[string]*route53.HealthCheck),
+		callerReferences: make(map[string]*callerReference),
+		tags:             make(map[string]map[string]string),
+		zones:            make(map[string]map[string]*route53.ResourceRecordSet),
+		changes:          make(map[string]*route53.ChangeInfo),
+		statuses:         make(map[string][]string),
+		healthCheckLimit: DefaultHealthCheckLimit,
+	}
+}
+
+// SetHealthCheckLimit sets the number of health checks the account can create.
+func (r *Route53) SetHealthCheckLimit(limit int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.healthCheckLimit = limit
+}
+
+// AddHostedZone creates an empty hosted zone which records can be changed in.
+func (r *Route53) AddHostedZone(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id = trimId(&id)
+	if _, ok := r.zones[id]; !ok {
+		r.zones[id] = make(map[string]*route53.ResourceRecordSet)
+	}
+}
+
+// HealthChecks gets a copy of every health check, ordered by id.
+func (r *Route53) HealthChecks() []*route53.HealthCheck {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var healthChecks []*route53.HealthCheck
+	for _, id := range r.healthCheckIds() {
+		healthChecks = append(healthChecks, awsutil.CopyOf(r.healthChecks[id]).(*route53.HealthCheck))
+	}
+	return healthChecks
+}
+
+// DeleteHealthCheckOutOfBand deletes a health check without going through the
+// API, as if someone had used the console.
+func (r *Route53) DeleteHealthCheckOutOfBand(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.deleteHealthCheck(id)
+}
+
+// SetHealthCheckStatus sets the status reported by each health checker, eg.
+// "Failure: Connection timed out.". Health checks report success until set.
+func (r *Route53) SetHealthCheckStatus(id string, statuses ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.statuses[id] = statuses
+}
+
+func (r *Route53) CreateHealthCheck(input *route53.CreateHealthCheckInput) (*route53.CreateHealthCheckOutput, error) {
+	if err := r.Faults.call("CreateHealthCheck"); err != nil {
+		return nil, err
+	}
+	if input.CallerReference == nil || *input.CallerReference == "" || input.HealthCheckConfig == nil {
+		return nil, NewError(route53.ErrCodeInvalidInput, "CallerReference and HealthCheckConfig are required", http.StatusBadRequest)
+	}
+	if len(*input.CallerReference) > 64 {
+		return nil, NewError(route53.ErrCodeInvalidInput, "CallerReference must be at most 64 characters", http.StatusBadRequest)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	config := withHealthCheckDefaults(input.HealthCheckConfig)
+
+	// Requests are idempotent for the same caller reference and configuration.
+	if ref, ok := r.callerReferences[*input.CallerReference]; ok {
+		if ref.deleted || !awsutil.DeepEqual(ref.config, config) {
+			return nil, NewError(route53.ErrCodeHealthCheckAlreadyExists,
+				fmt.Sprintf("A health check with caller reference %s already exists", *input.CallerReference), http.StatusConflict)
+		}
+		return &route53.CreateHealthCheckOutput{
+			HealthCheck: awsutil.CopyOf(r.healthChecks[ref.healthCheckId]).(*route53.HealthCheck),
+			Location:    aws.String("https://route53.amazonaws.com/2013-04-01/healthcheck/" + ref.healthCheckId),
+		}, nil
+	}
+
+	if int64(len(r.healthChecks)) >= r.healthCheckLimit {
+		return nil, NewError(route53.ErrCodeTooManyHealthChecks,
+			fmt.Sprintf("The account limit of %d health checks has been reached", r.healthCheckLimit), http.StatusBadRequest)
+	}
+
+	r.nextId++
+	id := fmt.Sprintf("%08x-0000-4000-8000-%012x", r.nextId, r.nextId)
+
+	r.healthChecks[id] = &route53.HealthCheck{
+		Id:                 aws.String(id),
+		CallerReference:    aws.String(*input.CallerReference),
+		HealthCheckConfig:  config,
+		HealthCheckVersion: aws.Int64(1),
+	}
+	r.callerReferences[*input.CallerReference] = &callerReference{
+		healthCheckId: id,
+		config:        awsutil.CopyOf(config).(*route53.HealthCheckConfig),
+	}
+
+	return &route53.CreateHealthCheckOutput{
+		HealthCheck: awsutil.CopyOf(r.healthChecks[id]).(*route53.HealthCheck),
+		Location:    aws.String("https://route53.amazonaws.com/2013-04-01/healthcheck/" + id),
+	}, nil
+}
+
+func (r *Route53) GetHealthCheck(input *route53.GetHealthCheckInput) (*route53.GetHealthCheckOutput, error) {
+	if err := r.Faults.call("GetHealthCheck"); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	healthCheck, err := r.getHealthCheck(input.HealthCheckId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &route53.GetHealthCheckOutput{
+		HealthCheck: awsutil.CopyOf(healthCheck).(*route53.HealthCheck),
+	}, nil
+}
+
+func (r *Route53) GetHealthCheckStatus(input *route53.GetHealthCheckStatusInput) (*route53.GetHealthCheckStatusOutput, error) {
+	if err := r.Faults.call("GetHealthCheckStatus"); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	healthCheck, err := r.getHealthCheck(input.HealthCheckId)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses, ok := r.statuses[*healthCheck.Id]
+	if !ok {
+		statuses = []string{"Success: HTTP Status Code 200, OK"}
+	}
+
+	output := &route53.GetHealthCheckStatusOutput{}
+	for i, status := range statuses {
+		output.HealthCheckObservations = append(output.HealthCheckObservations, &route53.HealthCheckObservation{
+			Region:    aws.String(healthCheckerRegions[i%len(healthCheckerRegions)]),
+			IPAddress: aws.String(fmt.Sprintf("15.177.%d.%d", i/250, i%250+1)),
+			StatusReport: &route53.StatusReport{
+				Status:      aws.String(status),
+				CheckedTime: aws.Time(time.Now().UTC()),
+			},
+		})
+	}
+	return output, nil
+}
+
+func (r *Route53) UpdateHealthCheck(input *route53.UpdateHealthCheckInput) (*route53.UpdateHealthCheckOutput, error) {
+	if err := r.Faults.call("UpdateHealthCheck"); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	healthCheck, err := r.getHealthCheck(input.HealthCheckId)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.HealthCheckVersion != nil && *input.HealthCheckVersion != *healthCheck.HealthCheckVersion {
+		return nil, NewError(route53.ErrCodeHealthCheckVersionMismatch,
+			fmt.Sprintf("The value of HealthCheckVersion %d does not match the current version %d", *input.HealthCheckVersion, *healthCheck.HealthCheckVersion), http.StatusConflict)
+	}
+
+	config := healthCheck.HealthCheckConfig
+	if input.FullyQualifiedDomainName != nil {
+		config.FullyQualifiedDomainName = aws.String(*input.FullyQualifiedDomainName)
+	}
+	if input.IPAddress != nil {
+		config.IPAddress = aws.String(*input.IPAddress)
+	}
+	if input.Port != nil {
+		config.Port = aws.Int64(*input.Port)
+	}
+	if input.ResourcePath != nil {
+		config.ResourcePath = aws.String(*input.ResourcePath)
+	}
+	if input.SearchString != nil {
+		config.SearchString = aws.String(*input.SearchString)
+	}
+	if input.FailureThreshold != nil {
+		config.FailureThreshold = aws.Int64(*input.FailureThreshold)
+	}
+	if input.Inverted != nil {
+		config.Inverted = aws.Bool(*input.Inverted)
+	}
+	if input.Disabled != nil {
+		config.Disabled = aws.Bool(*input.Disabled)
+	}
+	if input.EnableSNI != nil {
+		config.EnableSNI = aws.Bool(*input.EnableSNI)
+	}
+	if input.Regions != nil {
+		config.Regions = aws.StringSlice(aws.StringValueSlice(input.Regions))
+	}
+
+	healthCheck.HealthCheckVersion = aws.Int64(*healthCheck.HealthCheckVersion + 1)
+
+	return &route53.UpdateHealthCheckOutput{
+		HealthCheck: awsutil.CopyOf(healthCheck).(*route53.HealthCheck),
+	}, nil
+}
+
+func (r *Route53) DeleteHealthCheck(input *route53.DeleteHealthCheckInput) (*route53.DeleteHealthCheckOutput, error) {
+	if err := r.Faults.call("DeleteHealthCheck"); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := r.getHealthCheck(input.HealthCheckId); err != nil {
+		return nil, err
+	}
+
+	for _, zone := range r.zones {
+		for _, set := range zone {
+			if aws.StringValue(set.HealthCheckId) == *input.HealthCheckId {
+				return nil, NewError(route53.ErrCodeHealthCheckInUse,
+					fmt.Sprintf("The health check %s is still referenced from %s", *input.HealthCheckId, aws.StringValue(set.Name)), http.StatusBadRequest)
+			}
+		}
+	}
+
+	r.deleteHealthCheck(*input.HealthCheckId)
+
+	return &route53.DeleteHealthCheckOutput{}, nil
+}
+
+func (r *Route53) GetAccountLimit(input *route53.GetAccountLimitInput) (*route53.GetAccountLimitOutput, error) {
+	if err := r.Faults.call("GetAccountLimit"); err != nil {
+		return nil, err
+	}
+	if input.Type == nil || *input.Type != route53.AccountLimitTypeMaxHealthChecksByOwner {
+		return nil, NewError(route53.ErrCodeInvalidInput, "Only the MAX_HEALTH_CHECKS_BY_OWNER limit is supported", http.StatusBadRequest)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return &route53.GetAccountLimitOutput{
+		Count: aws.Int64(int64(len(r.healthChecks))),
+		Limit: &route53.AccountLimit{
+			Type:  aws.String(route53.AccountLimitTypeMaxHealthChecksByOwner),
+			Value: aws.Int64(r.healthCheckLimit),
+		},
+	}, nil
+}
+
+func (r *Route53) GetHealthCheckCount(input *route53.GetHealthCheckCountInput) (*route53.GetHealthCheckCountOutput, error) {
+	if err := r.Faults.call("GetHealthCheckCount"); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return &route53.GetHealthCheckCountOutput{
+		HealthCheckCount: aws.Int64(int64(len(r.healthChecks))),
+	}, nil
+}
+
+func (r *Route53) ListHealthChecks(input *route53.ListHealthChecksInput) (*route53.ListHealthChecksOutput, error) {
+	if err := r.Faults.call("ListHealthChecks"); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	maxItems, err := parseMaxItems(input.MaxItems, 100, 1000)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := r.healthCheckIds()
+
+	start := 0
+	if input.Marker != nil {
+		start = sort.SearchStrings(ids, *input.Marker)
+		if start == len(ids) || ids[start] != *input.Marker {
+			return nil, NewError(route53.ErrCodeInvalidInput, "Invalid marker", http.StatusBadRequest)
+		}
+	}
+
+	output := &route53.ListHealthChecksOutput{
+		Marker:      input.Marker,
+		MaxItems:    aws.String(strconv.Itoa(maxItems)),
+		IsTruncated: aws.Bool(false),
+	}
+	for i := start; i < len(ids); i++ {
+		if len(output.HealthChecks) == maxItems {
+			output.IsTruncated = aws.Bool(true)
+			output.NextMarker = aws.String(ids[i])
+			break
+		}
+		output.HealthChecks = append(output.HealthChecks, awsutil.CopyOf(r.healthChecks[ids[i]]).(*route53.HealthCheck))
+	}
+
+	return output, nil
+}
+
+func (r *Route53) ListHealthChecksPages(input *route53.ListHealthChecksInput, fn func(*route53.ListHealthChecksOutput, bool) bool) error {
+	input = awsutil.CopyOf(input).(*route53.ListHealthChecksInput)
+	for {
+		output, err := r.ListHealthChecks(input)
+		if err != nil {
+			return err
+		}
+		lastPage := !aws.BoolValue(output.IsTruncated)
+		if !fn(output, lastPage) || lastPage {
+			return nil
+		}
+		input.Marker = output.NextMarker
+	}
+}
+
+func (r *Route53) ChangeTagsForResource(input *route53.ChangeTagsForResourceInput) (*route53.ChangeTagsForResourceOutput, error) {
+	if err := r.Faults.call("ChangeTagsForResource"); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.checkTagResource(input.ResourceType, input.ResourceId); err != nil {
+		return nil, err
+	}
+
+	key := tagKey(*input.ResourceType, *input.ResourceId)
+	if r.tags[key] == nil {
+		r.tags[key] = make(map[string]string)
+	}
+	for _, tag := range input.AddTags {
+		r.tags[key][aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+	for _, name := range input.RemoveTagKeys {
+		delete(r.tags[key], aws.StringValue(name))
+	}
+
+	return &route53.ChangeTagsForResourceOutput{}, nil
+}
+
+func (r *Route53) ListTagsForResource(input *route53.ListTagsForResourceInput) (*route53.ListTagsForResourceOutput, error) {
+	if err := r.Faults.call("ListTagsForResource"); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.checkTagResource(input.ResourceType, input.ResourceId); err != nil {
+		return nil, err
+	}
+
+	return &route53.ListTagsForResourceOutput{
+		ResourceTagSet: r.getTagSet(*input.ResourceType, *input.ResourceId),
+	}, nil
+}
+
+func (r *Route53) ListTagsForResources(input *route53.ListTagsForResourcesInput) (*route53.ListTagsForResourcesOutput, error) {
+	if err := r.Faults.call("ListTagsForResources"); err != nil {
+		return nil, err
+	}
+	if len(input.ResourceIds) > 10 {
+		return nil, NewError(route53.ErrCodeInvalidInput, "ResourceIds may contain at most 10 items", http.StatusBadRequest)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	output := &route53.ListTagsForResourcesOutput{}
+	for _, id := range input.ResourceIds {
+		if err := r.checkTagResource(input.ResourceType, id); err != nil {
+			return nil, err
+		}
+		output.ResourceTagSets = append(output.ResourceTagSets, r.getTagSet(*input.ResourceType, *id))
+	}
+
+	return output, nil
+}
+
+func (r *Route53) ChangeResourceRecordSets(input *route53.ChangeResourceRecordSetsInput) (*route53.ChangeResourceRecordSetsOutput, error) {
+	if err := r.Faults.call("ChangeResourceRecordSets"); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	zone, ok := r.zones[trimId(input.HostedZoneId)]
+	if !ok {
+		return nil, NewError(route53.ErrCodeNoSuchHostedZone, "No hosted zone found with ID: "+aws.StringValue(input.HostedZoneId), http.StatusNotFound)
+	}
+	if input.ChangeBatch == nil || len(input.ChangeBatch.Changes) == 0 {
+		return nil, NewError(route53.ErrCodeInvalidInput, "ChangeBatch must contain at least one change", http.StatusBadRequest)
+	}
+
+	// Changes are applied atomically, so validate against a copy.
+	staged := make(map[string]*route53.ResourceRecordSet, len(zone))
+	for key, set := range zone {
+		staged[key] = set
+	}
+
+	for _, change := range input.ChangeBatch.Changes {
+		set := normaliseRecordSet(change.ResourceRecordSet)
+		key := recordSetKey(set)
+
+		if id := aws.StringValue(set.HealthCheckId); id != "" {
+			if _, ok := r.healthChecks[id]; !ok {
+				return nil, NewError(route53.ErrCodeInvalidChangeBatch, "Invalid health check id: "+id, http.StatusBadRequest)
+			}
+		}
+
+		switch aws.StringValue(change.Action) {
+		case route53.ChangeActionCreate:
+			if _, ok := staged[key]; ok {
+				return nil, NewError(route53.ErrCodeInvalidChangeBatch,
+					fmt.Sprintf("Tried to create resource record set %s but it already exists", key), http.StatusBadRequest)
+			}
+			staged[key] = set
+		case route53.ChangeActionUpsert:
+			staged[key] = set
+		case route53.ChangeActionDelete:
+			existing, ok := staged[key]
+			if !ok || !awsutil.DeepEqual(existing, set) {
+				return nil, NewError(route53.ErrCodeInvalidChangeBatch,
+					fmt.Sprintf("Tried to delete resource record set %s but it was not found or the values provided do not match the current values", key), http.StatusBadRequest)
+			}
+			delete(staged, key)
+		default:
+			return nil, NewError(route53.ErrCodeInvalidInput, "Invalid action: "+aws.StringValue(change.Action), http.StatusBadRequest)
+		}
+	}
+
+	r.zones[trimId(input.HostedZoneId)] = staged
+
+	r.nextId++
+	id := fmt.Sprintf("/change/C%013d", r.nextId)
+	r.changes[trimId(&id)] = &route53.ChangeInfo{
+		Id:      aws.String(id),
+		Status:  aws.String(route53.ChangeStatusInsync),
+		Comment: input.ChangeBatch.Comment,
+	}
+
+	return &route53.ChangeResourceRecordSetsOutput{
+		ChangeInfo: &route53.ChangeInfo{
+			Id:      aws.String(id),
+			Status:  aws.String(route53.ChangeStatusPending),
+			Comment: input.ChangeBatch.Comment,
+		},
+	}, nil
+}
+
+func (r *Route53) GetChange(input *route53.GetChangeInput) (*route53.GetChangeOutput, error) {
+	if err := r.Faults.call("GetChange"); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	change, ok := r.changes[trimId(input.Id)]
+	if !ok {
+		return nil, NewError(route53.ErrCodeNoSuchChange, "No change found with ID: "+aws.StringValue(input.Id), http.StatusNotFound)
+	}
+
+	return &route53.GetChangeOutput{
+		ChangeInfo: awsutil.CopyOf(change).(*route53.ChangeInfo),
+	}, nil
+}
+
+func (r *Route53) ListResourceRecordSets(input *route53.ListResourceRecordSetsInput) (*route53.ListResourceRecordSetsOutput, error) {
+	if err := r.Faults.call("ListResourceRecordSets"); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	zone, ok := r.zones[trimId(input.HostedZoneId)]
+	if !ok {
+		return nil, NewError(route53.ErrCodeNoSuchHostedZone, "No hosted zone found with ID: "+aws.StringValue(input.HostedZoneId), http.StatusNotFound)
+	}
+
+	maxItems, err := parseMaxItems(input.MaxItems, 300, 300)
+	if err != nil {
+		return nil, err
+	}
+
+	sets := make([]*route53.ResourceRecordSet, 0, len(zone))
+	for _, set := range zone {
+		sets = append(sets, set)
+	}
+	sort.Slice(sets, func(i, j int) bool {
+		return recordSetLess(sets[i], sets[j])
+	})
+
+	start := 0
+	if input.StartRecordName != nil {
+		from := &route53.ResourceRecordSet{
+			Name:          aws.String(normaliseName(*input.StartRecordName)),
+			Type:          input.StartRecordType,
+			SetIdentifier: input.StartRecordIdentifier,
+		}
+		start = sort.Search(len(sets), func(i int) bool {
+			return !recordSetLess(sets[i], from)
+		})
+	}
+
+	output := &route53.ListResourceRecordSetsOutput{
+		MaxItems:    aws.String(strconv.Itoa(maxItems)),
+		IsTruncated: aws.Bool(false),
+	}
+	for i := start; i < len(sets); i++ {
+		if len(output.ResourceRecordSets) == maxItems {
+			output.IsTruncated = aws.Bool(true)
+			output.NextRecordName = sets[i].Name
+			output.NextRecordType = sets[i].Type
+			output.NextRecordIdentifier = sets[i].SetIdentifier
+			break
+		}
+		output.ResourceRecordSets = append(output.ResourceRecordSets, awsutil.CopyOf(sets[i]).(*route53.ResourceRecordSet))
+	}
+
+	return output, nil
+}
+
+// getHealthCheck gets a health check by id. The caller must hold the lock.
+func (r *Route53) getHealthCheck(id *string) (*route53.HealthCheck, error) {
+	healthCheck, ok := r.healthChecks[aws.StringValue(id)]
+	if !ok {
+		return nil, NewError(route53.ErrCodeNoSuchHealthCheck, "No health check exists with the specified ID "+aws.StringValue(id), http.StatusNotFound)
+	}
+	return healthCheck, nil
+}
+
+// deleteHealthCheck removes a health check. The caller must hold the lock.
+func (r *Route53) deleteHealthCheck(id string) {
+	healthCheck, ok := r.healthChecks[id]
+	if !ok {
+		return
+	}
+
+	// The caller reference can never be used again.
+	if ref, ok := r.callerReferences[aws.StringValue(healthCheck.CallerReference)]; ok {
+		ref.deleted = true
+	}
+
+	delete(r.healthChecks, id)
+	delete(r.statuses, id)
+	delete(r.tags, tagKey(route53.TagResourceTypeHealthcheck, id))
+}
+
+// healthCheckIds gets the sorted health check ids. The caller must hold the lock.
+func (r *Route53) healthCheckIds() []string {
+	ids := make([]string, 0, len(r.healthChecks))
+	for id := range r.healthChecks {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// checkTagResource checks that a taggable resource exists. The caller must hold the lock.
+func (r *Route53) checkTagResource(resourceType, id *string) error {
+	switch aws.StringValue(resourceType) {
+	case route53.TagResourceTypeHealthcheck:
+		_, err := r.getHealthCheck(id)
+		return err
+	case route53.TagResourceTypeHostedzone:
+		if _, ok := r.zones[trimId(id)]; !ok {
+			return NewError(route53.ErrCodeNoSuchHostedZone, "No hosted zone found with ID: "+aws.StringValue(id), http.StatusNotFound)
+		}
+		return nil
+	}
+	return NewError(route53.ErrCodeInvalidInput, "Invalid resource type: "+aws.StringValue(resourceType), http.StatusBadRequest)
+}
+
+// getTagSet gets the tags of a resource, sorted by key. The caller must hold the lock.
+func (r *Route53) getTagSet(resourceType, id string) *route53.ResourceTagSet {
+	tags := r.tags[tagKey(resourceType, id)]
+
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	set := &route53.ResourceTagSet{
+		ResourceId:   aws.String(id),
+		ResourceType: aws.String(resourceType),
+		Tags:         []*route53.Tag{},
+	}
+	for _, key := range keys {
+		set.Tags = append(set.Tags, &route53.Tag{Key: aws.String(key), Value: aws.String(tags[key])})
+	}
+	return set
+}
+
+func tagKey(resourceType, id string) string {
+	return resourceType + "/" + id
+}
+
+// withHealthCheckDefaults copies a config, filling in the defaults Route53 applies.
+func withHealthCheckDefaults(config *route53.HealthCheckConfig) *route53.HealthCheckConfig {
+	config = awsutil.CopyOf(config).(*route53.HealthCheckConfig)
+	if config.RequestInterval == nil {
+		config.RequestInterval = aws.Int64(30)
+	}
+	if config.FailureThreshold == nil {
+		config.FailureThreshold = aws.Int64(3)
+	}
+	if config.MeasureLatency == nil {
+		config.MeasureLatency = aws.Bool(false)
+	}
+	if config.Inverted == nil {
+		config.Inverted = aws.Bool(false)
+	}
+	if config.Disabled == nil {
+		config.Disabled = aws.Bool(false)
+	}
+	return config
+}
+
+// normaliseRecordSet copies a record set, converting names to the form Route53 returns.
+func normaliseRecordSet(set *route53.ResourceRecordSet) *route53.ResourceRecordSet {
+	set = awsutil.CopyOf(set).(*route53.ResourceRecordSet)
+	set.Name = aws.String(normaliseName(aws.StringValue(set.Name)))
+	if set.AliasTarget != nil {
+		set.AliasTarget.DNSName = aws.String(normaliseName(aws.StringValue(set.AliasTarget.DNSName)))
+	}
+	return set
+}
+
+// trimId removes the resource type prefix from an id, eg. "/hostedzone/Z123"
+// becomes "Z123", like the SDK does for request paths.
+func trimId(id *string) string {
+	value := aws.StringValue(id)
+	return value[strings.LastIndex(value, "/")+1:]
+}
+
+// normaliseName fully qualifies a name like Route53 does, escaping characters
+// other than a-z, 0-9, hyphens, underscores and dots as octal codes.
+func normaliseName(name string) string {
+	name = strings.ToLower(name)
+	if !strings.HasSuffix(name, ".") {
+		name = name + "."
+	}
+
+	var escaped strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+			escaped.WriteByte(c)
+		case c == '\\' && i+3 < len(name) && strings.Trim(name[i+1:i+4], "01234567") == "":
+			escaped.WriteString(name[i : i+4])
+			i += 3
+		default:
+			fmt.Fprintf(&escaped, "\\%03o", c)
+		}
+	}
+	return escaped.String()
+}
+
+func recordSetKey(set *route53.ResourceRecordSet) string {
+	return strings.Join([]string{aws.StringValue(set.Name), aws.StringValue(set.Type), aws.StringValue(set.SetIdentifier)}, " ")
+}
+
+// recordSetLess orders record sets like Route53, by name with the labels
+// reversed, then type, then set identifier.
+func recordSetLess(a, b *route53.ResourceRecordSet) bool {
+	an, bn := reverseLabels(aws.StringValue(a.Name)), reverseLabels(aws.StringValue(b.Name))
+	if an != bn {
+		return an < bn
+	}
+	if aws.StringValue(a.Type) != aws.StringValue(b.Type) {
+		return aws.StringValue(a.Type) < aws.StringValue(b.Type)
+	}
+	return aws.StringValue(a.SetIdentifier) < aws.StringValue(b.SetIdentifier)
+}
+
+func reverseLabels(name string) string {
+	labels := strings.Split(strings.TrimSuffix(name, "."), ".")
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+	return strings.Join(labels, ".")
+}
+
+func parseMaxItems(value *string, defaultValue, max int) (int, error) {
+	if value == nil {
+		return defaultValue, nil
+	}
+	n, err := strconv.Atoi(*value)
+	if err != nil || n < 1 {
+		return 0, NewError(route53.ErrCodeInvalidInput, "Invalid MaxItems: "+*value, http.StatusBadRequest)
+	}
+	if n > max {
+		n = max
+	}
+	return n, nil
+}
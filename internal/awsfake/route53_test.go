@@ -0,0 +1,271 @@
+package awsfake
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateHealthCheckIdempotency(t *testing.T) {
+	client := NewRoute53()
+
+	input := &route53.CreateHealthCheckInput{
+		CallerReference: aws.String("abc"),
+		HealthCheckConfig: &route53.HealthCheckConfig{
+			Type:                     aws.String(route53.HealthCheckTypeHttps),
+			FullyQualifiedDomainName: aws.String("example.com"),
+			Port:                     aws.Int64(443),
+		},
+	}
+
+	first, err := client.CreateHealthCheck(input)
+	assert.Nil(t, err)
+
+	// The same request returns the same health check.
+	second, err := client.CreateHealthCheck(input)
+	assert.Nil(t, err)
+	assert.Equal(t, *first.HealthCheck.Id, *second.HealthCheck.Id)
+	assert.Len(t, client.HealthChecks(), 1)
+
+	// A different configuration with the same caller reference is refused.
+	input.HealthCheckConfig.Port = aws.Int64(80)
+	_, err = client.CreateHealthCheck(input)
+	assertErrorCode(t, route53.ErrCodeHealthCheckAlreadyExists, err)
+
+	// Caller references of deleted health checks cannot be reused.
+	_, err = client.DeleteHealthCheck(&route53.DeleteHealthCheckInput{HealthCheckId: first.HealthCheck.Id})
+	assert.Nil(t, err)
+
+	input.HealthCheckConfig.Port = aws.Int64(443)
+	_, err = client.CreateHealthCheck(input)
+	assertErrorCode(t, route53.ErrCodeHealthCheckAlreadyExists, err)
+
+	_, err = client.DeleteHealthCheck(&route53.DeleteHealthCheckInput{HealthCheckId: first.HealthCheck.Id})
+	assertErrorCode(t, route53.ErrCodeNoSuchHealthCheck, err)
+}
+
+func TestUpdateHealthCheckVersion(t *testing.T) {
+	client := NewRoute53()
+
+	created, err := client.CreateHealthCheck(&route53.CreateHealthCheckInput{
+		CallerReference: aws.String("abc"),
+		HealthCheckConfig: &route53.HealthCheckConfig{
+			Type:                     aws.String(route53.HealthCheckTypeHttps),
+			FullyQualifiedDomainName: aws.String("example.com"),
+		},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), *created.HealthCheck.HealthCheckConfig.FailureThreshold)
+
+	updated, err := client.UpdateHealthCheck(&route53.UpdateHealthCheckInput{
+		HealthCheckId:      created.HealthCheck.Id,
+		HealthCheckVersion: aws.Int64(1),
+		Disabled:           aws.Bool(true),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), *updated.HealthCheck.HealthCheckVersion)
+	assert.True(t, *updated.HealthCheck.HealthCheckConfig.Disabled)
+
+	_, err = client.UpdateHealthCheck(&route53.UpdateHealthCheckInput{
+		HealthCheckId:      created.HealthCheck.Id,
+		HealthCheckVersion: aws.Int64(1),
+		Disabled:           aws.Bool(false),
+	})
+	assertErrorCode(t, route53.ErrCodeHealthCheckVersionMismatch, err)
+}
+
+func TestGetHealthCheckStatus(t *testing.T) {
+	client := NewRoute53()
+
+	created, err := client.CreateHealthCheck(&route53.CreateHealthCheckInput{
+		CallerReference: aws.String("abc"),
+		HealthCheckConfig: &route53.HealthCheckConfig{
+			Type:                     aws.String(route53.HealthCheckTypeHttps),
+			FullyQualifiedDomainName: aws.String("example.com"),
+		},
+	})
+	assert.Nil(t, err)
+
+	output, err := client.GetHealthCheckStatus(&route53.GetHealthCheckStatusInput{HealthCheckId: created.HealthCheck.Id})
+	assert.Nil(t, err)
+	assert.Len(t, output.HealthCheckObservations, 1)
+	assert.Equal(t, "Success: HTTP Status Code 200, OK", *output.HealthCheckObservations[0].StatusReport.Status)
+
+	client.SetHealthCheckStatus(*created.HealthCheck.Id, "Failure: Connection timed out.", "Success: HTTP Status Code 200, OK")
+
+	output, err = client.GetHealthCheckStatus(&route53.GetHealthCheckStatusInput{HealthCheckId: created.HealthCheck.Id})
+	assert.Nil(t, err)
+	assert.Len(t, output.HealthCheckObservations, 2)
+	assert.Equal(t, "Failure: Connection timed out.", *output.HealthCheckObservations[0].StatusReport.Status)
+	assert.NotEqual(t, *output.HealthCheckObservations[0].Region, *output.HealthCheckObservations[1].Region)
+
+	_, err = client.GetHealthCheckStatus(&route53.GetHealthCheckStatusInput{HealthCheckId: aws.String("missing")})
+	assertErrorCode(t, route53.ErrCodeNoSuchHealthCheck, err)
+}
+
+func TestListHealthChecksPagination(t *testing.T) {
+	client := NewRoute53()
+
+	for _, ref := range []string{"a", "b", "c"} {
+		_, err := client.CreateHealthCheck(&route53.CreateHealthCheckInput{
+			CallerReference:   aws.String(ref),
+			HealthCheckConfig: &route53.HealthCheckConfig{Type: aws.String(route53.HealthCheckTypeHttp)},
+		})
+		assert.Nil(t, err)
+	}
+
+	var pages, total int
+	err := client.ListHealthChecksPages(&route53.ListHealthChecksInput{MaxItems: aws.String("2")}, func(output *route53.ListHealthChecksOutput, lastPage bool) bool {
+		pages++
+		total += len(output.HealthChecks)
+		return true
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, pages)
+	assert.Equal(t, 3, total)
+}
+
+func TestTags(t *testing.T) {
+	client := NewRoute53()
+
+	created, err := client.CreateHealthCheck(&route53.CreateHealthCheckInput{
+		CallerReference:   aws.String("abc"),
+		HealthCheckConfig: &route53.HealthCheckConfig{Type: aws.String(route53.HealthCheckTypeHttp)},
+	})
+	assert.Nil(t, err)
+
+	_, err = client.ChangeTagsForResource(&route53.ChangeTagsForResourceInput{
+		ResourceId:   created.HealthCheck.Id,
+		ResourceType: aws.String(route53.TagResourceTypeHealthcheck),
+		AddTags:      []*route53.Tag{{Key: aws.String("Name"), Value: aws.String("example")}},
+	})
+	assert.Nil(t, err)
+
+	output, err := client.ListTagsForResource(&route53.ListTagsForResourceInput{
+		ResourceId:   created.HealthCheck.Id,
+		ResourceType: aws.String(route53.TagResourceTypeHealthcheck),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "example", *output.ResourceTagSet.Tags[0].Value)
+
+	_, err = client.ChangeTagsForResource(&route53.ChangeTagsForResourceInput{
+		ResourceId:   aws.String("missing"),
+		ResourceType: aws.String(route53.TagResourceTypeHealthcheck),
+	})
+	assertErrorCode(t, route53.ErrCodeNoSuchHealthCheck, err)
+}
+
+func TestChangeResourceRecordSets(t *testing.T) {
+	client := NewRoute53()
+	client.AddHostedZone("Z123")
+
+	created, err := client.CreateHealthCheck(&route53.CreateHealthCheckInput{
+		CallerReference:   aws.String("abc"),
+		HealthCheckConfig: &route53.HealthCheckConfig{Type: aws.String(route53.HealthCheckTypeHttp)},
+	})
+	assert.Nil(t, err)
+
+	set := &route53.ResourceRecordSet{
+		Name:            aws.String("WWW.example.com"),
+		Type:            aws.String("A"),
+		TTL:             aws.Int64(60),
+		SetIdentifier:   aws.String("primary"),
+		Failover:        aws.String("PRIMARY"),
+		HealthCheckId:   created.HealthCheck.Id,
+		ResourceRecords: []*route53.ResourceRecord{{Value: aws.String("192.0.2.1")}},
+	}
+
+	_, err = client.ChangeResourceRecordSets(&route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String("Z123"),
+		ChangeBatch: &route53.ChangeBatch{
+			Changes: []*route53.Change{{Action: aws.String(route53.ChangeActionCreate), ResourceRecordSet: set}},
+		},
+	})
+	assert.Nil(t, err)
+
+	output, err := client.ListResourceRecordSets(&route53.ListResourceRecordSetsInput{
+		HostedZoneId:    aws.String("Z123"),
+		StartRecordName: aws.String("www.example.com"),
+		StartRecordType: aws.String("A"),
+		MaxItems:        aws.String("1"),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "www.example.com.", *output.ResourceRecordSets[0].Name)
+
+	// Health checks which are in use cannot be deleted.
+	_, err = client.DeleteHealthCheck(&route53.DeleteHealthCheckInput{HealthCheckId: created.HealthCheck.Id})
+	assertErrorCode(t, route53.ErrCodeHealthCheckInUse, err)
+
+	// Deletes must match the current values.
+	set.TTL = aws.Int64(300)
+	_, err = client.ChangeResourceRecordSets(&route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String("Z123"),
+		ChangeBatch: &route53.ChangeBatch{
+			Changes: []*route53.Change{{Action: aws.String(route53.ChangeActionDelete), ResourceRecordSet: set}},
+		},
+	})
+	assertErrorCode(t, route53.ErrCodeInvalidChangeBatch, err)
+
+	_, err = client.ChangeResourceRecordSets(&route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String("Z123"),
+		ChangeBatch: &route53.ChangeBatch{
+			Changes: []*route53.Change{{Action: aws.String(route53.ChangeActionDelete), ResourceRecordSet: output.ResourceRecordSets[0]}},
+		},
+	})
+	assert.Nil(t, err)
+}
+
+func TestAccountLimit(t *testing.T) {
+	client := NewRoute53()
+	client.SetHealthCheckLimit(1)
+
+	create := func(ref string) error {
+		_, err := client.CreateHealthCheck(&route53.CreateHealthCheckInput{
+			CallerReference: aws.String(ref),
+			HealthCheckConfig: &route53.HealthCheckConfig{
+				FullyQualifiedDomainName: aws.String("example.com"),
+				Type:                     aws.String(route53.HealthCheckTypeHttps),
+			},
+		})
+		return err
+	}
+
+	assert.Nil(t, create("a"))
+	assertErrorCode(t, route53.ErrCodeTooManyHealthChecks, create("b"))
+
+	limit, err := client.GetAccountLimit(&route53.GetAccountLimitInput{Type: aws.String(route53.AccountLimitTypeMaxHealthChecksByOwner)})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), *limit.Limit.Value)
+	assert.Equal(t, int64(1), *limit.Count)
+
+	count, err := client.GetHealthCheckCount(&route53.GetHealthCheckCountInput{})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), *count.HealthCheckCount)
+}
+
+func TestFaults(t *testing.T) {
+	client := NewRoute53()
+	client.Faults.Throttle("GetHealthCheck", "Throttling", 2)
+
+	for i := 0; i < 2; i++ {
+		_, err := client.GetHealthCheck(&route53.GetHealthCheckInput{HealthCheckId: aws.String("missing")})
+		assertErrorCode(t, "Throttling", err)
+	}
+
+	_, err := client.GetHealthCheck(&route53.GetHealthCheckInput{HealthCheckId: aws.String("missing")})
+	assertErrorCode(t, route53.ErrCodeNoSuchHealthCheck, err)
+	assert.Equal(t, 3, client.Faults.Calls("GetHealthCheck"))
+}
+
+func assertErrorCode(t *testing.T, code string, err error) {
+	t.Helper()
+	if assert.NotNil(t, err) {
+		aerr, ok := err.(awserr.Error)
+		if assert.True(t, ok) {
+			assert.Equal(t, code, aerr.Code())
+		}
+	}
+}
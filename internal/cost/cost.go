@@ -0,0 +1,177 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cost estimates what the AWS resources of each HealthCheck cost, so
+// tenants can be billed for them.
+package cost
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	healthcheckv1 "github.com/skpr/r53-check/api/v1"
+)
+
+// Prices is the price table health checks are estimated with. Prices are monthly.
+type Prices struct {
+	Currency string
+	// AWS prices health checks of endpoints running on AWS.
+	AWS EndpointPrices
+	// NonAWS prices health checks of every other endpoint.
+	NonAWS EndpointPrices
+	// Alarm is the price of a CloudWatch alarm.
+	Alarm float64
+	// AWSDomains are the domain suffixes of endpoints which are priced as AWS endpoints.
+	AWSDomains []string
+}
+
+// EndpointPrices are the prices of a health check and its optional features.
+type EndpointPrices struct {
+	HealthCheck    float64
+	HTTPS          float64
+	StringMatching float64
+	FastInterval   float64
+	MeasureLatency float64
+}
+
+// DefaultPrices gets the Route53 and CloudWatch list prices in us-east-1.
+func DefaultPrices() Prices {
+	return Prices{
+		Currency: "USD",
+		AWS: EndpointPrices{
+			HealthCheck:    0.50,
+			HTTPS:          1.00,
+			StringMatching: 1.00,
+			FastInterval:   1.00,
+			MeasureLatency: 1.00,
+		},
+		NonAWS: EndpointPrices{
+			HealthCheck:    0.75,
+			HTTPS:          2.00,
+			StringMatching: 2.00,
+			FastInterval:   2.00,
+			MeasureLatency: 2.00,
+		},
+		Alarm:      0.10,
+		AWSDomains: []string{".amazonaws.com", ".cloudfront.net", ".elasticbeanstalk.com"},
+	}
+}
+
+// FromConfigMap gets the prices from the data of a ConfigMap, eg.
+// non_aws_health_check: "0.75". Prices which are not set are the defaults.
+func FromConfigMap(data map[string]string) (Prices, error) {
+	prices := DefaultPrices()
+
+	for key, value := range data {
+		switch key {
+		case "currency":
+			prices.Currency = value
+		case "aws_domains":
+			prices.AWSDomains = nil
+			for _, domain := range strings.Split(value, ",") {
+				if domain = strings.TrimSpace(domain); domain != "" {
+					prices.AWSDomains = append(prices.AWSDomains, domain)
+				}
+			}
+		default:
+			price, ok := prices.fields()[key]
+			if !ok {
+				return Prices{}, fmt.Errorf("unknown price: %s", key)
+			}
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || parsed < 0 {
+				return Prices{}, fmt.Errorf("invalid price for %s: %q", key, value)
+			}
+			*price = parsed
+		}
+	}
+
+	return prices, nil
+}
+
+// fields gets the prices by their key in the ConfigMap.
+func (p *Prices) fields() map[string]*float64 {
+	return map[string]*float64{
+		"aws_health_check":        &p.AWS.HealthCheck,
+		"aws_https":               &p.AWS.HTTPS,
+		"aws_string_matching":     &p.AWS.StringMatching,
+		"aws_fast_interval":       &p.AWS.FastInterval,
+		"aws_measure_latency":     &p.AWS.MeasureLatency,
+		"non_aws_health_check":    &p.NonAWS.HealthCheck,
+		"non_aws_https":           &p.NonAWS.HTTPS,
+		"non_aws_string_matching": &p.NonAWS.StringMatching,
+		"non_aws_fast_interval":   &p.NonAWS.FastInterval,
+		"non_aws_measure_latency": &p.NonAWS.MeasureLatency,
+		"alarm":                   &p.Alarm,
+	}
+}
+
+// IsAWSEndpoint checks if a domain is priced as an AWS endpoint.
+func (p Prices) IsAWSEndpoint(domain string) bool {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	for _, suffix := range p.AWSDomains {
+		if strings.HasSuffix(domain, strings.ToLower(suffix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Estimate estimates the monthly cost of a HealthCheck, and whether it has a
+// CloudWatch alarm. The incluster backend does not create a Route53 health check.
+func Estimate(prices Prices, healthCheck *healthcheckv1.HealthCheck, alarm bool) (healthcheckv1.CostEstimate, float64) {
+	estimate := healthcheckv1.CostEstimate{Currency: prices.Currency}
+	var total float64
+
+	add := func(item string, price float64) {
+		estimate.Items = append(estimate.Items, fmt.Sprintf("%s: %s", item, format(price)))
+		total += price
+	}
+
+	if healthCheck.Spec.Backend != healthcheckv1.BackendInCluster {
+		endpoint := prices.NonAWS
+		if prices.IsAWSEndpoint(healthCheck.Spec.Domain) {
+			endpoint = prices.AWS
+			estimate.AWSEndpoint = true
+		}
+
+		add("health_check", endpoint.HealthCheck)
+		if strings.HasPrefix(healthCheck.Spec.Type, "HTTPS") {
+			add("https", endpoint.HTTPS)
+		}
+		if strings.HasSuffix(healthCheck.Spec.Type, "_STR_MATCH") {
+			add("string_matching", endpoint.StringMatching)
+		}
+		if healthCheck.Spec.RequestInterval == 10 {
+			add("fast_interval", endpoint.FastInterval)
+		}
+		if healthCheck.Spec.MeasureLatency {
+			add("measure_latency", endpoint.MeasureLatency)
+		}
+	}
+
+	if alarm {
+		add("alarm", prices.Alarm)
+	}
+
+	estimate.Monthly = format(total)
+	return estimate, total
+}
+
+// format formats a price, eg. "2.85".
+func format(price float64) string {
+	return strconv.FormatFloat(price, 'f', 2, 64)
+}
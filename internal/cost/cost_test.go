@@ -0,0 +1,117 @@
+package cost
+
+import (
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/types"
+
+	healthcheckv1 "github.com/skpr/r53-check/api/v1"
+)
+
+func TestEstimate(t *testing.T) {
+	prices := DefaultPrices()
+
+	healthCheck := &healthcheckv1.HealthCheck{
+		Spec: healthcheckv1.HealthCheckSpec{
+			Domain:          "www.example.com",
+			Type:            "HTTPS_STR_MATCH",
+			RequestInterval: 10,
+		},
+	}
+
+	estimate, monthly := Estimate(prices, healthCheck, true)
+	assert.Equal(t, healthcheckv1.CostEstimate{
+		Monthly:  "6.85",
+		Currency: "USD",
+		Items: []string{
+			"health_check: 0.75",
+			"https: 2.00",
+			"string_matching: 2.00",
+			"fast_interval: 2.00",
+			"alarm: 0.10",
+		},
+	}, estimate)
+	assert.InDelta(t, 6.85, monthly, 0.001)
+
+	// Endpoints running on AWS are cheaper.
+	healthCheck.Spec = healthcheckv1.HealthCheckSpec{
+		Domain:         "example-123.ap-southeast-2.elb.amazonaws.com",
+		Type:           "HTTP",
+		MeasureLatency: true,
+	}
+	estimate, _ = Estimate(prices, healthCheck, false)
+	assert.Equal(t, healthcheckv1.CostEstimate{
+		Monthly:     "1.50",
+		Currency:    "USD",
+		AWSEndpoint: true,
+		Items:       []string{"health_check: 0.50", "measure_latency: 1.00"},
+	}, estimate)
+
+	// The incluster backend only pays for the alarm.
+	healthCheck.Spec.Backend = healthcheckv1.BackendInCluster
+	estimate, _ = Estimate(prices, healthCheck, true)
+	assert.Equal(t, healthcheckv1.CostEstimate{
+		Monthly:  "0.10",
+		Currency: "USD",
+		Items:    []string{"alarm: 0.10"},
+	}, estimate)
+}
+
+func TestFromConfigMap(t *testing.T) {
+	prices, err := FromConfigMap(map[string]string{
+		"currency":             "AUD",
+		"non_aws_health_check": "1.15",
+		"alarm":                " 0.15 ",
+		"aws_domains":          ".example.net, .internal",
+	})
+	assert.Nil(t, err)
+
+	expected := DefaultPrices()
+	expected.Currency = "AUD"
+	expected.NonAWS.HealthCheck = 1.15
+	expected.Alarm = 0.15
+	expected.AWSDomains = []string{".example.net", ".internal"}
+	assert.Equal(t, expected, prices)
+
+	assert.True(t, prices.IsAWSEndpoint("www.Example.NET."))
+	assert.False(t, prices.IsAWSEndpoint("www.example.com"))
+
+	_, err = FromConfigMap(map[string]string{"health_check": "0.50"})
+	assert.EqualError(t, err, "unknown price: health_check")
+
+	_, err = FromConfigMap(map[string]string{"alarm": "-1"})
+	assert.EqualError(t, err, `invalid price for alarm: "-1"`)
+}
+
+func TestTotals(t *testing.T) {
+	// gauge gets the total exported for a namespace.
+	gauge := func(namespace string) float64 {
+		var metric dto.Metric
+		err := namespaceCost.WithLabelValues(namespace).Write(&metric)
+		assert.Nil(t, err)
+		return metric.GetGauge().GetValue()
+	}
+
+	totals := NewTotals()
+	totals.Set(types.NamespacedName{Namespace: "tenant", Name: "first"}, 1.25)
+	totals.Set(types.NamespacedName{Namespace: "tenant", Name: "second"}, 0.5)
+	totals.Set(types.NamespacedName{Namespace: "other", Name: "first"}, 2)
+
+	assert.Equal(t, 1.75, totals.Namespace("tenant"))
+	assert.Equal(t, 1.75, gauge("tenant"))
+
+	totals.Set(types.NamespacedName{Namespace: "tenant", Name: "first"}, 0.25)
+	assert.Equal(t, 0.75, gauge("tenant"))
+
+	totals.Delete(types.NamespacedName{Namespace: "tenant", Name: "first"})
+	totals.Delete(types.NamespacedName{Namespace: "tenant", Name: "missing"})
+	assert.Equal(t, 0.5, gauge("tenant"))
+	assert.Equal(t, 2.0, gauge("other"))
+
+	// A nil Totals is ignored.
+	var disabled *Totals
+	disabled.Set(types.NamespacedName{Namespace: "tenant", Name: "first"}, 1)
+	disabled.Delete(types.NamespacedName{Namespace: "tenant", Name: "first"})
+}
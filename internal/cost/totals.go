@@ -0,0 +1,110 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cost
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// NamespaceCostMetric is the estimated monthly cost of the HealthChecks in a namespace.
+const NamespaceCostMetric = "r53_check_namespace_estimated_monthly_cost"
+
+var namespaceCost = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: NamespaceCostMetric,
+	Help: "The estimated monthly cost of the HealthChecks in a namespace, in the currency of the price table.",
+}, []string{"namespace"})
+
+func init() {
+	metrics.Registry.MustRegister(namespaceCost)
+}
+
+// Totals adds up the estimates of the HealthChecks in each namespace. Only
+// the HealthChecks reconciled by this manager are counted, so the totals of
+// shards are summed.
+type Totals struct {
+	mu sync.Mutex
+	// costs are the estimates by namespace and name.
+	costs map[string]map[string]float64
+}
+
+// NewTotals creates empty totals.
+func NewTotals() *Totals {
+	return &Totals{costs: make(map[string]map[string]float64)}
+}
+
+// Set records the estimate of a HealthCheck.
+func (t *Totals) Set(key types.NamespacedName, monthly float64) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.costs[key.Namespace] == nil {
+		t.costs[key.Namespace] = make(map[string]float64)
+	}
+	t.costs[key.Namespace][key.Name] = monthly
+	t.sync(key.Namespace)
+}
+
+// Delete forgets the estimate of a HealthCheck.
+func (t *Totals) Delete(key types.NamespacedName) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.costs[key.Namespace][key.Name]; !ok {
+		return
+	}
+	delete(t.costs[key.Namespace], key.Name)
+	t.sync(key.Namespace)
+}
+
+// Namespace gets the total of a namespace.
+func (t *Totals) Namespace(namespace string) float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.total(namespace)
+}
+
+// total adds up the estimates in a namespace.
+func (t *Totals) total(namespace string) float64 {
+	var total float64
+	for _, monthly := range t.costs[namespace] {
+		total += monthly
+	}
+	return total
+}
+
+// sync sets the gauge of a namespace, which is removed once it has no HealthChecks.
+func (t *Totals) sync(namespace string) {
+	if len(t.costs[namespace]) == 0 {
+		delete(t.costs, namespace)
+		namespaceCost.DeleteLabelValues(namespace)
+		return
+	}
+
+	namespaceCost.WithLabelValues(namespace).Set(t.total(namespace))
+}
@@ -0,0 +1,190 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package dryrun wraps the AWS clients so that mutating calls are planned
+// instead of made. Read calls are passed through, so what is observed still
+// reflects reality.
+package dryrun
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awsutil"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/aws/aws-sdk-go/service/route53/route53iface"
+	"github.com/go-logr/logr"
+)
+
+// PlannedId is the id of a resource which would have been created.
+const PlannedId = "(planned)"
+
+// Plan records the mutating calls which would have been made.
+type Plan struct {
+	Log logr.Logger
+
+	mu      sync.Mutex
+	changes []string
+	// discard only logs the calls, without recording them.
+	discard bool
+}
+
+// NewPlan creates an empty plan.
+func NewPlan(log logr.Logger) *Plan {
+	return &Plan{Log: log}
+}
+
+// NewLog creates a plan which only logs the calls, for callers which plan
+// calls for as long as the manager runs, eg. the prober.
+func NewLog(log logr.Logger) *Plan {
+	return &Plan{Log: log, discard: true}
+}
+
+// Changes gets the calls which would have been made, in order.
+func (p *Plan) Changes() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]string(nil), p.changes...)
+}
+
+// Record logs and records a change which would have been made outside of
+// AWS, eg. to a Kubernetes object.
+func (p *Plan) Record(operation, description string) {
+	p.Log.Info(fmt.Sprintf("Would call %s", operation), "input", description)
+
+	if p.discard {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.changes = append(p.changes, fmt.Sprintf("%s %s", operation, description))
+}
+
+// record logs and records a call which would have been made.
+func (p *Plan) record(operation string, input interface{}) {
+	// Prettify spreads the input over many lines.
+	p.Record(operation, strings.Join(strings.Fields(awsutil.Prettify(input)), " "))
+}
+
+// IsPlanned checks if an id is of a resource which would have been created,
+// so there is nothing to read.
+func IsPlanned(id string) bool {
+	return id == PlannedId
+}
+
+// Route53 plans mutating Route53 calls.
+type Route53 struct {
+	route53iface.Route53API
+	Plan *Plan
+}
+
+// NewRoute53 wraps a Route53 client.
+func NewRoute53(client route53iface.Route53API, plan *Plan) *Route53 {
+	return &Route53{Route53API: client, Plan: plan}
+}
+
+func (r *Route53) CreateHealthCheck(input *route53.CreateHealthCheckInput) (*route53.CreateHealthCheckOutput, error) {
+	r.Plan.record("Route53.CreateHealthCheck", input)
+	return &route53.CreateHealthCheckOutput{
+		HealthCheck: &route53.HealthCheck{
+			Id:                aws.String(PlannedId),
+			CallerReference:   input.CallerReference,
+			HealthCheckConfig: input.HealthCheckConfig,
+		},
+	}, nil
+}
+
+func (r *Route53) UpdateHealthCheck(input *route53.UpdateHealthCheckInput) (*route53.UpdateHealthCheckOutput, error) {
+	r.Plan.record("Route53.UpdateHealthCheck", input)
+	return &route53.UpdateHealthCheckOutput{}, nil
+}
+
+func (r *Route53) DeleteHealthCheck(input *route53.DeleteHealthCheckInput) (*route53.DeleteHealthCheckOutput, error) {
+	r.Plan.record("Route53.DeleteHealthCheck", input)
+	return &route53.DeleteHealthCheckOutput{}, nil
+}
+
+func (r *Route53) ChangeTagsForResource(input *route53.ChangeTagsForResourceInput) (*route53.ChangeTagsForResourceOutput, error) {
+	r.Plan.record("Route53.ChangeTagsForResource", input)
+	return &route53.ChangeTagsForResourceOutput{}, nil
+}
+
+func (r *Route53) ChangeResourceRecordSets(input *route53.ChangeResourceRecordSetsInput) (*route53.ChangeResourceRecordSetsOutput, error) {
+	r.Plan.record("Route53.ChangeResourceRecordSets", input)
+	return &route53.ChangeResourceRecordSetsOutput{
+		ChangeInfo: &route53.ChangeInfo{
+			Id:     aws.String(PlannedId),
+			Status: aws.String(route53.ChangeStatusInsync),
+		},
+	}, nil
+}
+
+// CloudWatch plans mutating CloudWatch calls.
+type CloudWatch struct {
+	cloudwatchiface.CloudWatchAPI
+	Plan *Plan
+}
+
+// NewCloudWatch wraps a CloudWatch client.
+func NewCloudWatch(client cloudwatchiface.CloudWatchAPI, plan *Plan) *CloudWatch {
+	return &CloudWatch{CloudWatchAPI: client, Plan: plan}
+}
+
+func (c *CloudWatch) PutMetricAlarm(input *cloudwatch.PutMetricAlarmInput) (*cloudwatch.PutMetricAlarmOutput, error) {
+	c.Plan.record("CloudWatch.PutMetricAlarm", input)
+	return &cloudwatch.PutMetricAlarmOutput{}, nil
+}
+
+func (c *CloudWatch) DeleteAlarms(input *cloudwatch.DeleteAlarmsInput) (*cloudwatch.DeleteAlarmsOutput, error) {
+	c.Plan.record("CloudWatch.DeleteAlarms", input)
+	return &cloudwatch.DeleteAlarmsOutput{}, nil
+}
+
+func (c *CloudWatch) EnableAlarmActions(input *cloudwatch.EnableAlarmActionsInput) (*cloudwatch.EnableAlarmActionsOutput, error) {
+	c.Plan.record("CloudWatch.EnableAlarmActions", input)
+	return &cloudwatch.EnableAlarmActionsOutput{}, nil
+}
+
+func (c *CloudWatch) DisableAlarmActions(input *cloudwatch.DisableAlarmActionsInput) (*cloudwatch.DisableAlarmActionsOutput, error) {
+	c.Plan.record("CloudWatch.DisableAlarmActions", input)
+	return &cloudwatch.DisableAlarmActionsOutput{}, nil
+}
+
+func (c *CloudWatch) SetAlarmState(input *cloudwatch.SetAlarmStateInput) (*cloudwatch.SetAlarmStateOutput, error) {
+	c.Plan.record("CloudWatch.SetAlarmState", input)
+	return &cloudwatch.SetAlarmStateOutput{}, nil
+}
+
+func (c *CloudWatch) PutMetricData(input *cloudwatch.PutMetricDataInput) (*cloudwatch.PutMetricDataOutput, error) {
+	c.Plan.record("CloudWatch.PutMetricData", input)
+	return &cloudwatch.PutMetricDataOutput{}, nil
+}
+
+func (c *CloudWatch) PutDashboard(input *cloudwatch.PutDashboardInput) (*cloudwatch.PutDashboardOutput, error) {
+	c.Plan.record("CloudWatch.PutDashboard", input)
+	return &cloudwatch.PutDashboardOutput{}, nil
+}
+
+func (c *CloudWatch) DeleteDashboards(input *cloudwatch.DeleteDashboardsInput) (*cloudwatch.DeleteDashboardsOutput, error) {
+	c.Plan.record("CloudWatch.DeleteDashboards", input)
+	return &cloudwatch.DeleteDashboardsOutput{}, nil
+}
@@ -0,0 +1,230 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package emulator
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/go-logr/logr"
+
+	"github.com/skpr/r53-check/internal/awsfake"
+)
+
+// CloudWatchNamespace is the XML namespace of CloudWatch responses.
+const CloudWatchNamespace = "http://monitoring.amazonaws.com/doc/2010-08-01/"
+
+// cloudwatchOperations are the actions which the emulator supports.
+var cloudwatchOperations = map[string]bool{
+	"PutMetricAlarm":       true,
+	"DescribeAlarms":       true,
+	"DeleteAlarms":         true,
+	"EnableAlarmActions":   true,
+	"DisableAlarmActions":  true,
+	"SetAlarmState":        true,
+	"DescribeAlarmHistory": true,
+	"PutMetricData":        true,
+	"GetMetricStatistics":  true,
+	"PutDashboard":         true,
+	"GetDashboard":         true,
+	"DeleteDashboards":     true,
+}
+
+// CloudWatchHandler serves the CloudWatch Query protocol.
+type CloudWatchHandler struct {
+	Log  logr.Logger
+	Fake *awsfake.CloudWatch
+}
+
+// NewCloudWatchHandler creates a handler for the fake.
+func NewCloudWatchHandler(log logr.Logger, fake *awsfake.CloudWatch) *CloudWatchHandler {
+	return &CloudWatchHandler{
+		Log:  log,
+		Fake: fake,
+	}
+}
+
+// ServeHTTP decodes the request, calls the fake and encodes the response.
+func (h *CloudWatchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, CloudWatchNamespace, invalidInput("MalformedQueryString", err))
+		return
+	}
+
+	operation := r.Form.Get("Action")
+	if !cloudwatchOperations[operation] {
+		writeError(w, CloudWatchNamespace, awserr.NewRequestFailure(
+			awserr.New("InvalidAction", fmt.Sprintf("action %q is not supported", operation), nil),
+			http.StatusBadRequest, awsfake.NewRequestID()))
+		return
+	}
+
+	log := h.Log.WithValues("operation", operation)
+
+	input := newInput(h.Fake, operation)
+	if err := decodeQuery(r.Form, "", input.Elem()); err != nil {
+		log.Error(err, "failed to decode request")
+		writeError(w, CloudWatchNamespace, invalidInput("InvalidParameterValue", err))
+		return
+	}
+
+	output, err := call(h.Fake, operation, input)
+	if err != nil {
+		log.Info("request failed", "error", err.Error())
+		writeError(w, CloudWatchNamespace, err)
+		return
+	}
+
+	log.Info("request succeeded")
+
+	requestID := awsfake.NewRequestID()
+
+	w.Header().Set("Content-Type", "text/xml")
+	w.Header().Set("X-Amzn-RequestId", requestID)
+
+	e := xml.NewEncoder(w)
+	response := xml.StartElement{
+		Name: xml.Name{Local: operation + "Response"},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: CloudWatchNamespace}},
+	}
+	result := xml.StartElement{Name: xml.Name{Local: operation + "Result"}}
+	metadata := xml.StartElement{Name: xml.Name{Local: "ResponseMetadata"}}
+
+	err = func() error {
+		if err := e.EncodeToken(response); err != nil {
+			return err
+		}
+		if err := e.EncodeToken(result); err != nil {
+			return err
+		}
+		if err := encodeFields(e, reflect.ValueOf(output)); err != nil {
+			return err
+		}
+		if err := e.EncodeToken(result.End()); err != nil {
+			return err
+		}
+		if err := e.EncodeToken(metadata); err != nil {
+			return err
+		}
+		if err := e.EncodeElement(requestID, xml.StartElement{Name: xml.Name{Local: "RequestId"}}); err != nil {
+			return err
+		}
+		if err := e.EncodeToken(metadata.End()); err != nil {
+			return err
+		}
+		if err := e.EncodeToken(response.End()); err != nil {
+			return err
+		}
+		return e.Flush()
+	}()
+	if err != nil {
+		log.Error(err, "failed to encode response")
+	}
+}
+
+// decodeQuery decodes form values into a structure, eg. "AlarmNames.member.1".
+func decodeQuery(values url.Values, prefix string, value reflect.Value) error {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if field.PkgPath != "" || field.Name == "_" {
+			continue
+		}
+
+		name := field.Tag.Get("locationName")
+		if name == "" {
+			name = field.Name
+		}
+
+		if err := decodeQueryValue(values, prefix+name, value.Field(i), field.Tag); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// decodeQueryValue decodes the form values under a key into a field.
+func decodeQueryValue(values url.Values, key string, field reflect.Value, tag reflect.StructTag) error {
+	switch {
+	case field.Kind() == reflect.Slice:
+		member := tag.Get("locationNameList")
+		if member == "" {
+			member = "member"
+		}
+
+		list := reflect.MakeSlice(field.Type(), 0, 0)
+		for n := 1; ; n++ {
+			elemKey := key + "." + member + "." + strconv.Itoa(n)
+			if tag.Get("flattened") == "true" {
+				elemKey = key + "." + strconv.Itoa(n)
+			}
+			if !hasQueryKey(values, elemKey) {
+				break
+			}
+
+			elem := reflect.New(field.Type().Elem()).Elem()
+			if err := decodeQueryValue(values, elemKey, elem, ""); err != nil {
+				return err
+			}
+			list = reflect.Append(list, elem)
+		}
+
+		// An empty list is sent as the key without a value.
+		if list.Len() > 0 || values[key] != nil {
+			field.Set(list)
+		}
+		return nil
+
+	case field.Kind() == reflect.Ptr && field.Type().Elem().Kind() == reflect.Struct && field.Type().Elem() != timeType:
+		if !hasQueryKey(values, key) {
+			return nil
+		}
+		elem := reflect.New(field.Type().Elem())
+		if err := decodeQuery(values, key+".", elem.Elem()); err != nil {
+			return err
+		}
+		field.Set(elem)
+		return nil
+	}
+
+	raw, ok := values[key]
+	if !ok || len(raw) == 0 {
+		return nil
+	}
+	if err := setScalar(field, raw[0], tag); err != nil {
+		return fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return nil
+}
+
+// hasQueryKey checks if there is a value for the key, or any key nested under it.
+func hasQueryKey(values url.Values, key string) bool {
+	if _, ok := values[key]; ok {
+		return true
+	}
+	for k := range values {
+		if strings.HasPrefix(k, key+".") {
+			return true
+		}
+	}
+	return false
+}
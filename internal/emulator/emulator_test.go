@@ -0,0 +1,228 @@
+package emulator
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	"github.com/skpr/r53-check/internal/awsfake"
+)
+
+func newSession(t *testing.T, server *httptest.Server) *session.Session {
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Endpoint:    aws.String(server.URL),
+		Credentials: credentials.NewStaticCredentials("emulator", "emulator", ""),
+		MaxRetries:  aws.Int(0),
+	})
+	assert.Nil(t, err)
+
+	return sess
+}
+
+func TestRoute53(t *testing.T) {
+	fake := awsfake.NewRoute53()
+	fake.AddHostedZone("Z123")
+
+	server := httptest.NewServer(NewRoute53Handler(zap.New(), fake))
+	defer server.Close()
+
+	client := route53.New(newSession(t, server))
+
+	created, err := client.CreateHealthCheck(&route53.CreateHealthCheckInput{
+		CallerReference: aws.String("abc"),
+		HealthCheckConfig: &route53.HealthCheckConfig{
+			Type:                     aws.String(route53.HealthCheckTypeHttps),
+			FullyQualifiedDomainName: aws.String("example.com"),
+			Port:                     aws.Int64(443),
+			ResourcePath:             aws.String("/healthz"),
+			Regions:                  aws.StringSlice([]string{"us-east-1", "us-west-1", "eu-west-1"}),
+		},
+	})
+	assert.Nil(t, err)
+	assert.Len(t, fake.HealthChecks(), 1)
+
+	got, err := client.GetHealthCheck(&route53.GetHealthCheckInput{HealthCheckId: created.HealthCheck.Id})
+	assert.Nil(t, err)
+	assert.Equal(t, "/healthz", *got.HealthCheck.HealthCheckConfig.ResourcePath)
+	assert.Len(t, got.HealthCheck.HealthCheckConfig.Regions, 3)
+
+	fake.SetHealthCheckStatus(*created.HealthCheck.Id, "Failure: Connection timed out.")
+	status, err := client.GetHealthCheckStatus(&route53.GetHealthCheckStatusInput{HealthCheckId: created.HealthCheck.Id})
+	assert.Nil(t, err)
+	if assert.Len(t, status.HealthCheckObservations, 1) {
+		assert.Equal(t, "Failure: Connection timed out.", *status.HealthCheckObservations[0].StatusReport.Status)
+	}
+
+	_, err = client.UpdateHealthCheck(&route53.UpdateHealthCheckInput{
+		HealthCheckId:      created.HealthCheck.Id,
+		HealthCheckVersion: aws.Int64(5),
+	})
+	if assert.NotNil(t, err) {
+		assert.Equal(t, route53.ErrCodeHealthCheckVersionMismatch, err.(awserr.Error).Code())
+	}
+
+	_, err = client.ChangeTagsForResource(&route53.ChangeTagsForResourceInput{
+		ResourceId:   created.HealthCheck.Id,
+		ResourceType: aws.String(route53.TagResourceTypeHealthcheck),
+		AddTags:      []*route53.Tag{{Key: aws.String("Name"), Value: aws.String("example")}},
+	})
+	assert.Nil(t, err)
+
+	tags, err := client.ListTagsForResource(&route53.ListTagsForResourceInput{
+		ResourceId:   created.HealthCheck.Id,
+		ResourceType: aws.String(route53.TagResourceTypeHealthcheck),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "example", *tags.ResourceTagSet.Tags[0].Value)
+
+	change, err := client.ChangeResourceRecordSets(&route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String("/hostedzone/Z123"),
+		ChangeBatch: &route53.ChangeBatch{
+			Changes: []*route53.Change{
+				{
+					Action: aws.String(route53.ChangeActionUpsert),
+					ResourceRecordSet: &route53.ResourceRecordSet{
+						Name:            aws.String("www.example.com"),
+						Type:            aws.String("A"),
+						TTL:             aws.Int64(60),
+						ResourceRecords: []*route53.ResourceRecord{{Value: aws.String("192.0.2.1")}},
+					},
+				},
+			},
+		},
+	})
+	assert.Nil(t, err)
+
+	_, err = client.GetChange(&route53.GetChangeInput{Id: change.ChangeInfo.Id})
+	assert.Nil(t, err)
+
+	records, err := client.ListResourceRecordSets(&route53.ListResourceRecordSetsInput{
+		HostedZoneId:    aws.String("Z123"),
+		StartRecordName: aws.String("www.example.com"),
+		StartRecordType: aws.String("A"),
+		MaxItems:        aws.String("1"),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "192.0.2.1", *records.ResourceRecordSets[0].ResourceRecords[0].Value)
+
+	var total int
+	err = client.ListHealthChecksPages(&route53.ListHealthChecksInput{}, func(output *route53.ListHealthChecksOutput, lastPage bool) bool {
+		total += len(output.HealthChecks)
+		return true
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, total)
+
+	limit, err := client.GetAccountLimit(&route53.GetAccountLimitInput{Type: aws.String(route53.AccountLimitTypeMaxHealthChecksByOwner)})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(awsfake.DefaultHealthCheckLimit), *limit.Limit.Value)
+
+	count, err := client.GetHealthCheckCount(&route53.GetHealthCheckCountInput{})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), *count.HealthCheckCount)
+
+	_, err = client.DeleteHealthCheck(&route53.DeleteHealthCheckInput{HealthCheckId: created.HealthCheck.Id})
+	assert.Nil(t, err)
+	assert.Empty(t, fake.HealthChecks())
+}
+
+func TestCloudWatch(t *testing.T) {
+	fake := awsfake.NewCloudWatch()
+
+	server := httptest.NewServer(NewCloudWatchHandler(zap.New(), fake))
+	defer server.Close()
+
+	client := cloudwatch.New(newSession(t, server))
+
+	_, err := client.PutMetricAlarm(&cloudwatch.PutMetricAlarmInput{
+		AlarmName:          aws.String("example"),
+		AlarmActions:       aws.StringSlice([]string{"arn:aws:sns:us-east-1:123456789012:example"}),
+		MetricName:         aws.String("HealthCheckStatus"),
+		Namespace:          aws.String("AWS/Route53"),
+		Statistic:          aws.String(cloudwatch.StatisticMinimum),
+		Period:             aws.Int64(60),
+		EvaluationPeriods:  aws.Int64(1),
+		Threshold:          aws.Float64(1),
+		ComparisonOperator: aws.String(cloudwatch.ComparisonOperatorLessThanThreshold),
+		Dimensions: []*cloudwatch.Dimension{
+			{Name: aws.String("HealthCheckId"), Value: aws.String("abc")},
+		},
+	})
+	assert.Nil(t, err)
+
+	_, err = client.DisableAlarmActions(&cloudwatch.DisableAlarmActionsInput{AlarmNames: aws.StringSlice([]string{"example"})})
+	assert.Nil(t, err)
+
+	_, err = client.SetAlarmState(&cloudwatch.SetAlarmStateInput{
+		AlarmName:   aws.String("example"),
+		StateValue:  aws.String(cloudwatch.StateValueAlarm),
+		StateReason: aws.String("Testing"),
+	})
+	assert.Nil(t, err)
+
+	output, err := client.DescribeAlarms(&cloudwatch.DescribeAlarmsInput{AlarmNames: aws.StringSlice([]string{"example"})})
+	assert.Nil(t, err)
+	if assert.Len(t, output.MetricAlarms, 1) {
+		alarm := output.MetricAlarms[0]
+		assert.Equal(t, cloudwatch.StateValueAlarm, *alarm.StateValue)
+		assert.False(t, *alarm.ActionsEnabled)
+		assert.Equal(t, "abc", *alarm.Dimensions[0].Value)
+		assert.Equal(t, float64(1), *alarm.Threshold)
+		assert.NotNil(t, alarm.StateUpdatedTimestamp)
+	}
+
+	history, err := client.DescribeAlarmHistory(&cloudwatch.DescribeAlarmHistoryInput{AlarmName: aws.String("example")})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, history.AlarmHistoryItems)
+
+	now := time.Now().UTC().Truncate(time.Minute)
+	_, err = client.PutMetricData(&cloudwatch.PutMetricDataInput{
+		Namespace: aws.String("R53Check"),
+		MetricData: []*cloudwatch.MetricDatum{
+			{MetricName: aws.String("HealthCheckStatus"), Timestamp: aws.Time(now), Value: aws.Float64(1)},
+		},
+	})
+	assert.Nil(t, err)
+
+	statistics, err := client.GetMetricStatistics(&cloudwatch.GetMetricStatisticsInput{
+		Namespace:  aws.String("R53Check"),
+		MetricName: aws.String("HealthCheckStatus"),
+		StartTime:  aws.Time(now.Add(-time.Hour)),
+		EndTime:    aws.Time(now.Add(time.Hour)),
+		Period:     aws.Int64(3600),
+		Statistics: aws.StringSlice([]string{cloudwatch.StatisticSum}),
+	})
+	assert.Nil(t, err)
+	if assert.Len(t, statistics.Datapoints, 1) {
+		assert.Equal(t, float64(1), *statistics.Datapoints[0].Sum)
+		assert.Equal(t, now, *statistics.Datapoints[0].Timestamp)
+	}
+
+	_, err = client.PutDashboard(&cloudwatch.PutDashboardInput{
+		DashboardName: aws.String("example"),
+		DashboardBody: aws.String(`{"widgets":[]}`),
+	})
+	assert.Nil(t, err)
+
+	dashboard, err := client.GetDashboard(&cloudwatch.GetDashboardInput{DashboardName: aws.String("example")})
+	assert.Nil(t, err)
+	assert.Equal(t, `{"widgets":[]}`, aws.StringValue(dashboard.DashboardBody))
+
+	_, err = client.DeleteDashboards(&cloudwatch.DeleteDashboardsInput{DashboardNames: aws.StringSlice([]string{"example"})})
+	assert.Nil(t, err)
+
+	_, err = client.DeleteAlarms(&cloudwatch.DeleteAlarmsInput{AlarmNames: aws.StringSlice([]string{"missing"})})
+	if assert.NotNil(t, err) {
+		assert.Equal(t, cloudwatch.ErrCodeResourceNotFound, err.(awserr.Error).Code())
+	}
+}
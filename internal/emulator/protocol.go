@@ -0,0 +1,274 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package emulator serves the in-memory fakes over HTTP using the Route53
+// REST-XML and CloudWatch Query protocols, so the manager can run against them
+// with custom endpoints.
+package emulator
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/private/protocol"
+
+	"github.com/skpr/r53-check/internal/awsfake"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// call invokes an operation on a fake by name, eg. "CreateHealthCheck".
+func call(fake interface{}, operation string, input reflect.Value) (interface{}, error) {
+	results := reflect.ValueOf(fake).MethodByName(operation).Call([]reflect.Value{input})
+	if err, ok := results[1].Interface().(error); ok && err != nil {
+		return nil, err
+	}
+	return results[0].Interface(), nil
+}
+
+// newInput creates an empty input for an operation.
+func newInput(fake interface{}, operation string) reflect.Value {
+	return reflect.New(reflect.ValueOf(fake).MethodByName(operation).Type().In(0).Elem())
+}
+
+// encodeFields writes the body fields of a response structure as XML elements.
+func encodeFields(e *xml.Encoder, value reflect.Value) error {
+	value = reflect.Indirect(value)
+
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if field.PkgPath != "" || field.Name == "_" {
+			continue
+		}
+		// Headers and status codes are not part of the body.
+		if field.Tag.Get("location") != "" {
+			continue
+		}
+
+		name := field.Tag.Get("locationName")
+		if name == "" {
+			name = field.Name
+		}
+
+		if err := encodeValue(e, name, value.Field(i), field.Tag); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// encodeValue writes a value as an XML element.
+func encodeValue(e *xml.Encoder, name string, value reflect.Value, tag reflect.StructTag) error {
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+
+	switch {
+	case value.Type() == timeType:
+		format := tag.Get("timestampFormat")
+		if format == "" {
+			format = protocol.ISO8601TimeFormatName
+		}
+		return e.EncodeElement(protocol.FormatTime(format, value.Interface().(time.Time)), start)
+
+	case value.Kind() == reflect.Struct:
+		if err := e.EncodeToken(start); err != nil {
+			return err
+		}
+		if err := encodeFields(e, value); err != nil {
+			return err
+		}
+		return e.EncodeToken(start.End())
+
+	case value.Kind() == reflect.Slice:
+		if value.IsNil() {
+			return nil
+		}
+
+		if tag.Get("flattened") == "true" {
+			for i := 0; i < value.Len(); i++ {
+				if err := encodeValue(e, name, value.Index(i), ""); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		member := tag.Get("locationNameList")
+		if member == "" {
+			member = "member"
+		}
+
+		if err := e.EncodeToken(start); err != nil {
+			return err
+		}
+		for i := 0; i < value.Len(); i++ {
+			if err := encodeValue(e, member, value.Index(i), ""); err != nil {
+				return err
+			}
+		}
+		return e.EncodeToken(start.End())
+
+	case value.Kind() == reflect.Map:
+		if value.IsNil() {
+			return nil
+		}
+
+		if err := e.EncodeToken(start); err != nil {
+			return err
+		}
+		keys := value.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		for _, key := range keys {
+			entry := xml.StartElement{Name: xml.Name{Local: "entry"}}
+			if err := e.EncodeToken(entry); err != nil {
+				return err
+			}
+			if err := encodeValue(e, "key", key, ""); err != nil {
+				return err
+			}
+			if err := encodeValue(e, "value", value.MapIndex(key), ""); err != nil {
+				return err
+			}
+			if err := e.EncodeToken(entry.End()); err != nil {
+				return err
+			}
+		}
+		return e.EncodeToken(start.End())
+
+	case value.Kind() == reflect.String:
+		return e.EncodeElement(value.String(), start)
+
+	case value.Kind() == reflect.Bool:
+		return e.EncodeElement(strconv.FormatBool(value.Bool()), start)
+
+	case value.Kind() == reflect.Int64:
+		return e.EncodeElement(strconv.FormatInt(value.Int(), 10), start)
+
+	case value.Kind() == reflect.Float64:
+		return e.EncodeElement(strconv.FormatFloat(value.Float(), 'f', -1, 64), start)
+	}
+
+	return fmt.Errorf("unsupported type %s for %s", value.Type(), name)
+}
+
+// setScalar parses a string into a pointer field, eg. a *string or *int64.
+func setScalar(field reflect.Value, value string, tag reflect.StructTag) error {
+	elem := reflect.New(field.Type().Elem())
+
+	switch {
+	case elem.Elem().Type() == timeType:
+		format := tag.Get("timestampFormat")
+		if format == "" {
+			format = protocol.ISO8601TimeFormatName
+		}
+		t, err := protocol.ParseTime(format, value)
+		if err != nil {
+			return err
+		}
+		elem.Elem().Set(reflect.ValueOf(t))
+
+	case elem.Elem().Kind() == reflect.String:
+		elem.Elem().SetString(value)
+
+	case elem.Elem().Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		elem.Elem().SetBool(b)
+
+	case elem.Elem().Kind() == reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		elem.Elem().SetInt(n)
+
+	case elem.Elem().Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		elem.Elem().SetFloat(f)
+
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+
+	field.Set(elem)
+	return nil
+}
+
+// errorResponse is the error body shared by the REST-XML and Query protocols.
+type errorResponse struct {
+	XMLName   xml.Name `xml:"ErrorResponse"`
+	Namespace string   `xml:"xmlns,attr"`
+	Type      string   `xml:"Error>Type"`
+	Code      string   `xml:"Error>Code"`
+	Message   string   `xml:"Error>Message"`
+	RequestID string   `xml:"RequestId"`
+}
+
+// writeError writes an error in the form the SDK unmarshals.
+func writeError(w http.ResponseWriter, namespace string, err error) {
+	resp := errorResponse{
+		Namespace: namespace,
+		Type:      "Sender",
+		Code:      "InternalFailure",
+		Message:   err.Error(),
+		RequestID: awsfake.NewRequestID(),
+	}
+	status := http.StatusInternalServerError
+
+	if aerr, ok := err.(awserr.Error); ok {
+		resp.Code = aerr.Code()
+		resp.Message = aerr.Message()
+	}
+	if rerr, ok := err.(awserr.RequestFailure); ok {
+		status = rerr.StatusCode()
+		resp.RequestID = rerr.RequestID()
+	}
+	if status >= http.StatusInternalServerError {
+		resp.Type = "Receiver"
+	}
+
+	w.Header().Set("Content-Type", "text/xml")
+	w.Header().Set("X-Amzn-RequestId", resp.RequestID)
+	w.WriteHeader(status)
+
+	e := xml.NewEncoder(w)
+	if err := e.Encode(resp); err != nil {
+		return
+	}
+	e.Flush()
+}
+
+// invalidInput creates an error for requests which could not be decoded.
+func invalidInput(code string, err error) error {
+	return awserr.NewRequestFailure(awserr.New(code, err.Error(), nil), http.StatusBadRequest, awsfake.NewRequestID())
+}
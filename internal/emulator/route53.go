@@ -0,0 +1,210 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package emulator
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/private/protocol/xml/xmlutil"
+	"github.com/go-logr/logr"
+
+	"github.com/skpr/r53-check/internal/awsfake"
+)
+
+// Route53Namespace is the XML namespace of Route53 requests and responses.
+const Route53Namespace = "https://route53.amazonaws.com/doc/2013-04-01/"
+
+// route53Route maps a request to an operation.
+type route53Route struct {
+	Method    string
+	Path      string
+	Operation string
+}
+
+// route53Routes are the operations which the emulator supports.
+var route53Routes = []route53Route{
+	{http.MethodPost, "/2013-04-01/healthcheck", "CreateHealthCheck"},
+	{http.MethodGet, "/2013-04-01/healthcheck", "ListHealthChecks"},
+	{http.MethodGet, "/2013-04-01/healthcheckcount", "GetHealthCheckCount"},
+	{http.MethodGet, "/2013-04-01/accountlimit/{Type}", "GetAccountLimit"},
+	{http.MethodGet, "/2013-04-01/healthcheck/{HealthCheckId}", "GetHealthCheck"},
+	{http.MethodPost, "/2013-04-01/healthcheck/{HealthCheckId}", "UpdateHealthCheck"},
+	{http.MethodDelete, "/2013-04-01/healthcheck/{HealthCheckId}", "DeleteHealthCheck"},
+	{http.MethodGet, "/2013-04-01/healthcheck/{HealthCheckId}/status", "GetHealthCheckStatus"},
+	{http.MethodPost, "/2013-04-01/tags/{ResourceType}", "ListTagsForResources"},
+	{http.MethodGet, "/2013-04-01/tags/{ResourceType}/{ResourceId}", "ListTagsForResource"},
+	{http.MethodPost, "/2013-04-01/tags/{ResourceType}/{ResourceId}", "ChangeTagsForResource"},
+	{http.MethodPost, "/2013-04-01/hostedzone/{Id}/rrset", "ChangeResourceRecordSets"},
+	{http.MethodGet, "/2013-04-01/hostedzone/{Id}/rrset", "ListResourceRecordSets"},
+	{http.MethodGet, "/2013-04-01/change/{Id}", "GetChange"},
+}
+
+// Route53Handler serves the Route53 REST-XML protocol.
+type Route53Handler struct {
+	Log  logr.Logger
+	Fake *awsfake.Route53
+}
+
+// NewRoute53Handler creates a handler for the fake.
+func NewRoute53Handler(log logr.Logger, fake *awsfake.Route53) *Route53Handler {
+	return &Route53Handler{
+		Log:  log,
+		Fake: fake,
+	}
+}
+
+// ServeHTTP decodes the request, calls the fake and encodes the response.
+func (h *Route53Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	operation, params := matchRoute53Route(r.Method, r.URL.EscapedPath())
+	if operation == "" {
+		writeError(w, Route53Namespace, awserr.NewRequestFailure(
+			awserr.New("UnknownOperationException", fmt.Sprintf("%s %s is not supported", r.Method, r.URL.Path), nil),
+			http.StatusNotFound, awsfake.NewRequestID()))
+		return
+	}
+
+	log := h.Log.WithValues("operation", operation)
+
+	input, err := decodeRoute53Input(h.Fake, operation, r, params)
+	if err != nil {
+		log.Error(err, "failed to decode request")
+		writeError(w, Route53Namespace, invalidInput("InvalidInput", err))
+		return
+	}
+
+	output, err := call(h.Fake, operation, input)
+	if err != nil {
+		log.Info("request failed", "error", err.Error())
+		writeError(w, Route53Namespace, err)
+		return
+	}
+
+	log.Info("request succeeded")
+
+	w.Header().Set("Content-Type", "text/xml")
+	w.Header().Set("X-Amzn-RequestId", awsfake.NewRequestID())
+
+	e := xml.NewEncoder(w)
+	start := xml.StartElement{
+		Name: xml.Name{Local: operation + "Response"},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: Route53Namespace}},
+	}
+	if err := e.EncodeToken(start); err != nil {
+		log.Error(err, "failed to encode response")
+		return
+	}
+	if err := encodeFields(e, reflect.ValueOf(output)); err != nil {
+		log.Error(err, "failed to encode response")
+		return
+	}
+	if err := e.EncodeToken(start.End()); err != nil {
+		log.Error(err, "failed to encode response")
+		return
+	}
+	e.Flush()
+}
+
+// matchRoute53Route finds the operation for a request, along with the values
+// of the parameters in the path.
+func matchRoute53Route(method, path string) (string, map[string]string) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	for _, route := range route53Routes {
+		if route.Method != method {
+			continue
+		}
+
+		pattern := strings.Split(strings.Trim(route.Path, "/"), "/")
+		if len(pattern) != len(segments) {
+			continue
+		}
+
+		params := make(map[string]string)
+		matched := true
+
+		for i, segment := range pattern {
+			if strings.HasPrefix(segment, "{") {
+				value, err := url.PathUnescape(segments[i])
+				if err != nil {
+					matched = false
+					break
+				}
+				params[strings.Trim(segment, "{}")] = value
+				continue
+			}
+			if segment != segments[i] {
+				matched = false
+				break
+			}
+		}
+
+		if matched {
+			return route.Operation, params
+		}
+	}
+
+	return "", nil
+}
+
+// decodeRoute53Input builds the input for an operation from the body, path and query string.
+func decodeRoute53Input(fake interface{}, operation string, r *http.Request, params map[string]string) (reflect.Value, error) {
+	input := newInput(fake, operation)
+
+	if r.Method == http.MethodPost {
+		err := xmlutil.UnmarshalXML(input.Interface(), xml.NewDecoder(r.Body), "")
+		if err != nil && err != io.EOF {
+			return input, err
+		}
+	}
+
+	query := r.URL.Query()
+	value := input.Elem()
+
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+
+		var (
+			raw string
+			ok  bool
+		)
+
+		switch field.Tag.Get("location") {
+		case "uri":
+			raw, ok = params[field.Tag.Get("locationName")]
+		case "querystring":
+			if values, found := query[field.Tag.Get("locationName")]; found && len(values) > 0 {
+				raw, ok = values[0], true
+			}
+		}
+
+		if !ok {
+			continue
+		}
+
+		if err := setScalar(value.Field(i), raw, field.Tag); err != nil {
+			return input, fmt.Errorf("invalid %s: %w", field.Name, err)
+		}
+	}
+
+	return input, nil
+}
@@ -0,0 +1,523 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package inventory caches the alarms and health checks read by reconciles,
+// refreshing them with bulk AWS calls, so the number of calls does not grow
+// with the number of HealthChecks.
+package inventory
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awsutil"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/aws/aws-sdk-go/service/route53/route53iface"
+	"github.com/go-logr/logr"
+)
+
+const (
+	// alarmBatchSize is the most alarm names DescribeAlarms accepts.
+	alarmBatchSize = 100
+	// tagBatchSize is the most resource ids ListTagsForResources accepts.
+	tagBatchSize = 10
+)
+
+// Inventory caches alarms, health checks and health check tags for the TTL.
+// AWS is called without holding the lock, and concurrent readers share a refresh.
+//
+// Alarms and tags are only refreshed once they have been read, so that the
+// inventory is limited to the resources the controller manages. Alarms,
+// health checks and tags changed through the clients of the inventory are
+// read from AWS until the next refresh.
+type Inventory struct {
+	Log              logr.Logger
+	Route53Client    route53iface.Route53API
+	CloudwatchClient cloudwatchiface.CloudWatchAPI
+	TTL              time.Duration
+	// Now is the clock which the TTL is measured with.
+	Now func() time.Time
+
+	mu sync.Mutex
+	// alarms are the alarms which have been read. A nil alarm does not exist.
+	alarms        map[string]*cloudwatch.MetricAlarm
+	alarmsExpire  time.Time
+	alarmsRefresh *refresh
+	// alarmsVersion counts the changes to alarms, so an alarm read while it
+	// was changed is not added.
+	alarmsVersion uint64
+	healthChecks  map[string]*route53.HealthCheck
+	tags          map[string][]*route53.Tag
+	tagsRead      map[string]bool
+	// tagsVersion counts the changes to tags, so tags read while they were
+	// changed are not added.
+	tagsVersion    uint64
+	route53Expire  time.Time
+	route53Refresh *refresh
+
+	// The resources changed while a refresh is in flight, which are dropped
+	// from what it fetched.
+	changedAlarms       map[string]bool
+	changedHealthChecks map[string]bool
+	changedTags         map[string]bool
+}
+
+// New creates an empty inventory.
+func New(log logr.Logger, route53Client route53iface.Route53API, cloudwatchClient cloudwatchiface.CloudWatchAPI, ttl time.Duration) *Inventory {
+	return &Inventory{
+		Log:              log,
+		Route53Client:    route53Client,
+		CloudwatchClient: cloudwatchClient,
+		TTL:              ttl,
+		Now:              time.Now,
+		alarms:           make(map[string]*cloudwatch.MetricAlarm),
+		healthChecks:     make(map[string]*route53.HealthCheck),
+		tags:             make(map[string][]*route53.Tag),
+		tagsRead:         make(map[string]bool),
+	}
+}
+
+// Route53 gets a Route53 client which reads health checks and their tags from the inventory.
+func (i *Inventory) Route53() route53iface.Route53API {
+	return &Route53{Route53API: i.Route53Client, inventory: i}
+}
+
+// CloudWatch gets a CloudWatch client which reads alarms from the inventory.
+func (i *Inventory) CloudWatch() cloudwatchiface.CloudWatchAPI {
+	return &CloudWatch{CloudWatchAPI: i.CloudwatchClient, inventory: i}
+}
+
+// refresh is a refresh in flight, which concurrent readers wait for.
+type refresh struct {
+	done chan struct{}
+	err  error
+}
+
+// refresh fetches from AWS when the expiry has passed, or waits for the
+// refresh already in flight. The lock is not held while AWS is called, only
+// while the fetched resources are swapped in.
+func (i *Inventory) refresh(flight **refresh, expire *time.Time, fetch func() (func(), error)) error {
+	i.mu.Lock()
+	if i.Now().Before(*expire) {
+		i.mu.Unlock()
+		return nil
+	}
+	if inFlight := *flight; inFlight != nil {
+		i.mu.Unlock()
+		<-inFlight.done
+		return inFlight.err
+	}
+	r := &refresh{done: make(chan struct{})}
+	*flight = r
+	i.mu.Unlock()
+
+	swap, err := fetch()
+
+	i.mu.Lock()
+	if err == nil {
+		swap()
+		*expire = i.Now().Add(i.TTL)
+	}
+	*flight = nil
+	i.mu.Unlock()
+
+	r.err = err
+	close(r.done)
+	return err
+}
+
+// getAlarm gets an alarm, or nil if it does not exist.
+func (i *Inventory) getAlarm(name string) (*cloudwatch.MetricAlarm, error) {
+	err := i.refresh(&i.alarmsRefresh, &i.alarmsExpire, i.fetchAlarms)
+	if err != nil {
+		return nil, err
+	}
+
+	i.mu.Lock()
+	alarm, ok := i.alarms[name]
+	version := i.alarmsVersion
+	i.mu.Unlock()
+
+	if !ok {
+		// The alarm is added to the inventory, to be refreshed with the others.
+		output, err := i.CloudwatchClient.DescribeAlarms(&cloudwatch.DescribeAlarmsInput{
+			AlarmNames: []*string{aws.String(name)},
+			MaxRecords: aws.Int64(1),
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range output.MetricAlarms {
+			alarm = a
+		}
+
+		i.mu.Lock()
+		// An alarm changed while it was described is read again next time.
+		if i.alarmsVersion == version {
+			i.alarms[name] = alarm
+		}
+		i.mu.Unlock()
+	}
+
+	if alarm == nil {
+		return nil, nil
+	}
+	return awsutil.CopyOf(alarm).(*cloudwatch.MetricAlarm), nil
+}
+
+// fetchAlarms describes the alarms in the inventory, in batches.
+func (i *Inventory) fetchAlarms() (func(), error) {
+	i.mu.Lock()
+	var names []string
+	for name := range i.alarms {
+		names = append(names, name)
+	}
+	i.changedAlarms = make(map[string]bool)
+	i.mu.Unlock()
+	sort.Strings(names)
+
+	alarms := make(map[string]*cloudwatch.MetricAlarm)
+	for start := 0; start < len(names); start += alarmBatchSize {
+		end := start + alarmBatchSize
+		if end > len(names) {
+			end = len(names)
+		}
+
+		var batch []*string
+		for _, name := range names[start:end] {
+			batch = append(batch, aws.String(name))
+			alarms[name] = nil
+		}
+
+		err := i.CloudwatchClient.DescribeAlarmsPages(&cloudwatch.DescribeAlarmsInput{
+			AlarmNames: batch,
+			MaxRecords: aws.Int64(alarmBatchSize),
+		}, func(output *cloudwatch.DescribeAlarmsOutput, lastPage bool) bool {
+			for _, alarm := range output.MetricAlarms {
+				alarms[aws.StringValue(alarm.AlarmName)] = alarm
+			}
+			return true
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to refresh alarms: %w", err)
+		}
+	}
+
+	return func() {
+		// Alarms changed during the refresh may have been described before the change.
+		for name := range i.changedAlarms {
+			delete(alarms, name)
+		}
+		i.changedAlarms = nil
+
+		i.Log.V(1).Info(fmt.Sprintf("Refreshed %d alarms", len(alarms)))
+		i.alarms = alarms
+	}, nil
+}
+
+// invalidateAlarms removes changed alarms, so they are read from AWS.
+func (i *Inventory) invalidateAlarms(names ...*string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.alarmsVersion++
+	for _, name := range names {
+		delete(i.alarms, aws.StringValue(name))
+		if i.changedAlarms != nil {
+			i.changedAlarms[aws.StringValue(name)] = true
+		}
+	}
+}
+
+// getHealthCheck gets a health check, or nil if it is not in the inventory.
+func (i *Inventory) getHealthCheck(id string) (*route53.HealthCheck, error) {
+	err := i.refresh(&i.route53Refresh, &i.route53Expire, i.fetchRoute53)
+	if err != nil {
+		return nil, err
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	healthCheck, ok := i.healthChecks[id]
+	if !ok {
+		return nil, nil
+	}
+	return awsutil.CopyOf(healthCheck).(*route53.HealthCheck), nil
+}
+
+// getTags gets the tags of a health check, or false if they are not in the
+// inventory. The version is passed to setTags when they are read from Route53.
+func (i *Inventory) getTags(id string) ([]*route53.Tag, bool, uint64, error) {
+	err := i.refresh(&i.route53Refresh, &i.route53Expire, i.fetchRoute53)
+	if err != nil {
+		return nil, false, 0, err
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	// The tags are refreshed with the others from now on.
+	i.tagsRead[id] = true
+
+	tags, ok := i.tags[id]
+	if !ok {
+		return nil, false, i.tagsVersion, nil
+	}
+	return copyTags(tags), true, i.tagsVersion, nil
+}
+
+// setTags adds the tags of a health check to the inventory, unless tags were
+// changed since the version they were read at.
+func (i *Inventory) setTags(id string, tags []*route53.Tag, version uint64) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.tagsVersion == version {
+		i.tags[id] = copyTags(tags)
+	}
+}
+
+// copyTags deep copies tags.
+func copyTags(tags []*route53.Tag) []*route53.Tag {
+	copied := []*route53.Tag{}
+	for _, tag := range tags {
+		copied = append(copied, awsutil.CopyOf(tag).(*route53.Tag))
+	}
+	return copied
+}
+
+// fetchRoute53 lists the health checks, and the tags which have been read.
+func (i *Inventory) fetchRoute53() (func(), error) {
+	i.mu.Lock()
+	var read []string
+	for id := range i.tagsRead {
+		read = append(read, id)
+	}
+	i.changedHealthChecks = make(map[string]bool)
+	i.changedTags = make(map[string]bool)
+	i.mu.Unlock()
+
+	healthChecks := make(map[string]*route53.HealthCheck)
+	err := i.Route53Client.ListHealthChecksPages(&route53.ListHealthChecksInput{},
+		func(output *route53.ListHealthChecksOutput, lastPage bool) bool {
+			for _, healthCheck := range output.HealthChecks {
+				healthChecks[aws.StringValue(healthCheck.Id)] = healthCheck
+			}
+			return true
+		})
+	if err != nil {
+		return nil, fmt.Errorf("failed to refresh health checks: %w", err)
+	}
+
+	var ids, deleted []string
+	for _, id := range read {
+		if _, ok := healthChecks[id]; !ok {
+			deleted = append(deleted, id)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	tags := make(map[string][]*route53.Tag)
+	for start := 0; start < len(ids); start += tagBatchSize {
+		end := start + tagBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		output, err := i.Route53Client.ListTagsForResources(&route53.ListTagsForResourcesInput{
+			ResourceIds:  aws.StringSlice(ids[start:end]),
+			ResourceType: aws.String(route53.TagResourceTypeHealthcheck),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to refresh health check tags: %w", err)
+		}
+		for _, tagSet := range output.ResourceTagSets {
+			tags[aws.StringValue(tagSet.ResourceId)] = tagSet.Tags
+		}
+	}
+
+	return func() {
+		for _, id := range deleted {
+			delete(i.tagsRead, id)
+		}
+
+		// Health checks and tags changed during the refresh may have been
+		// listed before the change.
+		for id := range i.changedHealthChecks {
+			delete(healthChecks, id)
+		}
+		for id := range i.changedTags {
+			delete(tags, id)
+		}
+		i.changedHealthChecks = nil
+		i.changedTags = nil
+
+		i.Log.V(1).Info(fmt.Sprintf("Refreshed %d health checks", len(healthChecks)))
+		i.healthChecks = healthChecks
+		i.tags = tags
+	}, nil
+}
+
+// invalidateHealthCheck removes a changed health check, so it is read from AWS.
+func (i *Inventory) invalidateHealthCheck(id string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	delete(i.healthChecks, id)
+	if i.changedHealthChecks != nil {
+		i.changedHealthChecks[id] = true
+	}
+}
+
+// invalidateTags removes changed tags, so they are read from AWS.
+func (i *Inventory) invalidateTags(id string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.tagsVersion++
+	delete(i.tags, id)
+	if i.changedTags != nil {
+		i.changedTags[id] = true
+	}
+}
+
+// CloudWatch reads alarms from the inventory.
+type CloudWatch struct {
+	cloudwatchiface.CloudWatchAPI
+	inventory *Inventory
+}
+
+// DescribeAlarms reads a single alarm from the inventory. Other requests are
+// passed through.
+func (c *CloudWatch) DescribeAlarms(input *cloudwatch.DescribeAlarmsInput) (*cloudwatch.DescribeAlarmsOutput, error) {
+	if len(input.AlarmNames) != 1 || input.AlarmNamePrefix != nil || input.ActionPrefix != nil ||
+		input.StateValue != nil || input.NextToken != nil {
+		return c.CloudWatchAPI.DescribeAlarms(input)
+	}
+
+	alarm, err := c.inventory.getAlarm(aws.StringValue(input.AlarmNames[0]))
+	if err != nil {
+		return nil, err
+	}
+
+	output := &cloudwatch.DescribeAlarmsOutput{}
+	if alarm != nil {
+		output.MetricAlarms = []*cloudwatch.MetricAlarm{alarm}
+	}
+	return output, nil
+}
+
+func (c *CloudWatch) PutMetricAlarm(input *cloudwatch.PutMetricAlarmInput) (*cloudwatch.PutMetricAlarmOutput, error) {
+	defer c.inventory.invalidateAlarms(input.AlarmName)
+	return c.CloudWatchAPI.PutMetricAlarm(input)
+}
+
+func (c *CloudWatch) DeleteAlarms(input *cloudwatch.DeleteAlarmsInput) (*cloudwatch.DeleteAlarmsOutput, error) {
+	defer c.inventory.invalidateAlarms(input.AlarmNames...)
+	return c.CloudWatchAPI.DeleteAlarms(input)
+}
+
+func (c *CloudWatch) EnableAlarmActions(input *cloudwatch.EnableAlarmActionsInput) (*cloudwatch.EnableAlarmActionsOutput, error) {
+	defer c.inventory.invalidateAlarms(input.AlarmNames...)
+	return c.CloudWatchAPI.EnableAlarmActions(input)
+}
+
+func (c *CloudWatch) DisableAlarmActions(input *cloudwatch.DisableAlarmActionsInput) (*cloudwatch.DisableAlarmActionsOutput, error) {
+	defer c.inventory.invalidateAlarms(input.AlarmNames...)
+	return c.CloudWatchAPI.DisableAlarmActions(input)
+}
+
+func (c *CloudWatch) SetAlarmState(input *cloudwatch.SetAlarmStateInput) (*cloudwatch.SetAlarmStateOutput, error) {
+	defer c.inventory.invalidateAlarms(input.AlarmName)
+	return c.CloudWatchAPI.SetAlarmState(input)
+}
+
+// Route53 reads health checks and their tags from the inventory.
+type Route53 struct {
+	route53iface.Route53API
+	inventory *Inventory
+}
+
+// GetHealthCheck reads the health check from the inventory, or from Route53
+// when it is not in the inventory.
+func (r *Route53) GetHealthCheck(input *route53.GetHealthCheckInput) (*route53.GetHealthCheckOutput, error) {
+	healthCheck, err := r.inventory.getHealthCheck(aws.StringValue(input.HealthCheckId))
+	if err != nil {
+		return nil, err
+	}
+	if healthCheck == nil {
+		return r.Route53API.GetHealthCheck(input)
+	}
+	return &route53.GetHealthCheckOutput{HealthCheck: healthCheck}, nil
+}
+
+// ListTagsForResource reads the tags of a health check from the inventory, or
+// from Route53 when they are not in the inventory.
+func (r *Route53) ListTagsForResource(input *route53.ListTagsForResourceInput) (*route53.ListTagsForResourceOutput, error) {
+	if aws.StringValue(input.ResourceType) != route53.TagResourceTypeHealthcheck {
+		return r.Route53API.ListTagsForResource(input)
+	}
+
+	id := aws.StringValue(input.ResourceId)
+
+	tags, ok, version, err := r.inventory.getTags(id)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		output, err := r.Route53API.ListTagsForResource(input)
+		if err != nil {
+			return nil, err
+		}
+		if output.ResourceTagSet != nil {
+			r.inventory.setTags(id, output.ResourceTagSet.Tags, version)
+		}
+		return output, nil
+	}
+
+	return &route53.ListTagsForResourceOutput{
+		ResourceTagSet: &route53.ResourceTagSet{
+			ResourceId:   input.ResourceId,
+			ResourceType: input.ResourceType,
+			Tags:         tags,
+		},
+	}, nil
+}
+
+func (r *Route53) UpdateHealthCheck(input *route53.UpdateHealthCheckInput) (*route53.UpdateHealthCheckOutput, error) {
+	defer r.inventory.invalidateHealthCheck(aws.StringValue(input.HealthCheckId))
+	return r.Route53API.UpdateHealthCheck(input)
+}
+
+func (r *Route53) DeleteHealthCheck(input *route53.DeleteHealthCheckInput) (*route53.DeleteHealthCheckOutput, error) {
+	defer r.inventory.invalidateHealthCheck(aws.StringValue(input.HealthCheckId))
+	defer r.inventory.invalidateTags(aws.StringValue(input.HealthCheckId))
+	return r.Route53API.DeleteHealthCheck(input)
+}
+
+func (r *Route53) ChangeTagsForResource(input *route53.ChangeTagsForResourceInput) (*route53.ChangeTagsForResourceOutput, error) {
+	if aws.StringValue(input.ResourceType) == route53.TagResourceTypeHealthcheck {
+		defer r.inventory.invalidateTags(aws.StringValue(input.ResourceId))
+	}
+	return r.Route53API.ChangeTagsForResource(input)
+}
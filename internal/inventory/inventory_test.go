@@ -0,0 +1,296 @@
+package inventory
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	"github.com/skpr/r53-check/internal/awsfake"
+)
+
+func TestAlarms(t *testing.T) {
+	clock := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	cloudwatchClient := awsfake.NewCloudWatch()
+	inventory := New(zap.New(), awsfake.NewRoute53(), cloudwatchClient, time.Minute)
+	inventory.Now = func() time.Time { return clock }
+	client := inventory.CloudWatch()
+
+	var names []string
+	for i := 0; i < 150; i++ {
+		name := fmt.Sprintf("alarm-%03d", i)
+		names = append(names, name)
+		_, err := cloudwatchClient.PutMetricAlarm(&cloudwatch.PutMetricAlarmInput{
+			AlarmName:          aws.String(name),
+			EvaluationPeriods:  aws.Int64(1),
+			ComparisonOperator: aws.String(cloudwatch.ComparisonOperatorLessThanThreshold),
+		})
+		assert.Nil(t, err)
+	}
+
+	// describe describes an alarm through the inventory.
+	describe := func(name string) *cloudwatch.MetricAlarm {
+		output, err := client.DescribeAlarms(&cloudwatch.DescribeAlarmsInput{
+			AlarmNames: []*string{aws.String(name)},
+			MaxRecords: aws.Int64(1),
+		})
+		assert.Nil(t, err)
+		for _, alarm := range output.MetricAlarms {
+			return alarm
+		}
+		return nil
+	}
+
+	// Alarms are described once when they are first read.
+	for _, name := range names {
+		assert.Equal(t, name, *describe(name).AlarmName)
+	}
+	assert.Nil(t, describe("missing"))
+	assert.Equal(t, 151, cloudwatchClient.Faults.Calls("DescribeAlarms"))
+
+	for _, name := range names {
+		describe(name)
+	}
+	assert.Nil(t, describe("missing"))
+	assert.Equal(t, 151, cloudwatchClient.Faults.Calls("DescribeAlarms"), "alarms are cached")
+
+	// Alarms are refreshed in batches once the TTL has passed.
+	err := cloudwatchClient.TransitionAlarm("alarm-000", cloudwatch.StateValueAlarm, "Threshold Crossed")
+	assert.Nil(t, err)
+	assert.Equal(t, cloudwatch.StateValueInsufficientData, *describe("alarm-000").StateValue)
+
+	clock = clock.Add(time.Minute)
+	for _, name := range names {
+		describe(name)
+	}
+	assert.Equal(t, 153, cloudwatchClient.Faults.Calls("DescribeAlarms"))
+	assert.Equal(t, cloudwatch.StateValueAlarm, *describe("alarm-000").StateValue)
+
+	// Changed alarms are read from CloudWatch.
+	_, err = client.DisableAlarmActions(&cloudwatch.DisableAlarmActionsInput{
+		AlarmNames: []*string{aws.String("alarm-001")},
+	})
+	assert.Nil(t, err)
+	assert.False(t, *describe("alarm-001").ActionsEnabled)
+	assert.Equal(t, 154, cloudwatchClient.Faults.Calls("DescribeAlarms"))
+
+	// Other requests are passed through.
+	output, err := client.DescribeAlarms(&cloudwatch.DescribeAlarmsInput{
+		AlarmNamePrefix: aws.String("alarm-00"),
+	})
+	assert.Nil(t, err)
+	assert.Len(t, output.MetricAlarms, 10)
+}
+
+func TestHealthChecks(t *testing.T) {
+	clock := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	route53Client := awsfake.NewRoute53()
+	inventory := New(zap.New(), route53Client, awsfake.NewCloudWatch(), time.Minute)
+	inventory.Now = func() time.Time { return clock }
+	client := inventory.Route53()
+
+	var ids []string
+	for i := 0; i < 15; i++ {
+		output, err := route53Client.CreateHealthCheck(&route53.CreateHealthCheckInput{
+			CallerReference: aws.String(fmt.Sprintf("test-%d", i)),
+			HealthCheckConfig: &route53.HealthCheckConfig{
+				FullyQualifiedDomainName: aws.String(fmt.Sprintf("www%d.example.com", i)),
+				Type:                     aws.String(route53.HealthCheckTypeHttps),
+			},
+		})
+		assert.Nil(t, err)
+		ids = append(ids, *output.HealthCheck.Id)
+
+		_, err = route53Client.ChangeTagsForResource(&route53.ChangeTagsForResourceInput{
+			AddTags:      []*route53.Tag{{Key: aws.String("Name"), Value: aws.String(fmt.Sprintf("test-%d", i))}},
+			ResourceId:   output.HealthCheck.Id,
+			ResourceType: aws.String(route53.TagResourceTypeHealthcheck),
+		})
+		assert.Nil(t, err)
+	}
+
+	// getName gets the Name tag through the inventory.
+	getName := func(id string) string {
+		output, err := client.ListTagsForResource(&route53.ListTagsForResourceInput{
+			ResourceId:   aws.String(id),
+			ResourceType: aws.String(route53.TagResourceTypeHealthcheck),
+		})
+		assert.Nil(t, err)
+		return *output.ResourceTagSet.Tags[0].Value
+	}
+
+	// Health checks are listed, rather than read one at a time.
+	for i, id := range ids {
+		output, err := client.GetHealthCheck(&route53.GetHealthCheckInput{HealthCheckId: aws.String(id)})
+		assert.Nil(t, err)
+		assert.Equal(t, fmt.Sprintf("www%d.example.com", i), *output.HealthCheck.HealthCheckConfig.FullyQualifiedDomainName)
+		assert.Equal(t, fmt.Sprintf("test-%d", i), getName(id))
+	}
+	assert.Equal(t, 1, route53Client.Faults.Calls("ListHealthChecks"))
+	assert.Equal(t, 0, route53Client.Faults.Calls("GetHealthCheck"))
+	assert.Equal(t, 15, route53Client.Faults.Calls("ListTagsForResource"))
+
+	// Tags which were read are refreshed in batches once the TTL has passed.
+	clock = clock.Add(time.Minute)
+	for _, id := range ids {
+		getName(id)
+	}
+	assert.Equal(t, 2, route53Client.Faults.Calls("ListHealthChecks"))
+	assert.Equal(t, 2, route53Client.Faults.Calls("ListTagsForResources"))
+	assert.Equal(t, 15, route53Client.Faults.Calls("ListTagsForResource"))
+
+	// Changed health checks are read from Route53.
+	_, err := client.UpdateHealthCheck(&route53.UpdateHealthCheckInput{
+		HealthCheckId: aws.String(ids[0]),
+		ResourcePath:  aws.String("/status"),
+	})
+	assert.Nil(t, err)
+	output, err := client.GetHealthCheck(&route53.GetHealthCheckInput{HealthCheckId: aws.String(ids[0])})
+	assert.Nil(t, err)
+	assert.Equal(t, "/status", *output.HealthCheck.HealthCheckConfig.ResourcePath)
+	assert.Equal(t, 1, route53Client.Faults.Calls("GetHealthCheck"))
+
+	// Health checks deleted outside of the controller are missing after the next refresh.
+	route53Client.DeleteHealthCheckOutOfBand(ids[1])
+	clock = clock.Add(time.Minute)
+	_, err = client.GetHealthCheck(&route53.GetHealthCheckInput{HealthCheckId: aws.String(ids[1])})
+	assert.NotNil(t, err)
+}
+
+// blockingRoute53 blocks listing health checks until it is released.
+type blockingRoute53 struct {
+	*awsfake.Route53
+	listing chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingRoute53) ListHealthChecksPages(input *route53.ListHealthChecksInput, fn func(*route53.ListHealthChecksOutput, bool) bool) error {
+	b.listing <- struct{}{}
+	<-b.release
+	return b.Route53.ListHealthChecksPages(input, fn)
+}
+
+func TestConcurrentRefresh(t *testing.T) {
+	route53Client := &blockingRoute53{
+		Route53: awsfake.NewRoute53(),
+		listing: make(chan struct{}, 1),
+		release: make(chan struct{}),
+	}
+	output, err := route53Client.CreateHealthCheck(&route53.CreateHealthCheckInput{
+		CallerReference: aws.String("test"),
+		HealthCheckConfig: &route53.HealthCheckConfig{
+			FullyQualifiedDomainName: aws.String("www.example.com"),
+			Type:                     aws.String(route53.HealthCheckTypeHttps),
+		},
+	})
+	assert.Nil(t, err)
+	id := *output.HealthCheck.Id
+
+	inventory := New(zap.New(), route53Client, awsfake.NewCloudWatch(), time.Minute)
+	client := inventory.Route53()
+
+	get := func(results chan<- error) {
+		_, err := client.GetHealthCheck(&route53.GetHealthCheckInput{HealthCheckId: aws.String(id)})
+		results <- err
+	}
+
+	results := make(chan error, 2)
+	go get(results)
+	<-route53Client.listing
+
+	// The inventory is not locked while Route53 is called, and the second
+	// reader waits for the refresh in flight.
+	go get(results)
+	inventory.invalidateTags(id)
+	_, err = client.UpdateHealthCheck(&route53.UpdateHealthCheckInput{
+		HealthCheckId: aws.String(id),
+		ResourcePath:  aws.String("/status"),
+	})
+	assert.Nil(t, err)
+
+	close(route53Client.release)
+	assert.Nil(t, <-results)
+	assert.Nil(t, <-results)
+	assert.Equal(t, 1, route53Client.Faults.Calls("ListHealthChecks"))
+
+	// The health check changed during the refresh is read from Route53.
+	updated, err := client.GetHealthCheck(&route53.GetHealthCheckInput{HealthCheckId: aws.String(id)})
+	assert.Nil(t, err)
+	assert.Equal(t, "/status", *updated.HealthCheck.HealthCheckConfig.ResourcePath)
+}
+
+// blockingTags blocks returning the tags it read until it is released.
+type blockingTags struct {
+	*awsfake.Route53
+	listing chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingTags) ListTagsForResource(input *route53.ListTagsForResourceInput) (*route53.ListTagsForResourceOutput, error) {
+	output, err := b.Route53.ListTagsForResource(input)
+	b.listing <- struct{}{}
+	<-b.release
+	return output, err
+}
+
+func TestConcurrentTags(t *testing.T) {
+	route53Client := &blockingTags{
+		Route53: awsfake.NewRoute53(),
+		listing: make(chan struct{}, 1),
+		release: make(chan struct{}),
+	}
+	output, err := route53Client.CreateHealthCheck(&route53.CreateHealthCheckInput{
+		CallerReference: aws.String("test"),
+		HealthCheckConfig: &route53.HealthCheckConfig{
+			FullyQualifiedDomainName: aws.String("www.example.com"),
+			Type:                     aws.String(route53.HealthCheckTypeHttps),
+		},
+	})
+	assert.Nil(t, err)
+	id := *output.HealthCheck.Id
+
+	inventory := New(zap.New(), route53Client, awsfake.NewCloudWatch(), time.Minute)
+	client := inventory.Route53()
+
+	// list lists the tags through the inventory.
+	list := func() ([]*route53.Tag, error) {
+		output, err := client.ListTagsForResource(&route53.ListTagsForResourceInput{
+			ResourceId:   aws.String(id),
+			ResourceType: aws.String(route53.TagResourceTypeHealthcheck),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return output.ResourceTagSet.Tags, nil
+	}
+
+	results := make(chan error, 1)
+	go func() {
+		_, err := list()
+		results <- err
+	}()
+	<-route53Client.listing
+
+	// The tags are changed after they were read, but before they are cached.
+	_, err = client.ChangeTagsForResource(&route53.ChangeTagsForResourceInput{
+		ResourceId:   aws.String(id),
+		ResourceType: aws.String(route53.TagResourceTypeHealthcheck),
+		AddTags:      []*route53.Tag{{Key: aws.String("Name"), Value: aws.String("test")}},
+	})
+	assert.Nil(t, err)
+
+	close(route53Client.release)
+	assert.Nil(t, <-results)
+
+	// The stale tags were not cached, so the change is read from Route53.
+	tags, err := list()
+	assert.Nil(t, err)
+	assert.Equal(t, []*route53.Tag{{Key: aws.String("Name"), Value: aws.String("test")}}, tags)
+}
@@ -0,0 +1,138 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package prober
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// TypeHTTP probes succeed when the response status is 2xx or 3xx.
+	TypeHTTP = "HTTP"
+	// TypeHTTPS probes are HTTP probes which do not validate the certificate.
+	TypeHTTPS = "HTTPS"
+	// TypeHTTPStrMatch probes also require the search string in the response body.
+	TypeHTTPStrMatch = "HTTP_STR_MATCH"
+	// TypeHTTPSStrMatch probes also require the search string in the response body.
+	TypeHTTPSStrMatch = "HTTPS_STR_MATCH"
+	// TypeTCP probes succeed when a connection is established.
+	TypeTCP = "TCP"
+)
+
+// Same limits as Route53 health checkers.
+const (
+	// probeTimeout is how long a probe has to connect and respond.
+	probeTimeout = time.Second * 4
+	// searchLimit is how much of the response body is searched.
+	searchLimit = 5120
+)
+
+// Config describes a probe.
+type Config struct {
+	Type         string
+	Host         string
+	Port         int64
+	ResourcePath string
+	SearchString string
+	// Interval between probes.
+	Interval time.Duration
+	// FailureThreshold is the number of consecutive probes which must fail, or
+	// succeed, to change the health.
+	FailureThreshold int
+	// Disabled checks are reported as healthy without being probed, like Route53.
+	Disabled bool
+}
+
+// Probe checks the endpoint once, returning an error describing why it failed.
+func Probe(ctx context.Context, config Config) error {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	address := net.JoinHostPort(config.Host, strconv.FormatInt(config.Port, 10))
+
+	switch config.Type {
+	case TypeTCP:
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+
+	case TypeHTTP, TypeHTTPS, TypeHTTPStrMatch, TypeHTTPSStrMatch:
+		return probeHTTP(ctx, config, address)
+	}
+
+	return fmt.Errorf("unsupported type: %s", config.Type)
+}
+
+// probeHTTP makes a request without following redirects.
+func probeHTTP(ctx context.Context, config Config, address string) error {
+	scheme := "http"
+	if config.Type == TypeHTTPS || config.Type == TypeHTTPSStrMatch {
+		scheme = "https"
+	}
+
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s://%s%s", scheme, address, config.ResourcePath), nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Host = config.Host
+	req.Header.Set("User-Agent", "r53-check-prober")
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			// Route53 does not validate certificates either.
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true, ServerName: config.Host},
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	if config.Type == TypeHTTPStrMatch || config.Type == TypeHTTPSStrMatch {
+		body, err := ioutil.ReadAll(io.LimitReader(resp.Body, searchLimit))
+		if err != nil {
+			return err
+		}
+		if !bytes.Contains(body, []byte(config.SearchString)) {
+			return fmt.Errorf("search string %q not found in the first %d bytes of the response", config.SearchString, searchLimit)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package prober
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// getConfig gets a config which probes the server.
+func getConfig(t *testing.T, server *httptest.Server, probeType, path string) Config {
+	u, err := url.Parse(server.URL)
+	assert.Nil(t, err)
+
+	host, port, err := net.SplitHostPort(u.Host)
+	assert.Nil(t, err)
+
+	n, err := strconv.ParseInt(port, 10, 64)
+	assert.Nil(t, err)
+
+	return Config{
+		Type:         probeType,
+		Host:         host,
+		Port:         n,
+		ResourcePath: path,
+	}
+}
+
+func TestProbe(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("status: ok"))
+	})
+	mux.HandleFunc("/error", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "oops", http.StatusInternalServerError)
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/error", http.StatusFound)
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tlsServer := httptest.NewTLSServer(mux)
+	defer tlsServer.Close()
+
+	ctx := context.Background()
+
+	assert.Nil(t, Probe(ctx, getConfig(t, server, TypeHTTP, "/healthz")))
+	assert.Nil(t, Probe(ctx, getConfig(t, tlsServer, TypeHTTPS, "/healthz")), "certificates are not validated")
+	assert.Nil(t, Probe(ctx, getConfig(t, server, TypeHTTP, "/redirect")), "redirects are not followed")
+	assert.NotNil(t, Probe(ctx, getConfig(t, server, TypeHTTP, "/error")))
+
+	config := getConfig(t, server, TypeHTTPStrMatch, "/healthz")
+	config.SearchString = "ok"
+	assert.Nil(t, Probe(ctx, config))
+
+	config.SearchString = "missing"
+	assert.NotNil(t, Probe(ctx, config))
+
+	assert.Nil(t, Probe(ctx, getConfig(t, server, TypeTCP, "")))
+
+	config = getConfig(t, server, TypeTCP, "")
+	server.Close()
+	assert.NotNil(t, Probe(ctx, config))
+}
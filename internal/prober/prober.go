@@ -0,0 +1,296 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package prober probes endpoints from inside the cluster, for services which
+// Route53 health checkers cannot reach.
+package prober
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// CloudWatch custom metric which results are published to. The metric is 1
+// when the endpoint is healthy and 0 when it is not, like AWS/Route53.
+const (
+	MetricNamespace    = "R53Check"
+	MetricName         = "HealthCheckStatus"
+	DimensionNamespace = "Namespace"
+	DimensionName      = "Name"
+)
+
+// HealthyMetric is the Prometheus gauge which is 1 when the endpoint is healthy
+// and 0 when it is not.
+const HealthyMetric = "r53_check_probe_healthy"
+
+var (
+	healthyGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: HealthyMetric,
+		Help: "Whether the endpoint probed from inside the cluster is healthy.",
+	}, []string{"namespace", "name"})
+
+	durationHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "r53_check_probe_duration_seconds",
+		Help: "How long probes from inside the cluster take.",
+	}, []string{"namespace", "name"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(healthyGauge, durationHistogram)
+}
+
+// Result is the health of a probed endpoint.
+type Result struct {
+	Healthy bool
+	// LastProbe is when the endpoint was last probed.
+	LastProbe time.Time
+	// Message describes why the last probe failed.
+	Message string
+}
+
+// Prober probes endpoints on their interval and publishes the results.
+type Prober struct {
+	Log logr.Logger
+	// CloudwatchClient publishes results as custom metrics when set,
+	// otherwise they are only exposed to Prometheus.
+	CloudwatchClient cloudwatchiface.CloudWatchAPI
+	// Probe checks an endpoint once. Replaced in tests.
+	Probe func(context.Context, Config) error
+	// Events are sent when the health of an endpoint changes.
+	Events chan event.GenericEvent
+
+	mu      sync.Mutex
+	ctx     context.Context
+	cancel  context.CancelFunc
+	targets map[types.NamespacedName]*target
+}
+
+// target is an endpoint which is being probed.
+type target struct {
+	config    Config
+	cancel    context.CancelFunc
+	result    Result
+	failures  int
+	successes int
+}
+
+// New creates a prober.
+func New(log logr.Logger, cloudwatchClient cloudwatchiface.CloudWatchAPI) *Prober {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Prober{
+		Log:              log,
+		CloudwatchClient: cloudwatchClient,
+		Probe:            Probe,
+		Events:           make(chan event.GenericEvent, 100),
+		ctx:              ctx,
+		cancel:           cancel,
+		targets:          make(map[types.NamespacedName]*target),
+	}
+}
+
+// Start runs until the manager stops, then stops probing.
+func (p *Prober) Start(stop <-chan struct{}) error {
+	<-stop
+	p.cancel()
+	return nil
+}
+
+// PublishesToCloudWatch reports whether CloudWatch alarms can be created for results.
+func (p *Prober) PublishesToCloudWatch() bool {
+	return p.CloudwatchClient != nil
+}
+
+// Ensure probes an endpoint, restarting the probes when the config changes.
+func (p *Prober) Ensure(key types.NamespacedName, config Config) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Endpoints are considered healthy until proven otherwise.
+	result := Result{Healthy: true}
+
+	if existing, ok := p.targets[key]; ok {
+		if existing.config == config {
+			return
+		}
+		existing.cancel()
+		result = existing.result
+	}
+
+	ctx, cancel := context.WithCancel(p.ctx)
+
+	t := &target{
+		config: config,
+		cancel: cancel,
+		result: result,
+	}
+	p.targets[key] = t
+
+	go p.run(ctx, key, t)
+}
+
+// Remove stops probing an endpoint.
+func (p *Prober) Remove(key types.NamespacedName) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if t, ok := p.targets[key]; ok {
+		t.cancel()
+		delete(p.targets, key)
+		healthyGauge.DeleteLabelValues(key.Namespace, key.Name)
+		durationHistogram.DeleteLabelValues(key.Namespace, key.Name)
+	}
+}
+
+// Result gets the health of an endpoint, if it is being probed.
+func (p *Prober) Result(key types.NamespacedName) (Result, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	t, ok := p.targets[key]
+	if !ok {
+		return Result{}, false
+	}
+	return t.result, true
+}
+
+// run probes the endpoint on its interval until cancelled.
+func (p *Prober) run(ctx context.Context, key types.NamespacedName, t *target) {
+	ticker := time.NewTicker(t.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		p.probe(ctx, key, t)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// probe checks the endpoint once and records the result.
+func (p *Prober) probe(ctx context.Context, key types.NamespacedName, t *target) {
+	var err error
+	if !t.config.Disabled {
+		start := time.Now()
+		err = p.Probe(ctx, t.config)
+		durationHistogram.WithLabelValues(key.Namespace, key.Name).Observe(time.Since(start).Seconds())
+	}
+
+	// The probe was cancelled because the config changed or the endpoint was removed.
+	if ctx.Err() != nil {
+		return
+	}
+
+	p.mu.Lock()
+	changed := t.record(err, time.Now())
+	result := t.result
+	p.mu.Unlock()
+
+	if changed {
+		p.Log.Info("Health changed", "namespace", key.Namespace, "name", key.Name, "healthy", result.Healthy, "message", result.Message)
+	}
+
+	p.publish(key, result)
+
+	if changed {
+		select {
+		case p.Events <- event.GenericEvent{Meta: &metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name}}:
+		case <-ctx.Done():
+		}
+	}
+}
+
+// record updates the health, which changes after FailureThreshold consecutive
+// probes disagree with it. It reports whether the health changed.
+func (t *target) record(err error, now time.Time) bool {
+	t.result.LastProbe = now
+
+	threshold := t.config.FailureThreshold
+	if threshold < 1 {
+		threshold = 1
+	}
+
+	if err == nil {
+		t.successes++
+		t.failures = 0
+		t.result.Message = ""
+		if !t.result.Healthy && t.successes >= threshold {
+			t.result.Healthy = true
+			return true
+		}
+		return false
+	}
+
+	t.failures++
+	t.successes = 0
+	t.result.Message = err.Error()
+	if t.result.Healthy && t.failures >= threshold {
+		t.result.Healthy = false
+		return true
+	}
+	return false
+}
+
+// publish exposes the health to Prometheus and CloudWatch.
+func (p *Prober) publish(key types.NamespacedName, result Result) {
+	value := 0.0
+	if result.Healthy {
+		value = 1.0
+	}
+
+	healthyGauge.WithLabelValues(key.Namespace, key.Name).Set(value)
+
+	if p.CloudwatchClient == nil {
+		return
+	}
+
+	_, err := p.CloudwatchClient.PutMetricData(&cloudwatch.PutMetricDataInput{
+		Namespace: aws.String(MetricNamespace),
+		MetricData: []*cloudwatch.MetricDatum{
+			{
+				MetricName: aws.String(MetricName),
+				Dimensions: Dimensions(key),
+				Timestamp:  aws.Time(result.LastProbe),
+				Value:      aws.Float64(value),
+				Unit:       aws.String(cloudwatch.StandardUnitNone),
+			},
+		},
+	})
+	if err != nil {
+		p.Log.Error(err, "failed to publish metric", "namespace", key.Namespace, "name", key.Name)
+	}
+}
+
+// Dimensions of the custom metric for an endpoint.
+func Dimensions(key types.NamespacedName) []*cloudwatch.Dimension {
+	return []*cloudwatch.Dimension{
+		{Name: aws.String(DimensionNamespace), Value: aws.String(key.Namespace)},
+		{Name: aws.String(DimensionName), Value: aws.String(key.Name)},
+	}
+}
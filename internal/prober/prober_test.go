@@ -0,0 +1,72 @@
+package prober
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	"github.com/skpr/r53-check/internal/awsfake"
+)
+
+func TestRecord(t *testing.T) {
+	target := &target{
+		config: Config{FailureThreshold: 3},
+		result: Result{Healthy: true},
+	}
+
+	failure := errors.New("connection refused")
+
+	assert.False(t, target.record(failure, time.Now()))
+	assert.False(t, target.record(failure, time.Now()))
+	assert.True(t, target.record(failure, time.Now()), "unhealthy after 3 consecutive failures")
+	assert.False(t, target.result.Healthy)
+	assert.Equal(t, "connection refused", target.result.Message)
+
+	assert.False(t, target.record(nil, time.Now()))
+	assert.False(t, target.record(failure, time.Now()), "a failure resets the successes")
+	assert.False(t, target.record(nil, time.Now()))
+	assert.False(t, target.record(nil, time.Now()))
+	assert.True(t, target.record(nil, time.Now()), "healthy after 3 consecutive successes")
+	assert.True(t, target.result.Healthy)
+}
+
+func TestProber(t *testing.T) {
+	cloudwatchClient := awsfake.NewCloudWatch()
+
+	p := New(zap.New(), cloudwatchClient)
+	p.Probe = func(context.Context, Config) error {
+		return errors.New("connection refused")
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go p.Start(stop)
+
+	key := types.NamespacedName{Namespace: "default", Name: "test"}
+	p.Ensure(key, Config{Type: TypeHTTP, Interval: time.Millisecond * 10, FailureThreshold: 2})
+
+	select {
+	case evt := <-p.Events:
+		assert.Equal(t, "test", evt.Meta.GetName())
+	case <-time.After(time.Second * 5):
+		t.Fatal("health did not change")
+	}
+
+	result, ok := p.Result(key)
+	assert.True(t, ok)
+	assert.False(t, result.Healthy)
+	assert.Equal(t, "connection refused", result.Message)
+
+	data := cloudwatchClient.MetricData(MetricNamespace)
+	assert.NotEmpty(t, data)
+	assert.Equal(t, float64(0), *data[len(data)-1].Value)
+
+	p.Remove(key)
+	_, ok = p.Result(key)
+	assert.False(t, ok)
+}
@@ -0,0 +1,125 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package quota
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/aws/aws-sdk-go/service/route53/route53iface"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	// HealthCheckLimitMetric is the number of health checks the account can create.
+	HealthCheckLimitMetric = "r53_check_route53_health_check_limit"
+	// HealthCheckCountMetric is the number of health checks in the account.
+	HealthCheckCountMetric = "r53_check_route53_health_checks"
+)
+
+var (
+	healthCheckLimit = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: HealthCheckLimitMetric,
+		Help: "The number of health checks the AWS account can create.",
+	})
+	healthCheckCount = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: HealthCheckCountMetric,
+		Help: "The number of health checks in the AWS account, including those not managed by the controller.",
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(healthCheckLimit, healthCheckCount)
+}
+
+// Account tracks the headroom under the health check limit of the account.
+type Account struct {
+	Route53Client route53iface.Route53API
+	// Headroom is the number of health checks which are kept free, eg. so
+	// health checks deleted out of band can be recreated.
+	Headroom int64
+	// LimitTTL is how long the limit is cached for, since it rarely changes.
+	LimitTTL time.Duration
+	Now      func() time.Time
+
+	mu        sync.Mutex
+	limit     int64
+	limitRead time.Time
+}
+
+// NewAccount creates an account which keeps headroom health checks free.
+func NewAccount(client route53iface.Route53API, headroom int64) *Account {
+	return &Account{
+		Route53Client: client,
+		Headroom:      headroom,
+		LimitTTL:      time.Hour,
+		Now:           time.Now,
+	}
+}
+
+// Check refuses to create a health check within the headroom of the limit.
+// Health checks are rarely created, so the count is always read. The count is
+// not reserved, so concurrent reconciles, and the managers of other shards,
+// can each create a health check within the headroom.
+func (a *Account) Check() error {
+	limit, err := a.getLimit()
+	if err != nil {
+		return err
+	}
+
+	output, err := a.Route53Client.GetHealthCheckCount(&route53.GetHealthCheckCountInput{})
+	if err != nil {
+		return fmt.Errorf("failed to get health check count: %w", err)
+	}
+	count := aws.Int64Value(output.HealthCheckCount)
+	healthCheckCount.Set(float64(count))
+
+	if count+a.Headroom >= limit {
+		return &ExceededError{
+			Reason: ReasonAccountLimit,
+			Message: fmt.Sprintf("%d of the %d health checks the account can create are used, and %d are kept free",
+				count, limit, a.Headroom),
+		}
+	}
+	return nil
+}
+
+// getLimit gets the limit, which is cached.
+func (a *Account) getLimit() (int64, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.limitRead.IsZero() && a.Now().Sub(a.limitRead) < a.LimitTTL {
+		return a.limit, nil
+	}
+
+	output, err := a.Route53Client.GetAccountLimit(&route53.GetAccountLimitInput{
+		Type: aws.String(route53.AccountLimitTypeMaxHealthChecksByOwner),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get health check limit: %w", err)
+	}
+
+	a.limit = aws.Int64Value(output.Limit.Value)
+	a.limitRead = a.Now()
+	healthCheckLimit.Set(float64(a.limit))
+
+	return a.limit, nil
+}
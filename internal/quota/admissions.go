@@ -0,0 +1,142 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package quota
+
+import (
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+
+	healthcheckv1 "github.com/skpr/r53-check/api/v1"
+)
+
+// Counted gets the HealthChecks which use the quotas of their namespace, for
+// admitting a HealthCheck, or every one when it is nil. HealthChecks which a
+// quota refused are waiting for it, so they are not counted. HealthChecks
+// which are waiting to be created are admitted oldest first.
+func Counted(healthChecks []healthcheckv1.HealthCheck, healthCheck *healthcheckv1.HealthCheck, admitted map[string]bool) []healthcheckv1.HealthCheck {
+	var counted []healthcheckv1.HealthCheck
+	for _, other := range healthChecks {
+		if healthCheck != nil && other.Name == healthCheck.Name {
+			continue
+		}
+		if !isCreated(&other) && !admitted[other.Name] {
+			if isRefused(&other) || (healthCheck != nil && !isOlder(&other, healthCheck)) {
+				continue
+			}
+		}
+		counted = append(counted, other)
+	}
+	return counted
+}
+
+// isCreated checks if the HealthCheck has been checked. The incluster backend
+// does not create a Route53 health check, so it is never refused.
+func isCreated(healthCheck *healthcheckv1.HealthCheck) bool {
+	return healthCheck.Status.HealthCheckId != "" || healthCheck.Spec.Backend == healthcheckv1.BackendInCluster
+}
+
+// isRefused checks if a quota refused to create the health check.
+func isRefused(healthCheck *healthcheckv1.HealthCheck) bool {
+	for _, condition := range healthCheck.Status.Conditions {
+		if condition.Type == healthcheckv1.ConditionQuotaExceeded {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// isOlder checks if a HealthCheck was created before another, which is newest
+// while it is being admitted by the webhook.
+func isOlder(a, b *healthcheckv1.HealthCheck) bool {
+	if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+		if a.CreationTimestamp.IsZero() || b.CreationTimestamp.IsZero() {
+			return b.CreationTimestamp.IsZero()
+		}
+		return a.CreationTimestamp.Before(&b.CreationTimestamp)
+	}
+	return a.Name < b.Name
+}
+
+// Admissions serializes the quota checks of each namespace, and remembers the
+// HealthChecks which were admitted until their health checks are created, so
+// concurrent reconciles cannot both take the last of a quota.
+//
+// Admissions are only shared within the manager. With --shards greater than 1
+// the HealthChecks of a namespace are split between managers, which can each
+// take the last of a quota, so quotas are only enforced by the webhook.
+type Admissions struct {
+	mu         sync.Mutex
+	namespaces map[string]*namespaceAdmissions
+}
+
+// namespaceAdmissions are the admissions of a namespace.
+type namespaceAdmissions struct {
+	mu       sync.Mutex
+	admitted map[string]bool
+}
+
+// NewAdmissions creates empty admissions.
+func NewAdmissions() *Admissions {
+	return &Admissions{namespaces: make(map[string]*namespaceAdmissions)}
+}
+
+// namespace gets the admissions of a namespace.
+func (a *Admissions) namespace(namespace string) *namespaceAdmissions {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	n, ok := a.namespaces[namespace]
+	if !ok {
+		n = &namespaceAdmissions{admitted: make(map[string]bool)}
+		a.namespaces[namespace] = n
+	}
+	return n
+}
+
+// Admit runs check while no other check runs in the namespace, passing the
+// HealthChecks which were admitted and not created yet. The HealthCheck is
+// admitted when check does not return an error. Checks are not serialized
+// when the Admissions are nil.
+func (a *Admissions) Admit(namespace, name string, check func(admitted map[string]bool) error) error {
+	if a == nil {
+		return check(nil)
+	}
+
+	n := a.namespace(namespace)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if err := check(n.admitted); err != nil {
+		return err
+	}
+	n.admitted[name] = true
+	return nil
+}
+
+// Forget forgets an admission once the health check was created, or the
+// HealthCheck deleted.
+func (a *Admissions) Forget(namespace, name string) {
+	if a == nil {
+		return
+	}
+
+	n := a.namespace(namespace)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	delete(n.admitted, name)
+}
@@ -0,0 +1,119 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package quota limits the health checks created in the AWS account, and by
+// each namespace, so that one tenant cannot exhaust the account limit.
+package quota
+
+import (
+	"fmt"
+
+	healthcheckv1 "github.com/skpr/r53-check/api/v1"
+)
+
+const (
+	// ReasonAccountLimit is the reason creation was refused near the Route53 account limit.
+	ReasonAccountLimit = "AccountLimit"
+	// ReasonNamespaceQuota is the reason creation was refused by a HealthCheckQuota.
+	ReasonNamespaceQuota = "NamespaceQuota"
+)
+
+// ExceededError is returned when a health check is not created because it
+// would exceed a quota.
+type ExceededError struct {
+	// Reason is ReasonAccountLimit or ReasonNamespaceQuota.
+	Reason  string
+	Message string
+}
+
+func (e *ExceededError) Error() string {
+	return e.Message
+}
+
+// UsageOf gets what a HealthCheck uses. Fast intervals and latency are
+// Route53 features, so they are not used by other backends.
+func UsageOf(healthCheck *healthcheckv1.HealthCheck) healthcheckv1.HealthCheckUsage {
+	usage := healthcheckv1.HealthCheckUsage{HealthChecks: 1}
+
+	if healthCheck.Spec.Backend == healthcheckv1.BackendInCluster {
+		return usage
+	}
+	if healthCheck.Spec.RequestInterval == 10 {
+		usage.FastInterval = 1
+	}
+	if healthCheck.Spec.MeasureLatency {
+		usage.MeasureLatency = 1
+	}
+	return usage
+}
+
+// Sum gets what HealthChecks use between them.
+func Sum(healthChecks []healthcheckv1.HealthCheck) healthcheckv1.HealthCheckUsage {
+	var sum healthcheckv1.HealthCheckUsage
+	for i := range healthChecks {
+		sum = Add(sum, UsageOf(&healthChecks[i]))
+	}
+	return sum
+}
+
+// Add adds two usages.
+func Add(a, b healthcheckv1.HealthCheckUsage) healthcheckv1.HealthCheckUsage {
+	return healthcheckv1.HealthCheckUsage{
+		HealthChecks:   a.HealthChecks + b.HealthChecks,
+		FastInterval:   a.FastInterval + b.FastInterval,
+		MeasureLatency: a.MeasureLatency + b.MeasureLatency,
+	}
+}
+
+// limit is a single limit of a quota.
+type limit struct {
+	name string
+	hard *int64
+	used func(healthcheckv1.HealthCheckUsage) int64
+}
+
+// limits gets the limits of a quota, named after their fields.
+func limits(spec healthcheckv1.HealthCheckQuotaSpec) []limit {
+	return []limit{
+		{"health_checks", spec.HealthChecks, func(u healthcheckv1.HealthCheckUsage) int64 { return u.HealthChecks }},
+		{"fast_interval", spec.FastInterval, func(u healthcheckv1.HealthCheckUsage) int64 { return u.FastInterval }},
+		{"measure_latency", spec.MeasureLatency, func(u healthcheckv1.HealthCheckUsage) int64 { return u.MeasureLatency }},
+	}
+}
+
+// Exceeded lists the limits of a quota which are exceeded, eg. "health_checks: 11 > 10".
+func Exceeded(spec healthcheckv1.HealthCheckQuotaSpec, used healthcheckv1.HealthCheckUsage) []string {
+	var exceeded []string
+	for _, l := range limits(spec) {
+		if l.hard != nil && l.used(used) > *l.hard {
+			exceeded = append(exceeded, fmt.Sprintf("%s: %d > %d", l.name, l.used(used), *l.hard))
+		}
+	}
+	return exceeded
+}
+
+// Admit lists the limits of a quota which a change in usage would exceed.
+// Usage which is already over a limit, eg. because the quota was lowered, may
+// shrink but not grow.
+func Admit(spec healthcheckv1.HealthCheckQuotaSpec, before, after healthcheckv1.HealthCheckUsage) []string {
+	var denied []string
+	for _, l := range limits(spec) {
+		if l.hard == nil || l.used(after) <= *l.hard || l.used(after) <= l.used(before) {
+			continue
+		}
+		denied = append(denied, fmt.Sprintf("%s: %d > %d", l.name, l.used(after), *l.hard))
+	}
+	return denied
+}
@@ -0,0 +1,148 @@
+package quota
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+
+	healthcheckv1 "github.com/skpr/r53-check/api/v1"
+	"github.com/skpr/r53-check/internal/awsfake"
+)
+
+func TestUsage(t *testing.T) {
+	healthChecks := []healthcheckv1.HealthCheck{
+		{Spec: healthcheckv1.HealthCheckSpec{RequestInterval: 10, MeasureLatency: true}},
+		{Spec: healthcheckv1.HealthCheckSpec{RequestInterval: 30}},
+		{Spec: healthcheckv1.HealthCheckSpec{RequestInterval: 10, Backend: healthcheckv1.BackendInCluster}},
+	}
+
+	assert.Equal(t, healthcheckv1.HealthCheckUsage{HealthChecks: 3, FastInterval: 1, MeasureLatency: 1}, Sum(healthChecks))
+}
+
+func TestExceeded(t *testing.T) {
+	spec := healthcheckv1.HealthCheckQuotaSpec{
+		HealthChecks: pointer.Int64Ptr(2),
+		FastInterval: pointer.Int64Ptr(0),
+	}
+
+	assert.Empty(t, Exceeded(spec, healthcheckv1.HealthCheckUsage{HealthChecks: 2, MeasureLatency: 5}))
+	assert.Equal(t, []string{"health_checks: 3 > 2", "fast_interval: 1 > 0"},
+		Exceeded(spec, healthcheckv1.HealthCheckUsage{HealthChecks: 3, FastInterval: 1}))
+}
+
+func TestAdmit(t *testing.T) {
+	spec := healthcheckv1.HealthCheckQuotaSpec{HealthChecks: pointer.Int64Ptr(2)}
+
+	assert.Empty(t, Admit(spec, healthcheckv1.HealthCheckUsage{HealthChecks: 1}, healthcheckv1.HealthCheckUsage{HealthChecks: 2}))
+	assert.Equal(t, []string{"health_checks: 3 > 2"},
+		Admit(spec, healthcheckv1.HealthCheckUsage{HealthChecks: 2}, healthcheckv1.HealthCheckUsage{HealthChecks: 3}))
+
+	// Usage which is already over the limit may be kept.
+	assert.Empty(t, Admit(spec, healthcheckv1.HealthCheckUsage{HealthChecks: 3}, healthcheckv1.HealthCheckUsage{HealthChecks: 3}))
+}
+
+func TestCounted(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// newHealthCheck creates a HealthCheck some minutes after the start.
+	newHealthCheck := func(name string, minutes int, id string) healthcheckv1.HealthCheck {
+		healthCheck := healthcheckv1.HealthCheck{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				CreationTimestamp: metav1.NewTime(start.Add(time.Duration(minutes) * time.Minute)),
+			},
+		}
+		healthCheck.Status.HealthCheckId = id
+		return healthCheck
+	}
+
+	created := newHealthCheck("created", 3, "abcdefg")
+	older := newHealthCheck("older", 1, "")
+	newer := newHealthCheck("newer", 5, "")
+	refused := newHealthCheck("refused", 0, "")
+	refused.Status.Conditions = []healthcheckv1.HealthCheckCondition{
+		{Type: healthcheckv1.ConditionQuotaExceeded, Status: corev1.ConditionTrue},
+	}
+	healthChecks := []healthcheckv1.HealthCheck{created, older, newer, refused}
+
+	names := func(healthChecks []healthcheckv1.HealthCheck) []string {
+		var names []string
+		for _, healthCheck := range healthChecks {
+			names = append(names, healthCheck.Name)
+		}
+		return names
+	}
+
+	// Waiting HealthChecks are admitted oldest first.
+	current := newHealthCheck("current", 2, "")
+	assert.Equal(t, []string{"created", "older"}, names(Counted(healthChecks, &current, nil)))
+	assert.Equal(t, []string{"created", "older", "refused"}, names(Counted(healthChecks, &current, map[string]bool{"refused": true})))
+
+	// New HealthChecks are the newest.
+	assert.Equal(t, []string{"created", "older", "newer"}, names(Counted(healthChecks, &healthcheckv1.HealthCheck{}, nil)))
+	assert.Equal(t, []string{"created", "older", "newer"}, names(Counted(healthChecks, nil, nil)))
+}
+
+func TestAdmissions(t *testing.T) {
+	admissions := NewAdmissions()
+
+	var seen map[string]bool
+	check := func(admitted map[string]bool) error {
+		seen = make(map[string]bool)
+		for name := range admitted {
+			seen[name] = true
+		}
+		return nil
+	}
+
+	assert.Nil(t, admissions.Admit("tenant", "first", check))
+	assert.Nil(t, admissions.Admit("tenant", "second", check))
+	assert.Equal(t, map[string]bool{"first": true}, seen)
+
+	// Refused HealthChecks are not admitted.
+	assert.Error(t, admissions.Admit("tenant", "third", func(map[string]bool) error { return &ExceededError{} }))
+	assert.Nil(t, admissions.Admit("other", "first", check))
+	assert.Empty(t, seen)
+
+	admissions.Forget("tenant", "first")
+	assert.Nil(t, admissions.Admit("tenant", "fourth", check))
+	assert.Equal(t, map[string]bool{"second": true}, seen)
+
+	// Checks are not serialized without admissions.
+	var disabled *Admissions
+	assert.Nil(t, disabled.Admit("tenant", "first", check))
+	disabled.Forget("tenant", "first")
+}
+
+func TestAccount(t *testing.T) {
+	clock := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	route53Client := awsfake.NewRoute53()
+	route53Client.SetHealthCheckLimit(3)
+
+	account := NewAccount(route53Client, 1)
+	account.Now = func() time.Time { return clock }
+
+	assert.Nil(t, account.Check())
+
+	for i := 0; i < 2; i++ {
+		createHealthCheck(t, route53Client)
+	}
+
+	err := account.Check()
+	if assert.IsType(t, &ExceededError{}, err) {
+		assert.Equal(t, ReasonAccountLimit, err.(*ExceededError).Reason)
+	}
+	assert.Equal(t, 1, route53Client.Faults.Calls("GetAccountLimit"), "the limit is cached")
+	assert.Equal(t, 2, route53Client.Faults.Calls("GetHealthCheckCount"))
+
+	// A raised limit is read once the cache expires.
+	route53Client.SetHealthCheckLimit(10)
+	clock = clock.Add(time.Hour)
+	assert.Nil(t, account.Check())
+	assert.Equal(t, 2, route53Client.Faults.Calls("GetAccountLimit"))
+}
@@ -0,0 +1,90 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package quota
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	healthcheckv1 "github.com/skpr/r53-check/api/v1"
+)
+
+// WebhookPath is where the Validator is served.
+const WebhookPath = "/validate-route53-skpr-io-v1-healthcheck"
+
+// +kubebuilder:webhook:path=/validate-route53-skpr-io-v1-healthcheck,mutating=false,failurePolicy=fail,groups=route53.skpr.io,resources=healthchecks,verbs=create;update,versions=v1,name=vhealthcheck.route53.skpr.io
+
+// Validator denies HealthChecks which would exceed a HealthCheckQuota in their namespace.
+type Validator struct {
+	Client  client.Reader
+	decoder *admission.Decoder
+}
+
+var _ admission.Handler = &Validator{}
+var _ admission.DecoderInjector = &Validator{}
+
+// InjectDecoder is called by the webhook server.
+func (v *Validator) InjectDecoder(decoder *admission.Decoder) error {
+	v.decoder = decoder
+	return nil
+}
+
+// Handle admits a HealthCheck unless it uses more than a quota allows.
+func (v *Validator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	healthCheck := &healthcheckv1.HealthCheck{}
+	if err := v.decoder.Decode(req, healthCheck); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	quotas := &healthcheckv1.HealthCheckQuotaList{}
+	if err := v.Client.List(ctx, quotas, client.InNamespace(req.Namespace)); err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if len(quotas.Items) == 0 {
+		return admission.Allowed("")
+	}
+
+	healthChecks := &healthcheckv1.HealthCheckList{}
+	if err := v.Client.List(ctx, healthChecks, client.InNamespace(req.Namespace)); err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	// The same HealthChecks are counted as by the reconciler.
+	others := Counted(healthChecks.Items, healthCheck, nil)
+
+	before := Sum(others)
+	if req.Operation == admissionv1beta1.Update {
+		old := &healthcheckv1.HealthCheck{}
+		if err := v.decoder.DecodeRaw(req.OldObject, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		before = Add(before, UsageOf(old))
+	}
+	after := Add(Sum(others), UsageOf(healthCheck))
+
+	for _, quota := range quotas.Items {
+		if denied := Admit(quota.Spec, before, after); len(denied) > 0 {
+			return admission.Denied(fmt.Sprintf("exceeds HealthCheckQuota %s: %s", quota.Name, strings.Join(denied, ", ")))
+		}
+	}
+	return admission.Allowed("")
+}
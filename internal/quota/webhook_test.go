@@ -0,0 +1,113 @@
+package quota
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/stretchr/testify/assert"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	healthcheckv1 "github.com/skpr/r53-check/api/v1"
+	"github.com/skpr/r53-check/internal/awsfake"
+)
+
+// createHealthCheck creates a health check in the fake.
+func createHealthCheck(t *testing.T, client *awsfake.Route53) {
+	_, err := client.CreateHealthCheck(&route53.CreateHealthCheckInput{
+		CallerReference: aws.String(fmt.Sprintf("test-%d", len(client.HealthChecks()))),
+		HealthCheckConfig: &route53.HealthCheckConfig{
+			FullyQualifiedDomainName: aws.String("example.com"),
+			Type:                     aws.String(route53.HealthCheckTypeHttps),
+		},
+	})
+	assert.Nil(t, err)
+}
+
+// newHealthCheck creates a HealthCheck in the default namespace.
+func newHealthCheck(name string, requestInterval int64) *healthcheckv1.HealthCheck {
+	return &healthcheckv1.HealthCheck{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: healthcheckv1.GroupVersion.String(),
+			Kind:       "HealthCheck",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: corev1.NamespaceDefault,
+		},
+		Spec: healthcheckv1.HealthCheckSpec{
+			Domain:          name + ".example.com",
+			RequestInterval: requestInterval,
+		},
+	}
+}
+
+// newRequest creates an admission request for a HealthCheck.
+func newRequest(t *testing.T, operation admissionv1beta1.Operation, healthCheck, old *healthcheckv1.HealthCheck) admission.Request {
+	raw := func(obj *healthcheckv1.HealthCheck) runtime.RawExtension {
+		if obj == nil {
+			return runtime.RawExtension{}
+		}
+		data, err := json.Marshal(obj)
+		assert.Nil(t, err)
+		return runtime.RawExtension{Raw: data}
+	}
+
+	return admission.Request{
+		AdmissionRequest: admissionv1beta1.AdmissionRequest{
+			Operation: operation,
+			Name:      healthCheck.Name,
+			Namespace: healthCheck.Namespace,
+			Object:    raw(healthCheck),
+			OldObject: raw(old),
+		},
+	}
+}
+
+func TestValidator(t *testing.T) {
+	err := healthcheckv1.AddToScheme(scheme.Scheme)
+	assert.Nil(t, err)
+
+	existing := newHealthCheck("existing", 10)
+	quota := &healthcheckv1.HealthCheckQuota{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "tenant",
+			Namespace: corev1.NamespaceDefault,
+		},
+		Spec: healthcheckv1.HealthCheckQuotaSpec{
+			HealthChecks: pointer.Int64Ptr(2),
+			FastInterval: pointer.Int64Ptr(1),
+		},
+	}
+
+	decoder, err := admission.NewDecoder(scheme.Scheme)
+	assert.Nil(t, err)
+
+	validator := &Validator{Client: fake.NewFakeClientWithScheme(scheme.Scheme, existing, quota)}
+	err = validator.InjectDecoder(decoder)
+	assert.Nil(t, err)
+
+	handle := func(operation admissionv1beta1.Operation, healthCheck, old *healthcheckv1.HealthCheck) admission.Response {
+		return validator.Handle(context.TODO(), newRequest(t, operation, healthCheck, old))
+	}
+
+	assert.True(t, handle(admissionv1beta1.Create, newHealthCheck("slow", 30), nil).Allowed)
+
+	response := handle(admissionv1beta1.Create, newHealthCheck("fast", 10), nil)
+	assert.False(t, response.Allowed)
+	assert.Equal(t, "exceeds HealthCheckQuota tenant: fast_interval: 2 > 1", string(response.Result.Reason))
+
+	// Changes which do not use more are allowed.
+	assert.True(t, handle(admissionv1beta1.Update, existing, existing).Allowed)
+	assert.True(t, handle(admissionv1beta1.Update, newHealthCheck("existing", 30), existing).Allowed)
+}
@@ -0,0 +1,151 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scope
+
+import (
+	"context"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// NewCache creates a cache which only watches the allowed namespaces, so the
+// manager can run with namespaced Roles. Cluster scoped objects, eg. the
+// Namespaces whose annotations are read, are still watched across the cluster.
+func (s *Scope) NewCache() cache.NewCacheFunc {
+	if s == nil || len(s.Namespaces) == 0 {
+		return cache.New
+	}
+
+	return func(config *rest.Config, opts cache.Options) (cache.Cache, error) {
+		namespaced, err := cache.MultiNamespacedCacheBuilder(s.Namespaces)(config, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		opts.Namespace = ""
+		cluster, err := cache.New(config, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		return &scopedCache{namespaced: namespaced, cluster: cluster, scheme: opts.Scheme, mapper: opts.Mapper}, nil
+	}
+}
+
+// scopedCache reads namespaced objects from the allowed namespaces and
+// cluster scoped objects from the whole cluster.
+type scopedCache struct {
+	namespaced cache.Cache
+	cluster    cache.Cache
+	scheme     *runtime.Scheme
+	mapper     meta.RESTMapper
+}
+
+var _ cache.Cache = &scopedCache{}
+
+// cacheFor gets the cache an object, or list of objects, is read from.
+func (c *scopedCache) cacheFor(obj runtime.Object) (cache.Cache, error) {
+	gvk, err := apiutil.GVKForObject(obj, c.scheme)
+	if err != nil {
+		return nil, err
+	}
+	if meta.IsListType(obj) {
+		gvk.Kind = strings.TrimSuffix(gvk.Kind, "List")
+	}
+	return c.cacheForKind(gvk)
+}
+
+// cacheForKind gets the cache a kind is read from.
+func (c *scopedCache) cacheForKind(gvk schema.GroupVersionKind) (cache.Cache, error) {
+	mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, err
+	}
+	if mapping.Scope.Name() == meta.RESTScopeNameRoot {
+		return c.cluster, nil
+	}
+	return c.namespaced, nil
+}
+
+func (c *scopedCache) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	delegate, err := c.cacheFor(obj)
+	if err != nil {
+		return err
+	}
+	return delegate.Get(ctx, key, obj)
+}
+
+func (c *scopedCache) List(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	delegate, err := c.cacheFor(list)
+	if err != nil {
+		return err
+	}
+	return delegate.List(ctx, list, opts...)
+}
+
+func (c *scopedCache) GetInformer(obj runtime.Object) (cache.Informer, error) {
+	delegate, err := c.cacheFor(obj)
+	if err != nil {
+		return nil, err
+	}
+	return delegate.GetInformer(obj)
+}
+
+func (c *scopedCache) GetInformerForKind(gvk schema.GroupVersionKind) (cache.Informer, error) {
+	delegate, err := c.cacheForKind(gvk)
+	if err != nil {
+		return nil, err
+	}
+	return delegate.GetInformerForKind(gvk)
+}
+
+func (c *scopedCache) IndexField(obj runtime.Object, field string, extractValue client.IndexerFunc) error {
+	delegate, err := c.cacheFor(obj)
+	if err != nil {
+		return err
+	}
+	return delegate.IndexField(obj, field, extractValue)
+}
+
+func (c *scopedCache) Start(stopCh <-chan struct{}) error {
+	errs := make(chan error, 2)
+	for _, delegate := range []cache.Cache{c.namespaced, c.cluster} {
+		go func(delegate cache.Cache) {
+			errs <- delegate.Start(stopCh)
+		}(delegate)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *scopedCache) WaitForCacheSync(stop <-chan struct{}) bool {
+	// Both caches are waited for, even when one fails to sync.
+	namespaced := c.namespaced.WaitForCacheSync(stop)
+	cluster := c.cluster.WaitForCacheSync(stop)
+	return namespaced && cluster
+}
@@ -0,0 +1,112 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package scope selects the objects reconciled by a manager, so that tenants
+// can run their own manager and several replicas can split the checks between
+// them.
+package scope
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Scope selects objects by namespace and shard. A nil scope selects everything.
+type Scope struct {
+	// Namespaces allows objects in these namespaces only. Every namespace is
+	// allowed when empty.
+	Namespaces []string
+	// NamespaceSelector allows objects in namespaces with matching labels only.
+	NamespaceSelector labels.Selector
+	// Shard is the index of the shard owned by this manager, out of Shards.
+	Shard  int
+	Shards int
+}
+
+// New creates a scope from the flags of the manager.
+func New(namespaces []string, namespaceSelector string, shard, shards int) (*Scope, error) {
+	selector, err := labels.Parse(namespaceSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid namespace selector: %w", err)
+	}
+
+	if shards < 1 {
+		return nil, fmt.Errorf("shards must be at least 1: %d", shards)
+	}
+	if shard < 0 || shard >= shards {
+		return nil, fmt.Errorf("shard must be between 0 and %d: %d", shards-1, shard)
+	}
+
+	return &Scope{
+		Namespaces:        namespaces,
+		NamespaceSelector: selector,
+		Shard:             shard,
+		Shards:            shards,
+	}, nil
+}
+
+// Contains checks if an object is reconciled by this manager.
+func (s *Scope) Contains(ctx context.Context, c client.Reader, key types.NamespacedName) (bool, error) {
+	if s == nil {
+		return true, nil
+	}
+
+	if !s.InShard(key) || !s.AllowsNamespace(key.Namespace) {
+		return false, nil
+	}
+
+	if s.NamespaceSelector == nil || s.NamespaceSelector.Empty() {
+		return true, nil
+	}
+
+	ns := &corev1.Namespace{}
+	if err := c.Get(ctx, types.NamespacedName{Name: key.Namespace}, ns); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	return s.NamespaceSelector.Matches(labels.Set(ns.ObjectMeta.Labels)), nil
+}
+
+// InShard checks if an object belongs to the shard of this manager. Objects
+// are spread by a hash of their namespace and name.
+func (s *Scope) InShard(key types.NamespacedName) bool {
+	if s == nil || s.Shards <= 1 {
+		return true
+	}
+
+	hash := fnv.New32a()
+	// Writing to a hash never fails.
+	_, _ = hash.Write([]byte(key.String()))
+	return int(hash.Sum32()%uint32(s.Shards)) == s.Shard
+}
+
+// AllowsNamespace checks if a namespace is in the allow-list.
+func (s *Scope) AllowsNamespace(namespace string) bool {
+	if s == nil || len(s.Namespaces) == 0 {
+		return true
+	}
+
+	for _, allowed := range s.Namespaces {
+		if allowed == namespace {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package scope
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestNew(t *testing.T) {
+	_, err := New(nil, "tenant in (", 0, 1)
+	assert.NotNil(t, err)
+
+	_, err = New(nil, "", 0, 0)
+	assert.NotNil(t, err)
+
+	_, err = New(nil, "", 2, 2)
+	assert.NotNil(t, err)
+
+	_, err = New([]string{"a", "b"}, "tenant=example", 1, 2)
+	assert.Nil(t, err)
+}
+
+func TestInShard(t *testing.T) {
+	var scopes []*Scope
+	for i := 0; i < 3; i++ {
+		scope, err := New(nil, "", i, 3)
+		assert.Nil(t, err)
+		scopes = append(scopes, scope)
+	}
+
+	// Every object belongs to exactly one shard, and the shards are roughly even.
+	counts := make([]int, len(scopes))
+	for i := 0; i < 300; i++ {
+		key := types.NamespacedName{Namespace: fmt.Sprintf("ns-%d", i%7), Name: fmt.Sprintf("check-%d", i)}
+
+		owners := 0
+		for j, scope := range scopes {
+			if scope.InShard(key) {
+				owners++
+				counts[j]++
+			}
+		}
+		assert.Equal(t, 1, owners)
+	}
+	for _, count := range counts {
+		assert.True(t, count > 50, "shard has %d of 300 objects", count)
+	}
+
+	var all *Scope
+	assert.True(t, all.InShard(types.NamespacedName{Namespace: "a", Name: "b"}))
+}
+
+func TestContains(t *testing.T) {
+	client := fake.NewFakeClientWithScheme(scheme.Scheme,
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "tenant-a", Labels: map[string]string{"tenant": "a"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "tenant-b", Labels: map[string]string{"tenant": "b"}}},
+	)
+
+	contains := func(scope *Scope, namespace string) bool {
+		ok, err := scope.Contains(context.TODO(), client, types.NamespacedName{Namespace: namespace, Name: "test"})
+		assert.Nil(t, err)
+		return ok
+	}
+
+	var all *Scope
+	assert.True(t, contains(all, "tenant-a"))
+
+	allowed, err := New([]string{"tenant-a"}, "", 0, 1)
+	assert.Nil(t, err)
+	assert.True(t, contains(allowed, "tenant-a"))
+	assert.False(t, contains(allowed, "tenant-b"))
+
+	selected, err := New(nil, "tenant=b", 0, 1)
+	assert.Nil(t, err)
+	assert.False(t, contains(selected, "tenant-a"))
+	assert.True(t, contains(selected, "tenant-b"))
+	assert.False(t, contains(selected, "missing"))
+}
@@ -0,0 +1,405 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package statuspage serves a read-only view of the HealthChecks, for sharing
+// with the people who depend on the endpoints.
+package statuspage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/aws/aws-sdk-go/service/route53/route53iface"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	healthcheckv1 "github.com/skpr/r53-check/api/v1"
+)
+
+// States reported for each HealthCheck.
+const (
+	StateOperational = "operational"
+	StateOutage      = "outage"
+	StateMaintenance = "maintenance"
+	StateUnknown     = "unknown"
+)
+
+// recentIncidents is how many incidents are shown for each check.
+const recentIncidents = 5
+
+// refreshInterval is how often the snapshot is rebuilt in the background, so
+// the page can be polled without calling Route53 each time.
+const refreshInterval = time.Second * 30
+
+// errNoSnapshot is returned until the first snapshot has been built.
+var errNoSnapshot = errors.New("status page snapshot has not been built yet")
+
+// Page is everything shown on the status page.
+type Page struct {
+	Generated time.Time `json:"generated"`
+	Groups    []Group   `json:"groups"`
+}
+
+// Group is a set of checks which share a namespace or label value.
+type Group struct {
+	Name   string  `json:"name"`
+	Checks []Check `json:"checks"`
+}
+
+// Check is the public view of a HealthCheck.
+type Check struct {
+	Name         string                `json:"name"`
+	Namespace    string                `json:"namespace"`
+	Domain       string                `json:"domain"`
+	State        string                `json:"state"`
+	Observations []Observation         `json:"observations,omitempty"`
+	Uptime       *healthcheckv1.Uptime `json:"uptime,omitempty"`
+	// Incidents are the most recent outages, newest first.
+	Incidents []healthcheckv1.Incident `json:"incidents,omitempty"`
+}
+
+// Observation is the status reported by a Route53 health checker region.
+type Observation struct {
+	Region string `json:"region"`
+	Status string `json:"status"`
+}
+
+// Server serves the status page.
+type Server struct {
+	Client        client.Client
+	Log           logr.Logger
+	Route53Client route53iface.Route53API
+	Addr          string
+
+	mu       sync.Mutex
+	snapshot *snapshot
+}
+
+// snapshot is the public view of every HealthCheck, which each page groups.
+type snapshot struct {
+	generated time.Time
+	checks    []labelledCheck
+}
+
+// labelledCheck is a check with the labels it can be grouped by.
+type labelledCheck struct {
+	Check
+	labels map[string]string
+}
+
+// New creates a status page server.
+func New(log logr.Logger, c client.Client, route53Client route53iface.Route53API, addr string) *Server {
+	return &Server{
+		Client:        c,
+		Log:           log,
+		Route53Client: route53Client,
+		Addr:          addr,
+	}
+}
+
+// NeedLeaderElection serves the page from every replica.
+func (s *Server) NeedLeaderElection() bool {
+	return false
+}
+
+// Start serves the page until the manager stops. The snapshot is rebuilt in
+// the background, so requests never wait on Route53.
+func (s *Server) Start(stop <-chan struct{}) error {
+	server := &http.Server{
+		Addr:    s.Addr,
+		Handler: s.Handler(),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		ticker := time.NewTicker(refreshInterval)
+		defer ticker.Stop()
+
+		for {
+			s.refresh(ctx)
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	errs := make(chan error, 1)
+	go func() {
+		s.Log.Info("Serving status page", "addr", s.Addr)
+		errs <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-stop:
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+		return server.Shutdown(ctx)
+	}
+}
+
+// refresh builds a new snapshot and replaces the one being served. The last
+// snapshot is kept when the HealthChecks cannot be listed.
+func (s *Server) refresh(ctx context.Context) {
+	snapshot, err := s.buildSnapshot(ctx, time.Now())
+	if err != nil {
+		s.Log.Error(err, "Failed to build status page snapshot")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.snapshot = snapshot
+}
+
+// Handler serves HTML at / and JSON at /status.json. Checks are grouped by
+// namespace, or by the value of the label given by the group_by parameter.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/status.json", func(w http.ResponseWriter, r *http.Request) {
+		page, err := s.getPage(r.URL.Query().Get("group_by"))
+		if err != nil {
+			s.Log.Error(err, "Failed to get status page")
+			http.Error(w, "status unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(page); err != nil {
+			s.Log.Error(err, "Failed to write status page")
+		}
+	})
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		page, err := s.getPage(r.URL.Query().Get("group_by"))
+		if err != nil {
+			s.Log.Error(err, "Failed to get status page")
+			http.Error(w, "status unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := pageTemplate.Execute(w, page); err != nil {
+			s.Log.Error(err, "Failed to write status page")
+		}
+	})
+
+	return mux
+}
+
+// getPage groups the checks of the snapshot.
+func (s *Server) getPage(groupBy string) (*Page, error) {
+	snapshot, err := s.getSnapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make(map[string][]Check)
+	for _, check := range snapshot.checks {
+		group := check.Namespace
+		if groupBy != "" {
+			group = check.labels[groupBy]
+		}
+		groups[group] = append(groups[group], check.Check)
+	}
+
+	page := &Page{
+		Generated: snapshot.generated,
+		Groups:    []Group{},
+	}
+	for name, checks := range groups {
+		page.Groups = append(page.Groups, Group{Name: name, Checks: checks})
+	}
+	sort.Slice(page.Groups, func(i, j int) bool {
+		return page.Groups[i].Name < page.Groups[j].Name
+	})
+
+	return page, nil
+}
+
+// getSnapshot gets the last snapshot built in the background.
+func (s *Server) getSnapshot() (*snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.snapshot == nil {
+		return nil, errNoSnapshot
+	}
+
+	return s.snapshot, nil
+}
+
+// buildSnapshot reads the HealthChecks which are not excluded from the status
+// page, sorted by namespace and name.
+func (s *Server) buildSnapshot(ctx context.Context, now time.Time) (*snapshot, error) {
+	list := &healthcheckv1.HealthCheckList{}
+	if err := s.Client.List(ctx, list); err != nil {
+		return nil, err
+	}
+
+	snapshot := &snapshot{generated: now}
+	for i := range list.Items {
+		healthCheck := &list.Items[i]
+		if healthCheck.Labels[healthcheckv1.LabelStatusPageExclude] == "true" {
+			continue
+		}
+
+		snapshot.checks = append(snapshot.checks, labelledCheck{
+			Check:  s.getCheck(healthCheck),
+			labels: healthCheck.Labels,
+		})
+	}
+
+	sort.Slice(snapshot.checks, func(i, j int) bool {
+		if snapshot.checks[i].Namespace != snapshot.checks[j].Namespace {
+			return snapshot.checks[i].Namespace < snapshot.checks[j].Namespace
+		}
+		return snapshot.checks[i].Name < snapshot.checks[j].Name
+	})
+
+	return snapshot, nil
+}
+
+// getCheck gets the public view of a HealthCheck. The observations are left
+// out when Route53 cannot be read, rather than failing the whole page.
+func (s *Server) getCheck(healthCheck *healthcheckv1.HealthCheck) Check {
+	check := Check{
+		Name:      healthCheck.Name,
+		Namespace: healthCheck.Namespace,
+		Domain:    healthCheck.Spec.Domain,
+		State:     getState(healthCheck),
+		Uptime:    healthCheck.Status.Uptime,
+	}
+
+	incidents := healthCheck.Status.Incidents
+	for i := len(incidents) - 1; i >= 0 && len(check.Incidents) < recentIncidents; i-- {
+		check.Incidents = append(check.Incidents, incidents[i])
+	}
+
+	if healthCheck.Status.HealthCheckId == "" {
+		return check
+	}
+
+	output, err := s.Route53Client.GetHealthCheckStatus(&route53.GetHealthCheckStatusInput{
+		HealthCheckId: aws.String(healthCheck.Status.HealthCheckId),
+	})
+	if err != nil {
+		s.Log.Error(err, "Failed to get health check status", "namespace", healthCheck.Namespace, "name", healthCheck.Name)
+		return check
+	}
+	for _, observation := range output.HealthCheckObservations {
+		if observation.StatusReport == nil {
+			continue
+		}
+		check.Observations = append(check.Observations, Observation{
+			Region: aws.StringValue(observation.Region),
+			Status: aws.StringValue(observation.StatusReport.Status),
+		})
+	}
+	sort.Slice(check.Observations, func(i, j int) bool {
+		return check.Observations[i].Region < check.Observations[j].Region
+	})
+
+	return check
+}
+
+// getState summarises the status of a HealthCheck.
+func getState(healthCheck *healthcheckv1.HealthCheck) string {
+	if healthCheck.Status.MaintenanceWindow != nil {
+		return StateMaintenance
+	}
+
+	switch healthCheck.Status.AlarmState {
+	case "OK":
+		return StateOperational
+	case "ALARM":
+		return StateOutage
+	}
+
+	for _, condition := range healthCheck.Status.Conditions {
+		if condition.Type != healthcheckv1.ConditionHealthy {
+			continue
+		}
+		switch condition.Status {
+		case corev1.ConditionTrue:
+			return StateOperational
+		case corev1.ConditionFalse:
+			return StateOutage
+		}
+	}
+
+	return StateUnknown
+}
+
+var pageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Status</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 2em; }
+th, td { text-align: left; padding: 0.4em; border-bottom: 1px solid #ddd; vertical-align: top; }
+.operational { color: #2e7d32; }
+.outage { color: #c62828; }
+.maintenance { color: #1565c0; }
+.unknown { color: #757575; }
+</style>
+</head>
+<body>
+<h1>Status</h1>
+{{- range .Groups }}
+<h2>{{ if .Name }}{{ .Name }}{{ else }}Other{{ end }}</h2>
+<table>
+<tr><th>Name</th><th>Domain</th><th>State</th><th>1d</th><th>7d</th><th>30d</th><th>Regions</th><th>Recent incidents</th></tr>
+{{- range .Checks }}
+<tr>
+<td>{{ .Name }}</td>
+<td>{{ .Domain }}</td>
+<td class="{{ .State }}">{{ .State }}</td>
+{{- if .Uptime }}
+<td>{{ .Uptime.OneDay }}</td><td>{{ .Uptime.SevenDays }}</td><td>{{ .Uptime.ThirtyDays }}</td>
+{{- else }}
+<td></td><td></td><td></td>
+{{- end }}
+<td>{{ range .Observations }}{{ .Region }}: {{ .Status }}<br>{{ end }}</td>
+<td>{{ range .Incidents }}{{ .Start.UTC.Format "2006-01-02 15:04 MST" }} {{ if .Duration }}for {{ .Duration.Duration }}{{ else }}ongoing{{ end }}<br>{{ end }}</td>
+</tr>
+{{- end }}
+</table>
+{{- end }}
+<p>Updated {{ .Generated.UTC.Format "2006-01-02 15:04:05 MST" }}</p>
+</body>
+</html>
+`))
@@ -0,0 +1,165 @@
+package statuspage
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	healthcheckv1 "github.com/skpr/r53-check/api/v1"
+	"github.com/skpr/r53-check/internal/awsfake"
+)
+
+func TestHandler(t *testing.T) {
+	err := healthcheckv1.AddToScheme(scheme.Scheme)
+	assert.Nil(t, err)
+
+	route53Client := awsfake.NewRoute53()
+	output, err := route53Client.CreateHealthCheck(&route53.CreateHealthCheckInput{
+		CallerReference: aws.String("public"),
+		HealthCheckConfig: &route53.HealthCheckConfig{
+			FullyQualifiedDomainName: aws.String("www.example.com"),
+			Type:                     aws.String(route53.HealthCheckTypeHttps),
+		},
+	})
+	assert.Nil(t, err)
+	route53Client.SetHealthCheckStatus(*output.HealthCheck.Id, "Failure: HTTP Status Code 503, Service Unavailable")
+
+	client := fake.NewFakeClientWithScheme(scheme.Scheme,
+		&healthcheckv1.HealthCheck{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "public",
+				Namespace: "prod",
+				Labels:    map[string]string{"team": "web"},
+			},
+			Spec: healthcheckv1.HealthCheckSpec{Domain: "www.example.com"},
+			Status: healthcheckv1.HealthCheckStatus{
+				HealthCheckId: *output.HealthCheck.Id,
+				AlarmState:    "ALARM",
+				Uptime:        &healthcheckv1.Uptime{OneDay: "99.500"},
+				Incidents: []healthcheckv1.Incident{
+					{Start: metav1.NewTime(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)), Duration: &metav1.Duration{Duration: time.Minute}},
+					{Start: metav1.NewTime(time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC))},
+				},
+			},
+		},
+		&healthcheckv1.HealthCheck{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "api",
+				Namespace: "prod",
+			},
+			Spec: healthcheckv1.HealthCheckSpec{Domain: "api.example.com"},
+			Status: healthcheckv1.HealthCheckStatus{
+				Conditions: []healthcheckv1.HealthCheckCondition{
+					{Type: healthcheckv1.ConditionHealthy, Status: corev1.ConditionTrue},
+				},
+			},
+		},
+		&healthcheckv1.HealthCheck{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "internal",
+				Namespace: "prod",
+				Labels:    map[string]string{healthcheckv1.LabelStatusPageExclude: "true"},
+			},
+			Spec: healthcheckv1.HealthCheckSpec{Domain: "internal.example.com"},
+		},
+		&healthcheckv1.HealthCheck{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "deleted",
+				Namespace: "staging",
+			},
+			Spec: healthcheckv1.HealthCheckSpec{Domain: "staging.example.com"},
+			Status: healthcheckv1.HealthCheckStatus{
+				HealthCheckId: "missing",
+				AlarmState:    "OK",
+			},
+		},
+	)
+
+	statusPage := New(zap.New(), client, route53Client, "")
+	server := httptest.NewServer(statusPage.Handler())
+	defer server.Close()
+
+	// Requests do not build the snapshot themselves.
+	resp, err := http.Get(server.URL + "/status.json")
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, 0, route53Client.Faults.Calls("GetHealthCheckStatus"))
+
+	statusPage.refresh(context.Background())
+
+	resp, err = http.Get(server.URL + "/status.json")
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	page := &Page{}
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(page))
+	if assert.Len(t, page.Groups, 2) {
+		assert.Equal(t, "prod", page.Groups[0].Name)
+		if assert.Len(t, page.Groups[0].Checks, 2, "internal is excluded") {
+			api := page.Groups[0].Checks[0]
+			assert.Equal(t, "api", api.Name)
+			assert.Equal(t, StateOperational, api.State)
+			assert.Empty(t, api.Observations)
+
+			public := page.Groups[0].Checks[1]
+			assert.Equal(t, "public", public.Name)
+			assert.Equal(t, StateOutage, public.State)
+			assert.Equal(t, "99.500", public.Uptime.OneDay)
+			assert.NotEmpty(t, public.Observations)
+			assert.Equal(t, "Failure: HTTP Status Code 503, Service Unavailable", public.Observations[0].Status)
+			if assert.Len(t, public.Incidents, 2) {
+				assert.Nil(t, public.Incidents[0].Duration, "newest first")
+			}
+		}
+
+		// Checks which cannot be read from Route53 are shown without observations.
+		assert.Equal(t, "staging", page.Groups[1].Name)
+		if assert.Len(t, page.Groups[1].Checks, 1) {
+			assert.Equal(t, StateOperational, page.Groups[1].Checks[0].State)
+			assert.Empty(t, page.Groups[1].Checks[0].Observations)
+		}
+	}
+
+	resp, err = http.Get(server.URL + "/status.json?group_by=team")
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+
+	page = &Page{}
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(page))
+	if assert.Len(t, page.Groups, 2) {
+		assert.Equal(t, "", page.Groups[0].Name)
+		assert.Equal(t, "web", page.Groups[1].Name)
+	}
+
+	// Every grouping is served from the same snapshot.
+	resp, err = http.Get(server.URL + "/status.json?group_by=other")
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, 2, route53Client.Faults.Calls("GetHealthCheckStatus"))
+
+	resp, err = http.Get(server.URL + "/")
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Contains(t, string(body), "www.example.com")
+	assert.Contains(t, string(body), "2020-01-01 00:00 UTC for 1m0s")
+	assert.NotContains(t, string(body), "internal.example.com")
+}
@@ -0,0 +1,104 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package throttle rate limits the requests made by AWS clients and retries
+// throttled requests, so that many HealthChecks do not exhaust the API limits
+// of the account.
+package throttle
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// ThrottledRequestsMetric counts the requests which AWS throttled, including retries.
+const ThrottledRequestsMetric = "r53_check_aws_throttled_requests_total"
+
+var throttledRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: ThrottledRequestsMetric,
+	Help: "Requests which AWS throttled, including retries.",
+}, []string{"service"})
+
+func init() {
+	metrics.Registry.MustRegister(throttledRequests)
+}
+
+// Config limits the requests made to an AWS service.
+type Config struct {
+	// Rate is the number of requests per second, which is not limited when 0.
+	Rate float64
+	// MaxRetries is the number of times a failed request is retried.
+	MaxRetries int
+	// MinDelay and MaxDelay bound the jittered backoff between retries of
+	// throttled requests.
+	MinDelay time.Duration
+	MaxDelay time.Duration
+}
+
+// Apply limits the requests made by the client. Clients are shared by every
+// controller, so the limit applies to the whole process.
+func Apply(c *client.Client, config Config) {
+	limiter := rate.NewLimiter(rate.Inf, 0)
+	if config.Rate > 0 {
+		limiter = rate.NewLimiter(rate.Limit(config.Rate), int(math.Max(1, math.Ceil(config.Rate))))
+	}
+
+	// Every attempt, including retries, waits for a token.
+	c.Handlers.Send.PushFrontNamed(request.NamedHandler{
+		Name: "throttle.WaitForToken",
+		Fn: func(r *request.Request) {
+			if err := limiter.Wait(r.Context()); err != nil {
+				r.Error = awserr.New(request.CanceledErrorCode, "request canceled while waiting for the rate limit", err)
+			}
+		},
+	})
+
+	service := c.ClientInfo.ServiceName
+	c.Handlers.Retry.PushBackNamed(request.NamedHandler{
+		Name: "throttle.CountThrottled",
+		Fn: func(r *request.Request) {
+			if r.IsErrorThrottle() {
+				throttledRequests.WithLabelValues(service).Inc()
+			}
+		},
+	})
+
+	// The default retryer backs off exponentially, with jitter.
+	c.Retryer = client.DefaultRetryer{
+		NumMaxRetries:    config.MaxRetries,
+		MinThrottleDelay: config.MinDelay,
+		MaxThrottleDelay: config.MaxDelay,
+	}
+}
+
+// ErrorCode gets the code of a throttling error, which may be wrapped.
+func ErrorCode(err error) (string, bool) {
+	var aerr awserr.Error
+	if !errors.As(err, &aerr) {
+		return "", false
+	}
+	if !request.IsErrorThrottle(aerr) {
+		return "", false
+	}
+	return aerr.Code(), true
+}
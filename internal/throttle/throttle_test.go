@@ -0,0 +1,94 @@
+package throttle
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/route53"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	"github.com/skpr/r53-check/internal/awsfake"
+	"github.com/skpr/r53-check/internal/emulator"
+)
+
+// newRoute53 creates a Route53 client for an emulator.
+func newRoute53(t *testing.T, fake *awsfake.Route53) (*route53.Route53, func()) {
+	server := httptest.NewServer(emulator.NewRoute53Handler(zap.New(), fake))
+
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Endpoint:    aws.String(server.URL),
+		Credentials: credentials.NewStaticCredentials("emulator", "emulator", ""),
+	})
+	assert.Nil(t, err)
+
+	return route53.New(sess), server.Close
+}
+
+// getThrottledRequests gets the number of throttled requests made to a service.
+func getThrottledRequests(t *testing.T, service string) float64 {
+	var metric dto.Metric
+	err := throttledRequests.WithLabelValues(service).Write(&metric)
+	assert.Nil(t, err)
+	return metric.GetCounter().GetValue()
+}
+
+func TestRetry(t *testing.T) {
+	fake := awsfake.NewRoute53()
+	client, done := newRoute53(t, fake)
+	defer done()
+
+	Apply(client.Client, Config{MaxRetries: 3, MinDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond})
+
+	before := getThrottledRequests(t, route53.ServiceName)
+
+	// Throttled requests are retried until they succeed.
+	fake.Faults.Throttle("ListHealthChecks", "Throttling", 3)
+	_, err := client.ListHealthChecks(&route53.ListHealthChecksInput{})
+	assert.Nil(t, err)
+	assert.Equal(t, 4, fake.Faults.Calls("ListHealthChecks"))
+	assert.Equal(t, before+3, getThrottledRequests(t, route53.ServiceName))
+
+	// The error is returned once the retries are exhausted.
+	fake.Faults.Throttle("ListHealthChecks", "Throttling", 4)
+	_, err = client.ListHealthChecks(&route53.ListHealthChecksInput{})
+	code, ok := ErrorCode(fmt.Errorf("failed to list health checks: %w", err))
+	assert.True(t, ok)
+	assert.Equal(t, "Throttling", code)
+	assert.Equal(t, 8, fake.Faults.Calls("ListHealthChecks"))
+}
+
+func TestRate(t *testing.T) {
+	fake := awsfake.NewRoute53()
+	client, done := newRoute53(t, fake)
+	defer done()
+
+	Apply(client.Client, Config{Rate: 20})
+
+	// A burst of requests is allowed, after which they are spread out.
+	start := time.Now()
+	for i := 0; i < 25; i++ {
+		_, err := client.ListHealthChecks(&route53.ListHealthChecksInput{})
+		assert.Nil(t, err)
+	}
+	assert.True(t, time.Since(start) >= 200*time.Millisecond)
+}
+
+func TestErrorCode(t *testing.T) {
+	_, ok := ErrorCode(nil)
+	assert.False(t, ok)
+
+	_, ok = ErrorCode(fmt.Errorf("failed: %w", awsfake.NewError(route53.ErrCodeNoSuchHealthCheck, "not found", 404)))
+	assert.False(t, ok)
+
+	code, ok := ErrorCode(fmt.Errorf("failed: %w", awsfake.NewError("RequestLimitExceeded", "Rate exceeded", 400)))
+	assert.True(t, ok)
+	assert.Equal(t, "RequestLimitExceeded", code)
+}
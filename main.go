@@ -17,19 +17,34 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
 	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/aws/aws-sdk-go/service/route53/route53iface"
 	"os"
+	"strings"
+	"time"
 
 	route53v1 "github.com/skpr/r53-check/api/v1"
 	"github.com/skpr/r53-check/controllers"
+	"github.com/skpr/r53-check/internal/cost"
+	"github.com/skpr/r53-check/internal/dryrun"
+	"github.com/skpr/r53-check/internal/inventory"
+	"github.com/skpr/r53-check/internal/prober"
+	"github.com/skpr/r53-check/internal/quota"
+	"github.com/skpr/r53-check/internal/scope"
+	"github.com/skpr/r53-check/internal/statuspage"
+	"github.com/skpr/r53-check/internal/throttle"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -48,20 +63,113 @@ func init() {
 func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
+	var route53Endpoint string
+	var cloudwatchEndpoint string
+	var proberMetrics string
+	var statusPageAddr string
+	var statusPageRoute53Rate float64
+	var dryRun bool
+	var inventoryTTL time.Duration
+	var route53Rate float64
+	var cloudwatchRate float64
+	var awsMaxRetries int
+	var maxConcurrentReconciles int
+	var namespaces string
+	var namespaceSelector string
+	var shard int
+	var shards int
+	var accountHeadroom int64
+	var enableQuotaWebhook bool
+	var priceConfigMap string
+	var dashboardAdminNamespaces string
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&route53Endpoint, "route53-endpoint", "", "Override the Route53 API endpoint, eg. to use the emulator.")
+	flag.StringVar(&cloudwatchEndpoint, "cloudwatch-endpoint", "", "Override the CloudWatch API endpoint, eg. to use the emulator.")
+	flag.StringVar(&proberMetrics, "prober-metrics", "cloudwatch",
+		"Where the incluster backend publishes results, cloudwatch or prometheus. Alarms are only created for cloudwatch.")
+	flag.StringVar(&statusPageAddr, "status-page-addr", "",
+		"The address the status page binds to. The status page is disabled when empty.")
+	flag.Float64Var(&statusPageRoute53Rate, "status-page-route53-rate", 1,
+		"The most Route53 requests made per second by the status page, which is limited separately from the controllers. Requests are not limited when 0.")
+	flag.DurationVar(&inventoryTTL, "inventory-ttl", 30*time.Second,
+		"How long alarms and health checks read by the HealthCheck controller are cached for. They are not cached when 0.")
+	flag.BoolVar(&dryRun, "dry-run", false,
+		"Log the Route53 and CloudWatch changes every controller and the prober would make, without making them. The HealthCheck controller also records them in the status.")
+	flag.Float64Var(&route53Rate, "route53-rate", 5,
+		"The most Route53 requests made per second, including retries. Requests are not limited when 0.")
+	flag.Float64Var(&cloudwatchRate, "cloudwatch-rate", 10,
+		"The most CloudWatch requests made per second, including retries. Requests are not limited when 0.")
+	flag.IntVar(&awsMaxRetries, "aws-max-retries", 5,
+		"How many times throttled or failed AWS requests are retried, with jittered backoff.")
+	flag.IntVar(&maxConcurrentReconciles, "max-concurrent-reconciles", 1,
+		"How many objects each controller reconciles at once.")
+	flag.StringVar(&namespaces, "namespaces", "",
+		"Comma separated namespaces to reconcile, so the manager can run with namespaced Roles. Every namespace is reconciled when empty.")
+	flag.StringVar(&namespaceSelector, "namespace-selector", "",
+		"Only reconcile objects in namespaces with matching labels, eg. tenant=example.")
+	flag.IntVar(&shard, "shard", 0,
+		"The shard reconciled by this manager, between 0 and --shards minus 1.")
+	flag.IntVar(&shards, "shards", 1,
+		"How many managers split the objects between them, by a hash of their namespace and name. With more than 1 shard, HealthCheckQuotas are only enforced by the quota webhook.")
+	flag.Int64Var(&accountHeadroom, "account-headroom", 5,
+		"How many health checks are kept free under the Route53 account limit. New health checks are not created within it. Concurrent reconciles and other shards can each create one within it, so keep it above --max-concurrent-reconciles times --shards. The limit is not checked when negative.")
+	flag.BoolVar(&enableQuotaWebhook, "enable-quota-webhook", false,
+		"Serve the admission webhook which denies HealthChecks over a HealthCheckQuota.")
+	flag.StringVar(&priceConfigMap, "price-config-map", "",
+		"The namespace/name of the ConfigMap holding the prices costs are estimated with. The AWS list prices are used when empty. With --namespaces, its namespace must be listed.")
+	flag.StringVar(&dashboardAdminNamespaces, "dashboard-admin-namespaces", "",
+		"Comma separated namespaces whose HealthCheckDashboards may select HealthChecks from other namespaces. Every other dashboard only shows its own namespace.")
 	flag.Parse()
 
 	ctrl.SetLogger(zap.New(func(o *zap.Options) {
 		o.Development = true
 	}))
 
+	var scopeNamespaces []string
+	if namespaces != "" {
+		scopeNamespaces = strings.Split(namespaces, ",")
+	}
+	managerScope, err := scope.New(scopeNamespaces, namespaceSelector, shard, shards)
+	if err != nil {
+		setupLog.Error(err, "invalid scope")
+		os.Exit(1)
+	}
+
+	var adminNamespaces []string
+	if dashboardAdminNamespaces != "" {
+		adminNamespaces = strings.Split(dashboardAdminNamespaces, ",")
+	}
+
+	var prices types.NamespacedName
+	if priceConfigMap != "" {
+		parts := strings.SplitN(priceConfigMap, "/", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			setupLog.Info("invalid value for --price-config-map, expected namespace/name", "value", priceConfigMap)
+			os.Exit(1)
+		}
+		prices = types.NamespacedName{Namespace: parts[0], Name: parts[1]}
+	}
+
+	// Each shard elects its own leader, so the shards run side by side.
+	var leaderElectionID string
+	if shards > 1 {
+		leaderElectionID = fmt.Sprintf("r53-check-shard-%d", shard)
+
+		// The shards admit HealthChecks independently of each other.
+		if !enableQuotaWebhook {
+			setupLog.Info("HealthCheckQuotas are not enforced across shards without --enable-quota-webhook")
+		}
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:             scheme,
 		MetricsBindAddress: metricsAddr,
 		LeaderElection:     enableLeaderElection,
+		LeaderElectionID:   leaderElectionID,
 		Port:               9443,
+		NewCache:           managerScope.NewCache(),
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
@@ -72,16 +180,127 @@ func main() {
 	if err != nil {
 		setupLog.Error(err, "unable to create aws session", "controller", "HealthCheck")
 	}
+
+	route53Config := aws.NewConfig()
+	if route53Endpoint != "" {
+		route53Config = route53Config.WithEndpoint(route53Endpoint)
+	}
+	cloudwatchConfig := aws.NewConfig()
+	if cloudwatchEndpoint != "" {
+		cloudwatchConfig = cloudwatchConfig.WithEndpoint(cloudwatchEndpoint)
+	}
+	route53Client := route53.New(sess, route53Config)
+	cloudwatchClient := cloudwatch.New(sess, cloudwatchConfig)
+
+	// Every controller shares the clients, so the rate limits apply to the whole process.
+	throttle.Apply(route53Client.Client, throttle.Config{Rate: route53Rate, MaxRetries: awsMaxRetries})
+	throttle.Apply(cloudwatchClient.Client, throttle.Config{Rate: cloudwatchRate, MaxRetries: awsMaxRetries})
+
+	healthCheckProber := prober.New(ctrl.Log.WithName("prober"), nil)
+	switch proberMetrics {
+	case "cloudwatch":
+		healthCheckProber.CloudwatchClient = cloudwatchClient
+		if dryRun {
+			healthCheckProber.CloudwatchClient = dryrun.NewCloudWatch(cloudwatchClient, dryrun.NewLog(ctrl.Log.WithName("prober")))
+		}
+	case "prometheus":
+	default:
+		setupLog.Info("invalid value for --prober-metrics", "value", proberMetrics)
+		os.Exit(1)
+	}
+	if err := mgr.Add(healthCheckProber); err != nil {
+		setupLog.Error(err, "unable to add prober")
+		os.Exit(1)
+	}
+
+	if statusPageAddr != "" {
+		// Every replica serves the page, so it reads Route53 through its own
+		// client rather than taking requests from the controllers.
+		statusPageRoute53Client := route53.New(sess, route53Config)
+		throttle.Apply(statusPageRoute53Client.Client, throttle.Config{Rate: statusPageRoute53Rate, MaxRetries: awsMaxRetries})
+
+		statusPage := statuspage.New(ctrl.Log.WithName("statuspage"), mgr.GetClient(), statusPageRoute53Client, statusPageAddr)
+		if err := mgr.Add(statusPage); err != nil {
+			setupLog.Error(err, "unable to add status page")
+			os.Exit(1)
+		}
+	}
+
+	// Reconciles read alarms and health checks from an inventory, which is
+	// refreshed with bulk calls.
+	var healthCheckRoute53Client route53iface.Route53API = route53Client
+	var healthCheckCloudwatchClient cloudwatchiface.CloudWatchAPI = cloudwatchClient
+	if inventoryTTL > 0 {
+		awsInventory := inventory.New(ctrl.Log.WithName("inventory"), route53Client, cloudwatchClient, inventoryTTL)
+		healthCheckRoute53Client = awsInventory.Route53()
+		healthCheckCloudwatchClient = awsInventory.CloudWatch()
+	}
+
+	var account *quota.Account
+	if accountHeadroom >= 0 {
+		account = quota.NewAccount(route53Client, accountHeadroom)
+	}
+
 	if err = (&controllers.HealthCheckReconciler{
-		Client:           mgr.GetClient(),
-		Log:              ctrl.Log.WithName("controllers").WithName("HealthCheck"),
-		Scheme:           mgr.GetScheme(),
-		Route53Client:    route53.New(sess),
-		CloudwatchClient: cloudwatch.New(sess),
+		Client:                  mgr.GetClient(),
+		Log:                     ctrl.Log.WithName("controllers").WithName("HealthCheck"),
+		Scheme:                  mgr.GetScheme(),
+		Route53Client:           healthCheckRoute53Client,
+		CloudwatchClient:        healthCheckCloudwatchClient,
+		Recorder:                mgr.GetEventRecorderFor("healthcheck-controller"),
+		APIReader:               mgr.GetAPIReader(),
+		Prober:                  healthCheckProber,
+		DryRun:                  dryRun,
+		Account:                 account,
+		Admissions:              quota.NewAdmissions(),
+		PriceConfigMap:          prices,
+		Costs:                   cost.NewTotals(),
+		Scope:                   managerScope,
+		MaxConcurrentReconciles: maxConcurrentReconciles,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "HealthCheck")
 		os.Exit(1)
 	}
+	if err = (&controllers.DNSRecordReconciler{
+		Client:                  mgr.GetClient(),
+		Log:                     ctrl.Log.WithName("controllers").WithName("DNSRecord"),
+		Scheme:                  mgr.GetScheme(),
+		Route53Client:           route53Client,
+		DryRun:                  dryRun,
+		Scope:                   managerScope,
+		MaxConcurrentReconciles: maxConcurrentReconciles,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "DNSRecord")
+		os.Exit(1)
+	}
+	if err = (&controllers.HealthCheckDashboardReconciler{
+		Client:                  mgr.GetClient(),
+		Log:                     ctrl.Log.WithName("controllers").WithName("HealthCheckDashboard"),
+		Scheme:                  mgr.GetScheme(),
+		CloudwatchClient:        cloudwatchClient,
+		DryRun:                  dryRun,
+		Scope:                   managerScope,
+		MaxConcurrentReconciles: maxConcurrentReconciles,
+		AdminNamespaces:         adminNamespaces,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "HealthCheckDashboard")
+		os.Exit(1)
+	}
+	if err = (&controllers.HealthCheckQuotaReconciler{
+		Client:                  mgr.GetClient(),
+		Log:                     ctrl.Log.WithName("controllers").WithName("HealthCheckQuota"),
+		Scheme:                  mgr.GetScheme(),
+		Scope:                   managerScope,
+		MaxConcurrentReconciles: maxConcurrentReconciles,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "HealthCheckQuota")
+		os.Exit(1)
+	}
+	if enableQuotaWebhook {
+		mgr.GetWebhookServer().Register(quota.WebhookPath, &webhook.Admission{
+			Handler: &quota.Validator{Client: mgr.GetClient()},
+		})
+	}
 	// +kubebuilder:scaffold:builder
 
 	setupLog.Info("starting manager")